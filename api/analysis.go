@@ -0,0 +1,111 @@
+package api
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "strconv"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+// How many players are useful, which takes setting the game up for every number of players it's for,
+// so it's only worked out once for each game
+func (srv *Server) maxUsefulPlayers(g *game.Game) (int, error) {
+  srv.usefulPlayersMutex.Lock()
+  useful, ok := srv.usefulPlayers[(uint64)(g.Id)]
+  srv.usefulPlayersMutex.Unlock()
+  if ok {
+    return useful, nil
+  }
+
+  useful, err := setupgraph.MaxUsefulPlayers(g, func(players int) (*game.Game, error) { return srv.gameForPlayers(g, players) })
+  if nil != err {
+    return 0, err
+  }
+  srv.usefulPlayersMutex.Lock()
+  srv.usefulPlayers[(uint64)(g.Id)] = useful
+  srv.usefulPlayersMutex.Unlock()
+  return useful, nil
+}
+
+// Forget how many players are useful for the game, when its rules' conditions or quantities change
+func (srv *Server) forgetUsefulPlayers(gameId uint64) {
+  srv.usefulPlayersMutex.Lock()
+  defer srv.usefulPlayersMutex.Unlock()
+  delete(srv.usefulPlayers, gameId)
+}
+
+type GameAnalysisHandler struct {
+  srv *Server
+}
+func (h GameAnalysisHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+  g, ok := h.srv.gameIndex[id]
+  if !ok {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+
+  playerCount := g.MinPlayers
+  if players := r.URL.Query().Get("players"); "" != players {
+    playerCount, err = strconv.Atoi(players)
+    if nil != err {
+      http.Error(w, "Expected an integer number of players", http.StatusBadRequest)
+      return
+    }
+  }
+  if playerCount < g.MinPlayers || playerCount > g.MaxPlayers {
+    http.Error(w, fmt.Sprintf("%s is for %d to %d players, not %d", g.Name, g.MinPlayers, g.MaxPlayers, playerCount), http.StatusBadRequest)
+    return
+  }
+
+  useful, err := h.srv.maxUsefulPlayers(g)
+  if nil != err {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+  g, err = h.srv.gameForPlayers(g, playerCount)
+  if nil != err {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+  analysis, err := setupgraph.AnalyzeGame(g, playerCount)
+  if nil != err {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+  analysis.MaxUsefulPlayers = useful
+  if err := json.NewEncoder(w).Encode(analysis); nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
+
+type SessionAnalysisHandler struct {
+  srv *Server
+}
+func (h SessionAnalysisHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id, err := strconv.ParseUint(r.URL.Query().Get("session_id"), 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+  s, ok := h.srv.sessionIndex[id]
+  if !ok {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+
+  analysis, err := setupgraph.AnalyzeSession(s)
+  if nil != err {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+  if err := json.NewEncoder(w).Encode(analysis); nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
@@ -0,0 +1,219 @@
+/*
+
+The meeple_mover API: REST, GraphQL and gRPC over games, players and sessions, with webhooks
+reporting progress.
+
+New returns a Server, which serves every route as an http.Handler. Everything it knows is kept in
+the Server, so a program can embed one, or several, and tests can serve one with httptest over a
+Store of their own.
+
+  srv := api.New(api.NewPostgresStore(db), logger, api.Config{})
+  go srv.Load()
+  go srv.DeliverWebhooks()
+  http.ListenAndServe(":8080", srv)
+
+*/
+
+package api
+
+import (
+  "log/slog"
+  "net"
+  "net/http"
+  "sync"
+  "time"
+  "github.com/rcrowley/go-tigertonic"
+  "github.com/rkbodenner/meeple_mover/assign"
+  "github.com/rkbodenner/meeple_mover/condition"
+  "github.com/rkbodenner/meeple_mover/expansion"
+  "github.com/rkbodenner/meeple_mover/metrics"
+  "github.com/rkbodenner/meeple_mover/quantity"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// Larger than any session or player we'd ever be sent
+const defaultMaxRequestBodyBytes = 1 << 20
+
+const defaultWriteTimeout = 30 * time.Second
+
+type Config struct {
+  // Request bodies over this many bytes are rejected. 1 MiB if zero.
+  MaxRequestBodyBytes int64
+  // Delivers webhook events. If nil, one that refuses to connect to loopback, private and link-local
+  // addresses, other than those in WebhookAllowedNetworks.
+  WebhookClient *http.Client
+  // Networks that webhook receivers may be on, though they're not public, e.g. the LAN
+  WebhookAllowedNetworks []*net.IPNet
+  // How long a request can take to be served. A retry takes over an Idempotency-Key reserved longer
+  // ago than this by a request that never finished. 30 seconds if zero.
+  WriteTimeout time.Duration
+}
+
+type Server struct {
+  store Store
+  log *slog.Logger
+  config Config
+  mux http.Handler
+
+  startup startupState
+
+  // Guards the caches below, and the steps and assignments of the cached sessions. Routes hold it while
+  // they're served, through reading and writing, and the functions they call expect it to be held.
+  mutex sync.RWMutex
+  games []*game.Game
+  gameIndex map[uint64]*game.Game
+  sessions []*session.Session
+  sessionIndex map[uint64]*session.Session
+  strategies map[uint64]assign.Strategy
+  modules map[uint64][]*expansion.Module  // Each game's expansions and variants, by game ID
+  sessionModules map[uint64][]string  // Names of the modules each session was started with, by session ID
+  conditions map[int]*condition.Condition  // On the number of players rules are set up for, by rule ID
+  quantities map[int]quantity.Quantities  // Values of rules' placeholders, by rule ID
+
+  // Each game's max useful players, by game ID, once it's been analyzed. Guarded by its own mutex, since
+  // it's filled in by routes that only read the caches above.
+  usefulPlayersMutex sync.Mutex
+  usefulPlayers map[uint64]int
+
+  updates *sessionBroker
+  webhookWake chan struct{}
+
+  // Closed by Close
+  shuttingDown chan struct{}
+  closeOnce sync.Once
+
+  metrics *metrics.Registry
+  httpRequests *metrics.Counter
+  httpRequestDuration *metrics.Histogram
+  dbQueryDuration *metrics.Histogram
+  stepsFinished *metrics.Counter
+  grpcRequests *metrics.Counter
+  webhookDeliveries *metrics.Counter
+}
+
+// A server for the data in the store, logging to log. It serves the probes and /metrics straight away,
+// and the routes that read games and sessions once Load has loaded them.
+func New(store Store, log *slog.Logger, config Config) *Server {
+  if nil == log {
+    log = slog.Default()
+  }
+  if 0 == config.MaxRequestBodyBytes {
+    config.MaxRequestBodyBytes = defaultMaxRequestBodyBytes
+  }
+  if nil == config.WebhookClient {
+    config.WebhookClient = newWebhookClient(config.WebhookAllowedNetworks)
+  }
+  if 0 == config.WriteTimeout {
+    config.WriteTimeout = defaultWriteTimeout
+  }
+
+  srv := &Server{
+    store: store,
+    log: log,
+    config: config,
+    gameIndex: make(map[uint64]*game.Game),
+    sessionIndex: make(map[uint64]*session.Session),
+    strategies: make(map[uint64]assign.Strategy),
+    modules: make(map[uint64][]*expansion.Module),
+    sessionModules: make(map[uint64][]string),
+    conditions: make(map[int]*condition.Condition),
+    quantities: make(map[int]quantity.Quantities),
+    usefulPlayers: make(map[uint64]int),
+    updates: newSessionBroker(),
+    webhookWake: make(chan struct{}, 1),
+    shuttingDown: make(chan struct{}),
+  }
+  srv.instrument()
+
+  mux := tigertonic.NewTrieServeMux()
+  for _, rt := range srv.routes() {
+    handler := srv.accessLogged(rt.method, rt.pattern, srv.instrumented(rt.method, rt.pattern, rt.handler))
+    mux.Handle(rt.method, rt.pattern, withRequestID(srv.limitBody(handler)))
+  }
+  srv.mux = mux
+  return srv
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  srv.mux.ServeHTTP(w, r)
+}
+
+// End streams of updates and stop delivering webhooks. Call it when the HTTP and gRPC servers start
+// shutting down, since they won't interrupt streams while draining.
+func (srv *Server) Close() {
+  srv.closeOnce.Do(func() { close(srv.shuttingDown) })
+}
+
+type route struct {
+  method string
+  pattern string
+  handler http.Handler
+}
+
+// Every route the service handles. Each must also be described in apiDescription.
+// Routes that read the caches of games and sessions wait for them to be loaded, and lock them.
+func (srv *Server) routes() []route {
+  schema, err := newGraphQLSchema(srv)
+  if nil != err {
+    panic(err)  // The schema is fixed, so this can only be a mistake in it
+  }
+  return []route{
+    {"GET", "/games", srv.whenReady(srv.reading(CollectionHandler{srv}))},
+    {"GET", "/games/{id}", srv.whenReady(srv.reading(GameHandler{srv}))},
+    {"GET", "/games/{id}/checklist", srv.whenReady(srv.reading(GameChecklistHandler{srv}))},
+    {"GET", "/games/{id}/analysis", srv.whenReady(srv.reading(GameAnalysisHandler{srv}))},
+    {"GET", "/games/{id}/graph", srv.whenReady(srv.reading(GameGraphHandler{srv}))},
+    {"GET", "/games/{id}/modules", srv.whenReady(srv.reading(ModulesHandler{srv}))},
+    {"POST", "/games/{id}/modules", srv.whenReady(srv.idempotent(srv.writing(tigertonic.Marshaled(ModuleCreateHandler{srv}.marshalFunc()))))},
+    {"GET", "/games/{id}/conditions", srv.whenReady(srv.reading(ConditionsHandler{srv}))},
+    {"PUT", "/games/{id}/rules/{rule_id}/condition", srv.whenReady(srv.writing(tigertonic.Marshaled(ConditionUpdateHandler{srv}.marshalFunc())))},
+    {"GET", "/games/{id}/quantities", srv.whenReady(srv.reading(QuantitiesHandler{srv}))},
+    {"PUT", "/games/{id}/rules/{rule_id}/quantities", srv.whenReady(srv.writing(tigertonic.Marshaled(QuantitiesUpdateHandler{srv}.marshalFunc())))},
+    {"GET", "/players", PlayersHandler{srv}},
+    {"GET", "/players/{player_id}", PlayerHandler{srv}},
+    {"POST", "/players", srv.idempotent(tigertonic.Marshaled(PlayerCreateHandler{srv}.marshalFunc()))},
+    {"DELETE", "/players/{player_id}", PlayerDeleteHandler{srv}},
+    {"GET", "/sessions", srv.whenReady(srv.reading(SessionsHandler{srv}))},
+    {"POST", "/sessions", srv.whenReady(srv.idempotent(srv.writing(tigertonic.Marshaled(SessionCreateHandler{srv}.marshalFunc()))))},
+    {"GET", "/sessions/{session_id}", srv.whenReady(srv.reading(SessionHandler{srv}))},
+    {"GET", "/sessions/{session_id}/checklist", srv.whenReady(srv.reading(SessionChecklistHandler{srv}))},
+    {"GET", "/sessions/{session_id}/analysis", srv.whenReady(srv.reading(SessionAnalysisHandler{srv}))},
+    {"GET", "/sessions/{session_id}/graph", srv.whenReady(srv.reading(SessionGraphHandler{srv}))},
+    {"GET", "/sessions/{session_id}/updates", srv.whenReady(SessionUpdatesHandler{srv})},
+    {"PUT", "/sessions/{session_id}/players/{player_id}/steps/{step_desc}", srv.whenReady(srv.writing(StepHandler{srv}))},
+    {"POST", "/sessions/{session_id}/steps:batch", srv.whenReady(srv.writing(tigertonic.Marshaled(StepBatchHandler{srv}.marshalFunc())))},
+    {"GET", "/graphql", srv.whenReady(GraphQLHandler{srv, schema})},
+    {"POST", "/graphql", srv.whenReady(GraphQLHandler{srv, schema})},
+    {"GET", "/webhooks", WebhooksHandler{srv}},
+    {"POST", "/webhooks", srv.idempotent(tigertonic.Marshaled(WebhookCreateHandler{srv}.marshalFunc()))},
+    {"GET", "/webhooks/{webhook_id}", WebhookHandler{srv}},
+    {"DELETE", "/webhooks/{webhook_id}", WebhookDeleteHandler{srv}},
+    {"GET", "/webhooks/{webhook_id}/deliveries", WebhookDeliveriesHandler{srv}},
+    {"GET", "/openapi.json", OpenAPIHandler{apiDescription()}},
+    {"GET", "/healthz", HealthzHandler{}},
+    {"GET", "/readyz", ReadyzHandler{srv}},
+    {"GET", "/metrics", srv.metrics},
+  }
+}
+
+// Reject request bodies over the configured limit, rather than reading them into memory
+func (srv *Server) limitBody(h http.Handler) http.Handler {
+  limit := srv.config.MaxRequestBodyBytes
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.ContentLength > limit {
+      http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+      return
+    }
+    r.Body = http.MaxBytesReader(w, r.Body, limit)
+    h.ServeHTTP(w, r)
+  })
+}
+
+// Time a call into the store
+func (srv *Server) timed(method string, call func() error) error {
+  start := time.Now()
+  err := call()
+  srv.dbQueryDuration.Observe(time.Since(start).Seconds(), method)
+  return err
+}
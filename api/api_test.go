@@ -0,0 +1,694 @@
+package api
+
+import (
+  "bufio"
+  "bytes"
+  "context"
+  "crypto/hmac"
+  "crypto/sha256"
+  "encoding/hex"
+  "encoding/json"
+  "io"
+  "log/slog"
+  "net"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "strings"
+  "sync"
+  "testing"
+  "time"
+  "github.com/rkbodenner/meeple_mover/condition"
+  "github.com/rkbodenner/meeple_mover/expansion"
+  "github.com/rkbodenner/meeple_mover/meeplepb"
+  "github.com/rkbodenner/meeple_mover/quantity"
+  "github.com/rkbodenner/meeple_mover/record"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+  "google.golang.org/grpc"
+  "google.golang.org/grpc/codes"
+  "google.golang.org/grpc/credentials/insecure"
+  "google.golang.org/grpc/status"
+  "google.golang.org/grpc/test/bufconn"
+)
+
+var testLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// A loaded server over a store holding the test session, its game and players, and a webhook
+func newTestServer(t *testing.T) (*Server, *memStore) {
+  s := newTestSession(t)
+  s.StepAllPlayers()
+
+  store := newMemStore()
+  store.lastId = 10
+  store.games = []*game.Game{s.Game}
+  store.players = append([]*game.Player{}, s.Players...)
+  store.sessions = []*session.Session{s}
+  store.strategies[s.Id] = "first"
+  tokens := &game.SetupRule{Id: 3, Description: "Place {tokens} tokens", Arity: "Once", Dependencies: []*game.SetupRule{s.Game.SetupRules[0]}}
+  store.modules[s.Game.Id] = []*expansion.Module{&expansion.Module{Id: 1, GameId: s.Game.Id, Name: "Tokens", Kind: expansion.Expansion,
+    Rules: []*game.SetupRule{tokens}}}
+  store.conditions[tokens.Id] = &condition.Condition{MinPlayers: 2}
+  store.quantities[tokens.Id] = quantity.Quantities{"tokens": quantity.Table{2: "8", 0: "6"}}
+  store.webhooks = []*record.WebhookRecord{&record.WebhookRecord{Id: 1, URL: "https://example.com/hook", Secret: "s3cret", Events: webhookEvents}}
+
+  srv := New(store, testLog, Config{})
+  t.Cleanup(srv.Close)
+  srv.Load()
+  return srv, store
+}
+
+func TestRoutes_Described(t *testing.T) {
+  srv, _ := newTestServer(t)
+  doc := apiDescription()
+  for _, rt := range srv.routes() {
+    if !doc.Has(rt.method, rt.pattern) {
+      t.Errorf("Route %s %s is not described in the OpenAPI document", rt.method, rt.pattern)
+    }
+  }
+}
+
+func TestAPIDescription_NoStaleRoutes(t *testing.T) {
+  srv, _ := newTestServer(t)
+  registered := make(map[string]bool)
+  for _, rt := range srv.routes() {
+    registered[rt.method + " " + rt.pattern] = true
+  }
+
+  doc := apiDescription()
+  for path, item := range doc.Paths {
+    for method := range item {
+      if !registered[strings.ToUpper(method) + " " + path] {
+        t.Errorf("OpenAPI document describes %s %s, which is not a registered route", method, path)
+      }
+    }
+  }
+}
+
+func TestWhenReady_NotLoaded(t *testing.T) {
+  srv := New(newMemStore(), testLog, Config{})
+  srv.startup.gamesLoaded = true
+
+  called := false
+  h := srv.whenReady(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+  w := httptest.NewRecorder()
+  h.ServeHTTP(w, httptest.NewRequest("GET", "/games", nil))
+
+  if called {
+    t.Fatal("Handler should not be called before sessions are loaded")
+  }
+  if w.Code != http.StatusServiceUnavailable {
+    t.Fatalf("Expected 503, got %d", w.Code)
+  }
+}
+
+func TestWhenReady_Loaded(t *testing.T) {
+  srv, _ := newTestServer(t)
+
+  called := false
+  h := srv.whenReady(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+  h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/games", nil))
+
+  if !called {
+    t.Fatal("Handler should be called once games and sessions are loaded")
+  }
+}
+
+// A store whose games don't load until released
+type slowStore struct {
+  *memStore
+  release chan struct{}
+}
+
+func (store slowStore) Games() ([]*game.Game, error) {
+  <-store.release
+  return store.memStore.Games()
+}
+
+// Readiness is reported, and data routes refused, straight away while the store is slow to load
+func TestServer_ReadyWhileLoading(t *testing.T) {
+  store := slowStore{newMemStore(), make(chan struct{})}
+  srv := New(store, testLog, Config{})
+  t.Cleanup(srv.Close)
+  loaded := make(chan struct{})
+  go func() {
+    srv.Load()
+    close(loaded)
+  }()
+
+  for _, path := range []string{"/readyz", "/games"} {
+    served := make(chan int)
+    go func() { served <- serve(srv, "GET", path, "", nil).Code }()
+    select {
+    case code := <-served:
+      if http.StatusServiceUnavailable != code {
+        t.Errorf("%s: expected 503 while loading, got %d", path, code)
+      }
+    case <-time.After(time.Second):
+      t.Fatalf("%s: not served while loading", path)
+    }
+  }
+
+  close(store.release)
+  <-loaded
+  if w := serve(srv, "GET", "/readyz", "", nil); w.Code != http.StatusOK {
+    t.Errorf("Expected 200 once loaded, got %d: %s", w.Code, w.Body.String())
+  }
+}
+
+func TestHealthzHandler(t *testing.T) {
+  w := httptest.NewRecorder()
+  HealthzHandler{}.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+  if w.Code != http.StatusOK {
+    t.Fatalf("Expected 200, got %d", w.Code)
+  }
+}
+
+func TestWithRequestID(t *testing.T) {
+  var seen string
+  h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    seen = r.Header.Get(RequestIDHeader)
+  }))
+
+  r := httptest.NewRequest("GET", "/games", nil)
+  r.Header.Set(RequestIDHeader, "game-night-42")
+  w := httptest.NewRecorder()
+  h.ServeHTTP(w, r)
+  if seen != "game-night-42" || w.Header().Get(RequestIDHeader) != "game-night-42" {
+    t.Fatalf("Expected client's request ID to be used, got %q", seen)
+  }
+
+  r = httptest.NewRequest("GET", "/games", nil)
+  r.Header.Set(RequestIDHeader, "bad\nid")
+  w = httptest.NewRecorder()
+  h.ServeHTTP(w, r)
+  if seen == "bad\nid" || "" == seen {
+    t.Fatalf("Expected invalid request ID to be replaced, got %q", seen)
+  }
+  if w.Header().Get(RequestIDHeader) != seen {
+    t.Fatal("Expected generated request ID in response")
+  }
+}
+
+func TestLimitBody(t *testing.T) {
+  srv := New(newMemStore(), testLog, Config{MaxRequestBodyBytes: 16})
+  var readErr error
+  h := srv.limitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    _, readErr = io.ReadAll(r.Body)
+  }))
+
+  r := httptest.NewRequest("POST", "/players", bytes.NewReader(make([]byte, 17)))
+  w := httptest.NewRecorder()
+  h.ServeHTTP(w, r)
+  if w.Code != http.StatusRequestEntityTooLarge {
+    t.Fatalf("Expected 413 for declared length over the limit, got %d", w.Code)
+  }
+
+  // Without a declared length, the handler finds out when it reads too much
+  r = httptest.NewRequest("POST", "/players", io.MultiReader(bytes.NewReader(make([]byte, 16)), strings.NewReader("x")))
+  r.ContentLength = -1
+  h.ServeHTTP(httptest.NewRecorder(), r)
+  if nil == readErr {
+    t.Fatal("Expected error reading body over the limit")
+  }
+}
+
+func TestFingerprint(t *testing.T) {
+  body := []byte(`{"player":{"Name":"Bob"}}`)
+  if fingerprint("POST", "/players", body) != fingerprint("POST", "/players", body) {
+    t.Fatal("Expected same request to have the same fingerprint")
+  }
+  if fingerprint("POST", "/players", body) == fingerprint("POST", "/players", []byte(`{"player":{"Name":"Joe"}}`)) {
+    t.Fatal("Expected different bodies to have different fingerprints")
+  }
+  if fingerprint("POST", "/players", body) == fingerprint("POST", "/sessions", body) {
+    t.Fatal("Expected different paths to have different fingerprints")
+  }
+}
+
+func TestResponseCapture(t *testing.T) {
+  w := httptest.NewRecorder()
+  capture := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+  capture.WriteHeader(http.StatusCreated)
+  capture.Write([]byte(`{"Id":1}`))
+
+  if capture.status != http.StatusCreated || capture.body.String() != `{"Id":1}` {
+    t.Fatal("Expected response to be captured")
+  }
+  if w.Code != http.StatusCreated || w.Body.String() != `{"Id":1}` {
+    t.Fatal("Expected response to be passed through")
+  }
+}
+
+// Alice and Bob playing a game with a board to lay out and a pawn for each player to place once it is
+func newTestSession(t *testing.T) *session.Session {
+  board := &game.SetupRule{Id: 1, Description: "Lay out the board", Arity: "Once"}
+  pawn := &game.SetupRule{Id: 2, Description: "Place pawn", Arity: "Each player", Dependencies: []*game.SetupRule{board}}
+  g := &game.Game{Id: 1, Name: "Test", MinPlayers: 1, MaxPlayers: 4, SetupRules: []*game.SetupRule{board, pawn}}
+  players := []*game.Player{&game.Player{Id: 1, Name: "Alice"}, &game.Player{Id: 2, Name: "Bob"}}
+
+  s, err := session.NewSession(g, players)
+  if nil != err {
+    t.Fatal(err)
+  }
+  s.Id = 1
+  return s
+}
+
+func TestStepBatchHandler_Validate(t *testing.T) {
+  s := newTestSession(t)
+  rq := &StepBatchRequest{Steps: []StepAction{
+    {PlayerId: "2", StepDesc: "Place pawn"},
+    {PlayerId: "1", StepDesc: "Lay out the board", Action: "finish"},
+  }}
+
+  steps, reopen, err := StepBatchHandler{}.validate(s, rq)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if len(steps) != 2 || steps[0].Rule.Description != "Lay out the board" || steps[1].Owner.Id != 2 {
+    t.Fatal("Expected board to be finished before Bob's pawn")
+  }
+  if len(reopen) != 0 {
+    t.Fatal("Expected nothing to be reopened")
+  }
+}
+
+func TestStepBatchHandler_ValidateReopen(t *testing.T) {
+  s := newTestSession(t)
+  for _, step := range s.SetupSteps {
+    step.Finish()
+  }
+
+  rq := &StepBatchRequest{Steps: []StepAction{{PlayerId: "1", StepDesc: "Lay out the board", Action: "reopen"}}}
+  _, _, err := StepBatchHandler{}.validate(s, rq)
+  if _, ok := err.(*ValidationError); !ok {
+    t.Fatalf("Expected the board not to be reopened while pawns depending on it are done, got %v", err)
+  }
+
+  rq.Steps = append(rq.Steps,
+    StepAction{PlayerId: "1", StepDesc: "Place pawn", Action: "reopen"},
+    StepAction{PlayerId: "2", StepDesc: "Place pawn", Action: "reopen"})
+  _, reopen, err := StepBatchHandler{}.validate(s, rq)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if len(reopen) != 3 {
+    t.Fatalf("Expected the board and both pawns to be reopened, got %d steps", len(reopen))
+  }
+}
+
+func TestStepBatchHandler_ValidateProblems(t *testing.T) {
+  s := newTestSession(t)
+  rq := &StepBatchRequest{Steps: []StepAction{
+    {PlayerId: "1", StepDesc: "Place pawn"},
+    {PlayerId: "1", StepDesc: "Place pawn"},
+    {PlayerId: "3", StepDesc: "Lay out the board"},
+    {PlayerId: "2", StepDesc: "Roll dice"},
+    {PlayerId: "2", StepDesc: "Place pawn", Action: "skip"},
+  }}
+
+  _, _, err := StepBatchHandler{}.validate(s, rq)
+  problems, ok := err.(*ValidationError)
+  if !ok {
+    t.Fatalf("Expected validation error, got %v", err)
+  }
+  // Duplicate, player not in session, unknown step, unknown action, and Alice's pawn blocked by the board
+  if len(problems.Problems) != 5 {
+    t.Fatalf("Expected 5 problems, got %v", problems.Problems)
+  }
+}
+
+func TestGraphQLHandler_Query(t *testing.T) {
+  srv, _ := newTestServer(t)
+  schema, err := newGraphQLSchema(srv)
+  if nil != err {
+    t.Fatal(err)
+  }
+  body := `{"query": "query($id: ID!) { session(id: $id) { id game { name dependencies { parent { description } child { description } } } assignments { player { name } step { rule { description eachPlayer } } done } } }", "variables": {"id": "1"}}`
+  w := httptest.NewRecorder()
+  GraphQLHandler{srv, schema}.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", strings.NewReader(body)))
+  if w.Code != http.StatusOK {
+    t.Fatalf("Expected 200, got %d", w.Code)
+  }
+
+  var result struct {
+    Data struct {
+      Session struct {
+        Id string
+        Game struct {
+          Name string
+          Dependencies []struct {
+            Parent struct{ Description string }
+            Child struct{ Description string }
+          }
+        }
+        Assignments []struct {
+          Player struct{ Name string }
+          Step struct {
+            Rule struct {
+              Description string
+              EachPlayer bool
+            }
+          }
+          Done bool
+        }
+      }
+    }
+    Errors []interface{}
+  }
+  if err := json.NewDecoder(w.Body).Decode(&result); nil != err {
+    t.Fatal(err)
+  }
+  if len(result.Errors) > 0 {
+    t.Fatalf("Unexpected errors: %v", result.Errors)
+  }
+  got := result.Data.Session
+  if got.Id != "1" || got.Game.Name != "Test" {
+    t.Errorf("Expected session 1 of Test, got %+v", got)
+  }
+  if len(got.Game.Dependencies) != 1 || got.Game.Dependencies[0].Parent.Description != "Lay out the board" || got.Game.Dependencies[0].Child.Description != "Place pawn" {
+    t.Errorf("Expected pawn to depend on board, got %+v", got.Game.Dependencies)
+  }
+  if len(got.Assignments) != 2 || got.Assignments[0].Player.Name != "Alice" {
+    t.Fatalf("Expected an assignment for each player, got %+v", got.Assignments)
+  }
+}
+
+func TestGraphQLHandler_MutationByGET(t *testing.T) {
+  srv, _ := newTestServer(t)
+  schema, err := newGraphQLSchema(srv)
+  if nil != err {
+    t.Fatal(err)
+  }
+  q := "mutation { finishSteps(sessionId: 1, steps: []) { id } }"
+  w := httptest.NewRecorder()
+  GraphQLHandler{srv, schema}.ServeHTTP(w, httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape(q), nil))
+  if w.Code != http.StatusMethodNotAllowed {
+    t.Errorf("Expected 405, got %d", w.Code)
+  }
+}
+
+func TestGraphQLHandler_BadRequest(t *testing.T) {
+  srv, _ := newTestServer(t)
+  schema, err := newGraphQLSchema(srv)
+  if nil != err {
+    t.Fatal(err)
+  }
+  for _, body := range []string{"{", `{"query": ""}`} {
+    w := httptest.NewRecorder()
+    GraphQLHandler{srv, schema}.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", strings.NewReader(body)))
+    if w.Code != http.StatusBadRequest {
+      t.Errorf("Expected 400 for %q, got %d", body, w.Code)
+    }
+  }
+}
+
+func newTestGRPCClient(t *testing.T, srv *Server) meeplepb.MeepleMoverClient {
+  lis := bufconn.Listen(1 << 20)
+  g := srv.GRPCServer()
+  go g.Serve(lis)
+  t.Cleanup(g.Stop)
+
+  conn, err := grpc.NewClient("passthrough:///bufnet",
+    grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) { return lis.DialContext(ctx) }),
+    grpc.WithTransportCredentials(insecure.NewCredentials()))
+  if nil != err {
+    t.Fatal(err)
+  }
+  t.Cleanup(func() { conn.Close() })
+  return meeplepb.NewMeepleMoverClient(conn)
+}
+
+func TestGRPC_NotReady(t *testing.T) {
+  client := newTestGRPCClient(t, New(newMemStore(), testLog, Config{}))
+  _, err := client.ListGames(context.Background(), &meeplepb.ListGamesRequest{})
+  if status.Code(err) != codes.Unavailable {
+    t.Errorf("Expected Unavailable before games are loaded, got %v", err)
+  }
+}
+
+func TestGRPC_WatchSession(t *testing.T) {
+  srv, store := newTestServer(t)
+  s := store.sessions[0]
+
+  client := newTestGRPCClient(t, srv)
+  ctx, cancel := context.WithCancel(context.Background())
+  defer cancel()
+
+  _, err := client.GetSession(ctx, &meeplepb.GetSessionRequest{Id: 2})
+  if status.Code(err) != codes.NotFound {
+    t.Errorf("Expected NotFound, got %v", err)
+  }
+
+  stream, err := client.WatchSession(ctx, &meeplepb.WatchSessionRequest{SessionId: 1})
+  if nil != err {
+    t.Fatal(err)
+  }
+  first, err := stream.Recv()
+  if nil != err {
+    t.Fatal(err)
+  }
+  if first.Id != 1 || len(first.Assignments) != 2 || first.Steps[0].Done {
+    t.Fatalf("Expected the session as it was, got %v", first)
+  }
+
+  s.SetupSteps[0].Finish()
+  srv.updates.publish(s)
+  second, err := stream.Recv()
+  if nil != err {
+    t.Fatal(err)
+  }
+  if !second.Steps[0].Done {
+    t.Errorf("Expected the finished step in the update, got %v", second)
+  }
+}
+
+func TestSessionUpdatesHandler(t *testing.T) {
+  srv, _ := newTestServer(t)
+  server := httptest.NewServer(srv)
+  defer server.Close()
+
+  resp, err := http.Get(server.URL + "/sessions/1/updates")
+  if nil != err {
+    t.Fatal(err)
+  }
+  defer resp.Body.Close()
+  if "text/event-stream" != resp.Header.Get("Content-Type") {
+    t.Fatalf("Expected an event stream, got %s", resp.Header.Get("Content-Type"))
+  }
+  events := bufio.NewReader(resp.Body)
+  expectEvent := func() {
+    for _, expected := range []string{"event: session\n", "data: {\"session_id\":1}\n", "\n"} {
+      line, err := events.ReadString('\n')
+      if nil != err || expected != line {
+        t.Fatalf("Expected %q, got %q, %v", expected, line, err)
+      }
+    }
+  }
+  expectEvent()
+
+  serve(srv, "POST", "/sessions/1/steps:batch", `{"steps":[{"player_id":"1","step_desc":"Lay out the board"}]}`, nil)
+  expectEvent()
+
+  if w := serve(srv, "GET", "/sessions/7/updates", "", nil); w.Code != http.StatusNotFound {
+    t.Errorf("Expected 404 for an unknown session, got %d", w.Code)
+  }
+}
+
+func TestGRPCError(t *testing.T) {
+  problems := &ValidationError{}
+  problems.Add("Unknown game %q", "7")
+  if status.Code(grpcError(problems)) != codes.InvalidArgument {
+    t.Error("Expected validation errors to be InvalidArgument")
+  }
+  if status.Code(grpcError(&StatusError{http.StatusNotFound, "Session not found"})) != codes.NotFound {
+    t.Error("Expected 404s to be NotFound")
+  }
+  if status.Code(grpcError(io.EOF)) != codes.Internal {
+    t.Error("Expected other errors to be Internal")
+  }
+}
+
+func TestFormats_Choose(t *testing.T) {
+  cases := []struct {
+    url string
+    accept string
+    format string
+    ok bool
+  }{
+    {"/sessions/1/checklist", "", "markdown", true},
+    {"/sessions/1/checklist", "text/html,application/xhtml+xml", "html", true},
+    {"/sessions/1/checklist?format=text", "text/html", "text", true},
+    {"/sessions/1/checklist?format=pdf", "", "pdf", false},
+    {"/sessions/1/checklist", "text/plain", "text", true},
+  }
+  for _, c := range cases {
+    r := httptest.NewRequest("GET", c.url, nil)
+    r.Header.Set("Accept", c.accept)
+    format, ok := checklistFormats.choose(r)
+    if format != c.format || ok != c.ok {
+      t.Errorf("%s with Accept %q: expected %s %v, got %s %v", c.url, c.accept, c.format, c.ok, format, ok)
+    }
+  }
+}
+
+func TestWebhookBackoff(t *testing.T) {
+  if webhookBackoff(1) != webhookFirstRetry || webhookBackoff(3) != 4 * webhookFirstRetry {
+    t.Errorf("Expected backoff to double from %s, got %s then %s", webhookFirstRetry, webhookBackoff(1), webhookBackoff(3))
+  }
+  if webhookBackoff(webhookMaxAttempts) != webhookMaxRetry {
+    t.Errorf("Expected backoff to be capped at %s, got %s", webhookMaxRetry, webhookBackoff(webhookMaxAttempts))
+  }
+}
+
+func TestAttemptDelivery(t *testing.T) {
+  var got *http.Request
+  var gotBody []byte
+  status := http.StatusNoContent
+  receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    got = r
+    gotBody, _ = io.ReadAll(r.Body)
+    w.WriteHeader(status)
+  }))
+  defer receiver.Close()
+
+  payload := []byte(`{"event":"setup.completed","session_id":1}`)
+  delivery := &record.WebhookDeliveryRecord{Id: 9, Event: eventSetupCompleted, Payload: payload, URL: receiver.URL, Secret: "s3cret"}
+  now := time.Unix(1700000000, 0)
+  attemptDelivery(receiver.Client(), delivery, now)
+
+  if delivery.Status != record.DeliveryDelivered || delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusNoContent {
+    t.Fatalf("Expected delivery to succeed, got %+v", delivery)
+  }
+  if !bytes.Equal(gotBody, payload) || got.Header.Get(webhookEventHeader) != eventSetupCompleted || got.Header.Get(webhookDeliveryHeader) != "9" {
+    t.Errorf("Unexpected request %v with body %s", got.Header, gotBody)
+  }
+  mac := hmac.New(sha256.New, []byte("s3cret"))
+  mac.Write([]byte("1700000000." + string(payload)))
+  if expected := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil)); got.Header.Get(webhookSignatureHeader) != expected {
+    t.Errorf("Expected signature %s, got %s", expected, got.Header.Get(webhookSignatureHeader))
+  }
+
+  status = http.StatusServiceUnavailable
+  attemptDelivery(receiver.Client(), delivery, now)
+  if delivery.Status != record.DeliveryPending || delivery.Attempts != 2 || !delivery.NextAttemptAt.Equal(now.Add(webhookBackoff(2))) {
+    t.Errorf("Expected a retry after backoff, got %+v", delivery)
+  }
+  delivery.Attempts = webhookMaxAttempts - 1
+  attemptDelivery(receiver.Client(), delivery, now)
+  if delivery.Status != record.DeliveryFailed || "" == delivery.LastError {
+    t.Errorf("Expected delivery to fail after %d attempts, got %+v", webhookMaxAttempts, delivery)
+  }
+}
+
+// Two servers delivering at once, to a receiver slow enough that a batch of deliveries would outlast the lease
+func TestDeliverDueWebhooks_SlowReceiver(t *testing.T) {
+  lease, timeout := webhookLease, webhookTimeout
+  webhookLease, webhookTimeout = 200 * time.Millisecond, 150 * time.Millisecond
+  defer func() { webhookLease, webhookTimeout = lease, timeout }()
+
+  var mutex sync.Mutex
+  received := make(map[string]int)
+  receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    time.Sleep(100 * time.Millisecond)
+    mutex.Lock()
+    defer mutex.Unlock()
+    received[r.Header.Get(webhookDeliveryHeader)]++
+  }))
+  defer receiver.Close()
+
+  srv, store := newTestServer(t)
+  store.webhooks[0].URL = receiver.URL
+  for i := 0; i < 4; i++ {
+    store.QueueWebhookEvent(&WebhookEvent{Event: eventSetupCompleted, SessionId: 1})
+  }
+  other := New(store, testLog, Config{})
+  t.Cleanup(other.Close)
+
+  var wg sync.WaitGroup
+  wg.Add(2)
+  go func() {
+    defer wg.Done()
+    srv.deliverDueWebhooks(receiver.Client())
+  }()
+  go func() {
+    defer wg.Done()
+    time.Sleep(250 * time.Millisecond)  // Once a lease on the first deliveries would have run out
+    other.deliverDueWebhooks(receiver.Client())
+  }()
+  wg.Wait()
+
+  if 4 != len(received) {
+    t.Errorf("Expected 4 deliveries to be received, got %v", received)
+  }
+  for id, times := range received {
+    if 1 != times {
+      t.Errorf("Expected delivery %s to be received once, got %d times", id, times)
+    }
+  }
+  for _, delivery := range store.deliveries {
+    if record.DeliveryDelivered != delivery.Status {
+      t.Errorf("Expected delivery %d to be delivered, got %s", delivery.Id, delivery.Status)
+    }
+  }
+}
+
+func TestWebhookAddressAllowed(t *testing.T) {
+  _, lan, _ := net.ParseCIDR("192.168.1.0/24")
+  cases := []struct {
+    ip string
+    allowed bool
+  }{
+    {"93.184.216.34", true},
+    {"2606:2800:220:1::1", true},
+    {"127.0.0.1", false},
+    {"::1", false},
+    {"169.254.169.254", false},
+    {"10.0.0.5", false},
+    {"172.16.3.4", false},
+    {"192.168.2.1", false},
+    {"192.168.1.20", true},
+    {"fd00::1", false},
+    {"0.0.0.0", false},
+  }
+  for _, c := range cases {
+    if allowed := webhookAddressAllowed(net.ParseIP(c.ip), []*net.IPNet{lan}); allowed != c.allowed {
+      t.Errorf("%s: expected allowed %v, got %v", c.ip, c.allowed, allowed)
+    }
+  }
+}
+
+// The default client refuses to deliver to the receiver on loopback, unless its network is allowed
+func TestWebhookClient_Loopback(t *testing.T) {
+  called := false
+  receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+  defer receiver.Close()
+
+  delivery := &record.WebhookDeliveryRecord{Id: 9, Event: eventSetupCompleted, Payload: []byte(`{}`), URL: receiver.URL, Secret: "s3cret"}
+  attemptDelivery(New(newMemStore(), testLog, Config{}).config.WebhookClient, delivery, time.Now())
+  if called || record.DeliveryPending != delivery.Status || !strings.Contains(delivery.LastError, "may not be at 127.0.0.1") {
+    t.Errorf("Expected delivery to loopback to be refused, got %+v", delivery)
+  }
+
+  _, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+  client := New(newMemStore(), testLog, Config{WebhookAllowedNetworks: []*net.IPNet{loopback}}).config.WebhookClient
+  attemptDelivery(client, delivery, time.Now())
+  if !called || record.DeliveryDelivered != delivery.Status {
+    t.Errorf("Expected delivery to an allowed network, got %+v", delivery)
+  }
+}
+
+func TestWebhookCreateHandler_Validate(t *testing.T) {
+  rq := &WebhookCreateRequest{WebhookCreateHash{URL: "ftp://example.com", Events: []string{"session.created", "game.over"}}}
+  err := WebhookCreateHandler{}.validate(rq)
+  problems, ok := err.(*ValidationError)
+  if !ok || len(problems.Problems) != 2 {
+    t.Fatalf("Expected problems with the URL and an event, got %v", err)
+  }
+
+  rq = &WebhookCreateRequest{WebhookCreateHash{URL: "https://example.com/hook", Events: webhookEvents}}
+  if err := (WebhookCreateHandler{}).validate(rq); nil != err {
+    t.Errorf("Expected a valid webhook, got %v", err)
+  }
+}
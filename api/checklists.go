@@ -0,0 +1,92 @@
+package api
+
+import (
+  "bytes"
+  "net/http"
+  "strconv"
+  "github.com/rkbodenner/meeple_mover/checklist"
+)
+
+// How checklists can be written, Markdown by default
+var checklistFormats = formats{
+  contentTypes: map[string]string{
+    "markdown": "text/markdown; charset=utf-8",
+    "text": "text/plain; charset=utf-8",
+    "html": "text/html; charset=utf-8",
+  },
+  accepted: []string{"html", "markdown", "text"},
+  fallback: "markdown",
+  expected: "markdown, text or html",
+}
+
+func writeChecklist(w http.ResponseWriter, r *http.Request, c *checklist.Checklist) {
+  checklistFormats.write(w, r, func(format string, buf *bytes.Buffer) error {
+    switch format {
+    case "html":
+      return c.HTML(buf)
+    case "text":
+      return c.Text(buf)
+    }
+    return c.Markdown(buf)
+  })
+}
+
+type SessionChecklistHandler struct {
+  srv *Server
+}
+func (h SessionChecklistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id, err := strconv.ParseUint(r.URL.Query().Get("session_id"), 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+  s, ok := h.srv.sessionIndex[id]
+  if !ok {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+
+  c, err := checklist.ForSession(s)
+  if nil != err {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+  writeChecklist(w, r, c)
+}
+
+type GameChecklistHandler struct {
+  srv *Server
+}
+func (h GameChecklistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+  g, ok := h.srv.gameIndex[id]
+  if !ok {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+
+  playerCount := g.MinPlayers
+  if players := r.URL.Query().Get("players"); "" != players {
+    playerCount, err = strconv.Atoi(players)
+    if nil != err {
+      http.Error(w, "Expected an integer number of players", http.StatusBadRequest)
+      return
+    }
+  }
+
+  g, err = h.srv.gameForPlayers(g, playerCount)
+  if nil != err {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  c, err := checklist.ForGame(g, playerCount)
+  if nil != err {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  writeChecklist(w, r, c)
+}
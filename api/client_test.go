@@ -0,0 +1,151 @@
+package api
+
+import (
+  "context"
+  "errors"
+  "net/http/httptest"
+  "testing"
+  "github.com/rkbodenner/meeple_mover/meepleclient"
+)
+
+// A client of the test server, so that the two are tested against each other
+func newTestClient(t *testing.T) (*meepleclient.Client, *Server, *memStore) {
+  srv, store := newTestServer(t)
+  server := httptest.NewServer(srv)
+  t.Cleanup(server.Close)
+  return meepleclient.New(server.URL, meepleclient.Config{HTTPClient: server.Client(), Retries: -1}), srv, store
+}
+
+func TestClient_SessionStrategy(t *testing.T) {
+  c, srv, _ := newTestClient(t)
+  ctx := context.Background()
+
+  s, err := c.CreateSession(ctx, 1, []int{1, 2}, meepleclient.SessionOptions{Strategy: "balanced"})
+  if nil != err {
+    t.Fatal(err)
+  }
+  if "balanced" != srv.strategy(srv.sessionIndex[(uint64)(s.Id)]).Name() {
+    t.Error("Expected the session to be balanced")
+  }
+  if _, err = c.CreateSession(ctx, 1, []int{1, 2}, meepleclient.SessionOptions{Strategy: "random"}); !errors.Is(err, meepleclient.ErrInvalid) {
+    t.Errorf("Expected an unknown strategy to be refused, got %v", err)
+  }
+}
+
+func TestClient_Modules(t *testing.T) {
+  c, _, _ := newTestClient(t)
+  ctx := context.Background()
+
+  modules, err := c.Modules(ctx, 1)
+  if nil != err || 1 != len(modules) || "Tokens" != modules[0].Name || "Place {tokens} tokens" != modules[0].Rules[0].Description {
+    t.Fatalf("Expected the Tokens module, got %v, %v", modules, err)
+  }
+
+  solo, err := c.CreateModule(ctx, 1, &meepleclient.Module{Name: "Solo", Kind: "variant", MaxPlayers: 1, Removes: []string{"Place pawn"}})
+  if nil != err || 0 == solo.Id || 1 != solo.MaxPlayers || "Place pawn" != solo.Removes[0] {
+    t.Fatalf("Expected the Solo variant, got %+v, %v", solo, err)
+  }
+  if _, err = c.CreateModule(ctx, 1, &meepleclient.Module{Name: "Solo"}); !errors.Is(err, meepleclient.ErrInvalid) {
+    t.Errorf("Expected a module with a name that's taken to be refused, got %v", err)
+  }
+
+  s, err := c.CreateSession(ctx, 1, []int{1, 2}, meepleclient.SessionOptions{Modules: []string{"Tokens"}})
+  if nil != err {
+    t.Fatal(err)
+  }
+  found := false
+  for _, step := range s.SetupSteps {
+    found = found || "Place 8 tokens" == step.Rule.Description
+  }
+  if !found {
+    t.Errorf("Expected the session to be set up with the module's rules, got %v", s.SetupSteps)
+  }
+
+  _, err = c.CreateSession(ctx, 1, []int{1, 2}, meepleclient.SessionOptions{Modules: []string{"Dragons"}})
+  var invalid *meepleclient.ValidationError
+  if !errors.As(err, &invalid) || 1 != len(invalid.Problems) {
+    t.Errorf("Expected an unknown module to be refused, got %v", err)
+  }
+}
+
+func TestClient_Conditions(t *testing.T) {
+  c, srv, _ := newTestClient(t)
+  ctx := context.Background()
+
+  conditions, err := c.Conditions(ctx, 1)
+  if nil != err || 1 != len(conditions) || 3 != conditions[0].RuleId || 2 != conditions[0].Condition.MinPlayers {
+    t.Fatalf("Expected the tokens' condition, got %v, %v", conditions, err)
+  }
+
+  set, err := c.SetCondition(ctx, 1, 2, meepleclient.Condition{Expression: "players != 1"})
+  if nil != err || "Place pawn" != set.Rule || "players != 1" != set.Condition.Expression {
+    t.Fatalf("Expected the pawn's condition, got %+v, %v", set, err)
+  }
+  if _, ok := srv.conditions[2]; !ok {
+    t.Error("Expected the condition to be kept")
+  }
+  if _, err = c.SetCondition(ctx, 1, 2, meepleclient.Condition{Expression: "players = 2"}); !errors.Is(err, meepleclient.ErrInvalid) {
+    t.Errorf("Expected a malformed condition to be refused, got %v", err)
+  }
+  if _, err = c.SetCondition(ctx, 1, 99, meepleclient.Condition{MinPlayers: 2}); !errors.Is(err, meepleclient.ErrNotFound) {
+    t.Errorf("Expected 404 for an unknown rule, got %v", err)
+  }
+}
+
+func TestClient_Quantities(t *testing.T) {
+  c, srv, _ := newTestClient(t)
+  ctx := context.Background()
+
+  quantities, err := c.Quantities(ctx, 1)
+  if nil != err || 1 != len(quantities) || "8" != quantities[0].Quantities["tokens"]["2"] {
+    t.Fatalf("Expected the tokens' quantities, got %v, %v", quantities, err)
+  }
+
+  set, err := c.SetQuantities(ctx, 1, 3, meepleclient.Quantities{"tokens": {"*": "5"}})
+  if nil != err || "5" != set.Quantities["tokens"]["*"] {
+    t.Fatalf("Expected the new quantities, got %+v, %v", set, err)
+  }
+  if "5" != srv.quantities[3]["tokens"][0] {
+    t.Error("Expected the quantities to be kept")
+  }
+  var invalid *meepleclient.ValidationError
+  if _, err = c.SetQuantities(ctx, 1, 3, meepleclient.Quantities{"tokens": {"2": "8"}}); !errors.As(err, &invalid) {
+    t.Errorf("Expected quantities missing values to be refused, got %v", err)
+  }
+}
+
+func TestClient_Webhooks(t *testing.T) {
+  c, _, _ := newTestClient(t)
+  ctx := context.Background()
+
+  hooks, err := c.Webhooks(ctx)
+  if nil != err || 1 != len(hooks) || "https://example.com/hook" != hooks[0].URL || "" != hooks[0].Secret {
+    t.Fatalf("Expected the test webhook, without its secret, got %v, %v", hooks, err)
+  }
+
+  created, err := c.CreateWebhook(ctx, &meepleclient.Webhook{URL: "https://example.com/other", Events: []string{meepleclient.EventSetupCompleted}})
+  if nil != err || 0 == created.Id || "" == created.Secret {
+    t.Fatalf("Expected a webhook with a generated secret, got %+v, %v", created, err)
+  }
+  if hook, err := c.Webhook(ctx, created.Id); nil != err || "https://example.com/other" != hook.URL {
+    t.Errorf("Expected the new webhook, got %+v, %v", hook, err)
+  }
+  if _, err = c.CreateWebhook(ctx, &meepleclient.Webhook{URL: "ftp://example.com", Events: []string{"game.over"}}); !errors.Is(err, meepleclient.ErrInvalid) {
+    t.Errorf("Expected a bad webhook to be refused, got %v", err)
+  }
+
+  if err := c.FinishStep(ctx, 1, 1, "Lay out the board"); nil != err {
+    t.Fatal(err)
+  }
+  deliveries, err := c.WebhookDeliveries(ctx, 1)
+  if nil != err || 1 != len(deliveries) || meepleclient.EventStepFinished != deliveries[0].Event || "pending" != deliveries[0].Status {
+    t.Errorf("Expected the finished step to be pending delivery, got %v, %v", deliveries, err)
+  }
+
+  if err := c.DeleteWebhook(ctx, created.Id); nil != err {
+    t.Fatal(err)
+  }
+  if _, err := c.Webhook(ctx, created.Id); !errors.Is(err, meepleclient.ErrNotFound) {
+    t.Errorf("Expected the webhook to be deleted, got %v", err)
+  }
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+  "database/sql"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "net/http"
+  "net/url"
+  "strconv"
+  "github.com/rkbodenner/meeple_mover/condition"
+  "github.com/rkbodenner/meeple_mover/quantity"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+// The numbers of players a rule is set up for. Every part is optional, and a rule with none is always set up.
+type ConditionHash struct {
+  MinPlayers int `json:"min_players,omitempty"`
+  MaxPlayers int `json:"max_players,omitempty"`
+  Expression string `json:"expression,omitempty"`  // Such as "players == 2 || players >= 5"
+}
+
+type RuleConditionHash struct {
+  RuleId int `json:"rule_id"`
+  Rule string `json:"rule"`  // Its description
+  Condition ConditionHash `json:"condition"`
+  Description string `json:"description"`  // Of the condition, such as "at most 3 players"
+}
+
+type ConditionUpdateRequest struct {
+  Condition ConditionHash `json:"condition"`
+}
+
+func ruleConditionHash(rule *game.SetupRule, c *condition.Condition) *RuleConditionHash {
+  if nil == c {
+    c = &condition.Condition{}
+  }
+  return &RuleConditionHash{RuleId: rule.Id, Rule: rule.Description,
+    Condition: ConditionHash{c.MinPlayers, c.MaxPlayers, c.Expression}, Description: c.String()}
+}
+
+// The game's rules and those of its expansions and variants, which may all have conditions and quantities
+func (srv *Server) allRules(g *game.Game) []*game.SetupRule {
+  rules := append([]*game.SetupRule{}, g.SetupRules...)
+  for _, m := range srv.modules[(uint64)(g.Id)] {
+    rules = append(rules, m.Rules...)
+  }
+  return rules
+}
+
+// The fewest and most players the game is for, with any of its modules. Returns an error if it has no
+// maximum, since its rules' conditions and quantities couldn't be checked for every number of players.
+func (srv *Server) playerRange(g *game.Game) (int, int, error) {
+  minPlayers, maxPlayers := g.MinPlayers, g.MaxPlayers
+  for _, m := range srv.modules[(uint64)(g.Id)] {
+    if m.MinPlayers > 0 && m.MinPlayers < minPlayers {
+      minPlayers = m.MinPlayers
+    }
+    if m.MaxPlayers > maxPlayers {
+      maxPlayers = m.MaxPlayers
+    }
+  }
+  if minPlayers < 1 {
+    minPlayers = 1
+  }
+  if maxPlayers < minPlayers {
+    return 0, 0, errors.New(fmt.Sprintf("%s has no maximum number of players to check against", g.Name))
+  }
+  return minPlayers, maxPlayers, nil
+}
+
+// The game and rule of the id and rule_id path parameters. Returns a *StatusError if either isn't found.
+func (srv *Server) findRule(u *url.URL) (*game.Game, *game.SetupRule, error) {
+  id, err := strconv.ParseUint(u.Query().Get("id"), 10, 64)
+  if nil != err {
+    return nil, nil, &StatusError{http.StatusNotFound, "Game not found"}
+  }
+  g, ok := srv.gameIndex[id]
+  if !ok {
+    return nil, nil, &StatusError{http.StatusNotFound, "Game not found"}
+  }
+  ruleId, err := strconv.Atoi(u.Query().Get("rule_id"))
+  if nil != err {
+    return nil, nil, &StatusError{http.StatusNotFound, "Rule not found"}
+  }
+  for _, rule := range srv.allRules(g) {
+    if rule.Id == ruleId {
+      return g, rule, nil
+    }
+  }
+  return nil, nil, &StatusError{http.StatusNotFound, "Rule not found"}
+}
+
+// The game for the number of players, without the rules whose conditions leave them out, and with
+// the values of the others' placeholders filled in
+func (srv *Server) gameForPlayers(g *game.Game, players int) (*game.Game, error) {
+  g, err := condition.Filter(g, srv.conditions, players)
+  if nil != err {
+    return nil, err
+  }
+  return quantity.Render(g, srv.quantities, players)
+}
+
+type ConditionsHandler struct {
+  srv *Server
+}
+func (h ConditionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+  g, ok := h.srv.gameIndex[id]
+  if !ok {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+
+  hashes := make([]*RuleConditionHash, 0)
+  for _, rule := range h.srv.allRules(g) {
+    if c, ok := h.srv.conditions[rule.Id]; ok {
+      hashes = append(hashes, ruleConditionHash(rule, c))
+    }
+  }
+  if err := json.NewEncoder(w).Encode(hashes); nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
+
+type ConditionUpdateHandler struct {
+  srv *Server
+}
+
+// Parse the condition, and check that it can be evaluated for every number of players the game is
+// for, with any of its modules. Returns a *ValidationError.
+func (handler ConditionUpdateHandler) validate(g *game.Game, hash *ConditionHash) (*condition.Condition, error) {
+  problems := &ValidationError{}
+  c, err := condition.New(hash.MinPlayers, hash.MaxPlayers, hash.Expression)
+  if nil != err {
+    problems.Add("%s", err.Error())
+    return nil, problems
+  }
+  minPlayers, maxPlayers, err := handler.srv.playerRange(g)
+  if nil != err {
+    problems.Add("%s", err.Error())
+    return nil, problems
+  }
+  if err := c.Check(minPlayers, maxPlayers); nil != err {
+    problems.Add("%s", err.Error())
+    return nil, problems
+  }
+  return c, nil
+}
+
+func (handler ConditionUpdateHandler) marshalFunc() (func(*url.URL, http.Header, *ConditionUpdateRequest) (int, http.Header, *RuleConditionHash, error)) {
+  return func(u *url.URL, h http.Header, rq *ConditionUpdateRequest) (int, http.Header, *RuleConditionHash, error) {
+    srv := handler.srv
+    g, rule, err := srv.findRule(u)
+    if nil != err {
+      return http.StatusNotFound, nil, nil, err
+    }
+
+    c, err := handler.validate(g, &rq.Condition)
+    if nil != err {
+      return http.StatusUnprocessableEntity, nil, nil, err
+    }
+    err = srv.timed("SetCondition", func() error { return srv.store.SetCondition(rule, c) })
+    if sql.ErrNoRows == err {
+      return http.StatusNotFound, nil, nil, &StatusError{http.StatusNotFound, "Rule not found"}
+    } else if nil != err {
+      return http.StatusInternalServerError, nil, nil, err
+    }
+    if c.Empty() {
+      delete(srv.conditions, rule.Id)
+    } else {
+      srv.conditions[rule.Id] = c
+    }
+    srv.forgetUsefulPlayers((uint64)(g.Id))
+    srv.requestLog(h).Info("Set condition", "game_id", g.Id, "rule_id", rule.Id, "condition", c.String())
+    return http.StatusOK, nil, ruleConditionHash(rule, c), nil
+  }
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+  "bytes"
+  "fmt"
+  "net/http"
+  "strings"
+)
+
+// Formats a resource can be written in, chosen by the format parameter or else the Accept header
+type formats struct {
+  contentTypes map[string]string  // By format name
+  accepted []string  // Formats the Accept header can choose, in order of preference
+  fallback string  // When the Accept header chooses none
+  expected string  // The names, for the error when an unknown format is asked for
+}
+
+// The format asked for by the format parameter, or else the Accept header. Returns false if the
+// parameter names an unknown format.
+func (f formats) choose(r *http.Request) (string, bool) {
+  if format := r.URL.Query().Get("format"); "" != format {
+    _, ok := f.contentTypes[format]
+    return format, ok
+  }
+  accept := r.Header.Get("Accept")
+  for _, format := range f.accepted {
+    mediaType := strings.SplitN(f.contentTypes[format], ";", 2)[0]
+    if strings.Contains(accept, mediaType) {
+      return format, true
+    }
+  }
+  return f.fallback, true
+}
+
+// Write what render writes in the format chosen for the request. The response varies by the Accept
+// header as well as by whatever middleware like CORS has already added.
+func (f formats) write(w http.ResponseWriter, r *http.Request, render func(format string, buf *bytes.Buffer) error) {
+  format, ok := f.choose(r)
+  if !ok {
+    http.Error(w, fmt.Sprintf("Unknown format. Expected %s.", f.expected), http.StatusBadRequest)
+    return
+  }
+
+  var buf bytes.Buffer
+  if err := render(format, &buf); nil != err {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+  w.Header().Set("Content-Type", f.contentTypes[format])
+  w.Header().Add("Vary", "Accept")
+  buf.WriteTo(w)
+}
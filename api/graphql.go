@@ -0,0 +1,461 @@
+package api
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "log/slog"
+  "net/http"
+  "strconv"
+  "github.com/graphql-go/graphql"
+  "github.com/graphql-go/graphql/language/ast"
+  "github.com/graphql-go/graphql/language/parser"
+  "github.com/rkbodenner/meeple_mover/condition"
+  "github.com/rkbodenner/meeple_mover/expansion"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// An edge in a game's rule graph: the child rule can't be done until the parent is
+type RuleDependency struct {
+  Parent *game.SetupRule
+  Child *game.SetupRule
+}
+
+func ruleDependencies(g *game.Game) []RuleDependency {
+  edges := make([]RuleDependency, 0)
+  for _, child := range g.SetupRules {
+    for _, parent := range child.Dependencies {
+      edges = append(edges, RuleDependency{Parent: parent, Child: child})
+    }
+  }
+  return edges
+}
+
+type graphQLContextKey int
+
+const graphQLLogKey graphQLContextKey = 0
+
+// The request's logger, which the handler puts in the context resolvers are given
+func (srv *Server) graphQLLog(p graphql.ResolveParams) *slog.Logger {
+  if log, ok := p.Context.Value(graphQLLogKey).(*slog.Logger); ok {
+    return log
+  }
+  return srv.log
+}
+
+// Parse a GraphQL ID argument, which may have been given as a string or an integer
+func idArg(p graphql.ResolveParams, name string) (uint64, error) {
+  var str string
+  switch v := p.Args[name].(type) {
+  case string:
+    str = v
+  case int:
+    str = strconv.Itoa(v)
+  }
+  id, err := strconv.ParseUint(str, 10, 64)
+  if nil != err {
+    return 0, errors.New("Expected integer " + name + ", got " + strconv.Quote(str))
+  }
+  return id, nil
+}
+
+func stringArgs(p graphql.ResolveParams, name string) []string {
+  list := make([]string, 0)
+  if values, ok := p.Args[name].([]interface{}); ok {
+    for _, v := range values {
+      if str, ok := v.(string); ok {
+        list = append(list, str)
+      }
+    }
+  }
+  return list
+}
+
+// The schema is built on the same caches, records and handler logic as the REST routes
+func newGraphQLSchema(srv *Server) (graphql.Schema, error) {
+  playerType := graphql.NewObject(graphql.ObjectConfig{
+    Name: "Player",
+    Fields: graphql.Fields{
+      "id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+      "name": &graphql.Field{Type: graphql.String},
+    },
+  })
+
+  conditionType := graphql.NewObject(graphql.ObjectConfig{
+    Name: "Condition",
+    Description: "The numbers of players a rule is set up for",
+    Fields: graphql.Fields{
+      "minPlayers": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "0 for no minimum"},
+      "maxPlayers": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "0 for no maximum"},
+      "expression": &graphql.Field{Type: graphql.String, Description: "A test over the number of players, such as players != 3"},
+      "description": &graphql.Field{
+        Type: graphql.NewNonNull(graphql.String),
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          return p.Source.(*condition.Condition).String(), nil
+        },
+      },
+    },
+  })
+
+  var ruleType *graphql.Object
+  ruleType = graphql.NewObject(graphql.ObjectConfig{
+    Name: "Rule",
+    Fields: graphql.FieldsThunk(func() graphql.Fields {
+      return graphql.Fields{
+        "id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+        "description": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+        "details": &graphql.Field{Type: graphql.String},
+        "arity": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+        "eachPlayer": &graphql.Field{
+          Type: graphql.NewNonNull(graphql.Boolean),
+          Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+            return "Each player" == p.Source.(*game.SetupRule).Arity, nil
+          },
+        },
+        "dependsOn": &graphql.Field{
+          Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(ruleType))),
+          Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+            return p.Source.(*game.SetupRule).Dependencies, nil
+          },
+        },
+        "condition": &graphql.Field{
+          Type: conditionType,
+          Description: "Null if the rule is set up for any number of players",
+          Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+            if c, ok := srv.conditions[p.Source.(*game.SetupRule).Id]; ok {
+              return c, nil
+            }
+            return nil, nil
+          },
+        },
+      }
+    }),
+  })
+
+  dependencyType := graphql.NewObject(graphql.ObjectConfig{
+    Name: "RuleDependency",
+    Fields: graphql.Fields{
+      "parent": &graphql.Field{Type: graphql.NewNonNull(ruleType)},
+      "child": &graphql.Field{Type: graphql.NewNonNull(ruleType)},
+    },
+  })
+
+  moduleType := graphql.NewObject(graphql.ObjectConfig{
+    Name: "Module",
+    Description: "An expansion or variant of a game, adding rules to it and removing or replacing its own",
+    Fields: graphql.Fields{
+      "id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+      "name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+      "kind": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Description: "expansion or variant"},
+      "minPlayers": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "0 if it's the game's"},
+      "maxPlayers": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "0 if it's the game's"},
+      "rules": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(ruleType)))},
+      "removes": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(ruleType)))},
+    },
+  })
+
+  gameType := graphql.NewObject(graphql.ObjectConfig{
+    Name: "Game",
+    Fields: graphql.Fields{
+      "id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+      "name": &graphql.Field{Type: graphql.String},
+      "minPlayers": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+      "maxPlayers": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+      "rules": &graphql.Field{
+        Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(ruleType))),
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          return p.Source.(*game.Game).SetupRules, nil
+        },
+      },
+      "dependencies": &graphql.Field{
+        Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(dependencyType))),
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          return ruleDependencies(p.Source.(*game.Game)), nil
+        },
+      },
+      "modules": &graphql.Field{
+        Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(moduleType))),
+        Description: "Expansions and variants that sessions can be set up with",
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          if modules, ok := srv.modules[(uint64)(p.Source.(*game.Game).Id)]; ok {
+            return modules, nil
+          }
+          return []*expansion.Module{}, nil
+        },
+      },
+    },
+  })
+
+  stepType := graphql.NewObject(graphql.ObjectConfig{
+    Name: "Step",
+    Fields: graphql.Fields{
+      "rule": &graphql.Field{Type: graphql.NewNonNull(ruleType)},
+      "owner": &graphql.Field{Type: playerType},
+      "done": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+    },
+  })
+
+  assignmentType := graphql.NewObject(graphql.ObjectConfig{
+    Name: "Assignment",
+    Fields: graphql.Fields{
+      "player": &graphql.Field{Type: graphql.NewNonNull(playerType)},
+      "step": &graphql.Field{Type: stepType},
+      "done": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+    },
+  })
+
+  sessionType := graphql.NewObject(graphql.ObjectConfig{
+    Name: "Session",
+    Fields: graphql.Fields{
+      "id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+      "game": &graphql.Field{Type: graphql.NewNonNull(gameType)},
+      "players": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(playerType)))},
+      "steps": &graphql.Field{
+        Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(stepType))),
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          return p.Source.(*session.Session).SetupSteps, nil
+        },
+      },
+      "assignments": &graphql.Field{
+        Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(assignmentType))),
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          return assignments(p.Source.(*session.Session)), nil
+        },
+      },
+      "strategy": &graphql.Field{
+        Type: graphql.NewNonNull(graphql.String),
+        Description: "How each player's next step is picked",
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          return srv.strategy(p.Source.(*session.Session)).Name(), nil
+        },
+      },
+      "modules": &graphql.Field{
+        Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+        Description: "Names of the expansions and variants the game is set up with, in the order they were applied",
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          return srv.sessionModuleNames(p.Source.(*session.Session)), nil
+        },
+      },
+    },
+  })
+
+  queryType := graphql.NewObject(graphql.ObjectConfig{
+    Name: "Query",
+    Fields: graphql.Fields{
+      "games": &graphql.Field{
+        Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(gameType))),
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          return srv.games, nil
+        },
+      },
+      "game": &graphql.Field{
+        Type: gameType,
+        Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          id, err := idArg(p, "id")
+          if nil != err {
+            return nil, err
+          }
+          if g, ok := srv.gameIndex[id]; ok {
+            return g, nil
+          }
+          return nil, nil
+        },
+      },
+      "players": &graphql.Field{
+        Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(playerType))),
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          players, err := srv.listPlayers()
+          if nil != err {
+            return nil, errors.New("Could not fetch players from database")
+          }
+          return players, nil
+        },
+      },
+      "player": &graphql.Field{
+        Type: playerType,
+        Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          id, err := idArg(p, "id")
+          if nil != err {
+            return nil, err
+          }
+          problems := &ValidationError{}
+          players, err := srv.fetchPlayersById([]int{(int)(id)}, problems)
+          if nil != err {
+            return nil, err
+          }
+          if problems.Any() {
+            return nil, nil
+          }
+          return players[0], nil
+        },
+      },
+      "sessions": &graphql.Field{
+        Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(sessionType))),
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          return srv.sessions, nil
+        },
+      },
+      "session": &graphql.Field{
+        Type: sessionType,
+        Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          id, err := idArg(p, "id")
+          if nil != err {
+            return nil, err
+          }
+          if s, ok := srv.sessionIndex[id]; ok {
+            return s, nil
+          }
+          return nil, nil
+        },
+      },
+    },
+  })
+
+  stepInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+    Name: "StepInput",
+    Fields: graphql.InputObjectConfigFieldMap{
+      "playerId": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.ID)},
+      "stepDesc": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+      "action": &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "finish, the default, or reopen"},
+    },
+  })
+
+  mutationType := graphql.NewObject(graphql.ObjectConfig{
+    Name: "Mutation",
+    Fields: graphql.Fields{
+      "createSession": &graphql.Field{
+        Type: graphql.NewNonNull(sessionType),
+        Args: graphql.FieldConfigArgument{
+          "gameId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+          "playerIds": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.ID)))},
+          "startedDate": &graphql.ArgumentConfig{Type: graphql.String},
+          "strategy": &graphql.ArgumentConfig{Type: graphql.String, Description: "first, the default, balanced, unblocking or related"},
+          "modules": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String)), Description: "Names of the game's expansions and variants to set it up with"},
+        },
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          rq := &SessionCreateRequest{}
+          rq.Session.Game, _ = p.Args["gameId"].(string)
+          rq.Session.Players = stringArgs(p, "playerIds")
+          rq.Session.StartedDate, _ = p.Args["startedDate"].(string)
+          rq.Session.Strategy, _ = p.Args["strategy"].(string)
+          rq.Session.Modules = stringArgs(p, "modules")
+          return SessionCreateHandler{srv}.create(srv.graphQLLog(p), rq)
+        },
+      },
+      "finishSteps": &graphql.Field{
+        Type: graphql.NewNonNull(sessionType),
+        Args: graphql.FieldConfigArgument{
+          "sessionId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+          "steps": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(stepInputType)))},
+        },
+        Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+          session_id, err := idArg(p, "sessionId")
+          if nil != err {
+            return nil, err
+          }
+          rq := &StepBatchRequest{}
+          inputs, _ := p.Args["steps"].([]interface{})
+          for _, input := range inputs {
+            fields, _ := input.(map[string]interface{})
+            action := StepAction{}
+            action.PlayerId, _ = fields["playerId"].(string)
+            action.StepDesc, _ = fields["stepDesc"].(string)
+            action.Action, _ = fields["action"].(string)
+            rq.Steps = append(rq.Steps, action)
+          }
+          return StepBatchHandler{srv}.apply(srv.graphQLLog(p), session_id, rq)
+        },
+      },
+    },
+  })
+
+  return graphql.NewSchema(graphql.SchemaConfig{
+    Query: queryType,
+    Mutation: mutationType,
+  })
+}
+
+type GraphQLRequest struct {
+  Query string `json:"query"`
+  Variables map[string]interface{} `json:"variables"`
+  OperationName string `json:"operationName"`
+}
+
+// Whether the operation that would be run is a mutation. Unparseable queries aren't,
+// and are left for graphql.Do to report.
+func isMutation(rq *GraphQLRequest) bool {
+  doc, err := parser.Parse(parser.ParseParams{Source: rq.Query})
+  if nil != err {
+    return false
+  }
+  for _, def := range doc.Definitions {
+    op, ok := def.(*ast.OperationDefinition)
+    if !ok {
+      continue
+    }
+    if "" == rq.OperationName || (nil != op.Name && op.Name.Value == rq.OperationName) {
+      return "mutation" == op.Operation
+    }
+  }
+  return false
+}
+
+// Runs queries given in the query string of a GET, and queries and mutations POSTed as JSON.
+// Like any GraphQL server, responds 200 even if there were errors, which are listed in the result.
+type GraphQLHandler struct {
+  srv *Server
+  schema graphql.Schema
+}
+func (h GraphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  rq := &GraphQLRequest{}
+  if "GET" == r.Method {
+    rq.Query = r.URL.Query().Get("query")
+    rq.OperationName = r.URL.Query().Get("operationName")
+    if variables := r.URL.Query().Get("variables"); "" != variables {
+      if err := json.Unmarshal([]byte(variables), &rq.Variables); nil != err {
+        writeJSONError(w, http.StatusBadRequest, "error", "Could not parse variables: "+err.Error())
+        return
+      }
+    }
+    if isMutation(rq) {
+      writeJSONError(w, http.StatusMethodNotAllowed, "error", "Mutations must be POSTed")
+      return
+    }
+  } else {
+    if err := json.NewDecoder(r.Body).Decode(rq); nil != err {
+      writeJSONError(w, http.StatusBadRequest, "error", "Could not parse request: "+err.Error())
+      return
+    }
+  }
+  if "" == rq.Query {
+    writeJSONError(w, http.StatusBadRequest, "error", "Expected a query")
+    return
+  }
+
+  // Mutations change the caches one at a time, like the REST routes that do
+  if isMutation(rq) {
+    h.srv.mutex.Lock()
+    defer h.srv.mutex.Unlock()
+  } else {
+    h.srv.mutex.RLock()
+    defer h.srv.mutex.RUnlock()
+  }
+  ctx := context.WithValue(r.Context(), graphQLLogKey, h.srv.requestLog(r.Header))
+  result := graphql.Do(graphql.Params{
+    Schema: h.schema,
+    RequestString: rq.Query,
+    VariableValues: rq.Variables,
+    OperationName: rq.OperationName,
+    Context: ctx,
+  })
+
+  w.Header().Set("Content-Type", "application/json")
+  err := json.NewEncoder(w).Encode(result)
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
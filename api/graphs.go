@@ -0,0 +1,62 @@
+package api
+
+import (
+  "bytes"
+  "net/http"
+  "strconv"
+  "github.com/rkbodenner/meeple_mover/graphviz"
+)
+
+// How graphs can be written, DOT by default
+var graphFormats = formats{
+  contentTypes: map[string]string{
+    "dot": "text/vnd.graphviz; charset=utf-8",
+    "svg": "image/svg+xml",
+  },
+  accepted: []string{"svg", "dot"},
+  fallback: "dot",
+  expected: "dot or svg",
+}
+
+func writeGraph(w http.ResponseWriter, r *http.Request, graph *graphviz.Graph) {
+  graphFormats.write(w, r, func(format string, buf *bytes.Buffer) error {
+    if "svg" == format {
+      return graph.SVG(buf)
+    }
+    return graph.DOT(buf)
+  })
+}
+
+type GameGraphHandler struct {
+  srv *Server
+}
+func (h GameGraphHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+  g, ok := h.srv.gameIndex[id]
+  if !ok {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+  writeGraph(w, r, graphviz.ForGame(g))
+}
+
+type SessionGraphHandler struct {
+  srv *Server
+}
+func (h SessionGraphHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id, err := strconv.ParseUint(r.URL.Query().Get("session_id"), 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+  s, ok := h.srv.sessionIndex[id]
+  if !ok {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+  writeGraph(w, r, graphviz.ForSession(s))
+}
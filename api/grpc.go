@@ -0,0 +1,326 @@
+package api
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "log/slog"
+  "net/http"
+  "strconv"
+  "time"
+  "github.com/rkbodenner/meeple_mover/meeplepb"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+  "google.golang.org/grpc"
+  "google.golang.org/grpc/codes"
+  "google.golang.org/grpc/metadata"
+  "google.golang.org/grpc/status"
+)
+
+func playerMessage(p *game.Player) *meeplepb.Player {
+  if nil == p {
+    return nil
+  }
+  return &meeplepb.Player{Id: (int64)(p.Id), Name: p.Name}
+}
+
+func ruleMessage(r *game.SetupRule) *meeplepb.Rule {
+  msg := &meeplepb.Rule{Id: (int64)(r.Id), Description: r.Description, Details: r.Details, Arity: r.Arity}
+  for _, dep := range r.Dependencies {
+    msg.DependencyIds = append(msg.DependencyIds, (int64)(dep.Id))
+  }
+  return msg
+}
+
+func gameMessage(g *game.Game) *meeplepb.Game {
+  msg := &meeplepb.Game{Id: (uint64)(g.Id), Name: g.Name, MinPlayers: (int32)(g.MinPlayers), MaxPlayers: (int32)(g.MaxPlayers)}
+  for _, rule := range g.SetupRules {
+    msg.Rules = append(msg.Rules, ruleMessage(rule))
+  }
+  return msg
+}
+
+func stepMessage(step *game.SetupStep) *meeplepb.Step {
+  if nil == step {
+    return nil
+  }
+  return &meeplepb.Step{Rule: ruleMessage(step.Rule), Owner: playerMessage(step.Owner), Done: step.Done}
+}
+
+// The message for a session, locking the caches while it's made
+func (srv *Server) readSessionMessage(s *session.Session) *meeplepb.Session {
+  srv.mutex.RLock()
+  defer srv.mutex.RUnlock()
+  return srv.sessionMessage(s)
+}
+
+func (srv *Server) sessionMessage(s *session.Session) *meeplepb.Session {
+  msg := &meeplepb.Session{Id: (uint64)(s.Id), Game: gameMessage(s.Game), Strategy: srv.strategy(s).Name(), Modules: srv.sessionModuleNames(s)}
+  for _, p := range s.Players {
+    msg.Players = append(msg.Players, playerMessage(p))
+  }
+  for _, step := range s.SetupSteps {
+    msg.Steps = append(msg.Steps, stepMessage(step))
+  }
+  for _, a := range assignments(s) {
+    msg.Assignments = append(msg.Assignments, &meeplepb.Assignment{Player: playerMessage(a.Player), Step: stepMessage(a.Step), Done: a.Done})
+  }
+  return msg
+}
+
+// Translate the errors the REST handlers respond with into gRPC statuses
+func grpcError(err error) error {
+  if nil == err {
+    return nil
+  }
+  var invalid *ValidationError
+  if errors.As(err, &invalid) {
+    return status.Error(codes.InvalidArgument, invalid.Error())
+  }
+  var statusErr *StatusError
+  if errors.As(err, &statusErr) && http.StatusNotFound == statusErr.Status {
+    return status.Error(codes.NotFound, statusErr.Message)
+  }
+  return status.Error(codes.Internal, err.Error())
+}
+
+// Like whenReady, for calls that read the caches of games and sessions
+func (srv *Server) grpcReady() error {
+  if !srv.startup.ready() {
+    return status.Error(codes.Unavailable, "Service is starting")
+  }
+  return nil
+}
+
+type grpcLogKey struct{}
+
+// The call's logger, which carries its request ID
+func (srv *Server) grpcLog(ctx context.Context) *slog.Logger {
+  if log, ok := ctx.Value(grpcLogKey{}).(*slog.Logger); ok {
+    return log
+  }
+  return srv.log
+}
+
+// Give the call a request ID, from its metadata if the client sent a valid one, as withRequestID does
+func (srv *Server) grpcRequestContext(ctx context.Context) context.Context {
+  id := ""
+  if md, ok := metadata.FromIncomingContext(ctx); ok {
+    if ids := md.Get(RequestIDHeader); len(ids) > 0 && validRequestID.MatchString(ids[0]) {
+      id = ids[0]
+    }
+  }
+  if "" == id {
+    id = newRequestID()
+  }
+  grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+  return context.WithValue(ctx, grpcLogKey{}, srv.log.With("request_id", id))
+}
+
+func (srv *Server) logCall(ctx context.Context, method string, start time.Time, err error) {
+  code := status.Code(err)
+  srv.grpcRequests.Inc(method, code.String())
+  srv.grpcLog(ctx).Info("gRPC call", "method", method, "code", code.String(), "duration", time.Since(start))
+}
+
+func (srv *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+  start := time.Now()
+  ctx = srv.grpcRequestContext(ctx)
+  resp, err := handler(ctx, req)
+  srv.logCall(ctx, info.FullMethod, start, err)
+  return resp, err
+}
+
+type loggedStream struct {
+  grpc.ServerStream
+  ctx context.Context
+}
+
+func (s *loggedStream) Context() context.Context {
+  return s.ctx
+}
+
+func (srv *Server) streamInterceptor(service interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+  start := time.Now()
+  ctx := srv.grpcRequestContext(ss.Context())
+  err := handler(service, &loggedStream{ss, ctx})
+  srv.logCall(ctx, info.FullMethod, start, err)
+  return err
+}
+
+// The gRPC service, which shares its logic with the REST handlers
+type MeepleMoverServer struct {
+  meeplepb.UnimplementedMeepleMoverServer
+  srv *Server
+}
+
+// A gRPC server for the same data as the HTTP routes, for the caller to Serve on a listener of its own
+func (srv *Server) GRPCServer() *grpc.Server {
+  g := grpc.NewServer(grpc.UnaryInterceptor(srv.unaryInterceptor), grpc.StreamInterceptor(srv.streamInterceptor))
+  meeplepb.RegisterMeepleMoverServer(g, &MeepleMoverServer{srv: srv})
+  return g
+}
+
+func (s *MeepleMoverServer) ListGames(ctx context.Context, rq *meeplepb.ListGamesRequest) (*meeplepb.ListGamesResponse, error) {
+  if err := s.srv.grpcReady(); nil != err {
+    return nil, err
+  }
+  s.srv.mutex.RLock()
+  defer s.srv.mutex.RUnlock()
+  resp := &meeplepb.ListGamesResponse{}
+  for _, g := range s.srv.games {
+    resp.Games = append(resp.Games, gameMessage(g))
+  }
+  return resp, nil
+}
+
+func (s *MeepleMoverServer) GetGame(ctx context.Context, rq *meeplepb.GetGameRequest) (*meeplepb.Game, error) {
+  if err := s.srv.grpcReady(); nil != err {
+    return nil, err
+  }
+  s.srv.mutex.RLock()
+  defer s.srv.mutex.RUnlock()
+  g, ok := s.srv.gameIndex[rq.Id]
+  if !ok {
+    return nil, status.Error(codes.NotFound, "Game not found")
+  }
+  return gameMessage(g), nil
+}
+
+func (s *MeepleMoverServer) ListPlayers(ctx context.Context, rq *meeplepb.ListPlayersRequest) (*meeplepb.ListPlayersResponse, error) {
+  players, err := s.srv.listPlayers()
+  if nil != err {
+    return nil, grpcError(err)
+  }
+  resp := &meeplepb.ListPlayersResponse{}
+  for _, p := range players {
+    resp.Players = append(resp.Players, playerMessage(p))
+  }
+  return resp, nil
+}
+
+func (s *MeepleMoverServer) GetPlayer(ctx context.Context, rq *meeplepb.GetPlayerRequest) (*meeplepb.Player, error) {
+  player, err := s.srv.findPlayer((int)(rq.Id))
+  if sql.ErrNoRows == err {
+    return nil, status.Error(codes.NotFound, "Player not found")
+  } else if nil != err {
+    return nil, grpcError(err)
+  }
+  return playerMessage(player), nil
+}
+
+func (s *MeepleMoverServer) CreatePlayer(ctx context.Context, rq *meeplepb.CreatePlayerRequest) (*meeplepb.Player, error) {
+  player := &game.Player{Name: rq.Name}
+  err := s.srv.createPlayer(s.srv.grpcLog(ctx), player)
+  if nil != err {
+    return nil, grpcError(err)
+  }
+  return playerMessage(player), nil
+}
+
+func (s *MeepleMoverServer) DeletePlayer(ctx context.Context, rq *meeplepb.DeletePlayerRequest) (*meeplepb.DeletePlayerResponse, error) {
+  err := s.srv.deletePlayer(s.srv.grpcLog(ctx), (int)(rq.Id))
+  if nil != err {
+    return nil, grpcError(err)
+  }
+  return &meeplepb.DeletePlayerResponse{}, nil
+}
+
+func (s *MeepleMoverServer) ListSessions(ctx context.Context, rq *meeplepb.ListSessionsRequest) (*meeplepb.ListSessionsResponse, error) {
+  if err := s.srv.grpcReady(); nil != err {
+    return nil, err
+  }
+  s.srv.mutex.RLock()
+  defer s.srv.mutex.RUnlock()
+  resp := &meeplepb.ListSessionsResponse{}
+  for _, cached := range s.srv.sessions {
+    resp.Sessions = append(resp.Sessions, s.srv.sessionMessage(cached))
+  }
+  return resp, nil
+}
+
+func (s *MeepleMoverServer) GetSession(ctx context.Context, rq *meeplepb.GetSessionRequest) (*meeplepb.Session, error) {
+  if err := s.srv.grpcReady(); nil != err {
+    return nil, err
+  }
+  s.srv.mutex.RLock()
+  defer s.srv.mutex.RUnlock()
+  cached, ok := s.srv.sessionIndex[rq.Id]
+  if !ok {
+    return nil, status.Error(codes.NotFound, "Session not found")
+  }
+  return s.srv.sessionMessage(cached), nil
+}
+
+func (s *MeepleMoverServer) CreateSession(ctx context.Context, rq *meeplepb.CreateSessionRequest) (*meeplepb.Session, error) {
+  if err := s.srv.grpcReady(); nil != err {
+    return nil, err
+  }
+  create := &SessionCreateRequest{}
+  create.Session.Game = strconv.FormatUint(rq.GameId, 10)
+  create.Session.StartedDate = rq.StartedDate
+  create.Session.Strategy = rq.Strategy
+  create.Session.Modules = rq.Modules
+  for _, id := range rq.PlayerIds {
+    create.Session.Players = append(create.Session.Players, strconv.FormatInt(id, 10))
+  }
+
+  s.srv.mutex.Lock()
+  defer s.srv.mutex.Unlock()
+  created, err := SessionCreateHandler{s.srv}.create(s.srv.grpcLog(ctx), create)
+  if nil != err {
+    return nil, grpcError(err)
+  }
+  return s.srv.sessionMessage(created), nil
+}
+
+func (s *MeepleMoverServer) FinishSteps(ctx context.Context, rq *meeplepb.FinishStepsRequest) (*meeplepb.Session, error) {
+  if err := s.srv.grpcReady(); nil != err {
+    return nil, err
+  }
+  batch := &StepBatchRequest{}
+  for _, action := range rq.Steps {
+    batch.Steps = append(batch.Steps, StepAction{PlayerId: strconv.FormatInt(action.PlayerId, 10), StepDesc: action.StepDesc, Action: action.Action})
+  }
+
+  s.srv.mutex.Lock()
+  defer s.srv.mutex.Unlock()
+  updated, err := StepBatchHandler{s.srv}.apply(s.srv.grpcLog(ctx), rq.SessionId, batch)
+  if nil != err {
+    return nil, grpcError(err)
+  }
+  return s.srv.sessionMessage(updated), nil
+}
+
+// Ends when the client cancels, or the server shuts down
+func (s *MeepleMoverServer) WatchSession(rq *meeplepb.WatchSessionRequest, stream meeplepb.MeepleMover_WatchSessionServer) error {
+  if err := s.srv.grpcReady(); nil != err {
+    return err
+  }
+  updates, stop := s.srv.updates.watch(rq.SessionId)
+  defer stop()
+
+  // Watch before reading the session, so that no change is missed in between
+  s.srv.mutex.RLock()
+  cached, ok := s.srv.sessionIndex[rq.SessionId]
+  s.srv.mutex.RUnlock()
+  if !ok {
+    return status.Error(codes.NotFound, "Session not found")
+  }
+  if err := stream.Send(s.srv.readSessionMessage(cached)); nil != err {
+    return err
+  }
+
+  for {
+    select {
+    case updated := <-updates:
+      if err := stream.Send(s.srv.readSessionMessage(updated)); nil != err {
+        return err
+      }
+    case <-stream.Context().Done():
+      return nil
+    case <-s.srv.shuttingDown:
+      return status.Error(codes.Unavailable, "Server is shutting down")
+    }
+  }
+}
@@ -0,0 +1,598 @@
+package api
+
+import (
+  "database/sql"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "log/slog"
+  "net/http"
+  "net/url"
+  "strconv"
+  "strings"
+  "time"
+  "github.com/rkbodenner/meeple_mover/assign"
+  "github.com/rkbodenner/meeple_mover/condition"
+  "github.com/rkbodenner/meeple_mover/expansion"
+  "github.com/rkbodenner/meeple_mover/quantity"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+func (srv *Server) loadGames() error {
+  var games []*game.Game
+  err := srv.timed("Games", func() error {
+    var err error
+    games, err = srv.store.Games()
+    return err
+  })
+  if nil != err {
+    return err
+  }
+  modules := make(map[uint64][]*expansion.Module)
+  for _, g := range games {
+    err := srv.timed("Modules", func() error {
+      var err error
+      modules[(uint64)(g.Id)], err = srv.store.Modules(g)
+      return err
+    })
+    if nil != err {
+      return err
+    }
+  }
+  var conditions map[int]*condition.Condition
+  err = srv.timed("Conditions", func() error {
+    var err error
+    conditions, err = srv.store.Conditions()
+    return err
+  })
+  if nil != err {
+    return err
+  }
+  var quantities map[int]quantity.Quantities
+  err = srv.timed("Quantities", func() error {
+    var err error
+    quantities, err = srv.store.Quantities()
+    return err
+  })
+  if nil != err {
+    return err
+  }
+  srv.mutex.Lock()
+  defer srv.mutex.Unlock()
+  srv.games = games
+  srv.modules = modules
+  srv.conditions = conditions
+  srv.quantities = quantities
+  srv.usefulPlayersMutex.Lock()
+  srv.usefulPlayers = make(map[uint64]int)
+  srv.usefulPlayersMutex.Unlock()
+
+  for _, game := range games {
+    srv.gameIndex[(uint64)(game.Id)] = game
+  }
+
+  srv.log.Info("Loaded games from DB", "count", len(games))
+  return nil
+}
+
+func (srv *Server) loadSessions() error {
+  var sessions []*session.Session
+  err := srv.timed("Sessions", func() error {
+    var err error
+    sessions, err = srv.store.Sessions()
+    return err
+  })
+  if nil != err {
+    return err
+  }
+  var names map[uint]string
+  err = srv.timed("SessionStrategies", func() error {
+    var err error
+    names, err = srv.store.SessionStrategies()
+    return err
+  })
+  if nil != err {
+    return err
+  }
+  var modules map[uint][]string
+  err = srv.timed("SessionModules", func() error {
+    var err error
+    modules, err = srv.store.SessionModules()
+    return err
+  })
+  if nil != err {
+    return err
+  }
+  srv.mutex.Lock()
+  defer srv.mutex.Unlock()
+  srv.sessions = sessions
+
+  // Update cache of sessions
+  for _, s := range sessions {
+    srv.sessionIndex[(uint64)(s.Id)] = s
+    strategy := assign.Lookup(names[s.Id])
+    if nil == strategy {
+      srv.log.Warn("Unknown assignment strategy; using the default", "session_id", s.Id, "strategy", names[s.Id])
+      strategy = assign.Default
+    }
+    srv.strategies[(uint64)(s.Id)] = strategy
+    if names, ok := modules[s.Id]; ok {
+      srv.sessionModules[(uint64)(s.Id)] = names
+    }
+  }
+
+  srv.log.Info("Loaded sessions from DB", "count", len(sessions))
+  return nil
+}
+
+
+type CollectionHandler struct {
+  srv *Server
+}
+func (h CollectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  err := json.NewEncoder(w).Encode(h.srv.games)
+  if ( nil != err ) {
+    fmt.Fprintln(w, err)
+  }
+}
+
+type GameHandler struct {
+  srv *Server
+}
+func (h GameHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id_str := r.URL.Query().Get("id")
+  id, err := strconv.ParseUint(id_str, 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+
+  game, ok := h.srv.gameIndex[id]
+  if ok {
+    err := json.NewEncoder(w).Encode(game)
+    if ( nil != err ) {
+      http.Error(w, "Error", http.StatusInternalServerError)
+    }
+  } else {
+    http.Error(w, "Not found", http.StatusNotFound)
+  }
+}
+
+func (srv *Server) listPlayers() ([]*game.Player, error) {
+  var players []*game.Player
+  err := srv.timed("Players", func() error {
+    var err error
+    players, err = srv.store.Players()
+    return err
+  })
+  return players, err
+}
+
+// Returns sql.ErrNoRows if there's no such player
+func (srv *Server) findPlayer(id int) (*game.Player, error) {
+  var player *game.Player
+  err := srv.timed("FindPlayer", func() error {
+    var err error
+    player, err = srv.store.FindPlayer(id)
+    return err
+  })
+  return player, err
+}
+
+// Sets the player's ID
+func (srv *Server) createPlayer(log *slog.Logger, player *game.Player) error {
+  err := srv.timed("CreatePlayer", func() error { return srv.store.CreatePlayer(player) })
+  if nil != err {
+    return errors.New("Could not create player in database")
+  }
+
+  log.Info("Created player", "player_id", player.Id, "name", player.Name)
+  return nil
+}
+
+func (srv *Server) deletePlayer(log *slog.Logger, id int) error {
+  err := srv.timed("DeletePlayer", func() error { return srv.store.DeletePlayer(id) })
+  if nil != err {
+    return errors.New("Could not delete player from database")
+  }
+
+  log.Info("Deleted player", "player_id", id)
+  return nil
+}
+
+type PlayersHandler struct {
+  srv *Server
+}
+func (h PlayersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  players, err := h.srv.listPlayers()
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+    return
+  }
+
+  err = json.NewEncoder(w).Encode(players)
+  if ( nil != err ) {
+    fmt.Fprintln(w, err)
+  }
+}
+
+type PlayerHandler struct {
+  srv *Server
+}
+func (h PlayerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  player_id_str := r.URL.Query().Get("player_id")
+  player_id, err := strconv.ParseUint(player_id_str, 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+
+  player, err := h.srv.findPlayer((int)(player_id))
+  if nil != err {
+    http.Error(w, "Player not found", http.StatusNotFound)
+    return
+  }
+
+  err = json.NewEncoder(w).Encode(player)
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
+
+type PlayerCreateRequest struct {
+  Player game.Player `json:"player"`
+}
+
+type PlayerCreateHandler struct {
+  srv *Server
+}
+func (handler PlayerCreateHandler) marshalFunc() (func(*url.URL, http.Header, *PlayerCreateRequest) (int, http.Header, *game.Player, error)) {
+  return func(u *url.URL, h http.Header, rq *PlayerCreateRequest) (int, http.Header, *game.Player, error) {
+    err := handler.srv.createPlayer(handler.srv.requestLog(h), &rq.Player)
+    if nil != err {
+      return http.StatusInternalServerError, nil, nil, err
+    }
+    return http.StatusCreated, nil, &rq.Player, nil
+  }
+}
+
+type PlayerDeleteHandler struct {
+  srv *Server
+}
+func (h PlayerDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  player_id_str := r.URL.Query().Get("player_id")
+  player_id, err := strconv.ParseUint(player_id_str, 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+
+  err = h.srv.deletePlayer(h.srv.requestLog(r.Header), (int)(player_id))
+  if nil != err {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+}
+
+
+type SessionsHandler struct {
+  srv *Server
+}
+func (h SessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  err := json.NewEncoder(w).Encode(h.srv.sessions)
+  if ( nil != err ) {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
+
+
+type SessionCreateHandler struct {
+  srv *Server
+}
+type SessionCreateHash struct {
+  StartedDate string `json:"started_date"`
+  Game string `json:"game"`
+  Players []string `json:"players"`
+  Strategy string `json:"strategy"`  // How to pick each player's next step. "first" if empty.
+  Modules []string `json:"modules"`  // Names of the game's expansions and variants to set it up with, applied in order
+}
+type SessionCreateRequest struct {
+  Session SessionCreateHash `json:"session"`
+}
+
+// Returned when a request is well-formed but its contents can't be acted on.
+// Every problem found is listed, so the client can fix them all at once.
+type ValidationError struct {
+  Problems []string
+}
+
+func (err *ValidationError) Add(format string, args ...interface{}) {
+  err.Problems = append(err.Problems, fmt.Sprintf(format, args...))
+}
+
+func (err *ValidationError) Any() bool {
+  return len(err.Problems) > 0
+}
+
+func (err *ValidationError) Error() string {
+  return strings.Join(err.Problems, "; ")
+}
+
+// Implements tigertonic.HTTPEquivError, which sets the status of the response
+func (err *ValidationError) StatusCode() int {
+  return http.StatusUnprocessableEntity
+}
+
+// Implements tigertonic.NamedError, which sets the "error" field of the response
+func (err *ValidationError) Name() string {
+  return "validation"
+}
+
+// An error that tigertonic responds to with the given status
+type StatusError struct {
+  Status int
+  Message string
+}
+
+func (err *StatusError) Error() string {
+  return err.Message
+}
+
+func (err *StatusError) StatusCode() int {
+  return err.Status
+}
+
+// Players that don't exist (including those that have been deleted) are reported as problems rather than errors
+func (srv *Server) fetchPlayersById(playerIds []int, problems *ValidationError) ([]*game.Player, error) {
+  players := make([]*game.Player, 0, len(playerIds))
+
+  for _, playerId := range playerIds {
+    player, err := srv.findPlayer(playerId)
+    if sql.ErrNoRows == err {
+      problems.Add("Unknown player %d", playerId)
+      continue
+    }
+    if err != nil {
+       return players, err
+    }
+    players = append(players, player)
+  }
+
+  return players, nil
+}
+
+var startedDateLayouts = []string{time.RFC3339, "2006-01-02"}
+
+func validateStartedDate(startedDate string, problems *ValidationError) {
+  if "" == startedDate {
+    return
+  }
+  for _, layout := range startedDateLayouts {
+    if _, err := time.Parse(layout, startedDate); nil == err {
+      return
+    }
+  }
+  problems.Add("Malformed started_date %q: expected a date like 2006-01-02 or 2006-01-02T15:04:05Z07:00", startedDate)
+}
+
+// Check the request against the game definition and the players in the database. Returns the game,
+// set up with the modules, and the players, strategy and modules to start a session with, or a
+// *ValidationError listing every problem found.
+func (handler SessionCreateHandler) validate(rq *SessionCreateRequest) (*game.Game, []*game.Player, assign.Strategy, []*expansion.Module, error) {
+  problems := &ValidationError{}
+
+  validateStartedDate(rq.Session.StartedDate, problems)
+
+  strategy := assign.Lookup(rq.Session.Strategy)
+  if nil == strategy {
+    problems.Add("Unknown strategy %q: expected one of %s", rq.Session.Strategy, strings.Join(assign.Names(), ", "))
+  }
+
+  var g *game.Game
+  game_id, err := strconv.ParseUint(rq.Session.Game, 10, 64)
+  if nil != err {
+    problems.Add("Expected integer game ID, got %q", rq.Session.Game)
+  } else {
+    var ok bool
+    g, ok = handler.srv.gameIndex[game_id]
+    if !ok {
+      problems.Add("Unknown game %d", game_id)
+    }
+  }
+
+  modules := make([]*expansion.Module, 0)
+  if nil != g {
+    for _, name := range rq.Session.Modules {
+      m := handler.srv.findModule(g, name)
+      if nil == m {
+        problems.Add("Unknown module %q of %s: expected one of %s", name, g.Name, strings.Join(handler.srv.moduleNames(g), ", "))
+        continue
+      }
+      modules = append(modules, m)
+    }
+    // Without the modules, the players would be checked against the base game's numbers, so leave them be
+    if len(modules) != len(rq.Session.Modules) {
+      g = nil
+    } else if withModules, err := expansion.Apply(g, modules); nil != err {
+      addSetupProblems(problems, err)
+      g = nil
+    } else {
+      g = withModules
+    }
+  }
+
+  player_ids := make([]int, 0)
+  seen := make(map[int]bool)
+  for _, player_id_str := range rq.Session.Players {
+    player_id, err := strconv.ParseInt(player_id_str, 10, 32)
+    if nil != err {
+      problems.Add("Expected integer player ID, got %q", player_id_str)
+      continue
+    }
+    if seen[(int)(player_id)] {
+      problems.Add("Duplicate player %d", player_id)
+      continue
+    }
+    seen[(int)(player_id)] = true
+    player_ids = append(player_ids, (int)(player_id))
+  }
+
+  if nil != g {
+    count := len(rq.Session.Players)
+    if count < g.MinPlayers || count > g.MaxPlayers {
+      problems.Add("%s needs %d to %d players, got %d", g.Name, g.MinPlayers, g.MaxPlayers, count)
+    } else if forPlayers, err := handler.srv.gameForPlayers(g, count); nil != err {
+      problems.Add("%s", err.Error())
+    } else {
+      g = forPlayers
+    }
+  }
+
+  players, err := handler.srv.fetchPlayersById(player_ids, problems)
+  if nil != err {
+    return nil, nil, nil, nil, err
+  }
+
+  if problems.Any() {
+    return nil, nil, nil, nil, problems
+  }
+  return g, players, strategy, modules, nil
+}
+
+func playerIds(players []*game.Player) []int {
+  ids := make([]int, len(players))
+  for i, player := range players {
+    ids[i] = player.Id
+  }
+  return ids
+}
+
+// Persist a new session, returning a *ValidationError if the request doesn't make sense
+func (handler SessionCreateHandler) create(log *slog.Logger, rq *SessionCreateRequest) (*session.Session, error) {
+  g, players, strategy, modules, err := handler.validate(rq)
+  if nil != err {
+    return nil, err
+  }
+
+  var _session *session.Session
+  _session, err = session.NewSession(g, players)
+  if nil != err {
+    return nil, err
+  }
+  assign.StepAllPlayers(strategy, _session)
+
+  srv := handler.srv
+  err = srv.timed("CreateSession", func() error { return srv.store.CreateSession(_session, strategy.Name(), modules) })
+  if nil != err {
+    return nil, err
+  }
+  names := make([]string, 0, len(modules))
+  for _, m := range modules {
+    names = append(names, m.Name)
+  }
+
+  srv.sessions = append(srv.sessions, _session)
+  srv.sessionIndex[(uint64)(_session.Id)] = _session
+  srv.strategies[(uint64)(_session.Id)] = strategy
+  if len(names) > 0 {
+    srv.sessionModules[(uint64)(_session.Id)] = names
+  }
+  srv.updates.publish(_session)
+
+  log = log.With("session_id", _session.Id)
+  log.Info("Created session", "game_id", _session.Game.Id, "player_ids", playerIds(players), "strategy", strategy.Name(), "modules", names)
+  for _,step := range _session.SetupSteps {
+    log.Debug("Created step", "step", _session.StepWithAssigneeString(step))
+  }
+  srv.queueWebhookEventOrLog(log, &WebhookEvent{Event: eventSessionCreated, SessionId: _session.Id, Session: _session})
+
+  return _session, nil
+}
+
+func (handler SessionCreateHandler) marshalFunc() (func(*url.URL, http.Header, *SessionCreateRequest) (int, http.Header, *session.Session, error)) {
+  return func(u *url.URL, h http.Header, rq *SessionCreateRequest) (int, http.Header, *session.Session, error) {
+    _session, err := handler.create(handler.srv.requestLog(h), rq)
+    if _, invalid := err.(*ValidationError); invalid {
+      return http.StatusUnprocessableEntity, nil, nil, err
+    } else if nil != err {
+      return http.StatusInternalServerError, nil, nil, err
+    }
+    return http.StatusCreated, nil, _session, nil
+  }
+}
+
+
+type SessionHandler struct {
+  srv *Server
+}
+func (h SessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id_str := r.URL.Query().Get("session_id")
+  id, err := strconv.ParseUint(id_str, 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+
+  session, ok := h.srv.sessionIndex[id]
+  if ok {
+    err := json.NewEncoder(w).Encode(session)
+    if ( nil != err ) {
+      http.Error(w, "Error", http.StatusInternalServerError)
+    }
+  } else {
+    http.Error(w, "Not found", http.StatusNotFound)
+  }
+}
+
+type StepHandler struct{
+  srv *Server
+}
+func (h StepHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  session_id_str := r.URL.Query().Get("session_id")
+  session_id, err := strconv.ParseUint(session_id_str, 10, 64)
+  if nil != err {
+    http.Error(w, "Session not found", http.StatusNotFound)
+    return
+  }
+  session,ok := h.srv.sessionIndex[session_id]
+  if !ok {
+    http.Error(w, "Session not found", http.StatusNotFound)
+    return
+  }
+
+  player_id_str := r.URL.Query().Get("player_id")
+  player_id, err := strconv.ParseUint(player_id_str, 10, 64)
+  if nil != err {
+    http.Error(w, "Player not found", http.StatusNotFound)
+    return
+  }
+  player := sessionPlayer(session, (int)(player_id))
+  if nil == player {
+    http.Error(w, "Player not found", http.StatusNotFound)
+    return
+  }
+
+  step_desc,err := url.QueryUnescape(r.URL.Query().Get("step_desc"))
+  if nil != err {
+    http.Error(w, "Step description is not properly escaped", http.StatusBadRequest)
+    return
+  }
+  step := findStep(session, player, step_desc)
+  if nil == step {
+    http.Error(w, "Step not found", http.StatusNotFound)
+    return
+  }
+  // A repeat, as when a client retries, changes nothing, and isn't reported or counted again
+  if step.Done {
+    return
+  }
+
+  // FIXME. Should look in request data to see what to change.
+  log := h.srv.requestLog(r.Header).With("session_id", session.Id, "player_id", player.Id)
+  err = h.srv.finishSteps(log, session, []*game.SetupStep{step})
+  if nil != err {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+}
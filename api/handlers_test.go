@@ -0,0 +1,609 @@
+package api
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "testing"
+  "time"
+  "github.com/rkbodenner/meeple_mover/record"
+)
+
+func serve(srv *Server, method string, path string, body string, header http.Header) *httptest.ResponseRecorder {
+  r := httptest.NewRequest(method, path, strings.NewReader(body))
+  r.Header.Set("Accept", "application/json")
+  if "" != body {
+    r.Header.Set("Content-Type", "application/json")
+  }
+  for name, values := range header {
+    r.Header[name] = values
+  }
+  w := httptest.NewRecorder()
+  srv.ServeHTTP(w, r)
+  return w
+}
+
+// Each route, served by a fresh server over the test store
+func TestServer_EveryRoute(t *testing.T) {
+  cases := []struct {
+    method string
+    pattern string
+    path string
+    body string
+    status int
+    contains string
+  }{
+    {"GET", "/games", "/games", "", http.StatusOK, `"Test"`},
+    {"GET", "/games/{id}", "/games/1", "", http.StatusOK, `"Lay out the board"`},
+    {"GET", "/games/{id}/checklist", "/games/1/checklist?players=2", "", http.StatusOK, "Place pawn"},
+    {"GET", "/games/{id}/analysis", "/games/1/analysis?players=2", "", http.StatusOK, `"critical_path":["Lay out the board","Place pawn"]`},
+    {"GET", "/games/{id}/graph", "/games/1/graph", "", http.StatusOK, "rule1 -> rule2;"},
+    {"GET", "/games/{id}/modules", "/games/1/modules", "", http.StatusOK, `"Place {tokens} tokens"`},
+    {"POST", "/games/{id}/modules", "/games/1/modules", `{"module":{"name":"Solo","kind":"variant","max_players":1,"removes":["Place pawn"]}}`, http.StatusCreated, `"removes":["Place pawn"]`},
+    {"GET", "/games/{id}/conditions", "/games/1/conditions", "", http.StatusOK, `"description":"at least 2 players"`},
+    {"PUT", "/games/{id}/rules/{rule_id}/condition", "/games/1/rules/2/condition", `{"condition":{"expression":"players != 1"}}`, http.StatusOK, `"expression":"players != 1"`},
+    {"GET", "/games/{id}/quantities", "/games/1/quantities", "", http.StatusOK, `"quantities":{"tokens":{"*":"6","2":"8"}}`},
+    {"PUT", "/games/{id}/rules/{rule_id}/quantities", "/games/1/rules/3/quantities", `{"quantities":{"tokens":{"*":"5"}}}`, http.StatusOK, `"tokens":{"*":"5"}`},
+    {"GET", "/players", "/players", "", http.StatusOK, `"Bob"`},
+    {"GET", "/players/{player_id}", "/players/2", "", http.StatusOK, `"Bob"`},
+    {"POST", "/players", "/players", `{"player":{"Name":"Carol"}}`, http.StatusCreated, `"Carol"`},
+    {"DELETE", "/players/{player_id}", "/players/2", "", http.StatusOK, ""},
+    {"GET", "/sessions", "/sessions", "", http.StatusOK, `"Alice"`},
+    {"POST", "/sessions", "/sessions", `{"session":{"game":"1","players":["1","2"]}}`, http.StatusCreated, `"Place pawn"`},
+    {"GET", "/sessions/{session_id}", "/sessions/1", "", http.StatusOK, `"Lay out the board"`},
+    {"GET", "/sessions/{session_id}/checklist", "/sessions/1/checklist", "", http.StatusOK, "Alice"},
+    {"GET", "/sessions/{session_id}/analysis", "/sessions/1/analysis", "", http.StatusOK, `"waiting":2`},
+    {"GET", "/sessions/{session_id}/graph", "/sessions/1/graph", "", http.StatusOK, "assigned to Alice"},
+    {"GET", "/sessions/{session_id}/updates", "/sessions/1/updates", "", http.StatusOK, `data: {"session_id":1}`},
+    {"PUT", "/sessions/{session_id}/players/{player_id}/steps/{step_desc}", "/sessions/1/players/1/steps/Lay%20out%20the%20board", "", http.StatusOK, ""},
+    {"POST", "/sessions/{session_id}/steps:batch", "/sessions/1/steps:batch", `{"steps":[{"player_id":"1","step_desc":"Lay out the board"}]}`, http.StatusOK, `"assignments"`},
+    {"GET", "/graphql", "/graphql?query={games{name}}", "", http.StatusOK, `"Test"`},
+    {"POST", "/graphql", "/graphql", `{"query":"{ session(id: 1) { players { name } } }"}`, http.StatusOK, `"Alice"`},
+    {"GET", "/webhooks", "/webhooks", "", http.StatusOK, `"https://example.com/hook"`},
+    {"POST", "/webhooks", "/webhooks", `{"webhook":{"url":"https://example.com/other","events":["setup.completed"]}}`, http.StatusCreated, `"secret"`},
+    {"GET", "/webhooks/{webhook_id}", "/webhooks/1", "", http.StatusOK, `"https://example.com/hook"`},
+    {"DELETE", "/webhooks/{webhook_id}", "/webhooks/1", "", http.StatusOK, ""},
+    {"GET", "/webhooks/{webhook_id}/deliveries", "/webhooks/1/deliveries", "", http.StatusOK, "[]"},
+    {"GET", "/openapi.json", "/openapi.json", "", http.StatusOK, `"/sessions/{session_id}"`},
+    {"GET", "/healthz", "/healthz", "", http.StatusOK, `"alive"`},
+    {"GET", "/readyz", "/readyz", "", http.StatusOK, `"ready":true`},
+    {"GET", "/metrics", "/metrics", "", http.StatusOK, "meeple_mover_http_requests_total"},
+  }
+
+  srv, _ := newTestServer(t)
+  tested := make(map[string]bool)
+  for _, c := range cases {
+    tested[c.method + " " + c.pattern] = true
+  }
+  for _, rt := range srv.routes() {
+    if !tested[rt.method + " " + rt.pattern] {
+      t.Errorf("Route %s %s is not tested", rt.method, rt.pattern)
+    }
+  }
+
+  for _, c := range cases {
+    srv, _ := newTestServer(t)
+    if strings.HasSuffix(c.pattern, "/updates") {
+      srv.Close()  // So that the stream ends after its first event
+    }
+    w := serve(srv, c.method, c.path, c.body, nil)
+    if w.Code != c.status {
+      t.Errorf("%s %s: expected %d, got %d: %s", c.method, c.path, c.status, w.Code, w.Body.String())
+      continue
+    }
+    if !strings.Contains(w.Body.String(), c.contains) {
+      t.Errorf("%s %s: expected response to contain %s, got %s", c.method, c.path, c.contains, w.Body.String())
+    }
+  }
+}
+
+func TestServer_NotFound(t *testing.T) {
+  srv, _ := newTestServer(t)
+  for _, path := range []string{"/games/7", "/games/7/analysis", "/games/7/graph", "/games/7/modules", "/games/7/conditions", "/games/7/quantities", "/players/7", "/sessions/7", "/sessions/7/analysis", "/sessions/7/graph", "/sessions/1/players/7/steps/Place%20pawn", "/webhooks/7"} {
+    method := "GET"
+    if strings.Contains(path, "/steps/") {
+      method = "PUT"
+    }
+    if w := serve(srv, method, path, "", nil); w.Code != http.StatusNotFound {
+      t.Errorf("Expected 404 for %s, got %d", path, w.Code)
+    }
+  }
+}
+
+func TestServer_StepsQueueWebhookEvents(t *testing.T) {
+  srv, store := newTestServer(t)
+  w := serve(srv, "POST", "/sessions/1/steps:batch", `{"steps":[{"player_id":"1","step_desc":"Lay out the board"}]}`, nil)
+  if w.Code != http.StatusOK {
+    t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+  }
+  if len(store.deliveries) != 1 || eventStepFinished != store.deliveries[0].Event {
+    t.Fatalf("Expected a delivery of the finished step, got %v", store.deliveries)
+  }
+
+  w = serve(srv, "POST", "/sessions/1/steps:batch", `{"steps":[{"player_id":"1","step_desc":"Place pawn"},{"player_id":"2","step_desc":"Place pawn"}]}`, nil)
+  if w.Code != http.StatusOK {
+    t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+  }
+  events := make(map[string]int)
+  for _, delivery := range store.deliveries {
+    events[delivery.Event]++
+  }
+  if events[eventStepFinished] != 3 || events[eventPlayerDone] != 2 || events[eventSetupCompleted] != 1 {
+    t.Errorf("Expected every step, both players and the setup to be reported, got %v", events)
+  }
+}
+
+// Finishing a step again, as a retry does, neither reports nor counts it again
+func TestServer_StepRepeated(t *testing.T) {
+  srv, store := newTestServer(t)
+  for i := 0; i < 2; i++ {
+    if w := serve(srv, "PUT", "/sessions/1/players/1/steps/Lay%20out%20the%20board", "", nil); w.Code != http.StatusOK {
+      t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+    }
+  }
+  if len(store.deliveries) != 1 || 1 != srv.stepsFinished.Value() {
+    t.Errorf("Expected the step to be finished once, got %v and %v finished", store.deliveries, srv.stepsFinished.Value())
+  }
+
+  if w := serve(srv, "PUT", "/sessions/1/players/1/steps/50%25ZZ", "", nil); w.Code != http.StatusBadRequest {
+    t.Errorf("Expected 400 for a badly escaped step, got %d: %s", w.Code, w.Body.String())
+  }
+}
+
+func TestServer_Idempotent(t *testing.T) {
+  srv, store := newTestServer(t)
+  header := http.Header{IdempotencyKeyHeader: []string{"carol-1"}}
+  first := serve(srv, "POST", "/players", `{"player":{"Name":"Carol"}}`, header)
+  second := serve(srv, "POST", "/players", `{"player":{"Name":"Carol"}}`, header)
+  if first.Code != http.StatusCreated || second.Code != http.StatusCreated {
+    t.Fatalf("Expected both to respond 201, got %d and %d", first.Code, second.Code)
+  }
+  if "true" != second.Header().Get("Idempotent-Replayed") || first.Body.String() != second.Body.String() {
+    t.Error("Expected the first response to be replayed")
+  }
+  if len(store.players) != 3 {
+    t.Errorf("Expected Carol to be created once, got %d players", len(store.players))
+  }
+
+  w := serve(srv, "POST", "/players", `{"player":{"Name":"Dave"}}`, header)
+  if w.Code != http.StatusUnprocessableEntity {
+    t.Errorf("Expected a different body with the same key to be refused, got %d", w.Code)
+  }
+
+  // Reserved by a request that never finished
+  body := `{"player":{"Name":"Erin"}}`
+  store.keys["erin-1"] = &record.IdempotencyKeyRecord{Key: "erin-1", Fingerprint: fingerprint("POST", "/players", []byte(body)), CreatedAt: time.Now()}
+  header = http.Header{IdempotencyKeyHeader: []string{"erin-1"}}
+  if w := serve(srv, "POST", "/players", body, header); w.Code != http.StatusConflict {
+    t.Errorf("Expected 409 while the first request may still be served, got %d", w.Code)
+  }
+  store.keys["erin-1"].CreatedAt = time.Now().Add(-time.Minute)
+  if w := serve(srv, "POST", "/players", body, header); w.Code != http.StatusCreated {
+    t.Errorf("Expected the abandoned key to be taken over, got %d: %s", w.Code, w.Body.String())
+  }
+}
+
+func TestServer_StoreDown(t *testing.T) {
+  store := newMemStore()
+  store.err = errors.New("connection refused")
+  srv := New(store, testLog, Config{})
+
+  if w := serve(srv, "GET", "/games", "", nil); w.Code != http.StatusServiceUnavailable {
+    t.Errorf("Expected 503 before games are loaded, got %d", w.Code)
+  }
+  w := serve(srv, "GET", "/readyz", "", nil)
+  if w.Code != http.StatusServiceUnavailable {
+    t.Fatalf("Expected 503, got %d", w.Code)
+  }
+  var status ReadinessStatus
+  if err := json.NewDecoder(w.Body).Decode(&status); nil != err {
+    t.Fatal(err)
+  }
+  if status.Checks["database"].OK || "connection refused" != status.Checks["database"].Detail {
+    t.Errorf("Expected the database check to fail with the store's error, got %+v", status.Checks["database"])
+  }
+  if w := serve(srv, "GET", "/players", "", nil); w.Code != http.StatusInternalServerError {
+    t.Errorf("Expected 500 listing players, got %d", w.Code)
+  }
+}
+
+func TestSessionCreateHandler_Validate(t *testing.T) {
+  cases := []struct {
+    name string
+    body string
+    problems []string
+  }{
+    {"unknown game", `{"session":{"game":"7","players":["1","2"]}}`, []string{"Unknown game 7"}},
+    {"game ID", `{"session":{"game":"one","players":["1","2"]}}`, []string{`Expected integer game ID, got \"one\"`}},
+    {"unknown player", `{"session":{"game":"1","players":["1","9"]}}`, []string{"Unknown player 9"}},
+    {"deleted player", `{"session":{"game":"1","players":["1","2"]}}`, []string{"Unknown player 2"}},
+    {"duplicate player", `{"session":{"game":"1","players":["1","2","1"]}}`, []string{"Duplicate player 1"}},
+    {"too few players", `{"session":{"game":"1","players":[]}}`, []string{"Test needs 1 to 4 players, got 0"}},
+    {"too many players", `{"session":{"game":"1","players":["1","2","3","4","5"]}}`,
+      []string{"Test needs 1 to 4 players, got 5", "Unknown player 3", "Unknown player 4", "Unknown player 5"}},
+    {"started date", `{"session":{"game":"1","players":["1","2"],"started_date":"last Tuesday"}}`, []string{`Malformed started_date \"last Tuesday\"`}},
+    {"several", `{"session":{"game":"7","players":["1","1","x"],"started_date":"soon","strategy":"random"}}`,
+      []string{`Malformed started_date \"soon\"`, `Unknown strategy \"random\"`, "Unknown game 7", "Duplicate player 1", `Expected integer player ID, got \"x\"`}},
+  }
+  for _, c := range cases {
+    srv, _ := newTestServer(t)
+    if "deleted player" == c.name {
+      serve(srv, "DELETE", "/players/2", "", nil)
+    }
+    w := serve(srv, "POST", "/sessions", c.body, nil)
+    if w.Code != http.StatusUnprocessableEntity {
+      t.Errorf("%s: expected 422, got %d: %s", c.name, w.Code, w.Body.String())
+      continue
+    }
+    described := struct {
+      Description string `json:"description"`
+    }{}
+    json.Unmarshal(w.Body.Bytes(), &described)
+    if len(strings.Split(described.Description, "; ")) != len(c.problems) {
+      t.Errorf("%s: expected %d problems, got %s", c.name, len(c.problems), w.Body.String())
+    }
+    for _, problem := range c.problems {
+      if !strings.Contains(w.Body.String(), problem) {
+        t.Errorf("%s: expected %s, got %s", c.name, problem, w.Body.String())
+      }
+    }
+  }
+
+  srv, _ := newTestServer(t)
+  w := serve(srv, "POST", "/sessions", `{"session":{"game":"1","players":["2","1"],"started_date":"2024-03-01"}}`, nil)
+  if w.Code != http.StatusCreated {
+    t.Errorf("Expected a valid session to be created, got %d: %s", w.Code, w.Body.String())
+  }
+}
+
+func TestServer_SessionStrategy(t *testing.T) {
+  srv, store := newTestServer(t)
+  w := serve(srv, "POST", "/sessions", `{"session":{"game":"1","players":["1","2"],"strategy":"unblocking"}}`, nil)
+  if w.Code != http.StatusCreated {
+    t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+  }
+  created := srv.sessions[len(srv.sessions) - 1]
+  if "unblocking" != store.strategies[created.Id] || "unblocking" != srv.strategy(created).Name() {
+    t.Errorf("Expected the session to use and store its strategy, got %q", store.strategies[created.Id])
+  }
+
+  w = serve(srv, "POST", "/sessions", `{"session":{"game":"1","players":["1","2"],"strategy":"random"}}`, nil)
+  if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `Unknown strategy \"random\"`) {
+    t.Errorf("Expected an unknown strategy to be refused, got %d: %s", w.Code, w.Body.String())
+  }
+
+  // Sessions are stepped by their stored strategy once loaded again, or by the default if it's gone
+  store.strategies[1] = "balanced"
+  store.strategies[created.Id] = "retired"
+  reloaded := New(store, testLog, Config{})
+  reloaded.Load()
+  if "balanced" != reloaded.strategy(reloaded.sessionIndex[1]).Name() {
+    t.Error("Expected session 1 to be balanced")
+  }
+  if "first" != reloaded.strategy(reloaded.sessionIndex[(uint64)(created.Id)]).Name() {
+    t.Error("Expected the default for a strategy that's no longer registered")
+  }
+
+  w = serve(reloaded, "POST", "/graphql", `{"query":"{ session(id: 1) { strategy } }"}`, nil)
+  if !strings.Contains(w.Body.String(), `"strategy":"balanced"`) {
+    t.Errorf("Expected GraphQL to show the strategy, got %s", w.Body.String())
+  }
+}
+
+func TestServer_SessionModules(t *testing.T) {
+  srv, store := newTestServer(t)
+  w := serve(srv, "POST", "/sessions", `{"session":{"game":"1","players":["1","2"],"modules":["Tokens"]}}`, nil)
+  if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"Place 8 tokens"`) {
+    t.Fatalf("Expected the session to be set up with the module's rules, got %d: %s", w.Code, w.Body.String())
+  }
+  created := srv.sessions[len(srv.sessions) - 1]
+  if names := store.sessionModules[created.Id]; 1 != len(names) || "Tokens" != names[0] {
+    t.Errorf("Expected the session's modules to be stored, got %v", names)
+  }
+  if 2 != len(srv.gameIndex[1].SetupRules) {
+    t.Error("Expected the game itself to be left as it was")
+  }
+
+  w = serve(srv, "POST", "/sessions", `{"session":{"game":"1","players":["1","2"],"modules":["Tokens","Dragons"]}}`, nil)
+  if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `Unknown module \"Dragons\"`) {
+    t.Errorf("Expected an unknown module to be refused, got %d: %s", w.Code, w.Body.String())
+  }
+
+  // Players aren't checked against the base game when the modules can't be applied
+  serve(srv, "POST", "/games/1/modules", `{"module":{"name":"Crowd","kind":"variant","max_players":5}}`, nil)
+  w = serve(srv, "POST", "/sessions", `{"session":{"game":"1","players":["1","2","3","4","5"],"modules":["Crowd","Crowd"]}}`, nil)
+  if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "chosen twice") || strings.Contains(w.Body.String(), "needs") {
+    t.Errorf("Expected only the modules to be refused, got %d: %s", w.Code, w.Body.String())
+  }
+
+  // A variant for fewer players than are given
+  serve(srv, "POST", "/games/1/modules", `{"module":{"name":"Solo","kind":"variant","max_players":1}}`, nil)
+  w = serve(srv, "POST", "/sessions", `{"session":{"game":"1","players":["1","2"],"modules":["Solo"]}}`, nil)
+  if w.Code != http.StatusUnprocessableEntity {
+    t.Errorf("Expected too many players for the variant to be refused, got %d: %s", w.Code, w.Body.String())
+  }
+
+  reloaded := New(store, testLog, Config{})
+  reloaded.Load()
+  query := fmt.Sprintf(`{"query":"{ session(id: %d) { modules } game(id: 1) { modules { name } } }"}`, created.Id)
+  w = serve(reloaded, "POST", "/graphql", query, nil)
+  if !strings.Contains(w.Body.String(), `"modules":["Tokens"]`) || !strings.Contains(w.Body.String(), `"name":"Solo"`) {
+    t.Errorf("Expected GraphQL to show the modules, got %s", w.Body.String())
+  }
+}
+
+func TestServer_SessionConditions(t *testing.T) {
+  srv, store := newTestServer(t)
+  w := serve(srv, "PUT", "/games/1/rules/1/condition", `{"condition":{"min_players":2}}`, nil)
+  if w.Code != http.StatusOK {
+    t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+  }
+  if c, ok := store.conditions[1]; !ok || 2 != c.MinPlayers {
+    t.Errorf("Expected the condition to be stored, got %v", c)
+  }
+
+  // Alone, Alice places her pawn without laying out the board
+  w = serve(srv, "POST", "/sessions", `{"session":{"game":"1","players":["1"]}}`, nil)
+  if w.Code != http.StatusCreated || strings.Contains(w.Body.String(), "Lay out the board") {
+    t.Fatalf("Expected the session to be set up without the board, got %d: %s", w.Code, w.Body.String())
+  }
+  created := srv.sessions[len(srv.sessions) - 1]
+  if 1 != len(created.SetupSteps) || 0 != len(created.SetupSteps[0].Rule.Dependencies) {
+    t.Errorf("Expected only the pawn, waiting for nothing, got %v", created.SetupSteps)
+  }
+  if w := serve(srv, "GET", "/games/1/checklist?players=1", "", nil); strings.Contains(w.Body.String(), "Lay out the board") {
+    t.Errorf("Expected the checklist for 1 player to leave out the board, got %s", w.Body.String())
+  }
+  if w := serve(srv, "GET", "/games/1/checklist?players=2", "", nil); !strings.Contains(w.Body.String(), "Lay out the board") {
+    t.Errorf("Expected the checklist for 2 players to have the board, got %s", w.Body.String())
+  }
+
+  w = serve(srv, "POST", "/graphql", `{"query":"{ game(id: 1) { rules { condition { minPlayers description } } } }"}`, nil)
+  if !strings.Contains(w.Body.String(), `"description":"at least 2 players"`) || !strings.Contains(w.Body.String(), `"condition":null`) {
+    t.Errorf("Expected GraphQL to show the conditions, got %s", w.Body.String())
+  }
+
+  // An empty condition clears it
+  serve(srv, "PUT", "/games/1/rules/1/condition", `{"condition":{}}`, nil)
+  if _, ok := srv.conditions[1]; ok {
+    t.Error("Expected the condition to be cleared")
+  }
+  if _, ok := store.conditions[1]; ok {
+    t.Error("Expected the stored condition to be cleared")
+  }
+}
+
+func TestConditionUpdateHandler_Validate(t *testing.T) {
+  srv, _ := newTestServer(t)
+  cases := []struct {
+    path string
+    body string
+    status int
+    problem string
+  }{
+    {"/games/1/rules/1/condition", `{"condition":{"expression":"players = 2"}}`, http.StatusUnprocessableEntity, `Unexpected '='`},
+    {"/games/1/rules/1/condition", `{"condition":{"min_players":3,"max_players":2}}`, http.StatusUnprocessableEntity, "at most the maximum"},
+    {"/games/1/rules/1/condition", `{"condition":{"expression":"4 / (players - 3) > 1"}}`, http.StatusUnprocessableEntity, "Division by zero for 3 players"},
+    {"/games/1/rules/99/condition", `{"condition":{"min_players":2}}`, http.StatusNotFound, "Rule not found"},
+    {"/games/7/rules/1/condition", `{"condition":{"min_players":2}}`, http.StatusNotFound, "Game not found"},
+  }
+  for _, c := range cases {
+    w := serve(srv, "PUT", c.path, c.body, nil)
+    if w.Code != c.status || !strings.Contains(w.Body.String(), c.problem) {
+      t.Errorf("%s %s: expected %d with %s, got %d: %s", c.path, c.body, c.status, c.problem, w.Code, w.Body.String())
+    }
+  }
+  if _, ok := srv.conditions[1]; ok {
+    t.Error("Expected no invalid condition to be kept")
+  }
+
+  // Only checked for the numbers of players the game is for
+  srv.gameIndex[1].MinPlayers = 2
+  if w := serve(srv, "PUT", "/games/1/rules/1/condition", `{"condition":{"expression":"4 / (players - 1) > 1"}}`, nil); w.Code != http.StatusOK {
+    t.Errorf("Expected a condition that can't be evaluated for 1 player to be kept, got %d: %s", w.Code, w.Body.String())
+  }
+  srv.gameIndex[1].MaxPlayers = 0
+  if w := serve(srv, "PUT", "/games/1/rules/1/condition", `{"condition":{"min_players":2}}`, nil); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "no maximum") {
+    t.Errorf("Expected a condition to be refused for a game without a maximum, got %d: %s", w.Code, w.Body.String())
+  }
+  if w := serve(srv, "PUT", "/games/1/rules/3/quantities", `{"quantities":{"tokens":{"*":"6"}}}`, nil); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "no maximum") {
+    t.Errorf("Expected quantities to be refused for a game without a maximum, got %d: %s", w.Code, w.Body.String())
+  }
+}
+
+func TestServer_SessionQuantities(t *testing.T) {
+  srv, store := newTestServer(t)
+  w := serve(srv, "PUT", "/games/1/rules/3/quantities", `{"quantities":{"tokens":{"2":"10","*":"5"}}}`, nil)
+  if w.Code != http.StatusOK {
+    t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+  }
+  if q, ok := store.quantities[3]; !ok || "10" != q["tokens"][2] || "5" != q["tokens"][0] {
+    t.Errorf("Expected the quantities to be stored, got %v", q)
+  }
+
+  w = serve(srv, "POST", "/sessions", `{"session":{"game":"1","players":["1","2"],"modules":["Tokens"]}}`, nil)
+  if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"Place 10 tokens"`) {
+    t.Fatalf("Expected the session to place 10 tokens, got %d: %s", w.Code, w.Body.String())
+  }
+  created := srv.sessions[len(srv.sessions) - 1]
+
+  // Sessions already set up keep their text
+  serve(srv, "PUT", "/games/1/rules/3/quantities", `{"quantities":{}}`, nil)
+  if _, ok := srv.quantities[3]; ok {
+    t.Error("Expected the quantities to be cleared")
+  }
+  w = serve(srv, "GET", fmt.Sprintf("/sessions/%d", created.Id), "", nil)
+  if !strings.Contains(w.Body.String(), `"Place 10 tokens"`) {
+    t.Errorf("Expected the session to keep its text, got %s", w.Body.String())
+  }
+}
+
+func TestQuantitiesUpdateHandler_Validate(t *testing.T) {
+  srv, _ := newTestServer(t)
+  cases := []struct {
+    path string
+    body string
+    status int
+    problem string
+  }{
+    {"/games/1/rules/3/quantities", `{"quantities":{"tokens":{"2":"8"}}}`, http.StatusUnprocessableEntity, "{tokens} has no value for 1, 3, 4 players"},
+    {"/games/1/rules/3/quantities", `{"quantities":{"tokens":{"*":"6"},"cubes":{"*":"2"}}}`, http.StatusUnprocessableEntity, "{cubes} isn't in the rule's description or details"},
+    {"/games/1/rules/3/quantities", `{"quantities":{"tokens":{"two":"8","*":"6"}}}`, http.StatusUnprocessableEntity, `or * for any other, got \"two\"`},
+    {"/games/1/rules/3/quantities", `{"quantities":{"my tokens":{"*":"6"}}}`, http.StatusUnprocessableEntity, "should be letters, digits and underscores"},
+    {"/games/1/rules/99/quantities", `{"quantities":{}}`, http.StatusNotFound, "Rule not found"},
+    {"/games/7/rules/3/quantities", `{"quantities":{}}`, http.StatusNotFound, "Game not found"},
+  }
+  for _, c := range cases {
+    w := serve(srv, "PUT", c.path, c.body, nil)
+    if w.Code != c.status || !strings.Contains(w.Body.String(), c.problem) {
+      t.Errorf("%s %s: expected %d with %s, got %d: %s", c.path, c.body, c.status, c.problem, w.Code, w.Body.String())
+    }
+  }
+  if "8" != srv.quantities[3]["tokens"][2] {
+    t.Error("Expected no invalid quantities to be kept")
+  }
+}
+
+func TestModuleCreateHandler_Validate(t *testing.T) {
+  srv, _ := newTestServer(t)
+  cases := []struct {
+    body string
+    problem string
+  }{
+    {`{"module":{"name":" "}}`, "Expected a name"},
+    {`{"module":{"name":"Tokens"}}`, `Test already has a module named \"Tokens\"`},
+    {`{"module":{"name":"New","kind":"house rule"}}`, `Unknown kind \"house rule\"`},
+    {`{"module":{"name":"New","min_players":3,"max_players":2}}`, "Expected min_players to be at most max_players"},
+    {`{"module":{"name":"New","rules":[{"description":"Roll"},{"description":"Roll"}]}}`, `Rule \"Roll\" is given twice`},
+    {`{"module":{"name":"New","rules":[{"description":"Roll","after":["Shuffle"]}]}}`, `\"Roll\" depends on \"Shuffle\"`},
+    {`{"module":{"name":"New","removes":["Shuffle"]}}`, `Can't remove \"Shuffle\"`},
+    {`{"module":{"name":"New","replaces":[{"rule":"Place pawn","with":"Roll"}]}}`, `which isn't one of the module's rules`},
+    {`{"module":{"name":"New","rules":[{"description":"Place pawn"}]}}`, "Place pawn"},
+  }
+  for _, c := range cases {
+    w := serve(srv, "POST", "/games/1/modules", c.body, nil)
+    if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), c.problem) {
+      t.Errorf("%s: expected 422 with %s, got %d: %s", c.body, c.problem, w.Code, w.Body.String())
+    }
+  }
+  if 1 != len(srv.modules[1]) {
+    t.Errorf("Expected no invalid module to be kept, got %d modules", len(srv.modules[1]))
+  }
+}
+
+func TestServer_GameAnalysisPlayers(t *testing.T) {
+  srv, _ := newTestServer(t)
+  for _, players := range []string{"0", "5", "two"} {
+    if w := serve(srv, "GET", "/games/1/analysis?players=" + players, "", nil); w.Code != http.StatusBadRequest {
+      t.Errorf("Expected 400 for %s players, got %d", players, w.Code)
+    }
+  }
+}
+
+// How many players are useful is worked out once, until the game's conditions change
+func TestServer_GameAnalysisUsefulPlayers(t *testing.T) {
+  srv, _ := newTestServer(t)
+  w := serve(srv, "GET", "/games/1/analysis?players=2", "", nil)
+  if !strings.Contains(w.Body.String(), `"max_useful_players":1`) {
+    t.Errorf("Expected one useful player, got %s", w.Body.String())
+  }
+  if useful, ok := srv.usefulPlayers[1]; !ok || 1 != useful {
+    t.Errorf("Expected one useful player to be kept, got %v", srv.usefulPlayers)
+  }
+
+  serve(srv, "PUT", "/games/1/rules/2/condition", `{"condition":{"expression":"players != 1"}}`, nil)
+  if _, ok := srv.usefulPlayers[1]; ok {
+    t.Error("Expected useful players to be forgotten when a condition changes")
+  }
+}
+
+func TestServer_GraphFormat(t *testing.T) {
+  srv, _ := newTestServer(t)
+  w := serve(srv, "GET", "/sessions/1/graph", "", http.Header{"Accept": {"image/svg+xml"}})
+  if "image/svg+xml" != w.Header().Get("Content-Type") || !strings.HasPrefix(w.Body.String(), "<svg ") {
+    t.Errorf("Expected SVG, got %s: %s", w.Header().Get("Content-Type"), w.Body.String())
+  }
+  if w := serve(srv, "GET", "/games/1/graph?format=png", "", nil); w.Code != http.StatusBadRequest {
+    t.Errorf("Expected 400 for an unknown format, got %d", w.Code)
+  }
+}
+
+// Formats chosen by the Accept header vary by it, as well as by what middleware like CORS varies by
+func TestServer_VaryAccept(t *testing.T) {
+  srv, _ := newTestServer(t)
+  for _, path := range []string{"/games/1/checklist?players=2", "/sessions/1/checklist", "/games/1/graph", "/sessions/1/graph"} {
+    w := httptest.NewRecorder()
+    w.Header().Add("Vary", "Origin")
+    srv.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+    if vary := strings.Join(w.Header().Values("Vary"), ", "); "Origin, Accept" != vary {
+      t.Errorf("%s: expected to vary by Origin and Accept, got %q", path, vary)
+    }
+  }
+}
+
+// Run with -race. Changes are made one at a time, while reads see the caches between them.
+func TestServer_Concurrent(t *testing.T) {
+  srv, _ := newTestServer(t)
+  var wg sync.WaitGroup
+  var finished int32
+  for i := 0; i < 8; i++ {
+    wg.Add(5)
+    go func() {
+      defer wg.Done()
+      if w := serve(srv, "POST", "/sessions", `{"session":{"game":"1","players":["1","2"]}}`, nil); w.Code != http.StatusCreated {
+        t.Errorf("Expected 201, got %d: %s", w.Code, w.Body.String())
+      }
+    }()
+    go func() {
+      defer wg.Done()
+      w := serve(srv, "POST", "/sessions/1/steps:batch", `{"steps":[{"player_id":"1","step_desc":"Lay out the board"}]}`, nil)
+      if w.Code == http.StatusOK {
+        atomic.AddInt32(&finished, 1)
+      }
+    }()
+    go func() {
+      defer wg.Done()
+      if w := serve(srv, "GET", "/metrics", "", nil); w.Code != http.StatusOK {
+        t.Errorf("Expected 200 for metrics, got %d", w.Code)
+      }
+    }()
+    go func() {
+      defer wg.Done()
+      w := serve(srv, "POST", "/graphql", `{"query":"{ sessions { id steps { done } assignments { player { name } step { rule { description } } } } }"}`, nil)
+      if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"errors"`) {
+        t.Errorf("Expected the sessions from GraphQL, got %d: %s", w.Code, w.Body.String())
+      }
+    }()
+    go func() {
+      defer wg.Done()
+      serve(srv, "GET", "/sessions/1", "", nil)
+    }()
+  }
+  wg.Wait()
+
+  if 1 != finished {
+    t.Errorf("Expected the board to be finished once, got %d", finished)
+  }
+  if 9 != len(srv.sessions) || 9 != len(srv.sessionIndex) {
+    t.Errorf("Expected every session to be cached, got %d", len(srv.sessions))
+  }
+}
+
+// Servers keep nothing in common, so one can be tested while another is serving
+func TestServer_Independent(t *testing.T) {
+  first, _ := newTestServer(t)
+  second, _ := newTestServer(t)
+  serve(first, "POST", "/sessions/1/steps:batch", `{"steps":[{"player_id":"1","step_desc":"Lay out the board"}]}`, nil)
+
+  if w := serve(second, "GET", "/sessions/1", "", nil); strings.Contains(w.Body.String(), `"Done":true`) {
+    t.Error("Expected the second server's session to be untouched")
+  }
+  if w := serve(second, "GET", "/metrics", "", nil); strings.Contains(w.Body.String(), "steps:batch") {
+    t.Error("Expected the second server's metrics to be its own")
+  }
+}
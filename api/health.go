@@ -0,0 +1,175 @@
+package api
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "sync"
+  "time"
+  "github.com/rkbodenner/meeple_mover/record"
+)
+
+// How long to wait before trying again to load games and sessions from the database
+const loadRetryInterval = 5 * time.Second
+
+// Tracks whether the caches of games and sessions have been loaded.
+// Until they have, the data routes respond 503 and /readyz reports why.
+type startupState struct {
+  // Held by the loader throughout a load, so that loads don't overlap
+  loading sync.Mutex
+
+  // Only held to read or record how loading went, so that a slow store doesn't hold up readiness checks
+  mutex sync.RWMutex
+  gamesLoaded bool
+  sessionsLoaded bool
+  lastError error
+}
+
+func (s *startupState) ready() bool {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+  return s.gamesLoaded && s.sessionsLoaded
+}
+
+// Load the caches of games and sessions, retrying until the store cooperates or the server is closed
+func (srv *Server) Load() {
+  for {
+    err := srv.loadOnce()
+    if nil == err {
+      srv.log.Info("Ready to serve")
+      return
+    }
+    srv.log.Warn("Could not load data", "error", err, "retry_in", loadRetryInterval.String())
+    select {
+    case <-srv.shuttingDown:
+      return
+    case <-time.After(loadRetryInterval):
+    }
+  }
+}
+
+// Record how loading went. Returns the error.
+func (s *startupState) record(gamesLoaded bool, sessionsLoaded bool, err error) error {
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+  s.gamesLoaded = gamesLoaded
+  s.sessionsLoaded = sessionsLoaded
+  s.lastError = err
+  return err
+}
+
+func (srv *Server) loadOnce() error {
+  startup := &srv.startup
+  startup.loading.Lock()
+  defer startup.loading.Unlock()
+
+  startup.mutex.RLock()
+  gamesLoaded, sessionsLoaded := startup.gamesLoaded, startup.sessionsLoaded
+  startup.mutex.RUnlock()
+
+  if !gamesLoaded {
+    if err := srv.loadGames(); nil != err {
+      return startup.record(false, false, fmt.Errorf("Error initializing games: %s", err))
+    }
+    gamesLoaded = true
+  }
+  if !sessionsLoaded {
+    if err := srv.loadSessions(); nil != err {
+      return startup.record(true, false, fmt.Errorf("Error initializing sessions: %s", err))
+    }
+  }
+  return startup.record(true, true, nil)
+}
+
+// Respond 503 until the caches the handler reads have been loaded
+func (srv *Server) whenReady(h http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if !srv.startup.ready() {
+      w.Header().Set("Retry-After", fmt.Sprintf("%d", (int)(loadRetryInterval.Seconds())))
+      http.Error(w, "Service is starting", http.StatusServiceUnavailable)
+      return
+    }
+    h.ServeHTTP(w, r)
+  })
+}
+
+type HealthStatus struct {
+  Status string `json:"status"`
+}
+
+// Responds as long as the process is able to serve HTTP at all
+type HealthzHandler struct{}
+func (h HealthzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  w.Header().Set("Content-Type", "application/json")
+  err := json.NewEncoder(w).Encode(HealthStatus{"alive"})
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
+
+type ReadinessCheck struct {
+  OK bool `json:"ok"`
+  Detail string `json:"detail"`
+}
+
+type ReadinessStatus struct {
+  Ready bool `json:"ready"`
+  Checks map[string]ReadinessCheck `json:"checks"`
+}
+
+// Responds 200 only when every dependency of the data routes is usable, and 503 otherwise.
+// The body details each check either way.
+type ReadyzHandler struct {
+  srv *Server
+}
+func (h ReadyzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  status := ReadinessStatus{Ready: true, Checks: make(map[string]ReadinessCheck)}
+  check := func(name string, err error, detail string) {
+    if nil != err {
+      status.Ready = false
+      status.Checks[name] = ReadinessCheck{false, err.Error()}
+    } else {
+      status.Checks[name] = ReadinessCheck{true, detail}
+    }
+  }
+
+  err := h.srv.store.Ping()
+  check("database", err, "reachable")
+  if nil == err {
+    check("schema_version", h.srv.store.CheckSchemaVersion(), fmt.Sprintf("%d", record.SchemaVersion))
+  } else {
+    check("schema_version", fmt.Errorf("Database unreachable"), "")
+  }
+
+  startup := &h.srv.startup
+  startup.mutex.RLock()
+  h.srv.mutex.RLock()
+  if startup.gamesLoaded {
+    check("games", nil, fmt.Sprintf("%d loaded", len(h.srv.games)))
+  } else {
+    check("games", notLoadedError(startup.lastError), "")
+  }
+  if startup.sessionsLoaded {
+    check("sessions", nil, fmt.Sprintf("%d loaded", len(h.srv.sessions)))
+  } else {
+    check("sessions", notLoadedError(startup.lastError), "")
+  }
+  h.srv.mutex.RUnlock()
+  startup.mutex.RUnlock()
+
+  w.Header().Set("Content-Type", "application/json")
+  if !status.Ready {
+    w.WriteHeader(http.StatusServiceUnavailable)
+  }
+  err = json.NewEncoder(w).Encode(status)
+  if nil != err {
+    h.srv.requestLog(r.Header).Error("Error encoding readiness status", "error", err)
+  }
+}
+
+func notLoadedError(lastError error) error {
+  if nil == lastError {
+    return fmt.Errorf("Not loaded yet")
+  }
+  return fmt.Errorf("Not loaded yet: %s", lastError)
+}
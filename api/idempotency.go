@@ -0,0 +1,170 @@
+package api
+
+import (
+  "bytes"
+  "crypto/sha256"
+  "database/sql"
+  "encoding/hex"
+  "encoding/json"
+  "io"
+  "net/http"
+  "time"
+  "github.com/rkbodenner/meeple_mover/record"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// How long a response is kept for replay to retries
+const idempotencyWindow = 24 * time.Hour
+
+const maxIdempotencyKeyLength = 255
+
+// Identifies a request by what it asks for, so that a retry can be told apart from a different request reusing a key
+func fingerprint(method string, path string, body []byte) string {
+  hash := sha256.New()
+  io.WriteString(hash, method + " " + path + "\n")
+  hash.Write(body)
+  return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Passes the response through while keeping a copy
+type responseCapture struct {
+  http.ResponseWriter
+  status int
+  body bytes.Buffer
+}
+
+func (w *responseCapture) WriteHeader(status int) {
+  w.status = status
+  w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseCapture) Write(b []byte) (int, error) {
+  w.body.Write(b)
+  return w.ResponseWriter.Write(b)
+}
+
+// Same shape as the errors tigertonic writes for JSON endpoints
+func writeJSONError(w http.ResponseWriter, status int, name string, description string) {
+  w.Header().Set("Content-Type", "application/json")
+  w.WriteHeader(status)
+  json.NewEncoder(w).Encode(map[string]string{"description": description, "error": name})
+}
+
+// Make retries of a request safe. If the request carries an Idempotency-Key header, the first response
+// is stored with the key and replayed to retries for idempotencyWindow. Retries with a different
+// request are rejected with 422, and those that arrive while the first is still being served with 409.
+// Responses with server errors aren't stored, so that the request can be retried. A key reserved by a
+// request that never finished, as when the process died, is taken over by a retry after WriteTimeout.
+func (srv *Server) idempotent(h http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    key := r.Header.Get(IdempotencyKeyHeader)
+    if "" == key {
+      h.ServeHTTP(w, r)
+      return
+    }
+    if len(key) > maxIdempotencyKeyLength {
+      writeJSONError(w, http.StatusBadRequest, "idempotency", "Idempotency-Key is too long")
+      return
+    }
+
+    body, err := io.ReadAll(r.Body)
+    if nil != err {
+      writeJSONError(w, http.StatusBadRequest, "idempotency", "Could not read request body")
+      return
+    }
+    r.Body = io.NopCloser(bytes.NewReader(body))
+
+    log := srv.requestLog(r.Header).With("idempotency_key", key)
+    rec := &record.IdempotencyKeyRecord{Key: key, Fingerprint: fingerprint(r.Method, r.URL.Path, body)}
+
+    err = srv.timed("PruneIdempotencyKeys", func() error {
+      return srv.store.PruneIdempotencyKeys(time.Now().Add(-idempotencyWindow))
+    })
+    if nil != err {
+      log.Warn("Could not prune idempotency keys", "error", err)
+    }
+
+    var reserved bool
+    err = srv.timed("ReserveIdempotencyKey", func() error {
+      var err error
+      reserved, err = srv.store.ReserveIdempotencyKey(rec, time.Now().Add(-srv.config.WriteTimeout))
+      return err
+    })
+    if nil != err {
+      writeJSONError(w, http.StatusInternalServerError, "error", "Could not store Idempotency-Key")
+      return
+    }
+    if !reserved {
+      srv.replay(w, r, rec)
+      return
+    }
+
+    capture := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+    completed := false
+    defer func() {
+      // Free the key for a retry if the response wasn't stored, even if the handler panicked
+      if !completed {
+        if err := srv.timed("DeleteIdempotencyKey", func() error { return srv.store.DeleteIdempotencyKey(rec) }); nil != err {
+          log.Error("Could not release Idempotency-Key", "error", err)
+        }
+      }
+    }()
+    h.ServeHTTP(capture, r)
+
+    if capture.status >= 500 {
+      return
+    }
+    rec.Status = capture.status
+    rec.ContentType = capture.Header().Get("Content-Type")
+    rec.Location = capture.Header().Get("Location")
+    rec.Body = capture.body.Bytes()
+    err = srv.timed("CompleteIdempotencyKey", func() error { return srv.store.CompleteIdempotencyKey(rec) })
+    if nil != err {
+      log.Error("Could not store response for Idempotency-Key", "error", err)
+      return
+    }
+    completed = true
+  })
+}
+
+func (srv *Server) replay(w http.ResponseWriter, r *http.Request, rec *record.IdempotencyKeyRecord) {
+  log := srv.requestLog(r.Header).With("idempotency_key", rec.Key)
+
+  var existing *record.IdempotencyKeyRecord
+  err := srv.timed("FindIdempotencyKey", func() error {
+    var err error
+    existing, err = srv.store.FindIdempotencyKey(rec.Key)
+    return err
+  })
+  if sql.ErrNoRows == err {
+    // Released by a failed first request since we tried to reserve it
+    w.Header().Set("Retry-After", "1")
+    writeJSONError(w, http.StatusConflict, "idempotency", "Request with this Idempotency-Key failed. Retry it.")
+    return
+  }
+  if nil != err {
+    writeJSONError(w, http.StatusInternalServerError, "error", "Could not look up Idempotency-Key")
+    return
+  }
+
+  switch {
+  case existing.Fingerprint != rec.Fingerprint:
+    log.Warn("Idempotency-Key reused for a different request")
+    writeJSONError(w, http.StatusUnprocessableEntity, "idempotency", "Idempotency-Key was already used for a different request")
+  case 0 == existing.Status:
+    w.Header().Set("Retry-After", "1")
+    writeJSONError(w, http.StatusConflict, "idempotency", "Request with this Idempotency-Key is still being served")
+  default:
+    log.Info("Replayed response for Idempotency-Key")
+    if "" != existing.ContentType {
+      w.Header().Set("Content-Type", existing.ContentType)
+    }
+    if "" != existing.Location {
+      w.Header().Set("Location", existing.Location)
+    }
+    w.Header().Set("Idempotent-Replayed", "true")
+    w.WriteHeader(existing.Status)
+    w.Write(existing.Body)
+  }
+}
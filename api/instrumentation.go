@@ -0,0 +1,82 @@
+package api
+
+import (
+  "net/http"
+  "strconv"
+  "time"
+  "github.com/rkbodenner/meeple_mover/metrics"
+)
+
+func (srv *Server) instrument() {
+  srv.metrics = metrics.NewRegistry()
+  srv.httpRequests = srv.metrics.NewCounter("meeple_mover_http_requests_total",
+    "HTTP requests served, by route and status code.", "method", "route", "code")
+  srv.httpRequestDuration = srv.metrics.NewHistogram("meeple_mover_http_request_duration_seconds",
+    "Time to serve HTTP requests, by route.", metrics.DefaultBuckets, "method", "route")
+  srv.dbQueryDuration = srv.metrics.NewHistogram("meeple_mover_db_query_duration_seconds",
+    "Time spent in the store, by store method.", metrics.DefaultBuckets, "method")
+  srv.stepsFinished = srv.metrics.NewCounter("meeple_mover_steps_finished_total",
+    "Setup steps finished by players. Use rate() for steps finished per minute.")
+  srv.grpcRequests = srv.metrics.NewCounter("meeple_mover_grpc_requests_total",
+    "gRPC calls served, by method and status code.", "method", "code")
+  srv.webhookDeliveries = srv.metrics.NewCounter("meeple_mover_webhook_deliveries_total",
+    "Attempts to deliver webhook events, by event and outcome.", "event", "outcome")
+
+  srv.metrics.NewGaugeFunc("meeple_mover_active_sessions", "Sessions with setup steps left to do.", func() float64 {
+    srv.mutex.RLock()
+    defer srv.mutex.RUnlock()
+    active := 0
+    for _, s := range srv.sessions {
+      for _, step := range s.SetupSteps {
+        if !step.Done {
+          active++
+          break
+        }
+      }
+    }
+    return (float64)(active)
+  })
+  srv.metrics.NewGaugeFunc("meeple_mover_cached_games", "Games in the cache.", func() float64 {
+    srv.mutex.RLock()
+    defer srv.mutex.RUnlock()
+    return (float64)(len(srv.gameIndex))
+  })
+  srv.metrics.NewGaugeFunc("meeple_mover_cached_sessions", "Sessions in the cache.", func() float64 {
+    srv.mutex.RLock()
+    defer srv.mutex.RUnlock()
+    return (float64)(len(srv.sessionIndex))
+  })
+}
+
+// Records the status code written by a handler
+type statusRecorder struct {
+  http.ResponseWriter
+  status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+  w.status = status
+  w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Flush() {
+  if f, ok := w.ResponseWriter.(http.Flusher); ok {
+    f.Flush()
+  }
+}
+
+// Lets http.ResponseController reach the connection underneath
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+  return w.ResponseWriter
+}
+
+// Count and time requests to a route. The pattern is used as the label, rather than the path, to keep the number of series small.
+func (srv *Server) instrumented(method string, pattern string, h http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    start := time.Now()
+    rec := &statusRecorder{w, http.StatusOK}
+    h.ServeHTTP(rec, r)
+    srv.httpRequests.Inc(method, pattern, strconv.Itoa(rec.status))
+    srv.httpRequestDuration.Observe(time.Since(start).Seconds(), method, pattern)
+  })
+}
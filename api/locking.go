@@ -0,0 +1,79 @@
+package api
+
+import (
+  "bytes"
+  "errors"
+  "io"
+  "net/http"
+)
+
+// Holds a response until the handler is done, so that it can be written to the client after the
+// caches are unlocked. Headers are set on the response itself.
+type bufferedResponse struct {
+  http.ResponseWriter
+  status int
+  body bytes.Buffer
+}
+
+func (w *bufferedResponse) WriteHeader(status int) {
+  if 0 == w.status {
+    w.status = status
+  }
+}
+
+func (w *bufferedResponse) Write(b []byte) (int, error) {
+  w.WriteHeader(http.StatusOK)
+  return w.body.Write(b)
+}
+
+func (w *bufferedResponse) flush() {
+  if 0 == w.status {
+    w.status = http.StatusOK
+  }
+  w.ResponseWriter.WriteHeader(w.status)
+  w.body.WriteTo(w.ResponseWriter)
+}
+
+// Serve with the caches locked for reading, so that neither they nor the cached sessions change while
+// the response is made. The response is buffered, so that a slow client doesn't hold the lock.
+func (srv *Server) reading(h http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    buffered := &bufferedResponse{ResponseWriter: w}
+    func() {
+      srv.mutex.RLock()
+      defer srv.mutex.RUnlock()
+      h.ServeHTTP(buffered, r)
+    }()
+    buffered.flush()
+  })
+}
+
+// Serve with the caches locked for writing. Changes are made one at a time, so each is checked against
+// the state it changes, and responds with the state it left. The request body is read and the
+// response buffered outside the lock, so that a slow client doesn't hold it. The lock is held while
+// the change is stored, though, since handlers change the cached sessions before storing them and
+// reload them if that fails: every read, and every snapshot for a session's events, waits for the
+// store to finish each change.
+func (srv *Server) writing(h http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    body, err := io.ReadAll(r.Body)
+    if nil != err {
+      var tooLarge *http.MaxBytesError
+      if errors.As(err, &tooLarge) {
+        http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+      } else {
+        http.Error(w, "Could not read request body", http.StatusBadRequest)
+      }
+      return
+    }
+    r.Body = io.NopCloser(bytes.NewReader(body))
+
+    buffered := &bufferedResponse{ResponseWriter: w}
+    func() {
+      srv.mutex.Lock()
+      defer srv.mutex.Unlock()
+      h.ServeHTTP(buffered, r)
+    }()
+    buffered.flush()
+  })
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+  "crypto/rand"
+  "encoding/hex"
+  "log/slog"
+  "net/http"
+  "regexp"
+  "time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// Request IDs from clients are accepted only if they're short and can't mangle a log line
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+func newRequestID() string {
+  b := make([]byte, 8)
+  if _, err := rand.Read(b); nil != err {
+    return "unknown"
+  }
+  return hex.EncodeToString(b)
+}
+
+// Give every request an ID, taken from the X-Request-ID header if the client sent a valid one.
+// The ID is echoed in the response, and left in the request header for handlers to log.
+func withRequestID(h http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    id := r.Header.Get(RequestIDHeader)
+    if !validRequestID.MatchString(id) {
+      id = newRequestID()
+      r.Header.Set(RequestIDHeader, id)
+    }
+    w.Header().Set(RequestIDHeader, id)
+    h.ServeHTTP(w, r)
+  })
+}
+
+// Logger for a request, carrying its ID. Takes the header so that tigertonic.Marshaled funcs can use it.
+func (srv *Server) requestLog(h http.Header) *slog.Logger {
+  return srv.log.With("request_id", h.Get(RequestIDHeader))
+}
+
+// Log each request once it's been served
+func (srv *Server) accessLogged(method string, pattern string, h http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    start := time.Now()
+    rec := &statusRecorder{w, http.StatusOK}
+    h.ServeHTTP(rec, r)
+    srv.requestLog(r.Header).Info("Served request", "method", method, "route", pattern, "path", r.URL.Path,
+      "status", rec.status, "duration_ms", time.Since(start).Milliseconds())
+  })
+}
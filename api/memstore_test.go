@@ -0,0 +1,427 @@
+package api
+
+import (
+  "database/sql"
+  "encoding/json"
+  "sync"
+  "time"
+  "github.com/rkbodenner/meeple_mover/condition"
+  "github.com/rkbodenner/meeple_mover/expansion"
+  "github.com/rkbodenner/meeple_mover/quantity"
+  "github.com/rkbodenner/meeple_mover/record"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// Keeps everything in memory, so the handlers can be tested without a database.
+// Sessions are kept by reference, as the server's caches are.
+type memStore struct {
+  mutex sync.Mutex
+  err error  // Returned by every call, when set
+  lastId int
+
+  games []*game.Game
+  players []*game.Player
+  sessions []*session.Session
+  strategies map[uint]string
+  modules map[uint][]*expansion.Module  // By game ID
+  sessionModules map[uint][]string
+  conditions map[int]*condition.Condition  // By rule ID
+  quantities map[int]quantity.Quantities
+  webhooks []*record.WebhookRecord
+  deliveries []*record.WebhookDeliveryRecord
+  keys map[string]*record.IdempotencyKeyRecord
+}
+
+func newMemStore() *memStore {
+  return &memStore{strategies: make(map[uint]string), modules: make(map[uint][]*expansion.Module),
+    sessionModules: make(map[uint][]string), conditions: make(map[int]*condition.Condition),
+    quantities: make(map[int]quantity.Quantities), keys: make(map[string]*record.IdempotencyKeyRecord)}
+}
+
+func (store *memStore) nextId() int {
+  store.lastId++
+  return store.lastId
+}
+
+func (store *memStore) Ping() error {
+  return store.err
+}
+
+func (store *memStore) CheckSchemaVersion() error {
+  return store.err
+}
+
+func (store *memStore) Games() ([]*game.Game, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  return store.games, store.err
+}
+
+func (store *memStore) Players() ([]*game.Player, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  return append([]*game.Player{}, store.players...), store.err
+}
+
+func (store *memStore) FindPlayer(id int) (*game.Player, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return nil, store.err
+  }
+  for _, p := range store.players {
+    if p.Id == id {
+      return p, nil
+    }
+  }
+  return nil, sql.ErrNoRows
+}
+
+func (store *memStore) CreatePlayer(player *game.Player) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return store.err
+  }
+  player.Id = store.nextId()
+  store.players = append(store.players, player)
+  return nil
+}
+
+func (store *memStore) DeletePlayer(id int) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  for i, p := range store.players {
+    if p.Id == id {
+      store.players = append(store.players[:i], store.players[i+1:]...)
+      break
+    }
+  }
+  return store.err
+}
+
+func (store *memStore) Sessions() ([]*session.Session, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  return append([]*session.Session{}, store.sessions...), store.err
+}
+
+func (store *memStore) FindSession(id uint) (*session.Session, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return nil, store.err
+  }
+  for _, s := range store.sessions {
+    if s.Id == id {
+      return s, nil
+    }
+  }
+  return nil, sql.ErrNoRows
+}
+
+func (store *memStore) Modules(g *game.Game) ([]*expansion.Module, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  return append([]*expansion.Module{}, store.modules[g.Id]...), store.err
+}
+
+func (store *memStore) CreateModule(g *game.Game, m *expansion.Module) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return store.err
+  }
+  m.Id = store.nextId()
+  for _, rule := range m.Rules {
+    rule.Id = store.nextId()
+  }
+  store.modules[g.Id] = append(store.modules[g.Id], m)
+  return nil
+}
+
+func (store *memStore) Conditions() (map[int]*condition.Condition, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  conditions := make(map[int]*condition.Condition)
+  for id, c := range store.conditions {
+    conditions[id] = c
+  }
+  return conditions, store.err
+}
+
+func (store *memStore) SetCondition(rule *game.SetupRule, c *condition.Condition) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return store.err
+  }
+  if c.Empty() {
+    delete(store.conditions, rule.Id)
+  } else {
+    store.conditions[rule.Id] = c
+  }
+  return nil
+}
+
+func (store *memStore) Quantities() (map[int]quantity.Quantities, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  quantities := make(map[int]quantity.Quantities)
+  for id, q := range store.quantities {
+    quantities[id] = q
+  }
+  return quantities, store.err
+}
+
+func (store *memStore) SetQuantities(rule *game.SetupRule, q quantity.Quantities) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return store.err
+  }
+  if 0 == len(q) {
+    delete(store.quantities, rule.Id)
+  } else {
+    store.quantities[rule.Id] = q
+  }
+  return nil
+}
+
+func (store *memStore) CreateSession(s *session.Session, strategy string, modules []*expansion.Module) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return store.err
+  }
+  s.Id = (uint)(store.nextId())
+  store.sessions = append(store.sessions, s)
+  store.strategies[s.Id] = strategy
+  for _, m := range modules {
+    store.sessionModules[s.Id] = append(store.sessionModules[s.Id], m.Name)
+  }
+  return nil
+}
+
+func (store *memStore) SessionModules() (map[uint][]string, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  modules := make(map[uint][]string)
+  for id, names := range store.sessionModules {
+    modules[id] = names
+  }
+  return modules, store.err
+}
+
+func (store *memStore) SessionStrategies() (map[uint]string, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  strategies := make(map[uint]string)
+  for id, strategy := range store.strategies {
+    strategies[id] = strategy
+  }
+  return strategies, store.err
+}
+
+func (store *memStore) SaveSteps(change *StepChange) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return store.err
+  }
+  for _, event := range change.Events {
+    store.queue(event)
+  }
+  return nil
+}
+
+func (store *memStore) queue(event *WebhookEvent) {
+  event.OccurredAt = time.Now().UTC()
+  payload, _ := json.Marshal(event)
+  for _, hook := range store.webhooks {
+    for _, name := range hook.Events {
+      if name == event.Event {
+        store.deliveries = append(store.deliveries, &record.WebhookDeliveryRecord{
+          Id: store.nextId(),
+          WebhookId: hook.Id,
+          Event: event.Event,
+          Payload: payload,
+          Status: record.DeliveryPending,
+          NextAttemptAt: event.OccurredAt,
+          CreatedAt: event.OccurredAt,
+        })
+      }
+    }
+  }
+}
+
+func (store *memStore) QueueWebhookEvent(event *WebhookEvent) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return store.err
+  }
+  store.queue(event)
+  return nil
+}
+
+func (store *memStore) Webhooks() ([]*record.WebhookRecord, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  return append([]*record.WebhookRecord{}, store.webhooks...), store.err
+}
+
+func (store *memStore) FindWebhook(id int) (*record.WebhookRecord, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return nil, store.err
+  }
+  for _, hook := range store.webhooks {
+    if hook.Id == id {
+      return hook, nil
+    }
+  }
+  return nil, sql.ErrNoRows
+}
+
+func (store *memStore) CreateWebhook(hook *record.WebhookRecord) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return store.err
+  }
+  hook.Id = store.nextId()
+  hook.CreatedAt = time.Now()
+  store.webhooks = append(store.webhooks, hook)
+  return nil
+}
+
+func (store *memStore) DeleteWebhook(hook *record.WebhookRecord) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  for i, existing := range store.webhooks {
+    if existing.Id == hook.Id {
+      store.webhooks = append(store.webhooks[:i], store.webhooks[i+1:]...)
+      break
+    }
+  }
+  return store.err
+}
+
+func (store *memStore) WebhookDeliveries(webhookId int, limit int) ([]*record.WebhookDeliveryRecord, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  found := make([]*record.WebhookDeliveryRecord, 0)
+  for i := len(store.deliveries) - 1; i >= 0 && len(found) < limit; i-- {
+    if store.deliveries[i].WebhookId == webhookId {
+      found = append(found, store.deliveries[i])
+    }
+  }
+  return found, store.err
+}
+
+func (store *memStore) ClaimWebhookDeliveries(lease time.Duration, limit int) ([]*record.WebhookDeliveryRecord, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return nil, store.err
+  }
+  now := time.Now()
+  claimed := make([]*record.WebhookDeliveryRecord, 0)
+  for _, delivery := range store.deliveries {
+    if len(claimed) == limit {
+      break
+    }
+    if record.DeliveryPending != delivery.Status || delivery.NextAttemptAt.After(now) {
+      continue
+    }
+    for _, hook := range store.webhooks {
+      if hook.Id == delivery.WebhookId {
+        delivery.URL, delivery.Secret = hook.URL, hook.Secret
+        delivery.NextAttemptAt = now.Add(lease)
+        copied := *delivery
+        claimed = append(claimed, &copied)
+      }
+    }
+  }
+  return claimed, nil
+}
+
+func (store *memStore) UpdateWebhookDelivery(delivery *record.WebhookDeliveryRecord) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return store.err
+  }
+  for _, existing := range store.deliveries {
+    if existing.Id == delivery.Id {
+      *existing = *delivery
+    }
+  }
+  return nil
+}
+
+func (store *memStore) ReserveIdempotencyKey(key *record.IdempotencyKeyRecord, abandonedBefore time.Time) (bool, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return false, store.err
+  }
+  if taken, ok := store.keys[key.Key]; ok {
+    if 0 != taken.Status || taken.Fingerprint != key.Fingerprint || !taken.CreatedAt.Before(abandonedBefore) {
+      return false, nil
+    }
+  }
+  reserved := *key
+  reserved.CreatedAt = time.Now()
+  store.keys[key.Key] = &reserved
+  return true, nil
+}
+
+func (store *memStore) FindIdempotencyKey(key string) (*record.IdempotencyKeyRecord, error) {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return nil, store.err
+  }
+  rec, ok := store.keys[key]
+  if !ok {
+    return nil, sql.ErrNoRows
+  }
+  found := *rec
+  return &found, nil
+}
+
+func (store *memStore) CompleteIdempotencyKey(key *record.IdempotencyKeyRecord) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  if nil != store.err {
+    return store.err
+  }
+  completed := *key
+  if reserved, ok := store.keys[key.Key]; ok {
+    completed.CreatedAt = reserved.CreatedAt
+  }
+  store.keys[key.Key] = &completed
+  return nil
+}
+
+func (store *memStore) DeleteIdempotencyKey(key *record.IdempotencyKeyRecord) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  delete(store.keys, key.Key)
+  return store.err
+}
+
+func (store *memStore) PruneIdempotencyKeys(before time.Time) error {
+  store.mutex.Lock()
+  defer store.mutex.Unlock()
+  for key, rec := range store.keys {
+    if rec.CreatedAt.Before(before) {
+      delete(store.keys, key)
+    }
+  }
+  return store.err
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+  "encoding/json"
+  "log/slog"
+  "net/http"
+  "net/url"
+  "strconv"
+  "strings"
+  "github.com/rkbodenner/meeple_mover/expansion"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+type ModuleRuleHash struct {
+  Description string `json:"description"`
+  Details string `json:"details,omitempty"`
+  EachPlayer bool `json:"each_player"`
+  // Descriptions of the rules it depends on, of the game or of the module
+  After []string `json:"after"`
+}
+
+type ReplacementHash struct {
+  Rule string `json:"rule"`  // Description of the game's rule
+  With string `json:"with"`  // Description of the module's rule
+}
+
+// An expansion or variant of a game, with its rules referred to by description
+type ModuleHash struct {
+  Id int `json:"id"`  // Set by the server
+  Name string `json:"name"`
+  Kind string `json:"kind"`  // expansion, the default, or variant
+  // The players the game is for with the module, where they differ from the base game's
+  MinPlayers int `json:"min_players,omitempty"`
+  MaxPlayers int `json:"max_players,omitempty"`
+  Rules []ModuleRuleHash `json:"rules"`
+  Removes []string `json:"removes"`  // Descriptions of the game's rules that the module leaves out
+  Replaces []ReplacementHash `json:"replaces"`
+}
+
+type ModuleCreateRequest struct {
+  Module ModuleHash `json:"module"`
+}
+
+func moduleHash(m *expansion.Module) *ModuleHash {
+  hash := &ModuleHash{Id: m.Id, Name: m.Name, Kind: m.Kind, MinPlayers: m.MinPlayers, MaxPlayers: m.MaxPlayers,
+    Rules: make([]ModuleRuleHash, 0), Removes: make([]string, 0), Replaces: make([]ReplacementHash, 0)}
+  for _, rule := range m.Rules {
+    ruleHash := ModuleRuleHash{Description: rule.Description, Details: rule.Details, EachPlayer: "Each player" == rule.Arity, After: make([]string, 0)}
+    for _, dep := range rule.Dependencies {
+      ruleHash.After = append(ruleHash.After, dep.Description)
+    }
+    hash.Rules = append(hash.Rules, ruleHash)
+  }
+  for _, rule := range m.Removes {
+    hash.Removes = append(hash.Removes, rule.Description)
+  }
+  for _, r := range m.Replaces {
+    hash.Replaces = append(hash.Replaces, ReplacementHash{r.Rule.Description, r.With.Description})
+  }
+  return hash
+}
+
+// The game's module of the given name, or nil
+func (srv *Server) findModule(g *game.Game, name string) *expansion.Module {
+  for _, m := range srv.modules[(uint64)(g.Id)] {
+    if m.Name == name {
+      return m
+    }
+  }
+  return nil
+}
+
+// Names of the game's modules, in the order they were created
+func (srv *Server) moduleNames(g *game.Game) []string {
+  names := make([]string, 0)
+  for _, m := range srv.modules[(uint64)(g.Id)] {
+    names = append(names, m.Name)
+  }
+  return names
+}
+
+// Names of the modules the session was started with, in order
+func (srv *Server) sessionModuleNames(s *session.Session) []string {
+  if names, ok := srv.sessionModules[(uint64)(s.Id)]; ok {
+    return names
+  }
+  return []string{}
+}
+
+// Report the problems that keep the game from being set up with modules, one by one if there are several
+func addSetupProblems(problems *ValidationError, err error) {
+  if integrity, ok := err.(*setupgraph.IntegrityError); ok {
+    for _, problem := range integrity.Problems {
+      problems.Add("%s", problem)
+    }
+    return
+  }
+  problems.Add("%s", err.Error())
+}
+
+type ModulesHandler struct {
+  srv *Server
+}
+func (h ModulesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+  if _, ok := h.srv.gameIndex[id]; !ok {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+
+  hashes := make([]*ModuleHash, 0)
+  for _, m := range h.srv.modules[id] {
+    hashes = append(hashes, moduleHash(m))
+  }
+  if err := json.NewEncoder(w).Encode(hashes); nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
+
+type ModuleCreateHandler struct {
+  srv *Server
+}
+
+// Build the module from the request, finding the rules it refers to among the game's and its own.
+// Returns a *ValidationError listing every problem found.
+func (handler ModuleCreateHandler) validate(g *game.Game, hash *ModuleHash) (*expansion.Module, error) {
+  problems := &ValidationError{}
+  m := &expansion.Module{GameId: g.Id, Name: strings.TrimSpace(hash.Name), Kind: hash.Kind, MinPlayers: hash.MinPlayers, MaxPlayers: hash.MaxPlayers}
+
+  if "" == m.Name {
+    problems.Add("Expected a name")
+  } else if nil != handler.srv.findModule(g, m.Name) {
+    problems.Add("%s already has a module named %q", g.Name, m.Name)
+  }
+  switch m.Kind {
+  case "":
+    m.Kind = expansion.Expansion
+  case expansion.Expansion, expansion.Variant:
+  default:
+    problems.Add("Unknown kind %q: expected %s or %s", m.Kind, expansion.Expansion, expansion.Variant)
+  }
+  if m.MinPlayers < 0 || m.MaxPlayers < 0 {
+    problems.Add("Expected numbers of players to be positive, or 0 to keep the game's")
+  } else if m.MinPlayers > 0 && m.MaxPlayers > 0 && m.MinPlayers > m.MaxPlayers {
+    problems.Add("Expected min_players to be at most max_players, got %d and %d", m.MinPlayers, m.MaxPlayers)
+  }
+
+  base := make(map[string]*game.SetupRule)
+  for _, rule := range g.SetupRules {
+    base[rule.Description] = rule
+  }
+  own := make(map[string]*game.SetupRule)
+  for _, ruleHash := range hash.Rules {
+    rule := &game.SetupRule{Description: strings.TrimSpace(ruleHash.Description), Details: ruleHash.Details, Arity: "Once"}
+    if ruleHash.EachPlayer {
+      rule.Arity = "Each player"
+    }
+    if "" == rule.Description {
+      problems.Add("Expected each rule to have a description")
+      continue
+    }
+    if _, ok := own[rule.Description]; ok {
+      problems.Add("Rule %q is given twice", rule.Description)
+      continue
+    }
+    own[rule.Description] = rule
+    m.Rules = append(m.Rules, rule)
+  }
+  for _, ruleHash := range hash.Rules {
+    rule, ok := own[strings.TrimSpace(ruleHash.Description)]
+    if !ok {
+      continue
+    }
+    for _, after := range ruleHash.After {
+      if dep, ok := own[after]; ok {
+        rule.Dependencies = append(rule.Dependencies, dep)
+      } else if dep, ok := base[after]; ok {
+        rule.Dependencies = append(rule.Dependencies, dep)
+      } else {
+        problems.Add("%q depends on %q, which is neither %s's rule nor the module's", rule.Description, after, g.Name)
+      }
+    }
+  }
+
+  for _, description := range hash.Removes {
+    if rule, ok := base[description]; ok {
+      m.Removes = append(m.Removes, rule)
+    } else {
+      problems.Add("Can't remove %q, which isn't one of %s's rules", description, g.Name)
+    }
+  }
+  for _, r := range hash.Replaces {
+    rule, ok := base[r.Rule]
+    if !ok {
+      problems.Add("Can't replace %q, which isn't one of %s's rules", r.Rule, g.Name)
+    }
+    with, withOk := own[r.With]
+    if !withOk {
+      problems.Add("Can't replace %q with %q, which isn't one of the module's rules", r.Rule, r.With)
+    }
+    if ok && withOk {
+      m.Replaces = append(m.Replaces, expansion.Replacement{Rule: rule, With: with})
+    }
+  }
+
+  if !problems.Any() {
+    if _, err := expansion.Apply(g, []*expansion.Module{m}); nil != err {
+      addSetupProblems(problems, err)
+    }
+  }
+  if problems.Any() {
+    return nil, problems
+  }
+  return m, nil
+}
+
+func (handler ModuleCreateHandler) create(log *slog.Logger, g *game.Game, rq *ModuleCreateRequest) (*expansion.Module, error) {
+  m, err := handler.validate(g, &rq.Module)
+  if nil != err {
+    return nil, err
+  }
+
+  srv := handler.srv
+  err = srv.timed("CreateModule", func() error { return srv.store.CreateModule(g, m) })
+  if nil != err {
+    return nil, err
+  }
+  srv.modules[(uint64)(g.Id)] = append(srv.modules[(uint64)(g.Id)], m)
+  log.Info("Created module", "game_id", g.Id, "module_id", m.Id, "name", m.Name, "kind", m.Kind)
+  return m, nil
+}
+
+func (handler ModuleCreateHandler) marshalFunc() (func(*url.URL, http.Header, *ModuleCreateRequest) (int, http.Header, *ModuleHash, error)) {
+  return func(u *url.URL, h http.Header, rq *ModuleCreateRequest) (int, http.Header, *ModuleHash, error) {
+    id, err := strconv.ParseUint(u.Query().Get("id"), 10, 64)
+    if nil != err {
+      return http.StatusNotFound, nil, nil, &StatusError{http.StatusNotFound, "Game not found"}
+    }
+    g, ok := handler.srv.gameIndex[id]
+    if !ok {
+      return http.StatusNotFound, nil, nil, &StatusError{http.StatusNotFound, "Game not found"}
+    }
+
+    m, err := handler.create(handler.srv.requestLog(h), g, rq)
+    if _, invalid := err.(*ValidationError); invalid {
+      return http.StatusUnprocessableEntity, nil, nil, err
+    } else if nil != err {
+      return http.StatusInternalServerError, nil, nil, err
+    }
+    return http.StatusCreated, nil, moduleHash(m), nil
+  }
+}
@@ -0,0 +1,426 @@
+package api
+
+import (
+  "encoding/json"
+  "net/http"
+  "strings"
+  "github.com/rkbodenner/meeple_mover/openapi"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// Describe every route for clients, in OpenAPI 3 format
+func apiDescription() *openapi.Document {
+  doc := openapi.New("meeple_mover", "1.0.0")
+  doc.Info.Description = "Web service backing goboard, an app for faster multiplayer boardgame setup. " +
+    "Every response carries an X-Request-ID header, echoing the request's if it sent a valid one."
+
+  gameSchema := doc.SchemaFor(&game.Game{})
+  playerSchema := doc.SchemaFor(&game.Player{})
+  sessionSchema := doc.SchemaFor(&session.Session{})
+  // Errors from JSON endpoints are written by tigertonic
+  errorSchema := doc.SchemaFor(struct{
+    Description string `json:"description"`
+    Error string `json:"error"`
+  }{})
+
+  integer := &openapi.Schema{Type: "integer", Format: "int64"}
+  gameId := openapi.PathParameter("id", "ID of the game", integer)
+  playerId := openapi.PathParameter("player_id", "ID of the player", integer)
+  sessionId := openapi.PathParameter("session_id", "ID of the session", integer)
+  stepDesc := openapi.PathParameter("step_desc", "Description of the setup rule for the step, URL-escaped", &openapi.Schema{Type: "string"})
+
+  ok := func(schema *openapi.Schema) *openapi.Response {
+    return &openapi.Response{Description: "OK", Content: openapi.JSONContent(schema)}
+  }
+  text := func(description string) *openapi.Response {
+    return &openapi.Response{Description: description, Content: openapi.TextContent()}
+  }
+  jsonError := func(description string) *openapi.Response {
+    return &openapi.Response{Description: description, Content: openapi.JSONContent(errorSchema)}
+  }
+  idempotencyKey := &openapi.Parameter{
+    Name: IdempotencyKeyHeader,
+    In: "header",
+    Description: "Unique key for the request. Retries with the same key and body get the first response replayed, for 24 hours.",
+    Schema: &openapi.Schema{Type: "string"},
+  }
+  query := func(name string, description string, required bool) *openapi.Parameter {
+    return &openapi.Parameter{Name: name, In: "query", Description: description, Required: required, Schema: &openapi.Schema{Type: "string"}}
+  }
+  body := func(schema *openapi.Schema) *openapi.RequestBody {
+    return &openapi.RequestBody{Required: true, Content: openapi.JSONContent(schema)}
+  }
+
+  doc.Add("GET", "/games", &openapi.Operation{
+    Summary: "List all games",
+    Responses: map[string]*openapi.Response{
+      "200": ok(&openapi.Schema{Type: "array", Items: gameSchema}),
+    },
+  })
+  doc.Add("GET", "/games/{id}", &openapi.Operation{
+    Summary: "Show a game and its setup rules",
+    Parameters: []*openapi.Parameter{gameId},
+    Responses: map[string]*openapi.Response{
+      "200": ok(gameSchema),
+      "404": text("No such game"),
+    },
+  })
+
+  checklistFormat := query("format", "markdown, text or html. Otherwise the Accept header is used, and Markdown by default.", false)
+  checklist := &openapi.Response{Description: "OK", Content: map[string]*openapi.MediaType{
+    "text/markdown": &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}},
+    "text/plain": &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}},
+    "text/html": &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}},
+  }}
+  doc.Add("GET", "/games/{id}/checklist", &openapi.Operation{
+    Summary: "A setup checklist to print, for the given number of players, grouped by player with shared steps separate",
+    Parameters: []*openapi.Parameter{gameId, query("players", "Number of players. The game's minimum by default.", false), checklistFormat},
+    Responses: map[string]*openapi.Response{
+      "200": checklist,
+      "400": text("Unknown format, or a number of players the game isn't for"),
+      "404": text("No such game"),
+    },
+  })
+  doc.Add("GET", "/games/{id}/analysis", &openapi.Operation{
+    Summary: "How setup goes for the given number of players, if each step takes a round: the critical path, " +
+      "bottlenecks, rounds needed, and how many players can usefully help",
+    Parameters: []*openapi.Parameter{gameId, query("players", "Number of players. The game's minimum by default.", false)},
+    Responses: map[string]*openapi.Response{
+      "200": ok(doc.SchemaFor(&setupgraph.Analysis{})),
+      "400": text("A number of players the game isn't for"),
+      "404": text("No such game"),
+      "500": text("The game's rules depend on each other in a cycle"),
+    },
+  })
+  graphFormat := query("format", "dot or svg. Otherwise the Accept header is used, and DOT by default.", false)
+  graph := &openapi.Response{Description: "OK", Content: map[string]*openapi.MediaType{
+    "text/vnd.graphviz": &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}},
+    "image/svg+xml": &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}},
+  }}
+  doc.Add("GET", "/games/{id}/graph", &openapi.Operation{
+    Summary: "The game's setup rules and what each depends on, in DOT for Graphviz to lay out, or as SVG",
+    Parameters: []*openapi.Parameter{gameId, graphFormat},
+    Responses: map[string]*openapi.Response{
+      "200": graph,
+      "400": text("Unknown format"),
+      "404": text("No such game"),
+      "500": text("SVG was asked for, and the game's rules depend on each other in a cycle"),
+    },
+  })
+  doc.Add("GET", "/games/{id}/modules", &openapi.Operation{
+    Summary: "List the game's expansions and variants, which sessions can be set up with",
+    Parameters: []*openapi.Parameter{gameId},
+    Responses: map[string]*openapi.Response{
+      "200": ok(&openapi.Schema{Type: "array", Items: doc.SchemaFor(&ModuleHash{})}),
+      "404": text("No such game"),
+    },
+  })
+  doc.Add("POST", "/games/{id}/modules", &openapi.Operation{
+    Summary: "Add an expansion or variant to the game, referring to rules by description",
+    Parameters: []*openapi.Parameter{gameId, idempotencyKey},
+    RequestBody: body(doc.SchemaFor(&ModuleCreateRequest{})),
+    Responses: map[string]*openapi.Response{
+      "201": ok(doc.SchemaFor(&ModuleHash{})),
+      "404": jsonError("No such game"),
+      "409": jsonError("Request with the same Idempotency-Key is still being served"),
+      "422": jsonError("Invalid module, or one the game couldn't be set up with, with every problem listed in the description, separated by semicolons. " +
+        "Or Idempotency-Key was already used for a different request."),
+      "500": jsonError("Database error"),
+    },
+  })
+  doc.Add("GET", "/games/{id}/conditions", &openapi.Operation{
+    Summary: "List the conditions on the numbers of players the game's rules and its modules' rules are set up for",
+    Parameters: []*openapi.Parameter{gameId},
+    Responses: map[string]*openapi.Response{
+      "200": ok(&openapi.Schema{Type: "array", Items: doc.SchemaFor(&RuleConditionHash{})}),
+      "404": text("No such game"),
+    },
+  })
+  doc.Add("PUT", "/games/{id}/rules/{rule_id}/condition", &openapi.Operation{
+    Summary: "Set the condition on the numbers of players a rule is set up for, or clear it with an empty one. Sessions already started keep their steps.",
+    Parameters: []*openapi.Parameter{gameId, openapi.PathParameter("rule_id", "ID of one of the game's or its modules' rules", integer)},
+    RequestBody: body(doc.SchemaFor(&ConditionUpdateRequest{})),
+    Responses: map[string]*openapi.Response{
+      "200": ok(doc.SchemaFor(&RuleConditionHash{})),
+      "404": jsonError("No such game or rule"),
+      "422": jsonError("Invalid condition, or one that can't be evaluated for some number of players, such as by dividing by zero"),
+      "500": jsonError("Database error"),
+    },
+  })
+  doc.Add("GET", "/games/{id}/quantities", &openapi.Operation{
+    Summary: "List the values of the placeholders in the game's rules and its modules' rules, by number of players",
+    Parameters: []*openapi.Parameter{gameId},
+    Responses: map[string]*openapi.Response{
+      "200": ok(&openapi.Schema{Type: "array", Items: doc.SchemaFor(&RuleQuantitiesHash{})}),
+      "404": text("No such game"),
+    },
+  })
+  doc.Add("PUT", "/games/{id}/rules/{rule_id}/quantities", &openapi.Operation{
+    Summary: "Replace the values of the placeholders in braces in a rule's description and details, by placeholder and then by number of players, with * for any other number. Sessions already started keep their text.",
+    Parameters: []*openapi.Parameter{gameId, openapi.PathParameter("rule_id", "ID of one of the game's or its modules' rules", integer)},
+    RequestBody: body(doc.SchemaFor(&QuantitiesUpdateRequest{})),
+    Responses: map[string]*openapi.Response{
+      "200": ok(doc.SchemaFor(&RuleQuantitiesHash{})),
+      "404": jsonError("No such game or rule"),
+      "422": jsonError("Placeholders that aren't in the rule, or that have no value for some number of players the game is for, with every problem listed in the description, separated by semicolons"),
+      "500": jsonError("Database error"),
+    },
+  })
+
+  doc.Add("GET", "/players", &openapi.Operation{
+    Summary: "List all players",
+    Responses: map[string]*openapi.Response{
+      "200": ok(&openapi.Schema{Type: "array", Items: playerSchema}),
+      "500": text("Database error"),
+    },
+  })
+  doc.Add("GET", "/players/{player_id}", &openapi.Operation{
+    Summary: "Show a player",
+    Parameters: []*openapi.Parameter{playerId},
+    Responses: map[string]*openapi.Response{
+      "200": ok(playerSchema),
+      "404": text("No such player"),
+    },
+  })
+  doc.Add("POST", "/players", &openapi.Operation{
+    Summary: "Create a player",
+    Parameters: []*openapi.Parameter{idempotencyKey},
+    RequestBody: body(doc.SchemaFor(&PlayerCreateRequest{})),
+    Responses: map[string]*openapi.Response{
+      "201": &openapi.Response{Description: "Created", Content: openapi.JSONContent(playerSchema)},
+      "409": jsonError("Request with the same Idempotency-Key is still being served"),
+      "422": jsonError("Idempotency-Key was already used for a different request"),
+      "500": jsonError("Database error"),
+    },
+  })
+  doc.Add("DELETE", "/players/{player_id}", &openapi.Operation{
+    Summary: "Delete a player",
+    Parameters: []*openapi.Parameter{playerId},
+    Responses: map[string]*openapi.Response{
+      "200": &openapi.Response{Description: "Deleted"},
+      "404": text("Malformed player ID"),
+      "500": text("Database error"),
+    },
+  })
+
+  doc.Add("GET", "/sessions", &openapi.Operation{
+    Summary: "List all sessions",
+    Responses: map[string]*openapi.Response{
+      "200": ok(&openapi.Schema{Type: "array", Items: sessionSchema}),
+    },
+  })
+  doc.Add("POST", "/sessions", &openapi.Operation{
+    Summary: "Start a session of a game, assigning each player their first setup step by the session's strategy",
+    Parameters: []*openapi.Parameter{idempotencyKey},
+    RequestBody: body(doc.SchemaFor(&SessionCreateRequest{})),
+    Responses: map[string]*openapi.Response{
+      "201": &openapi.Response{Description: "Created", Content: openapi.JSONContent(sessionSchema)},
+      "409": jsonError("Request with the same Idempotency-Key is still being served"),
+      "422": jsonError("Invalid session, with every problem listed in the description, separated by semicolons. " +
+        "Or Idempotency-Key was already used for a different request."),
+      "500": jsonError("Database error"),
+    },
+  })
+  doc.Add("GET", "/sessions/{session_id}", &openapi.Operation{
+    Summary: "Show a session with its setup steps and assignments",
+    Parameters: []*openapi.Parameter{sessionId},
+    Responses: map[string]*openapi.Response{
+      "200": ok(sessionSchema),
+      "404": text("No such session"),
+    },
+  })
+  doc.Add("GET", "/sessions/{session_id}/checklist", &openapi.Operation{
+    Summary: "The session's setup checklist to print, with finished steps checked off",
+    Parameters: []*openapi.Parameter{sessionId, checklistFormat},
+    Responses: map[string]*openapi.Response{
+      "200": checklist,
+      "400": text("Unknown format"),
+      "404": text("No such session"),
+    },
+  })
+  doc.Add("GET", "/sessions/{session_id}/analysis", &openapi.Operation{
+    Summary: "What's left of the session's setup: rounds left, the critical path, and the unfinished steps " +
+      "holding up the most others",
+    Parameters: []*openapi.Parameter{sessionId},
+    Responses: map[string]*openapi.Response{
+      "200": ok(doc.SchemaFor(&setupgraph.SessionAnalysis{})),
+      "404": text("No such session"),
+      "500": text("The game's rules depend on each other in a cycle"),
+    },
+  })
+  doc.Add("GET", "/sessions/{session_id}/graph", &openapi.Operation{
+    Summary: "The session's setup steps and what each waits on, in DOT or SVG. Steps are labeled with " +
+      "their owners and who they're assigned to, and colored by whether they're done, assigned, blocked or ready.",
+    Parameters: []*openapi.Parameter{sessionId, graphFormat},
+    Responses: map[string]*openapi.Response{
+      "200": graph,
+      "400": text("Unknown format"),
+      "404": text("No such session"),
+      "500": text("SVG was asked for, and the game's rules depend on each other in a cycle"),
+    },
+  })
+  doc.Add("GET", "/sessions/{session_id}/updates", &openapi.Operation{
+    Summary: "A stream of Server-Sent Events, each an object with the session_id, sent on connecting and " +
+      "whenever the session changes. Fetch the session on each to follow it.",
+    Parameters: []*openapi.Parameter{sessionId},
+    Responses: map[string]*openapi.Response{
+      "200": &openapi.Response{Description: "OK", Content: map[string]*openapi.MediaType{
+        "text/event-stream": &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}},
+      }},
+      "404": text("No such session"),
+    },
+  })
+  doc.Add("PUT", "/sessions/{session_id}/players/{player_id}/steps/{step_desc}", &openapi.Operation{
+    Summary: "Finish a player's setup step and assign them the next one",
+    Parameters: []*openapi.Parameter{sessionId, playerId, stepDesc},
+    Responses: map[string]*openapi.Response{
+      "200": &openapi.Response{Description: "Step finished, or was already done"},
+      "400": text("Step description not properly escaped"),
+      "404": text("No such session, player in the session, or step"),
+      "500": text("Database error"),
+    },
+  })
+
+  doc.Add("POST", "/sessions/{session_id}/steps:batch", &openapi.Operation{
+    Summary: "Finish or reopen many steps, for any of the session's players, in one transaction. " +
+      "Steps are finished in dependency order, so a batch may include a step and the steps it depends on.",
+    Parameters: []*openapi.Parameter{sessionId},
+    RequestBody: body(doc.SchemaFor(&StepBatchRequest{})),
+    Responses: map[string]*openapi.Response{
+      "200": ok(doc.SchemaFor(&StepBatchResponse{})),
+      "404": jsonError("No such session"),
+      "422": jsonError("Invalid batch, with every problem listed in the description, separated by semicolons. Nothing was finished."),
+      "500": jsonError("Database error. Nothing was finished."),
+    },
+  })
+
+  webhookId := openapi.PathParameter("webhook_id", "ID of the webhook", integer)
+  webhookSchema := doc.SchemaFor(&Webhook{})
+  doc.Add("GET", "/webhooks", &openapi.Operation{
+    Summary: "List webhook subscriptions, without their secrets",
+    Responses: map[string]*openapi.Response{
+      "200": ok(&openapi.Schema{Type: "array", Items: webhookSchema}),
+      "500": text("Database error"),
+    },
+  })
+  doc.Add("POST", "/webhooks", &openapi.Operation{
+    Summary: "Subscribe a URL to events: " + strings.Join(webhookEvents, ", ") + ". " +
+      "Each event is POSTed as JSON, signed in the " + webhookSignatureHeader + " header with the secret, " +
+      "which is generated if not given and only shown in this response.",
+    Parameters: []*openapi.Parameter{idempotencyKey},
+    RequestBody: body(doc.SchemaFor(&WebhookCreateRequest{})),
+    Responses: map[string]*openapi.Response{
+      "201": &openapi.Response{Description: "Created", Content: openapi.JSONContent(webhookSchema)},
+      "409": jsonError("Request with the same Idempotency-Key is still being served"),
+      "422": jsonError("Invalid URL or events, with every problem listed in the description, or Idempotency-Key was already used for a different request"),
+      "500": jsonError("Database error"),
+    },
+  })
+  doc.Add("GET", "/webhooks/{webhook_id}", &openapi.Operation{
+    Summary: "Show a webhook subscription, without its secret",
+    Parameters: []*openapi.Parameter{webhookId},
+    Responses: map[string]*openapi.Response{
+      "200": ok(webhookSchema),
+      "404": text("No such webhook"),
+      "500": text("Database error"),
+    },
+  })
+  doc.Add("DELETE", "/webhooks/{webhook_id}", &openapi.Operation{
+    Summary: "Unsubscribe, dropping any deliveries still pending",
+    Parameters: []*openapi.Parameter{webhookId},
+    Responses: map[string]*openapi.Response{
+      "200": &openapi.Response{Description: "Deleted"},
+      "404": text("No such webhook"),
+      "500": text("Database error"),
+    },
+  })
+  doc.Add("GET", "/webhooks/{webhook_id}/deliveries", &openapi.Operation{
+    Summary: "The latest deliveries of events to a webhook, newest first, with the outcome of their last attempt",
+    Parameters: []*openapi.Parameter{webhookId},
+    Responses: map[string]*openapi.Response{
+      "200": ok(&openapi.Schema{Type: "array", Items: doc.SchemaFor(&WebhookDelivery{})}),
+      "404": text("No such webhook"),
+      "500": text("Database error"),
+    },
+  })
+
+  // GraphQL results are described by the schema, which clients can introspect
+  graphQLResult := &openapi.Schema{Type: "object"}
+  doc.Add("GET", "/graphql", &openapi.Operation{
+    Summary: "Run a GraphQL query over games, players and sessions. Mutations must be POSTed.",
+    Parameters: []*openapi.Parameter{
+      query("query", "The GraphQL query", true),
+      query("variables", "Values of the query's variables, as a JSON object", false),
+      query("operationName", "Which operation in the query to run", false),
+    },
+    Responses: map[string]*openapi.Response{
+      "200": ok(graphQLResult),
+      "400": jsonError("No query, or unparseable variables"),
+      "405": jsonError("The operation is a mutation"),
+    },
+  })
+  doc.Add("POST", "/graphql", &openapi.Operation{
+    Summary: "Run a GraphQL query or mutation over games, players and sessions. " +
+      "Mutations create sessions and finish or reopen steps, as POST /sessions and POST /sessions/{session_id}/steps:batch do.",
+    RequestBody: body(doc.SchemaFor(&GraphQLRequest{})),
+    Responses: map[string]*openapi.Response{
+      "200": ok(graphQLResult),
+      "400": jsonError("Unparseable request, or no query"),
+    },
+  })
+
+  doc.Add("GET", "/openapi.json", &openapi.Operation{
+    Summary: "This description of the API",
+    Responses: map[string]*openapi.Response{
+      "200": &openapi.Response{Description: "OK", Content: openapi.JSONContent(&openapi.Schema{Type: "object"})},
+    },
+  })
+
+  doc.Add("GET", "/healthz", &openapi.Operation{
+    Summary: "Liveness probe. Responds as long as the process can serve HTTP.",
+    Responses: map[string]*openapi.Response{
+      "200": ok(doc.SchemaFor(&HealthStatus{})),
+    },
+  })
+  readiness := doc.SchemaFor(&ReadinessStatus{})
+  doc.Add("GET", "/readyz", &openapi.Operation{
+    Summary: "Readiness probe. Checks the database, its schema version, and that games and sessions are loaded.",
+    Responses: map[string]*openapi.Response{
+      "200": ok(readiness),
+      "503": &openapi.Response{Description: "Not ready. The failing checks have details.", Content: openapi.JSONContent(readiness)},
+    },
+  })
+
+  doc.Add("GET", "/metrics", &openapi.Operation{
+    Summary: "Operational metrics in the Prometheus text format",
+    Responses: map[string]*openapi.Response{
+      "200": &openapi.Response{Description: "OK", Content: map[string]*openapi.MediaType{
+        "text/plain; version=0.0.4": &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}},
+      }},
+    },
+  })
+
+  // Routes that read the caches of games and sessions aren't available until they're loaded
+  for path, item := range doc.Paths {
+    if strings.HasPrefix(path, "/games") || strings.HasPrefix(path, "/sessions") || "/graphql" == path {
+      for _, op := range item {
+        op.Responses["503"] = text("Service is starting")
+      }
+    }
+  }
+
+  return doc
+}
+
+type OpenAPIHandler struct {
+  doc *openapi.Document
+}
+func (h OpenAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  w.Header().Set("Content-Type", "application/json")
+  err := json.NewEncoder(w).Encode(h.doc)
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+  "database/sql"
+  "encoding/json"
+  "net/http"
+  "net/url"
+  "sort"
+  "strconv"
+  "github.com/rkbodenner/meeple_mover/quantity"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+// Stands for any number of players a placeholder's table doesn't list
+const otherPlayers = "*"
+
+// Values of a rule's placeholders: by name, then by number of players
+type QuantitiesHash map[string]map[string]string
+
+type RuleQuantitiesHash struct {
+  RuleId int `json:"rule_id"`
+  Rule string `json:"rule"`  // Its description, with the placeholders
+  Details string `json:"details,omitempty"`
+  Quantities QuantitiesHash `json:"quantities"`
+}
+
+type QuantitiesUpdateRequest struct {
+  Quantities QuantitiesHash `json:"quantities"`
+}
+
+func ruleQuantitiesHash(rule *game.SetupRule, q quantity.Quantities) *RuleQuantitiesHash {
+  hash := &RuleQuantitiesHash{RuleId: rule.Id, Rule: rule.Description, Details: rule.Details, Quantities: make(QuantitiesHash)}
+  for name, table := range q {
+    values := make(map[string]string)
+    for players, value := range table {
+      if 0 == players {
+        values[otherPlayers] = value
+      } else {
+        values[strconv.Itoa(players)] = value
+      }
+    }
+    hash.Quantities[name] = values
+  }
+  return hash
+}
+
+type QuantitiesHandler struct {
+  srv *Server
+}
+func (h QuantitiesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+  if nil != err {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+  g, ok := h.srv.gameIndex[id]
+  if !ok {
+    http.Error(w, "Not found", http.StatusNotFound)
+    return
+  }
+
+  hashes := make([]*RuleQuantitiesHash, 0)
+  for _, rule := range h.srv.allRules(g) {
+    if q, ok := h.srv.quantities[rule.Id]; ok {
+      hashes = append(hashes, ruleQuantitiesHash(rule, q))
+    }
+  }
+  if err := json.NewEncoder(w).Encode(hashes); nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
+
+type QuantitiesUpdateHandler struct {
+  srv *Server
+}
+
+// Read the tables, and check that each is used by the rule and has a value for every number of players
+// the game is for, with any of its modules. Returns a *ValidationError listing every problem found.
+func (handler QuantitiesUpdateHandler) validate(g *game.Game, rule *game.SetupRule, hash QuantitiesHash) (quantity.Quantities, error) {
+  problems := &ValidationError{}
+  q := make(quantity.Quantities)
+  names := make([]string, 0, len(hash))
+  for name := range hash {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  for _, name := range names {
+    table := make(quantity.Table)
+    for players, value := range hash[name] {
+      if otherPlayers == players {
+        table[0] = value
+        continue
+      }
+      count, err := strconv.Atoi(players)
+      if nil != err || count < 1 {
+        problems.Add("Expected {%s}'s values to be for numbers of players, or %s for any other, got %q", name, otherPlayers, players)
+        continue
+      }
+      table[count] = value
+    }
+    q[name] = table
+  }
+
+  if minPlayers, maxPlayers, err := handler.srv.playerRange(g); nil != err {
+    problems.Add("%s", err.Error())
+  } else {
+    for _, problem := range q.Check([]string{rule.Description, rule.Details}, minPlayers, maxPlayers) {
+      problems.Add("%s", problem)
+    }
+  }
+  if problems.Any() {
+    return nil, problems
+  }
+  return q, nil
+}
+
+func (handler QuantitiesUpdateHandler) marshalFunc() (func(*url.URL, http.Header, *QuantitiesUpdateRequest) (int, http.Header, *RuleQuantitiesHash, error)) {
+  return func(u *url.URL, h http.Header, rq *QuantitiesUpdateRequest) (int, http.Header, *RuleQuantitiesHash, error) {
+    srv := handler.srv
+    g, rule, err := srv.findRule(u)
+    if nil != err {
+      return http.StatusNotFound, nil, nil, err
+    }
+
+    q, err := handler.validate(g, rule, rq.Quantities)
+    if nil != err {
+      return http.StatusUnprocessableEntity, nil, nil, err
+    }
+    err = srv.timed("SetQuantities", func() error { return srv.store.SetQuantities(rule, q) })
+    if sql.ErrNoRows == err {
+      return http.StatusNotFound, nil, nil, &StatusError{http.StatusNotFound, "Rule not found"}
+    } else if nil != err {
+      return http.StatusInternalServerError, nil, nil, err
+    }
+    if 0 == len(q) {
+      delete(srv.quantities, rule.Id)
+    } else {
+      srv.quantities[rule.Id] = q
+    }
+    srv.forgetUsefulPlayers((uint64)(g.Id))
+    srv.requestLog(h).Info("Set quantities", "game_id", g.Id, "rule_id", rule.Id, "placeholders", q.Names())
+    return http.StatusOK, nil, ruleQuantitiesHash(rule, q), nil
+  }
+}
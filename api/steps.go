@@ -0,0 +1,311 @@
+package api
+
+import (
+  "log/slog"
+  "net/http"
+  "net/url"
+  "strconv"
+  "github.com/rkbodenner/meeple_mover/assign"
+  "github.com/rkbodenner/meeple_mover/record"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// The session's own object for a player, or nil if they aren't playing
+func sessionPlayer(s *session.Session, id int) *game.Player {
+  for _, p := range s.Players {
+    if p.Id == id {
+      return p
+    }
+  }
+  return nil
+}
+
+// The step for a rule, by its description, that the player could own
+func findStep(s *session.Session, player *game.Player, desc string) *game.SetupStep {
+  for _, step := range s.SetupSteps {
+    if step.Rule.Description == desc && step.CanBeOwnedBy(player) {
+      return step
+    }
+  }
+  return nil
+}
+
+// Replace a cached session with what's in the store
+func (srv *Server) reloadSession(id uint) error {
+  var s *session.Session
+  err := srv.timed("FindSession", func() error {
+    var err error
+    s, err = srv.store.FindSession(id)
+    return err
+  })
+  if nil != err {
+    return err
+  }
+  srv.sessionIndex[(uint64)(id)] = s
+  for i, cached := range srv.sessions {
+    if cached.Id == id {
+      srv.sessions[i] = s
+    }
+  }
+  return nil
+}
+
+// How the session picks each player's next step
+func (srv *Server) strategy(s *session.Session) assign.Strategy {
+  if strategy, ok := srv.strategies[(uint64)(s.Id)]; ok {
+    return strategy
+  }
+  return assign.Default
+}
+
+// Whether the step's rule depends on the other's
+func dependsOn(step *game.SetupStep, other *game.SetupStep) bool {
+  for _, dep := range step.Rule.Dependencies {
+    if dep == other.Rule {
+      return true
+    }
+  }
+  return false
+}
+
+// The player assigned the step, or nil
+func assignee(s *session.Session, step *game.SetupStep) *game.Player {
+  for _, p := range s.Players {
+    if current, ok := s.SetupAssignments.Get(p); ok && current == step {
+      return p
+    }
+  }
+  return nil
+}
+
+func (srv *Server) finishSteps(log *slog.Logger, s *session.Session, steps []*game.SetupStep) error {
+  return srv.changeSteps(log, s, steps, nil)
+}
+
+// Reopen steps and finish others, then move every player whose step is done on to their next one,
+// as the session's strategy picks it. Players whose step depends on a reopened one are moved back
+// to it, if they can do it. The changes, and the webhook events reporting them, are stored
+// together. If they can't be, the cached session is reloaded from the store, so that it matches
+// what was stored.
+func (srv *Server) changeSteps(log *slog.Logger, s *session.Session, finish []*game.SetupStep, reopen []*game.SetupStep) error {
+  before := make(map[*game.Player]*game.SetupStep)
+  for _, p := range s.Players {
+    if step, ok := s.SetupAssignments.Get(p); ok {
+      before[p] = step
+    }
+  }
+  doneBefore := playersDone(s)
+  completedBefore := setupCompleted(s)
+  change := &StepChange{Session: s}
+
+  for _, step := range reopen {
+    step.Done = false
+    change.Steps = append(change.Steps, step)
+    log.Info("Reopened step", "step", s.StepWithAssigneeString(step))
+
+    for _, p := range s.Players {
+      current, ok := s.SetupAssignments.Get(p)
+      if ok && !current.Done && dependsOn(current, step) && step.CanBeOwnedBy(p) && nil == assignee(s, step) {
+        s.SetupAssignments.Set(p, step)
+      }
+    }
+  }
+
+  for _, step := range finish {
+    step.Finish()
+    change.Steps = append(change.Steps, step)
+    log.Info("Finished step", "step", s.StepWithAssigneeString(step))
+    change.Events = append(change.Events, &WebhookEvent{Event: eventStepFinished, SessionId: s.Id, Player: step.Owner, Step: step})
+  }
+
+  for _, p := range s.Players {
+    last := before[p]
+    next := assign.Step(srv.strategy(s), s, p)
+    if nil == next || next == last {
+      continue
+    }
+    if nil != last {
+      change.Unassigned = append(change.Unassigned, &record.SetupStepAssignmentRecord{s, p, last.Rule})
+    }
+    change.Assigned = append(change.Assigned, &record.SetupStepAssignmentRecord{s, p, next.Rule})
+    log.Info("Assigned step", "player_id", p.Id, "step", next.Rule.Description)
+  }
+
+  doneAfter := playersDone(s)
+  for _, p := range s.Players {
+    if doneAfter[p] && !doneBefore[p] {
+      log.Info("Player is done", "player_id", p.Id)
+      change.Events = append(change.Events, &WebhookEvent{Event: eventPlayerDone, SessionId: s.Id, Player: p})
+    }
+  }
+  if setupCompleted(s) && !completedBefore {
+    log.Info("Setup is complete")
+    change.Events = append(change.Events, &WebhookEvent{Event: eventSetupCompleted, SessionId: s.Id})
+  }
+
+  err := srv.timed("SaveSteps", func() error { return srv.store.SaveSteps(change) })
+  if nil != err {
+    if reloadErr := srv.reloadSession(s.Id); nil != reloadErr {
+      log.Error("Could not reload session after failing to store steps", "error", reloadErr)
+    }
+    return err
+  }
+  srv.stepsFinished.Add((float64)(len(finish)))
+  srv.updates.publish(s)
+  srv.wakeWebhookWorker()
+  return nil
+}
+
+type StepAction struct {
+  PlayerId string `json:"player_id"`
+  StepDesc string `json:"step_desc"`
+  Action string `json:"action"`  // "finish", the default, or "reopen"
+}
+
+type StepBatchRequest struct {
+  Steps []StepAction `json:"steps"`
+}
+
+// A player's current step. Done if they have nothing left to do.
+type StepAssignment struct {
+  Player *game.Player `json:"player"`
+  Step *game.SetupStep `json:"step"`
+  Done bool `json:"done"`
+}
+
+type StepBatchResponse struct {
+  Assignments []StepAssignment `json:"assignments"`
+}
+
+func assignments(s *session.Session) []StepAssignment {
+  list := make([]StepAssignment, 0, len(s.Players))
+  for _, p := range s.Players {
+    step, ok := s.SetupAssignments.Get(p)
+    if !ok {
+      step = nil
+    }
+    list = append(list, StepAssignment{p, step, nil == step || step.Done})
+  }
+  return list
+}
+
+type StepBatchHandler struct {
+  srv *Server
+}
+
+// Check every action against the session, returning the steps to finish in dependency order and the
+// steps to reopen, or a *ValidationError listing every problem found
+func (handler StepBatchHandler) validate(s *session.Session, rq *StepBatchRequest) ([]*game.SetupStep, []*game.SetupStep, error) {
+  problems := &ValidationError{}
+  if 0 == len(rq.Steps) {
+    problems.Add("Expected at least one step")
+  }
+
+  steps := make([]*game.SetupStep, 0)
+  reopen := make([]*game.SetupStep, 0)
+  seen := make(map[*game.SetupStep]bool)
+  reopening := make(map[*game.SetupStep]bool)
+  for i, action := range rq.Steps {
+    if "" != action.Action && "finish" != action.Action && "reopen" != action.Action {
+      problems.Add("Step %d: Unknown action %q", i, action.Action)
+      continue
+    }
+    player_id, err := strconv.ParseInt(action.PlayerId, 10, 32)
+    if nil != err {
+      problems.Add("Step %d: Expected integer player ID, got %q", i, action.PlayerId)
+      continue
+    }
+    player := sessionPlayer(s, (int)(player_id))
+    if nil == player {
+      problems.Add("Step %d: Player %d is not in this session", i, player_id)
+      continue
+    }
+    step := findStep(s, player, action.StepDesc)
+    switch {
+    case nil == step:
+      problems.Add("Step %d: No step %q for player %d", i, action.StepDesc, player_id)
+    case seen[step]:
+      problems.Add("Step %d: %q is already in this batch", i, action.StepDesc)
+    case "reopen" == action.Action && !step.Done:
+      problems.Add("Step %d: %q isn't done", i, action.StepDesc)
+    case "reopen" == action.Action:
+      seen[step] = true
+      reopening[step] = true
+      reopen = append(reopen, step)
+    case step.Done:
+      problems.Add("Step %d: %q is already done", i, action.StepDesc)
+    default:
+      seen[step] = true
+      steps = append(steps, step)
+    }
+  }
+
+  // Done steps mustn't be left depending on ones that aren't
+  for _, step := range reopen {
+    for _, other := range s.SetupSteps {
+      if other.Done && !reopening[other] && dependsOn(other, step) {
+        problems.Add("%q can't be reopened while %q, which depends on it, is done", step.Rule.Description, s.StepWithAssigneeString(other))
+      }
+    }
+  }
+
+  sorted, err := setupgraph.SortSteps(steps)
+  if nil != err {
+    problems.Add("%s", err)
+  } else {
+    for _, step := range sorted {
+      for _, blocker := range setupgraph.Blockers(s.SetupSteps, step) {
+        if !seen[blocker] {
+          problems.Add("%q depends on %q, which isn't done", step.Rule.Description, s.StepWithAssigneeString(blocker))
+        }
+      }
+      for _, other := range reopen {
+        if dependsOn(step, other) {
+          problems.Add("%q depends on %q, which is being reopened", step.Rule.Description, other.Rule.Description)
+        }
+      }
+    }
+  }
+
+  if problems.Any() {
+    return nil, nil, problems
+  }
+  return sorted, reopen, nil
+}
+
+func (handler StepBatchHandler) apply(log *slog.Logger, session_id uint64, rq *StepBatchRequest) (*session.Session, error) {
+  srv := handler.srv
+  s, ok := srv.sessionIndex[session_id]
+  if !ok {
+    return nil, &StatusError{http.StatusNotFound, "Session not found"}
+  }
+
+  finish, reopen, err := handler.validate(s, rq)
+  if nil != err {
+    return nil, err
+  }
+
+  err = srv.changeSteps(log.With("session_id", s.Id), s, finish, reopen)
+  if nil != err {
+    return nil, err
+  }
+  // The cached session may have been replaced
+  return srv.sessionIndex[session_id], nil
+}
+
+func (handler StepBatchHandler) marshalFunc() (func(*url.URL, http.Header, *StepBatchRequest) (int, http.Header, *StepBatchResponse, error)) {
+  return func(u *url.URL, h http.Header, rq *StepBatchRequest) (int, http.Header, *StepBatchResponse, error) {
+    session_id, err := strconv.ParseUint(u.Query().Get("session_id"), 10, 64)
+    if nil != err {
+      return http.StatusNotFound, nil, nil, &StatusError{http.StatusNotFound, "Session not found"}
+    }
+
+    s, err := handler.apply(handler.srv.requestLog(h), session_id, rq)
+    if nil != err {
+      return http.StatusInternalServerError, nil, nil, err
+    }
+    return http.StatusOK, nil, &StepBatchResponse{assignments(s)}, nil
+  }
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+  "database/sql"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "time"
+  "github.com/rkbodenner/meeple_mover/condition"
+  "github.com/rkbodenner/meeple_mover/expansion"
+  "github.com/rkbodenner/meeple_mover/quantity"
+  "github.com/rkbodenner/meeple_mover/record"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// Where the server keeps its data. The service runs on NewPostgresStore.
+// Finding anything that doesn't exist returns sql.ErrNoRows.
+type Store interface {
+  Ping() error
+  CheckSchemaVersion() error
+
+  Games() ([]*game.Game, error)
+  Modules(g *game.Game) ([]*expansion.Module, error)  // The game's expansions and variants
+  CreateModule(g *game.Game, m *expansion.Module) error  // Sets the IDs of the module and its rules
+  Conditions() (map[int]*condition.Condition, error)  // Of every rule that has one, by rule ID
+  SetCondition(rule *game.SetupRule, c *condition.Condition) error  // Clears it if c is empty
+  Quantities() (map[int]quantity.Quantities, error)  // Of every rule that has any, by rule ID
+  SetQuantities(rule *game.SetupRule, q quantity.Quantities) error  // Replaces the rule's
+
+  Players() ([]*game.Player, error)
+  FindPlayer(id int) (*game.Player, error)
+  CreatePlayer(player *game.Player) error  // Sets its ID
+  DeletePlayer(id int) error
+
+  Sessions() ([]*session.Session, error)
+  FindSession(id uint) (*session.Session, error)
+  CreateSession(s *session.Session, strategy string, modules []*expansion.Module) error  // Sets its ID
+  SessionStrategies() (map[uint]string, error)  // Names of each session's assign.Strategy, by ID
+  SessionModules() (map[uint][]string, error)  // Names of the modules each session has, by ID, leaving out those without
+  SaveSteps(change *StepChange) error  // All of it, or none of it
+
+  QueueWebhookEvent(event *WebhookEvent) error
+  Webhooks() ([]*record.WebhookRecord, error)
+  FindWebhook(id int) (*record.WebhookRecord, error)
+  CreateWebhook(hook *record.WebhookRecord) error
+  DeleteWebhook(hook *record.WebhookRecord) error
+  WebhookDeliveries(webhookId int, limit int) ([]*record.WebhookDeliveryRecord, error)
+  ClaimWebhookDeliveries(lease time.Duration, limit int) ([]*record.WebhookDeliveryRecord, error)
+  UpdateWebhookDelivery(delivery *record.WebhookDeliveryRecord) error
+
+  ReserveIdempotencyKey(key *record.IdempotencyKeyRecord, abandonedBefore time.Time) (bool, error)  // Takes over the key if it was reserved for the same request before abandonedBefore and never completed
+  FindIdempotencyKey(key string) (*record.IdempotencyKeyRecord, error)
+  CompleteIdempotencyKey(key *record.IdempotencyKeyRecord) error
+  DeleteIdempotencyKey(key *record.IdempotencyKeyRecord) error
+  PruneIdempotencyKeys(before time.Time) error
+}
+
+// Steps finished or reopened in a session, the assignments that moved as a result, and the webhook
+// events reporting it, to be stored together
+type StepChange struct {
+  Session *session.Session
+  Steps []*game.SetupStep
+  Unassigned []*record.SetupStepAssignmentRecord
+  Assigned []*record.SetupStepAssignmentRecord
+  Events []*WebhookEvent
+}
+
+// Stores everything in Postgres, through the record package
+type postgresStore struct {
+  db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) Store {
+  return &postgresStore{db}
+}
+
+func (store *postgresStore) Ping() error {
+  return store.db.Ping()
+}
+
+func (store *postgresStore) CheckSchemaVersion() error {
+  return record.CheckSchemaVersion(store.db)
+}
+
+func (store *postgresStore) Games() ([]*game.Game, error) {
+  recs := &record.GameRecordList{}
+  if err := recs.FindAll(store.db); nil != err {
+    return nil, err
+  }
+  return recs.List(), nil
+}
+
+func (store *postgresStore) Modules(g *game.Game) ([]*expansion.Module, error) {
+  return record.FindModulesByGame(store.db, g)
+}
+
+func (store *postgresStore) CreateModule(g *game.Game, m *expansion.Module) error {
+  return (&record.ModuleRecord{Module: m, Game: g}).Create(store.db)
+}
+
+func (store *postgresStore) Conditions() (map[int]*condition.Condition, error) {
+  return record.FindConditions(store.db)
+}
+
+func (store *postgresStore) SetCondition(rule *game.SetupRule, c *condition.Condition) error {
+  return (&record.SetupRuleRecord{Rule: rule, Condition: c}).UpdateCondition(store.db)
+}
+
+func (store *postgresStore) Quantities() (map[int]quantity.Quantities, error) {
+  return record.FindQuantities(store.db)
+}
+
+func (store *postgresStore) SetQuantities(rule *game.SetupRule, q quantity.Quantities) error {
+  return (&record.SetupRuleRecord{Rule: rule, Quantities: q}).UpdateQuantities(store.db)
+}
+
+func (store *postgresStore) Players() ([]*game.Player, error) {
+  recs := &record.PlayerRecordList{}
+  if err := recs.FindAll(store.db); nil != err {
+    return nil, err
+  }
+  return recs.List(), nil
+}
+
+func (store *postgresStore) FindPlayer(id int) (*game.Player, error) {
+  player := &game.Player{}
+  if err := (&record.PlayerRecord{player}).Find(store.db, id); nil != err {
+    return nil, err
+  }
+  return player, nil
+}
+
+func (store *postgresStore) CreatePlayer(player *game.Player) error {
+  return (&record.PlayerRecord{player}).Create(store.db)
+}
+
+func (store *postgresStore) DeletePlayer(id int) error {
+  return (&record.PlayerRecord{&game.Player{Id: id}}).Delete(store.db)
+}
+
+func (store *postgresStore) Sessions() ([]*session.Session, error) {
+  recs := &record.SessionRecordList{}
+  if err := recs.FindAll(store.db); nil != err {
+    return nil, err
+  }
+  return recs.List(), nil
+}
+
+func (store *postgresStore) FindSession(id uint) (*session.Session, error) {
+  s := session.NewEmptySession()
+  if err := record.NewSessionRecord(s).Find(store.db, (int)(id)); nil != err {
+    return nil, err
+  }
+  return s, nil
+}
+
+func (store *postgresStore) CreateSession(s *session.Session, strategy string, modules []*expansion.Module) error {
+  rec := record.NewSessionRecord(s)
+  rec.Strategy = strategy
+  rec.Modules = modules
+  return rec.Create(store.db)
+}
+
+func (store *postgresStore) SessionStrategies() (map[uint]string, error) {
+  return record.FindSessionStrategies(store.db)
+}
+
+func (store *postgresStore) SessionModules() (map[uint][]string, error) {
+  return record.FindSessionModules(store.db)
+}
+
+func (store *postgresStore) SaveSteps(change *StepChange) error {
+  tx, err := store.db.Begin()
+  if nil != err {
+    return err
+  }
+
+  err = func() error {
+    for _, step := range change.Steps {
+      rec := &record.SetupStepRecord{Step: step, SessionId: (int)(change.Session.Id)}
+      if err := rec.Update(tx); nil != err {
+        return errors.New(fmt.Sprintf("Error saving update to step: %s", err))
+      }
+    }
+    for _, rec := range change.Unassigned {
+      if err := rec.Delete(tx); nil != err {
+        return errors.New(fmt.Sprintf("Error removing assignment of last step: %s", err))
+      }
+    }
+    for _, rec := range change.Assigned {
+      if err := rec.Create(tx); nil != err {
+        return errors.New(fmt.Sprintf("Error creating assignment of next step: %s", err))
+      }
+    }
+    for _, event := range change.Events {
+      if err := queueWebhookEvent(tx, event); nil != err {
+        return errors.New(fmt.Sprintf("Error queueing webhook event: %s", err))
+      }
+    }
+    return nil
+  }()
+  if nil != err {
+    tx.Rollback()
+    return err
+  }
+  return tx.Commit()
+}
+
+// Queue the event for delivery to every webhook subscribed to it
+func queueWebhookEvent(q record.Queryer, event *WebhookEvent) error {
+  event.OccurredAt = time.Now().UTC()
+  payload, err := json.Marshal(event)
+  if nil != err {
+    return err
+  }
+  _, err = record.EnqueueWebhookDeliveries(q, event.Event, payload)
+  return err
+}
+
+func (store *postgresStore) QueueWebhookEvent(event *WebhookEvent) error {
+  return queueWebhookEvent(store.db, event)
+}
+
+func (store *postgresStore) Webhooks() ([]*record.WebhookRecord, error) {
+  return record.FindAllWebhooks(store.db)
+}
+
+func (store *postgresStore) FindWebhook(id int) (*record.WebhookRecord, error) {
+  rec := &record.WebhookRecord{}
+  if err := rec.Find(store.db, id); nil != err {
+    return nil, err
+  }
+  return rec, nil
+}
+
+func (store *postgresStore) CreateWebhook(hook *record.WebhookRecord) error {
+  return hook.Create(store.db)
+}
+
+func (store *postgresStore) DeleteWebhook(hook *record.WebhookRecord) error {
+  return hook.Delete(store.db)
+}
+
+func (store *postgresStore) WebhookDeliveries(webhookId int, limit int) ([]*record.WebhookDeliveryRecord, error) {
+  return record.FindWebhookDeliveries(store.db, webhookId, limit)
+}
+
+func (store *postgresStore) ClaimWebhookDeliveries(lease time.Duration, limit int) ([]*record.WebhookDeliveryRecord, error) {
+  return record.ClaimWebhookDeliveries(store.db, lease, limit)
+}
+
+func (store *postgresStore) UpdateWebhookDelivery(delivery *record.WebhookDeliveryRecord) error {
+  return delivery.Update(store.db)
+}
+
+func (store *postgresStore) ReserveIdempotencyKey(key *record.IdempotencyKeyRecord, abandonedBefore time.Time) (bool, error) {
+  return key.Reserve(store.db, abandonedBefore)
+}
+
+func (store *postgresStore) FindIdempotencyKey(key string) (*record.IdempotencyKeyRecord, error) {
+  rec := &record.IdempotencyKeyRecord{}
+  if err := rec.FindByKey(store.db, key); nil != err {
+    return nil, err
+  }
+  return rec, nil
+}
+
+func (store *postgresStore) CompleteIdempotencyKey(key *record.IdempotencyKeyRecord) error {
+  return key.Complete(store.db)
+}
+
+func (store *postgresStore) DeleteIdempotencyKey(key *record.IdempotencyKeyRecord) error {
+  return key.Delete(store.db)
+}
+
+func (store *postgresStore) PruneIdempotencyKeys(before time.Time) error {
+  _, err := record.PruneIdempotencyKeys(store.db, before)
+  return err
+}
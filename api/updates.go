@@ -0,0 +1,118 @@
+package api
+
+import (
+  "fmt"
+  "net/http"
+  "strconv"
+  "sync"
+  "time"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// How often to write a comment to an idle stream of updates, so proxies don't close it
+const updatesKeepAlive = 15 * time.Second
+
+// Tells watchers when a session changes. Each watcher only ever has the latest state of the session
+// waiting for it, so a slow watcher skips intermediate states rather than holding up the others.
+type sessionBroker struct {
+  mutex sync.Mutex
+  watchers map[uint64]map[chan *session.Session]bool
+}
+
+func newSessionBroker() *sessionBroker {
+  return &sessionBroker{watchers: make(map[uint64]map[chan *session.Session]bool)}
+}
+
+// Start watching a session. Call the returned func to stop.
+func (b *sessionBroker) watch(id uint64) (<-chan *session.Session, func()) {
+  ch := make(chan *session.Session, 1)
+  b.mutex.Lock()
+  defer b.mutex.Unlock()
+  if nil == b.watchers[id] {
+    b.watchers[id] = make(map[chan *session.Session]bool)
+  }
+  b.watchers[id][ch] = true
+
+  return ch, func() {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    delete(b.watchers[id], ch)
+    if 0 == len(b.watchers[id]) {
+      delete(b.watchers, id)
+    }
+  }
+}
+
+func (b *sessionBroker) publish(s *session.Session) {
+  b.mutex.Lock()
+  defer b.mutex.Unlock()
+  for ch := range b.watchers[(uint64)(s.Id)] {
+    // Replace any state the watcher hasn't taken yet
+    select {
+    case <-ch:
+    default:
+    }
+    ch <- s
+  }
+}
+
+// Streams Server-Sent Events telling the client each time a session changes, starting with one as
+// soon as it connects, so it can fetch the session then and after every change. Ends when the
+// client goes away or the server shuts down.
+type SessionUpdatesHandler struct {
+  srv *Server
+}
+func (h SessionUpdatesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  id, err := strconv.ParseUint(r.URL.Query().Get("session_id"), 10, 64)
+  if nil != err {
+    http.Error(w, "Session not found", http.StatusNotFound)
+    return
+  }
+  updates, stop := h.srv.updates.watch(id)
+  defer stop()
+  // Watch before looking for the session, so that no change is missed in between
+  h.srv.mutex.RLock()
+  _, ok := h.srv.sessionIndex[id]
+  h.srv.mutex.RUnlock()
+  if !ok {
+    http.Error(w, "Session not found", http.StatusNotFound)
+    return
+  }
+
+  // The stream outlasts the server's write timeout
+  rc := http.NewResponseController(w)
+  rc.SetWriteDeadline(time.Time{})
+  w.Header().Set("Content-Type", "text/event-stream")
+  w.Header().Set("Cache-Control", "no-cache")
+
+  send := func() error {
+    _, err := fmt.Fprintf(w, "event: session\ndata: {\"session_id\":%d}\n\n", id)
+    if nil == err {
+      err = rc.Flush()
+    }
+    return err
+  }
+  if err := send(); nil != err {
+    return
+  }
+
+  keepAlive := time.NewTicker(updatesKeepAlive)
+  defer keepAlive.Stop()
+  for {
+    select {
+    case <-updates:
+      if err := send(); nil != err {
+        return
+      }
+    case <-keepAlive.C:
+      if _, err := fmt.Fprint(w, ": keep-alive\n\n"); nil != err {
+        return
+      }
+      rc.Flush()
+    case <-r.Context().Done():
+      return
+    case <-h.srv.shuttingDown:
+      return
+    }
+  }
+}
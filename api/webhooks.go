@@ -0,0 +1,471 @@
+package api
+
+import (
+  "bytes"
+  "context"
+  "crypto/hmac"
+  "crypto/rand"
+  "crypto/sha256"
+  "database/sql"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "io"
+  "errors"
+  "log/slog"
+  "net"
+  "net/http"
+  "net/url"
+  "strconv"
+  "syscall"
+  "time"
+  "github.com/rkbodenner/meeple_mover/record"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+const (
+  eventSessionCreated = "session.created"
+  eventStepFinished = "step.finished"
+  eventPlayerDone = "player.done"
+  eventSetupCompleted = "setup.completed"
+)
+
+var webhookEvents = []string{eventSessionCreated, eventStepFinished, eventPlayerDone, eventSetupCompleted}
+
+const (
+  webhookSignatureHeader = "X-Meeple-Signature"
+  webhookEventHeader = "X-Meeple-Event"
+  webhookDeliveryHeader = "X-Meeple-Delivery"
+
+  webhookPollInterval = 5 * time.Second
+  // Backoff doubles from webhookFirstRetry up to webhookMaxRetry, so the last attempt is nearly 4 hours after the first
+  webhookMaxAttempts = 12
+  webhookFirstRetry = 10 * time.Second
+  webhookMaxRetry = time.Hour
+  webhookLogLimit = 100
+)
+
+// Vars so that tests can shorten them
+var (
+  // Attempts are cut off after this, whatever the client's own timeout
+  webhookTimeout = 10 * time.Second
+  // Deliveries are claimed one at a time, for longer than an attempt can take, so that no other server
+  // takes one while it's being attempted
+  webhookLease = time.Minute
+)
+
+// Nudge the worker to deliver newly queued events without waiting for its next poll
+func (srv *Server) wakeWebhookWorker() {
+  select {
+  case srv.webhookWake <- struct{}{}:
+  default:
+  }
+}
+
+// What's POSTed to webhooks. Which fields are set depends on the event.
+type WebhookEvent struct {
+  Event string `json:"event"`
+  OccurredAt time.Time `json:"occurred_at"`
+  SessionId uint `json:"session_id"`
+  Session *session.Session `json:"session,omitempty"`  // When created
+  Player *game.Player `json:"player,omitempty"`  // Who finished a step, or is done
+  Step *game.SetupStep `json:"step,omitempty"`
+}
+
+// Players who have no step left to do
+func playersDone(s *session.Session) map[*game.Player]bool {
+  done := make(map[*game.Player]bool)
+  for _, a := range assignments(s) {
+    done[a.Player] = a.Done
+  }
+  return done
+}
+
+func setupCompleted(s *session.Session) bool {
+  for _, step := range s.SetupSteps {
+    if !step.Done {
+      return false
+    }
+  }
+  return true
+}
+
+// Sign the body with the secret and time, so that receivers can check that it came from us, and
+// recently. The signature is "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">".
+func webhookSignature(secret string, at time.Time, body []byte) string {
+  timestamp := strconv.FormatInt(at.Unix(), 10)
+  mac := hmac.New(sha256.New, []byte(secret))
+  mac.Write([]byte(timestamp))
+  mac.Write([]byte("."))
+  mac.Write(body)
+  return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Whether receivers may be at the address. Anyone can add a webhook, so it mustn't be used to reach the
+// server's own network, or the cloud metadata service, unless that network is allowed.
+func webhookAddressAllowed(ip net.IP, allowed []*net.IPNet) bool {
+  for _, network := range allowed {
+    if network.Contains(ip) {
+      return true
+    }
+  }
+  return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+    ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// Checks the address each connection is actually made to, once the receiver's name is resolved, so
+// that a name can't be made to resolve to a public address when the webhook is added and a private one
+// when it's delivered to. Proxies are not used, since they'd connect on our behalf.
+func newWebhookClient(allowed []*net.IPNet) *http.Client {
+  dialer := &net.Dialer{
+    Timeout: webhookTimeout,
+    Control: func(network, address string, c syscall.RawConn) error {
+      host, _, err := net.SplitHostPort(address)
+      if nil != err {
+        return err
+      }
+      if ip := net.ParseIP(host); nil == ip || !webhookAddressAllowed(ip, allowed) {
+        return errors.New(fmt.Sprintf("Webhook receivers may not be at %s", host))
+      }
+      return nil
+    },
+  }
+  transport := http.DefaultTransport.(*http.Transport).Clone()
+  transport.Proxy = nil
+  transport.DialContext = dialer.DialContext
+  return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+// How long to wait after a failed attempt before the next
+func webhookBackoff(attempts int) time.Duration {
+  wait := webhookFirstRetry
+  for i := 1; i < attempts && wait < webhookMaxRetry; i++ {
+    wait *= 2
+  }
+  if wait > webhookMaxRetry {
+    wait = webhookMaxRetry
+  }
+  return wait
+}
+
+// POST the delivery, recording the outcome in it. Any 2xx response counts as delivered.
+func attemptDelivery(client *http.Client, delivery *record.WebhookDeliveryRecord, now time.Time) {
+  delivery.Attempts++
+  delivery.LastAttemptAt = &now
+  delivery.LastStatusCode = 0
+  delivery.LastError = ""
+
+  ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+  defer cancel()
+  rq, err := http.NewRequestWithContext(ctx, "POST", delivery.URL, bytes.NewReader(delivery.Payload))
+  if nil == err {
+    rq.Header.Set("Content-Type", "application/json")
+    rq.Header.Set("User-Agent", "meeple_mover-webhooks")
+    rq.Header.Set(webhookEventHeader, delivery.Event)
+    rq.Header.Set(webhookDeliveryHeader, strconv.Itoa(delivery.Id))
+    rq.Header.Set(webhookSignatureHeader, webhookSignature(delivery.Secret, now, delivery.Payload))
+
+    var resp *http.Response
+    resp, err = client.Do(rq)
+    if nil == err {
+      io.Copy(io.Discard, io.LimitReader(resp.Body, 64 << 10))
+      resp.Body.Close()
+      delivery.LastStatusCode = resp.StatusCode
+      if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        err = fmt.Errorf("Receiver responded %s", resp.Status)
+      }
+    }
+  }
+
+  switch {
+  case nil == err:
+    delivery.Status = record.DeliveryDelivered
+  case delivery.Attempts >= webhookMaxAttempts:
+    delivery.Status = record.DeliveryFailed
+    delivery.LastError = err.Error()
+  default:
+    delivery.Status = record.DeliveryPending
+    delivery.LastError = err.Error()
+    delivery.NextAttemptAt = now.Add(webhookBackoff(delivery.Attempts))
+  }
+}
+
+// Deliver everything that's due. Returns how many deliveries were attempted.
+func (srv *Server) deliverDueWebhooks(client *http.Client) (int, error) {
+  attempted := 0
+  for {
+    // Claimed one at a time, so that the lease only has to outlast one attempt
+    var claimed []*record.WebhookDeliveryRecord
+    err := srv.timed("ClaimWebhookDeliveries", func() error {
+      var err error
+      claimed, err = srv.store.ClaimWebhookDeliveries(webhookLease, 1)
+      return err
+    })
+    if nil != err {
+      return attempted, err
+    } else if 0 == len(claimed) {
+      return attempted, nil
+    }
+
+    delivery := claimed[0]
+    attemptDelivery(client, delivery, time.Now())
+    attempted++
+    srv.webhookDeliveries.Inc(delivery.Event, delivery.Status)
+
+    log := srv.log.With("webhook_id", delivery.WebhookId, "delivery_id", delivery.Id, "event", delivery.Event,
+      "attempts", delivery.Attempts, "status", delivery.Status)
+    if "" != delivery.LastError {
+      log.Warn("Could not deliver webhook event", "error", delivery.LastError)
+    } else {
+      log.Info("Delivered webhook event")
+    }
+    err = srv.timed("UpdateWebhookDelivery", func() error { return srv.store.UpdateWebhookDelivery(delivery) })
+    if nil != err {
+      // It will be attempted again once its lease runs out
+      log.Error("Could not store outcome of webhook delivery", "error", err)
+    }
+  }
+}
+
+// Deliver webhook events until the server is closed, whenever woken and every webhookPollInterval
+func (srv *Server) DeliverWebhooks() {
+  for {
+    if _, err := srv.deliverDueWebhooks(srv.config.WebhookClient); nil != err {
+      srv.log.Warn("Could not deliver webhook events", "error", err)
+    }
+    select {
+    case <-srv.shuttingDown:
+      return
+    case <-srv.webhookWake:
+    case <-time.After(webhookPollInterval):
+    }
+  }
+}
+
+// A webhook as shown to clients. The secret is only shown when it's created.
+type Webhook struct {
+  Id int `json:"id"`
+  URL string `json:"url"`
+  Events []string `json:"events"`
+  Secret string `json:"secret,omitempty"`
+  CreatedAt time.Time `json:"created_at"`
+}
+
+func webhookFromRecord(rec *record.WebhookRecord) *Webhook {
+  return &Webhook{Id: rec.Id, URL: rec.URL, Events: rec.Events, CreatedAt: rec.CreatedAt}
+}
+
+type WebhookDelivery struct {
+  Id int `json:"id"`
+  Event string `json:"event"`
+  Payload json.RawMessage `json:"payload"`
+  Status string `json:"status"`
+  Attempts int `json:"attempts"`
+  NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`  // While pending
+  LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+  LastStatusCode int `json:"last_status_code,omitempty"`
+  LastError string `json:"last_error,omitempty"`
+  CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhooksHandler struct {
+  srv *Server
+}
+func (h WebhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  var recs []*record.WebhookRecord
+  err := h.srv.timed("Webhooks", func() error {
+    var err error
+    recs, err = h.srv.store.Webhooks()
+    return err
+  })
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+    return
+  }
+
+  hooks := make([]*Webhook, 0, len(recs))
+  for _, rec := range recs {
+    hooks = append(hooks, webhookFromRecord(rec))
+  }
+  w.Header().Set("Content-Type", "application/json")
+  err = json.NewEncoder(w).Encode(hooks)
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
+
+// The webhook named by the webhook_id parameter, or nil if there's no such webhook
+func (srv *Server) findWebhook(r *http.Request) (*record.WebhookRecord, error) {
+  id, err := strconv.ParseUint(r.URL.Query().Get("webhook_id"), 10, 31)
+  if nil != err {
+    return nil, nil
+  }
+  var rec *record.WebhookRecord
+  err = srv.timed("FindWebhook", func() error {
+    var err error
+    rec, err = srv.store.FindWebhook((int)(id))
+    return err
+  })
+  if sql.ErrNoRows == err {
+    return nil, nil
+  } else if nil != err {
+    return nil, err
+  }
+  return rec, nil
+}
+
+type WebhookHandler struct {
+  srv *Server
+}
+func (h WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  rec, err := h.srv.findWebhook(r)
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+    return
+  } else if nil == rec {
+    http.Error(w, "Webhook not found", http.StatusNotFound)
+    return
+  }
+
+  w.Header().Set("Content-Type", "application/json")
+  err = json.NewEncoder(w).Encode(webhookFromRecord(rec))
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
+
+type WebhookCreateHash struct {
+  URL string `json:"url"`
+  Events []string `json:"events"`
+  Secret string `json:"secret"`  // Generated if not given
+}
+type WebhookCreateRequest struct {
+  Webhook WebhookCreateHash `json:"webhook"`
+}
+
+type WebhookCreateHandler struct {
+  srv *Server
+}
+
+func (handler WebhookCreateHandler) validate(rq *WebhookCreateRequest) error {
+  problems := &ValidationError{}
+  u, err := url.Parse(rq.Webhook.URL)
+  if nil != err || ("http" != u.Scheme && "https" != u.Scheme) || "" == u.Host {
+    problems.Add("Expected an http or https URL, got %q", rq.Webhook.URL)
+  }
+  if 0 == len(rq.Webhook.Events) {
+    problems.Add("Expected at least one event")
+  }
+  for _, event := range rq.Webhook.Events {
+    known := false
+    for _, e := range webhookEvents {
+      known = known || e == event
+    }
+    if !known {
+      problems.Add("Unknown event %q. Expected one of %v", event, webhookEvents)
+    }
+  }
+  if problems.Any() {
+    return problems
+  }
+  return nil
+}
+
+func (handler WebhookCreateHandler) marshalFunc() (func(*url.URL, http.Header, *WebhookCreateRequest) (int, http.Header, *Webhook, error)) {
+  return func(u *url.URL, h http.Header, rq *WebhookCreateRequest) (int, http.Header, *Webhook, error) {
+    if err := handler.validate(rq); nil != err {
+      return http.StatusUnprocessableEntity, nil, nil, err
+    }
+
+    rec := &record.WebhookRecord{URL: rq.Webhook.URL, Events: rq.Webhook.Events, Secret: rq.Webhook.Secret}
+    if "" == rec.Secret {
+      b := make([]byte, 32)
+      if _, err := rand.Read(b); nil != err {
+        return http.StatusInternalServerError, nil, nil, err
+      }
+      rec.Secret = hex.EncodeToString(b)
+    }
+    err := handler.srv.timed("CreateWebhook", func() error { return handler.srv.store.CreateWebhook(rec) })
+    if nil != err {
+      return http.StatusInternalServerError, nil, nil, &StatusError{http.StatusInternalServerError, "Could not create webhook in database"}
+    }
+
+    handler.srv.requestLog(h).Info("Created webhook", "webhook_id", rec.Id, "url", rec.URL, "events", rec.Events)
+    hook := webhookFromRecord(rec)
+    hook.Secret = rec.Secret
+    return http.StatusCreated, nil, hook, nil
+  }
+}
+
+type WebhookDeleteHandler struct {
+  srv *Server
+}
+func (h WebhookDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  rec, err := h.srv.findWebhook(r)
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+    return
+  } else if nil == rec {
+    http.Error(w, "Webhook not found", http.StatusNotFound)
+    return
+  }
+
+  err = h.srv.timed("DeleteWebhook", func() error { return h.srv.store.DeleteWebhook(rec) })
+  if nil != err {
+    http.Error(w, "Could not delete webhook from database", http.StatusInternalServerError)
+    return
+  }
+  h.srv.requestLog(r.Header).Info("Deleted webhook", "webhook_id", rec.Id)
+}
+
+type WebhookDeliveriesHandler struct {
+  srv *Server
+}
+func (h WebhookDeliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  rec, err := h.srv.findWebhook(r)
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+    return
+  } else if nil == rec {
+    http.Error(w, "Webhook not found", http.StatusNotFound)
+    return
+  }
+
+  var recs []*record.WebhookDeliveryRecord
+  err = h.srv.timed("WebhookDeliveries", func() error {
+    var err error
+    recs, err = h.srv.store.WebhookDeliveries(rec.Id, webhookLogLimit)
+    return err
+  })
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+    return
+  }
+
+  deliveries := make([]*WebhookDelivery, 0, len(recs))
+  for _, d := range recs {
+    delivery := &WebhookDelivery{Id: d.Id, Event: d.Event, Payload: d.Payload, Status: d.Status, Attempts: d.Attempts,
+      LastAttemptAt: d.LastAttemptAt, LastStatusCode: d.LastStatusCode, LastError: d.LastError, CreatedAt: d.CreatedAt}
+    if record.DeliveryPending == d.Status {
+      next := d.NextAttemptAt
+      delivery.NextAttemptAt = &next
+    }
+    deliveries = append(deliveries, delivery)
+  }
+  w.Header().Set("Content-Type", "application/json")
+  err = json.NewEncoder(w).Encode(deliveries)
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
+
+// Log rather than fail when events can't be queued for changes that have already been stored
+func (srv *Server) queueWebhookEventOrLog(log *slog.Logger, event *WebhookEvent) {
+  err := srv.timed("QueueWebhookEvent", func() error { return srv.store.QueueWebhookEvent(event) })
+  if nil != err {
+    log.Error("Could not queue webhook event", "event", event.Event, "error", err)
+    return
+  }
+  srv.wakeWebhookWorker()
+}
@@ -0,0 +1,245 @@
+/*
+
+Strategies for deciding which step a player does next, in place of the session's own Step and
+StepAllPlayers. Each session uses one, chosen by name when it's created.
+
+A strategy only chooses among the steps a player could start now: steps that aren't done, that the
+player could own, that nobody else is assigned, and whose dependencies are done. A player keeps their
+step until it's done, whatever the strategy.
+
+  next := assign.Step(assign.Lookup("balanced"), s, player)
+
+*/
+
+package assign
+
+import (
+  "sort"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+type Strategy interface {
+  // Stored with each session that uses the strategy, so it mustn't change
+  Name() string
+  // The player's next step, out of the candidates, which are in the session's order and never empty
+  Choose(s *session.Session, p *game.Player, candidates []*game.SetupStep) *game.SetupStep
+}
+
+// The strategy of sessions that don't choose one
+var Default Strategy = First{}
+
+var strategies = make(map[string]Strategy)
+
+// Make the strategy available by its name, replacing any of the same name. Call it from an init
+// function, since strategies are looked up without locking.
+func Register(strategy Strategy) {
+  strategies[strategy.Name()] = strategy
+}
+
+func init() {
+  Register(First{})
+  Register(Balanced{})
+  Register(Unblocking{})
+  Register(Related{})
+}
+
+// The strategy registered under the name, the default for "", or nil if there's no such strategy
+func Lookup(name string) Strategy {
+  if "" == name {
+    return Default
+  }
+  return strategies[name]
+}
+
+// Names of every registered strategy, sorted
+func Names() []string {
+  names := make([]string, 0, len(strategies))
+  for name := range strategies {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+// Whether anyone is assigned the step
+func assigned(s *session.Session, step *game.SetupStep) bool {
+  for _, p := range s.Players {
+    if current, ok := s.SetupAssignments.Get(p); ok && current == step {
+      return true
+    }
+  }
+  return false
+}
+
+// The steps the player could start now, in the session's order
+func Candidates(s *session.Session, p *game.Player) []*game.SetupStep {
+  candidates := make([]*game.SetupStep, 0)
+  for _, step := range s.SetupSteps {
+    if !step.Done && step.CanBeOwnedBy(p) && !assigned(s, step) && 0 == len(setupgraph.Blockers(s.SetupSteps, step)) {
+      candidates = append(candidates, step)
+    }
+  }
+  return candidates
+}
+
+// Assign the player their next step, if their current one is done and the strategy finds another.
+// Returns their step, which is nil if they have never had one, or done if there's nothing left to give them.
+func Step(strategy Strategy, s *session.Session, p *game.Player) *game.SetupStep {
+  current, ok := s.SetupAssignments.Get(p)
+  if !ok {
+    current = nil
+  }
+  if nil != current && !current.Done {
+    return current
+  }
+
+  candidates := Candidates(s, p)
+  if 0 == len(candidates) {
+    return current
+  }
+  next := strategy.Choose(s, p, candidates)
+  if nil == next {
+    return current
+  }
+  s.SetupAssignments.Set(p, next)
+  return next
+}
+
+// Step each player, in the session's order
+func StepAllPlayers(strategy Strategy, s *session.Session) {
+  for _, p := range s.Players {
+    Step(strategy, s, p)
+  }
+}
+
+// The first candidate for which score is highest
+func best(candidates []*game.SetupStep, score func(*game.SetupStep) int) *game.SetupStep {
+  chosen, highest := candidates[0], score(candidates[0])
+  for _, step := range candidates[1:] {
+    if n := score(step); n > highest {
+      chosen, highest = step, n
+    }
+  }
+  return chosen
+}
+
+// Assigns steps in the order the game lists its rules, as the session itself does
+type First struct{}
+
+func (First) Name() string {
+  return "first"
+}
+
+func (First) Choose(s *session.Session, p *game.Player, candidates []*game.SetupStep) *game.SetupStep {
+  return candidates[0]
+}
+
+// Spreads the work that's left: players with less of their own to do take the steps done once for
+// everyone, while the others get on with theirs
+type Balanced struct{}
+
+func (Balanced) Name() string {
+  return "balanced"
+}
+
+// Steps the player owns that aren't done
+func remaining(s *session.Session, p *game.Player) int {
+  n := 0
+  for _, step := range s.SetupSteps {
+    if !step.Done && nil != step.Owner && step.Owner.Id == p.Id {
+      n++
+    }
+  }
+  return n
+}
+
+func (Balanced) Choose(s *session.Session, p *game.Player, candidates []*game.SetupStep) *game.SetupStep {
+  mine := remaining(s, p)
+  busiest := 0
+  for _, other := range s.Players {
+    if other.Id != p.Id {
+      if n := remaining(s, other); n > busiest {
+        busiest = n
+      }
+    }
+  }
+  preferShared := mine < busiest
+  return best(candidates, func(step *game.SetupStep) int {
+    if (nil == step.Owner) == preferShared {
+      return 1
+    }
+    return 0
+  })
+}
+
+// Assigns first the steps that the most other steps are waiting on, directly or not
+type Unblocking struct{}
+
+func (Unblocking) Name() string {
+  return "unblocking"
+}
+
+// Whether the rule depends on the other, directly or through rules it depends on
+func dependsOn(rule *game.SetupRule, other *game.SetupRule, seen map[*game.SetupRule]bool) bool {
+  for _, dep := range rule.Dependencies {
+    if dep == other {
+      return true
+    }
+    if !seen[dep] {
+      seen[dep] = true
+      if dependsOn(dep, other, seen) {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+// Steps that aren't done and can't be until the step is
+func waiting(s *session.Session, step *game.SetupStep) int {
+  n := 0
+  for _, other := range s.SetupSteps {
+    if !other.Done && dependsOn(other.Rule, step.Rule, make(map[*game.SetupRule]bool)) {
+      n++
+    }
+  }
+  return n
+}
+
+func (Unblocking) Choose(s *session.Session, p *game.Player, candidates []*game.SetupStep) *game.SetupStep {
+  return best(candidates, func(step *game.SetupStep) int {
+    return waiting(s, step)
+  })
+}
+
+// Keeps each player on steps related to the one they just did: those that depend on it first, then
+// those that depend on something it depends on
+type Related struct{}
+
+func (Related) Name() string {
+  return "related"
+}
+
+func (Related) Choose(s *session.Session, p *game.Player, candidates []*game.SetupStep) *game.SetupStep {
+  last, ok := s.SetupAssignments.Get(p)
+  if !ok || nil == last {
+    return candidates[0]
+  }
+  return best(candidates, func(step *game.SetupStep) int {
+    for _, dep := range step.Rule.Dependencies {
+      if dep == last.Rule {
+        return 2
+      }
+    }
+    for _, dep := range step.Rule.Dependencies {
+      for _, lastDep := range last.Rule.Dependencies {
+        if dep == lastDep {
+          return 1
+        }
+      }
+    }
+    return 0
+  })
+}
@@ -0,0 +1,132 @@
+package assign
+
+import (
+  "testing"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+var (
+  shuffle = &game.SetupRule{Id: 1, Description: "Shuffle", Arity: "Once"}
+  board = &game.SetupRule{Id: 2, Description: "Lay out the board", Arity: "Once"}
+  deal = &game.SetupRule{Id: 3, Description: "Deal cards", Arity: "Each player", Dependencies: []*game.SetupRule{shuffle}}
+  pawn = &game.SetupRule{Id: 4, Description: "Place pawn", Arity: "Each player", Dependencies: []*game.SetupRule{board}}
+  tokens = &game.SetupRule{Id: 5, Description: "Place tokens", Arity: "Once", Dependencies: []*game.SetupRule{board}}
+)
+
+func testSession(t *testing.T) (*session.Session, *game.Player, *game.Player) {
+  alice := &game.Player{Id: 1, Name: "Alice"}
+  bob := &game.Player{Id: 2, Name: "Bob"}
+  g := &game.Game{Id: 1, Name: "Test", MinPlayers: 2, MaxPlayers: 4, SetupRules: []*game.SetupRule{shuffle, board, deal, pawn, tokens}}
+  s, err := session.NewSession(g, []*game.Player{alice, bob})
+  if nil != err {
+    t.Fatal(err)
+  }
+  return s, alice, bob
+}
+
+// The session's step for the rule, owned by the player or by nobody
+func step(s *session.Session, rule *game.SetupRule, p *game.Player) *game.SetupStep {
+  for _, step := range s.SetupSteps {
+    if step.Rule == rule && (nil == step.Owner || step.Owner == p) {
+      return step
+    }
+  }
+  return nil
+}
+
+func TestStepAllPlayers_First(t *testing.T) {
+  s, alice, bob := testSession(t)
+  StepAllPlayers(Default, s)
+  if next, _ := s.SetupAssignments.Get(alice); next.Rule != shuffle {
+    t.Errorf("Expected Alice to shuffle, got %s", next)
+  }
+  if next, _ := s.SetupAssignments.Get(bob); next.Rule != board {
+    t.Errorf("Expected Bob to lay out the board, got %s", next)
+  }
+}
+
+func TestStep_KeepsUnfinishedStep(t *testing.T) {
+  s, alice, _ := testSession(t)
+  s.SetupAssignments.Set(alice, step(s, board, alice))
+  if next := Step(Unblocking{}, s, alice); next.Rule != board {
+    t.Errorf("Expected Alice to keep the board, got %s", next)
+  }
+}
+
+func TestStep_NothingLeft(t *testing.T) {
+  s, alice, _ := testSession(t)
+  if next := Step(Default, s, alice); nil == next {
+    t.Fatal("Expected a step")
+  }
+  for _, step := range s.SetupSteps {
+    step.Done = true
+  }
+  last, _ := s.SetupAssignments.Get(alice)
+  if next := Step(Default, s, alice); next != last {
+    t.Errorf("Expected Alice to be left with her last step, got %s", next)
+  }
+}
+
+func TestUnblocking(t *testing.T) {
+  s, alice, _ := testSession(t)
+  // Both pawns and the tokens wait on the board, but only the two hands of cards on the shuffle
+  if next := Step(Unblocking{}, s, alice); next.Rule != board {
+    t.Errorf("Expected Alice to lay out the board, got %s", next)
+  }
+}
+
+func TestBalanced(t *testing.T) {
+  s, alice, bob := testSession(t)
+  step(s, shuffle, nil).Done = true
+  step(s, board, nil).Done = true
+  alicePawn := step(s, pawn, alice)
+  alicePawn.Done = true
+  s.SetupAssignments.Set(alice, alicePawn)
+
+  // Alice has only her cards left, while Bob has his cards and pawn, so she takes the tokens
+  if next := Step(Balanced{}, s, alice); next.Rule != tokens {
+    t.Errorf("Expected Alice to place the tokens, got %s", next)
+  }
+  if next := Step(Balanced{}, s, bob); next.Rule != deal || next.Owner != bob {
+    t.Errorf("Expected Bob to deal his cards, got %s", next)
+  }
+}
+
+func TestRelated(t *testing.T) {
+  s, alice, _ := testSession(t)
+  step(s, shuffle, nil).Done = true
+  last := step(s, board, nil)
+  last.Done = true
+  s.SetupAssignments.Set(alice, last)
+
+  if next := Step(Related{}, s, alice); next.Rule != pawn {
+    t.Errorf("Expected Alice to place her pawn on the board she laid out, got %s", next)
+  }
+}
+
+type lastStrategy struct{}
+
+func (lastStrategy) Name() string {
+  return "last"
+}
+
+func (lastStrategy) Choose(s *session.Session, p *game.Player, candidates []*game.SetupStep) *game.SetupStep {
+  return candidates[len(candidates) - 1]
+}
+
+func TestRegister(t *testing.T) {
+  if nil != Lookup("last") {
+    t.Fatal("Expected no strategy named last yet")
+  }
+  Register(lastStrategy{})
+  defer delete(strategies, "last")
+
+  s, alice, _ := testSession(t)
+  if next := Step(Lookup("last"), s, alice); next.Rule != board {
+    t.Errorf("Expected Alice to lay out the board, got %s", next)
+  }
+  if Lookup("") != Default {
+    t.Error("Expected the default strategy for no name")
+  }
+}
@@ -0,0 +1,207 @@
+/*
+
+Render a game's setup steps as a checklist to print, for players who don't use phones at the table.
+
+Steps are grouped by player, with the steps done once for everyone in a section of their own. Each
+rule is numbered in an order that respects its dependencies, and each step notes the numbers of
+the rules that must be done before it, so that players working through their own sections can
+tell when to wait for each other.
+
+*/
+
+package checklist
+
+import (
+  "errors"
+  "fmt"
+  "html/template"
+  "io"
+  "strings"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+type Item struct {
+  Number int
+  Description string
+  Details string
+  After []int  // Numbers of the rules to do first
+  Done bool
+}
+
+// The steps for one player, or the shared steps if Player is nil
+type Section struct {
+  Title string
+  Player *game.Player
+  Items []Item
+}
+
+type Checklist struct {
+  Title string
+  Sections []Section
+}
+
+// A checklist of the steps, in sections for the shared steps and for each of the players
+func New(title string, steps []*game.SetupStep, players []*game.Player) (*Checklist, error) {
+  sorted, err := setupgraph.SortSteps(steps)
+  if nil != err {
+    return nil, err
+  }
+
+  numbers := make(map[*game.SetupRule]int)
+  for _, step := range sorted {
+    if _, ok := numbers[step.Rule]; !ok {
+      numbers[step.Rule] = len(numbers) + 1
+    }
+  }
+
+  shared := Section{Title: "Everyone"}
+  sections := make([]Section, len(players))
+  sectionIndex := make(map[int]int)
+  for i, p := range players {
+    sections[i] = Section{Title: p.Name, Player: p}
+    sectionIndex[p.Id] = i
+  }
+
+  for _, step := range sorted {
+    item := Item{Number: numbers[step.Rule], Description: step.Rule.Description, Details: step.Rule.Details, Done: step.Done}
+    for _, dep := range step.Rule.Dependencies {
+      if n, ok := numbers[dep]; ok {
+        item.After = append(item.After, n)
+      }
+    }
+
+    if nil == step.Owner {
+      shared.Items = append(shared.Items, item)
+      continue
+    }
+    i, ok := sectionIndex[step.Owner.Id]
+    if !ok {
+      return nil, errors.New(fmt.Sprintf("Step %q is for player %d, who isn't playing", step.Rule.Description, step.Owner.Id))
+    }
+    sections[i].Items = append(sections[i].Items, item)
+  }
+
+  checklist := &Checklist{Title: title}
+  if len(shared.Items) > 0 {
+    checklist.Sections = append(checklist.Sections, shared)
+  }
+  checklist.Sections = append(checklist.Sections, sections...)
+  return checklist, nil
+}
+
+// The checklist for a session, with the steps done so far checked off
+func ForSession(s *session.Session) (*Checklist, error) {
+  return New(fmt.Sprintf("%s setup", s.Game.Name), s.SetupSteps, s.Players)
+}
+
+// The checklist for a game with the given number of players, who are named Player 1, Player 2, etc.
+func ForGame(g *game.Game, playerCount int) (*Checklist, error) {
+  if playerCount < g.MinPlayers || playerCount > g.MaxPlayers {
+    return nil, errors.New(fmt.Sprintf("%s is for %d to %d players, not %d", g.Name, g.MinPlayers, g.MaxPlayers, playerCount))
+  }
+  players := make([]*game.Player, playerCount)
+  for i := range players {
+    players[i] = &game.Player{Id: i + 1, Name: fmt.Sprintf("Player %d", i + 1)}
+  }
+  s, err := session.NewSession(g, players)
+  if nil != err {
+    return nil, err
+  }
+  return New(fmt.Sprintf("%s setup for %d players", g.Name, playerCount), s.SetupSteps, players)
+}
+
+func after(numbers []int) string {
+  if 0 == len(numbers) {
+    return ""
+  }
+  strs := make([]string, len(numbers))
+  for i, n := range numbers {
+    strs[i] = fmt.Sprintf("%d", n)
+  }
+  return "after " + strings.Join(strs, ", ")
+}
+
+func checkbox(done bool) string {
+  if done {
+    return "[x]"
+  }
+  return "[ ]"
+}
+
+// Write the checklist as Markdown, with a task list for each section
+func (c *Checklist) Markdown(w io.Writer) error {
+  var b strings.Builder
+  fmt.Fprintf(&b, "# %s\n", c.Title)
+  for _, section := range c.Sections {
+    fmt.Fprintf(&b, "\n## %s\n\n", section.Title)
+    for _, item := range section.Items {
+      fmt.Fprintf(&b, "- %s %d. %s", checkbox(item.Done), item.Number, item.Description)
+      if a := after(item.After); "" != a {
+        fmt.Fprintf(&b, " _(%s)_", a)
+      }
+      b.WriteString("\n")
+      if "" != item.Details {
+        fmt.Fprintf(&b, "  %s\n", strings.ReplaceAll(item.Details, "\n", "\n  "))
+      }
+    }
+  }
+  _, err := io.WriteString(w, b.String())
+  return err
+}
+
+// Write the checklist as plain text, for the narrowest of printers
+func (c *Checklist) Text(w io.Writer) error {
+  var b strings.Builder
+  fmt.Fprintf(&b, "%s\n%s\n", c.Title, strings.Repeat("=", len(c.Title)))
+  for _, section := range c.Sections {
+    fmt.Fprintf(&b, "\n%s\n%s\n", section.Title, strings.Repeat("-", len(section.Title)))
+    for _, item := range section.Items {
+      fmt.Fprintf(&b, "%s %d. %s", checkbox(item.Done), item.Number, item.Description)
+      if a := after(item.After); "" != a {
+        fmt.Fprintf(&b, " (%s)", a)
+      }
+      b.WriteString("\n")
+      if "" != item.Details {
+        fmt.Fprintf(&b, "      %s\n", strings.ReplaceAll(item.Details, "\n", "\n      "))
+      }
+    }
+  }
+  _, err := io.WriteString(w, b.String())
+  return err
+}
+
+var htmlTemplate = template.Must(template.New("checklist").Funcs(template.FuncMap{"after": after}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+  body { font-family: Georgia, serif; max-width: 40em; margin: 2em auto; }
+  section { break-inside: avoid; margin-bottom: 1.5em; }
+  ul { list-style: none; padding-left: 0; }
+  li { margin: 0.5em 0; }
+  .box { display: inline-block; width: 0.9em; height: 0.9em; border: 1px solid black; margin-right: 0.4em; text-align: center; line-height: 0.9em; }
+  .after { font-style: italic; color: #555; }
+  .details { margin: 0.2em 0 0 1.7em; font-size: 0.9em; white-space: pre-line; }
+  @media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Sections}}<section>
+<h2>{{.Title}}</h2>
+<ul>
+{{range .Items}}<li><span class="box">{{if .Done}}&#10003;{{end}}</span>{{.Number}}. {{.Description}}{{with after .After}} <span class="after">({{.}})</span>{{end}}{{with .Details}}
+<div class="details">{{.}}</div>{{end}}</li>
+{{end}}</ul>
+</section>
+{{end}}</body>
+</html>
+`))
+
+// Write the checklist as a page to print, with each section kept on one page where possible
+func (c *Checklist) HTML(w io.Writer) error {
+  return htmlTemplate.Execute(w, c)
+}
@@ -0,0 +1,96 @@
+package checklist
+
+import (
+  "strings"
+  "testing"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+func testGame() *game.Game {
+  pawn := &game.SetupRule{Id: 2, Description: "Place pawn", Arity: "Each player"}
+  board := &game.SetupRule{Id: 1, Description: "Lay out the board", Details: "Island side up", Arity: "Once"}
+  pawn.Dependencies = []*game.SetupRule{board}
+  return &game.Game{Id: 1, Name: "Test", MinPlayers: 1, MaxPlayers: 4, SetupRules: []*game.SetupRule{pawn, board}}
+}
+
+func TestForGame(t *testing.T) {
+  c, err := ForGame(testGame(), 2)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if len(c.Sections) != 3 || c.Sections[0].Title != "Everyone" || c.Sections[2].Title != "Player 2" {
+    t.Fatalf("Expected shared section then one per player, got %+v", c.Sections)
+  }
+  board := c.Sections[0].Items[0]
+  if board.Number != 1 || board.Details != "Island side up" {
+    t.Errorf("Expected the board first, with its details, got %+v", board)
+  }
+  pawn := c.Sections[1].Items[0]
+  if pawn.Number != 2 || len(pawn.After) != 1 || pawn.After[0] != 1 {
+    t.Errorf("Expected the pawn after the board, got %+v", pawn)
+  }
+}
+
+func TestForGame_PlayerCount(t *testing.T) {
+  _, err := ForGame(testGame(), 5)
+  if nil == err {
+    t.Fatal("Expected an error for too many players")
+  }
+}
+
+func TestForSession_Done(t *testing.T) {
+  players := []*game.Player{&game.Player{Id: 7, Name: "Alice"}}
+  s, err := session.NewSession(testGame(), players)
+  if nil != err {
+    t.Fatal(err)
+  }
+  for _, step := range s.SetupSteps {
+    if nil == step.Owner {
+      step.Finish()
+    }
+  }
+
+  c, err := ForSession(s)
+  if nil != err {
+    t.Fatal(err)
+  }
+  var b strings.Builder
+  if err := c.Markdown(&b); nil != err {
+    t.Fatal(err)
+  }
+  expected := "# Test setup\n\n## Everyone\n\n- [x] 1. Lay out the board\n  Island side up\n\n## Alice\n\n- [ ] 2. Place pawn _(after 1)_\n"
+  if b.String() != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, b.String())
+  }
+}
+
+func TestText(t *testing.T) {
+  c, err := ForGame(testGame(), 1)
+  if nil != err {
+    t.Fatal(err)
+  }
+  var b strings.Builder
+  if err := c.Text(&b); nil != err {
+    t.Fatal(err)
+  }
+  if !strings.Contains(b.String(), "Player 1\n--------\n[ ] 2. Place pawn (after 1)\n") {
+    t.Errorf("Unexpected text:\n%s", b.String())
+  }
+}
+
+func TestHTML_Escaped(t *testing.T) {
+  g := testGame()
+  g.SetupRules[1].Details = "<b>Island</b> side up"
+  c, err := ForGame(g, 1)
+  if nil != err {
+    t.Fatal(err)
+  }
+  var b strings.Builder
+  if err := c.HTML(&b); nil != err {
+    t.Fatal(err)
+  }
+  if strings.Contains(b.String(), "<b>Island") || !strings.Contains(b.String(), "&lt;b&gt;Island") {
+    t.Error("Expected details to be escaped")
+  }
+}
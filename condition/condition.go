@@ -0,0 +1,125 @@
+/*
+
+Conditions on setup rules, so that a rule is only set up in games of some numbers of players, as in
+"In a 2-player game, remove the 3 and 4 cards".
+
+A condition has a minimum and a maximum number of players, and for the cases they can't express, a
+test over the number of players. It has the numbers, `players`, arithmetic with + - * / %,
+comparisons with == != < <= > >=, and !, && and || between tests:
+
+  c, err := condition.New(0, 0, "players == 2 || players >= 5")
+
+Sessions are set up from the rules whose conditions apply to their players:
+
+  g, err := condition.Filter(base, conditions, len(players))
+
+*/
+
+package condition
+
+import (
+  "errors"
+  "fmt"
+  "strings"
+  "github.com/rkbodenner/meeple_mover/expansion"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+type Condition struct {
+  MinPlayers int  // 0 for no minimum
+  MaxPlayers int  // 0 for no maximum
+  Expression string  // Empty for none
+  test *node
+}
+
+// A condition on the number of players. Returns an error if the expression can't be parsed.
+func New(minPlayers int, maxPlayers int, expression string) (*Condition, error) {
+  c := &Condition{MinPlayers: minPlayers, MaxPlayers: maxPlayers, Expression: strings.TrimSpace(expression)}
+  if minPlayers < 0 || maxPlayers < 0 {
+    return nil, errors.New("Expected numbers of players to be positive, or 0 for no limit")
+  }
+  if minPlayers > 0 && maxPlayers > 0 && minPlayers > maxPlayers {
+    return nil, errors.New(fmt.Sprintf("Expected the minimum number of players to be at most the maximum, got %d and %d", minPlayers, maxPlayers))
+  }
+  if "" != c.Expression {
+    test, err := parse(c.Expression)
+    if nil != err {
+      return nil, err
+    }
+    c.test = test
+  }
+  return c, nil
+}
+
+// Whether the condition always applies
+func (c *Condition) Empty() bool {
+  return 0 == c.MinPlayers && 0 == c.MaxPlayers && "" == c.Expression
+}
+
+// Whether a rule with the condition is set up for the number of players. Returns an error if the
+// expression can't be evaluated for it, as when it divides by zero.
+func (c *Condition) Applies(players int) (bool, error) {
+  if c.MinPlayers > 0 && players < c.MinPlayers {
+    return false, nil
+  }
+  if c.MaxPlayers > 0 && players > c.MaxPlayers {
+    return false, nil
+  }
+  if nil == c.test {
+    return true, nil
+  }
+  value, err := c.test.eval(players)
+  return 1 == value, err
+}
+
+func (c *Condition) String() string {
+  parts := make([]string, 0)
+  switch {
+  case c.MinPlayers > 0 && c.MinPlayers == c.MaxPlayers:
+    parts = append(parts, fmt.Sprintf("%d players", c.MinPlayers))
+  case c.MinPlayers > 0 && c.MaxPlayers > 0:
+    parts = append(parts, fmt.Sprintf("%d to %d players", c.MinPlayers, c.MaxPlayers))
+  case c.MinPlayers > 0:
+    parts = append(parts, fmt.Sprintf("at least %d players", c.MinPlayers))
+  case c.MaxPlayers > 0:
+    parts = append(parts, fmt.Sprintf("at most %d players", c.MaxPlayers))
+  }
+  if "" != c.Expression {
+    parts = append(parts, c.Expression)
+  }
+  if 0 == len(parts) {
+    return "always"
+  }
+  return strings.Join(parts, " and ")
+}
+
+// Check that the condition can be evaluated for every number of players from min to max
+func (c *Condition) Check(minPlayers int, maxPlayers int) error {
+  for players := minPlayers; players <= maxPlayers; players++ {
+    if _, err := c.Applies(players); nil != err {
+      return err
+    }
+  }
+  return nil
+}
+
+// The game without the rules whose conditions don't apply to the number of players, by rule ID.
+// Rules that depended on one that's left out wait for what it waited for instead. Returns the game
+// itself if every rule applies.
+func Filter(g *game.Game, conditions map[int]*Condition, players int) (*game.Game, error) {
+  left := make([]*game.SetupRule, 0)
+  for _, rule := range g.SetupRules {
+    c, ok := conditions[rule.Id]
+    if !ok {
+      continue
+    }
+    applies, err := c.Applies(players)
+    if nil != err {
+      return nil, errors.New(fmt.Sprintf("Condition of %q: %s", rule.Description, err))
+    }
+    if !applies {
+      left = append(left, rule)
+    }
+  }
+  return expansion.Remove(g, left)
+}
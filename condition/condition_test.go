@@ -0,0 +1,137 @@
+package condition
+
+import (
+  "strings"
+  "testing"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+func TestCondition_Applies(t *testing.T) {
+  cases := []struct {
+    min int
+    max int
+    expression string
+    applies []int  // Numbers of players from 1 to 6 it applies to
+  }{
+    {0, 0, "", []int{1, 2, 3, 4, 5, 6}},
+    {2, 2, "", []int{2}},
+    {3, 0, "", []int{3, 4, 5, 6}},
+    {0, 0, "players == 2 || players >= 5", []int{2, 5, 6}},
+    {0, 0, "players % 2 == 0", []int{2, 4, 6}},
+    {2, 5, "!(players == 3)", []int{2, 4, 5}},
+    {0, 0, "players * 2 - 1 > 6 && players != 6", []int{4, 5}},
+    {0, 0, "-players + 10 <= 6", []int{4, 5, 6}},
+    {0, 0, "players != 1 && 6 / (players - 1) > 2", []int{2, 3}},
+  }
+  for _, c := range cases {
+    cond, err := New(c.min, c.max, c.expression)
+    if nil != err {
+      t.Errorf("%s: %s", c.expression, err)
+      continue
+    }
+    applies := make([]int, 0)
+    for players := 1; players <= 6; players++ {
+      ok, err := cond.Applies(players)
+      if nil != err {
+        t.Errorf("%s for %d players: %s", cond, players, err)
+      }
+      if ok {
+        applies = append(applies, players)
+      }
+    }
+    if len(applies) != len(c.applies) {
+      t.Errorf("Expected %s to apply to %v players, got %v", cond, c.applies, applies)
+      continue
+    }
+    for i := range applies {
+      if applies[i] != c.applies[i] {
+        t.Errorf("Expected %s to apply to %v players, got %v", cond, c.applies, applies)
+        break
+      }
+    }
+  }
+}
+
+func TestNew_Invalid(t *testing.T) {
+  cases := []struct {
+    min int
+    max int
+    expression string
+    problem string
+  }{
+    {3, 2, "", "at most the maximum"},
+    {-1, 0, "", "positive"},
+    {0, 0, "players", "Expected a test"},
+    {0, 0, "players = 2", `Unexpected '='`},
+    {0, 0, "player == 2", `Unknown name "player" at 1`},
+    {0, 0, "(players == 2", "Expected ) but got end of condition"},
+    {0, 0, "players == 2 &&", "Unexpected end of condition"},
+    {0, 0, "players > 2 players", `Unexpected "players" at 13`},
+    {0, 0, "players + (players > 2) > 1", "Expected numbers on both sides of +"},
+    {0, 0, "players && players > 2", "Expected tests on both sides of &&"},
+    {0, 0, "!players", "Expected a test after !"},
+  }
+  for _, c := range cases {
+    if _, err := New(c.min, c.max, c.expression); nil == err || !strings.Contains(err.Error(), c.problem) {
+      t.Errorf("%q: expected an error containing %s, got %v", c.expression, c.problem, err)
+    }
+  }
+}
+
+func TestCondition_Check(t *testing.T) {
+  c, err := New(0, 0, "12 % (players - 3) == 0")
+  if nil != err {
+    t.Fatal(err)
+  }
+  if err := c.Check(1, 2); nil != err {
+    t.Error(err)
+  }
+  if err := c.Check(1, 4); nil == err || !strings.Contains(err.Error(), "3 players") {
+    t.Errorf("Expected division by zero for 3 players, got %v", err)
+  }
+}
+
+func TestCondition_String(t *testing.T) {
+  cases := map[string]*Condition{
+    "always": &Condition{},
+    "2 players": &Condition{MinPlayers: 2, MaxPlayers: 2},
+    "2 to 3 players and players != 3": &Condition{MinPlayers: 2, MaxPlayers: 3, Expression: "players != 3"},
+    "at most 4 players": &Condition{MaxPlayers: 4},
+  }
+  for expected, c := range cases {
+    if expected != c.String() {
+      t.Errorf("Expected %q, got %q", expected, c.String())
+    }
+  }
+}
+
+func TestFilter(t *testing.T) {
+  deck := &game.SetupRule{Id: 1, Description: "Shuffle the deck", Arity: "Once"}
+  remove := &game.SetupRule{Id: 2, Description: "Remove the 3 and 4 cards", Arity: "Once", Dependencies: []*game.SetupRule{deck}}
+  deal := &game.SetupRule{Id: 3, Description: "Deal cards", Arity: "Each player", Dependencies: []*game.SetupRule{remove}}
+  g := &game.Game{Id: 1, Name: "Test", MinPlayers: 2, MaxPlayers: 4, SetupRules: []*game.SetupRule{deck, remove, deal}}
+  twoPlayers, _ := New(2, 2, "")
+  conditions := map[int]*Condition{remove.Id: twoPlayers}
+
+  if filtered, err := Filter(g, conditions, 2); nil != err || filtered != g {
+    t.Errorf("Expected the game itself for 2 players, got %v", err)
+  }
+  filtered, err := Filter(g, conditions, 3)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if 2 != len(filtered.SetupRules) {
+    t.Fatalf("Expected the removal to be left out for 3 players, got %d rules", len(filtered.SetupRules))
+  }
+  if deps := filtered.SetupRules[1].Dependencies; 1 != len(deps) || "Shuffle the deck" != deps[0].Description {
+    t.Error("Expected the deal to wait for the shuffle instead")
+  }
+  if 3 != len(g.SetupRules) {
+    t.Error("Expected the game to be left as it was")
+  }
+
+  broken, _ := New(0, 0, "6 / (players - 3) > 1")
+  if _, err := Filter(g, map[int]*Condition{deal.Id: broken}, 3); nil == err || !strings.Contains(err.Error(), "Deal cards") {
+    t.Errorf("Expected an error naming the rule, got %v", err)
+  }
+}
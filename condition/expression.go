@@ -0,0 +1,307 @@
+package condition
+
+import (
+  "errors"
+  "fmt"
+  "strconv"
+  "unicode"
+)
+
+// A parsed expression, whose value is a number or, if it's a test, 1 for true and 0 for false
+type node struct {
+  op string  // "number", "players", "!", "neg", or the binary operator
+  value int  // Of a number
+  left *node
+  right *node
+  test bool  // Whether it's true or false, rather than a number
+}
+
+var (
+  comparisons = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+  sums = map[string]bool{"+": true, "-": true}
+  terms = map[string]bool{"*": true, "/": true, "%": true}
+)
+
+type token struct {
+  text string
+  pos int  // 1-based, for errors
+}
+
+func tokenize(s string) ([]token, error) {
+  tokens := make([]token, 0)
+  runes := []rune(s)
+  for i := 0; i < len(runes); {
+    r := runes[i]
+    start := i
+    switch {
+    case unicode.IsSpace(r):
+      i++
+      continue
+    case unicode.IsDigit(r):
+      for i < len(runes) && unicode.IsDigit(runes[i]) {
+        i++
+      }
+    case unicode.IsLetter(r):
+      for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || '_' == runes[i]) {
+        i++
+      }
+    case i + 1 < len(runes) && (comparisons[string(runes[i:i+2])] || "&&" == string(runes[i:i+2]) || "||" == string(runes[i:i+2])):
+      i += 2
+    case comparisons[string(r)] || sums[string(r)] || terms[string(r)] || '!' == r || '(' == r || ')' == r:
+      i++
+    default:
+      return nil, errors.New(fmt.Sprintf("Unexpected %q at %d", r, start + 1))
+    }
+    tokens = append(tokens, token{string(runes[start:i]), start + 1})
+  }
+  return tokens, nil
+}
+
+type parser struct {
+  tokens []token
+  pos int
+}
+
+func (p *parser) peek() string {
+  if p.pos < len(p.tokens) {
+    return p.tokens[p.pos].text
+  }
+  return ""
+}
+
+// Where the next token is, or the end of the expression
+func (p *parser) at() string {
+  if p.pos < len(p.tokens) {
+    return fmt.Sprintf("%q at %d", p.tokens[p.pos].text, p.tokens[p.pos].pos)
+  }
+  return "end of condition"
+}
+
+func (p *parser) binary(op string, left *node, right *node) (*node, error) {
+  operandsAreTests := "&&" == op || "||" == op
+  if left.test != operandsAreTests || right.test != operandsAreTests {
+    if operandsAreTests {
+      return nil, errors.New(fmt.Sprintf("Expected tests on both sides of %s, such as players > 2", op))
+    }
+    return nil, errors.New(fmt.Sprintf("Expected numbers on both sides of %s", op))
+  }
+  return &node{op: op, left: left, right: right, test: operandsAreTests || comparisons[op]}, nil
+}
+
+func (p *parser) or() (*node, error) {
+  left, err := p.and()
+  for nil == err && "||" == p.peek() {
+    p.pos++
+    var right *node
+    if right, err = p.and(); nil == err {
+      left, err = p.binary("||", left, right)
+    }
+  }
+  return left, err
+}
+
+func (p *parser) and() (*node, error) {
+  left, err := p.not()
+  for nil == err && "&&" == p.peek() {
+    p.pos++
+    var right *node
+    if right, err = p.not(); nil == err {
+      left, err = p.binary("&&", left, right)
+    }
+  }
+  return left, err
+}
+
+func (p *parser) not() (*node, error) {
+  if "!" != p.peek() {
+    return p.comparison()
+  }
+  p.pos++
+  operand, err := p.not()
+  if nil != err {
+    return nil, err
+  }
+  if !operand.test {
+    return nil, errors.New("Expected a test after !, such as !(players > 2)")
+  }
+  return &node{op: "!", left: operand, test: true}, nil
+}
+
+func (p *parser) comparison() (*node, error) {
+  left, err := p.sum()
+  if nil != err || !comparisons[p.peek()] {
+    return left, err
+  }
+  op := p.peek()
+  p.pos++
+  right, err := p.sum()
+  if nil != err {
+    return nil, err
+  }
+  return p.binary(op, left, right)
+}
+
+func (p *parser) sum() (*node, error) {
+  left, err := p.term()
+  for nil == err && sums[p.peek()] {
+    op := p.peek()
+    p.pos++
+    var right *node
+    if right, err = p.term(); nil == err {
+      left, err = p.binary(op, left, right)
+    }
+  }
+  return left, err
+}
+
+func (p *parser) term() (*node, error) {
+  left, err := p.unary()
+  for nil == err && terms[p.peek()] {
+    op := p.peek()
+    p.pos++
+    var right *node
+    if right, err = p.unary(); nil == err {
+      left, err = p.binary(op, left, right)
+    }
+  }
+  return left, err
+}
+
+func (p *parser) unary() (*node, error) {
+  if "-" != p.peek() {
+    return p.primary()
+  }
+  p.pos++
+  operand, err := p.unary()
+  if nil != err {
+    return nil, err
+  }
+  if operand.test {
+    return nil, errors.New("Expected a number after -")
+  }
+  return &node{op: "neg", left: operand}, nil
+}
+
+func (p *parser) primary() (*node, error) {
+  text := p.peek()
+  switch {
+  case "" == text:
+    return nil, errors.New("Unexpected end of condition")
+  case "(" == text:
+    p.pos++
+    inner, err := p.or()
+    if nil != err {
+      return nil, err
+    }
+    if ")" != p.peek() {
+      return nil, errors.New(fmt.Sprintf("Expected ) but got %s", p.at()))
+    }
+    p.pos++
+    return inner, nil
+  case "players" == text:
+    p.pos++
+    return &node{op: "players"}, nil
+  case unicode.IsDigit([]rune(text)[0]):
+    value, err := strconv.Atoi(text)
+    if nil != err {
+      return nil, errors.New(fmt.Sprintf("Number %s is too big", text))
+    }
+    p.pos++
+    return &node{op: "number", value: value}, nil
+  case unicode.IsLetter([]rune(text)[0]):
+    return nil, errors.New(fmt.Sprintf("Unknown name %s: expected players", p.at()))
+  }
+  return nil, errors.New(fmt.Sprintf("Unexpected %s", p.at()))
+}
+
+// Parse a test over the number of players
+func parse(expression string) (*node, error) {
+  tokens, err := tokenize(expression)
+  if nil != err {
+    return nil, err
+  }
+  p := &parser{tokens: tokens}
+  root, err := p.or()
+  if nil != err {
+    return nil, err
+  }
+  if p.pos < len(p.tokens) {
+    return nil, errors.New(fmt.Sprintf("Unexpected %s", p.at()))
+  }
+  if !root.test {
+    return nil, errors.New("Expected a test, such as players == 2, not a number")
+  }
+  return root, nil
+}
+
+func truth(test bool) int {
+  if test {
+    return 1
+  }
+  return 0
+}
+
+func (n *node) eval(players int) (int, error) {
+  switch n.op {
+  case "number":
+    return n.value, nil
+  case "players":
+    return players, nil
+  }
+
+  left, err := n.left.eval(players)
+  if nil != err {
+    return 0, err
+  }
+  switch n.op {
+  case "neg":
+    return -left, nil
+  case "!":
+    return 1 - left, nil
+  // Evaluated lazily, so that a division by zero on the other side may be guarded against
+  case "&&":
+    if 0 == left {
+      return 0, nil
+    }
+    return n.right.eval(players)
+  case "||":
+    if 1 == left {
+      return 1, nil
+    }
+    return n.right.eval(players)
+  }
+
+  right, err := n.right.eval(players)
+  if nil != err {
+    return 0, err
+  }
+  switch n.op {
+  case "+":
+    return left + right, nil
+  case "-":
+    return left - right, nil
+  case "*":
+    return left * right, nil
+  case "/", "%":
+    if 0 == right {
+      return 0, errors.New(fmt.Sprintf("Division by zero for %d players", players))
+    }
+    if "/" == n.op {
+      return left / right, nil
+    }
+    return left % right, nil
+  case "==":
+    return truth(left == right), nil
+  case "!=":
+    return truth(left != right), nil
+  case "<":
+    return truth(left < right), nil
+  case "<=":
+    return truth(left <= right), nil
+  case ">":
+    return truth(left > right), nil
+  case ">=":
+    return truth(left >= right), nil
+  }
+  return 0, errors.New(fmt.Sprintf("Unknown operator %s", n.op))
+}
@@ -0,0 +1,152 @@
+/*
+
+Cross-Origin Resource Sharing, so that browsers let web apps served from other origins call the API.
+
+Allowed origins are matched exactly, or by wildcard subdomain as in "https://*.example.com",
+or "*" allows any origin.
+
+*/
+
+package cors
+
+import (
+  "net/http"
+  "net/url"
+  "strconv"
+  "strings"
+  "time"
+)
+
+type Policy struct {
+  AllowedOrigins []string
+  AllowedMethods []string
+  AllowedHeaders []string  // Request headers a client may send. "*" allows any.
+  ExposedHeaders []string  // Response headers a client may read, beyond the basic ones
+  AllowCredentials bool
+  MaxAge time.Duration  // How long browsers may cache the result of a preflight request
+}
+
+func (p *Policy) AllowsOrigin(origin string) bool {
+  if "" == origin {
+    return false
+  }
+  for _, allowed := range p.AllowedOrigins {
+    if "*" == allowed || matchOrigin(allowed, origin) {
+      return true
+    }
+  }
+  return false
+}
+
+func matchOrigin(pattern string, origin string) bool {
+  if strings.EqualFold(pattern, origin) {
+    return true
+  }
+  if !strings.Contains(pattern, "://*.") {
+    return false
+  }
+
+  p, err := url.Parse(strings.Replace(pattern, "://*.", "://", 1))
+  if nil != err {
+    return false
+  }
+  o, err := url.Parse(origin)
+  if nil != err {
+    return false
+  }
+  if !strings.EqualFold(p.Scheme, o.Scheme) || p.Port() != o.Port() {
+    return false
+  }
+  // At least one label in front of the domain, so *.example.com doesn't match example.com itself
+  return strings.HasSuffix(strings.ToLower(o.Hostname()), "." + strings.ToLower(p.Hostname()))
+}
+
+func (p *Policy) allowsMethod(method string) bool {
+  return contains(p.AllowedMethods, method, false)
+}
+
+func (p *Policy) allowsHeaders(requested string) bool {
+  if contains(p.AllowedHeaders, "*", false) {
+    return true
+  }
+  for _, header := range strings.Split(requested, ",") {
+    header = strings.TrimSpace(header)
+    if "" != header && !contains(p.AllowedHeaders, header, true) {
+      return false
+    }
+  }
+  return true
+}
+
+func contains(list []string, s string, ignoreCase bool) bool {
+  for _, item := range list {
+    if item == s || (ignoreCase && strings.EqualFold(item, s)) {
+      return true
+    }
+  }
+  return false
+}
+
+// Wrap a handler, answering preflight requests itself and adding CORS headers to other responses
+func (p *Policy) Handler(h http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    origin := r.Header.Get("Origin")
+    w.Header().Add("Vary", "Origin")
+
+    preflight := "OPTIONS" == r.Method && "" != r.Header.Get("Access-Control-Request-Method")
+    if preflight {
+      p.servePreflight(w, r, origin)
+      return
+    }
+
+    if p.AllowsOrigin(origin) {
+      p.setAllowOrigin(w, origin)
+      if len(p.ExposedHeaders) > 0 {
+        w.Header().Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+      }
+    }
+    h.ServeHTTP(w, r)
+  })
+}
+
+func (p *Policy) servePreflight(w http.ResponseWriter, r *http.Request, origin string) {
+  w.Header().Add("Vary", "Access-Control-Request-Method")
+  w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+  if !p.AllowsOrigin(origin) {
+    http.Error(w, "Origin not allowed", http.StatusForbidden)
+    return
+  }
+  method := r.Header.Get("Access-Control-Request-Method")
+  if !p.allowsMethod(method) {
+    http.Error(w, "Method not allowed: " + method, http.StatusForbidden)
+    return
+  }
+  requested := r.Header.Get("Access-Control-Request-Headers")
+  if !p.allowsHeaders(requested) {
+    http.Error(w, "Headers not allowed: " + requested, http.StatusForbidden)
+    return
+  }
+
+  p.setAllowOrigin(w, origin)
+  w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+  if "" != requested {
+    // Echo them, since "*" isn't honored by every browser
+    w.Header().Set("Access-Control-Allow-Headers", requested)
+  }
+  if p.MaxAge > 0 {
+    w.Header().Set("Access-Control-Max-Age", strconv.Itoa((int)(p.MaxAge.Seconds())))
+  }
+  w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Policy) setAllowOrigin(w http.ResponseWriter, origin string) {
+  if contains(p.AllowedOrigins, "*", false) && !p.AllowCredentials {
+    w.Header().Set("Access-Control-Allow-Origin", "*")
+  } else {
+    w.Header().Set("Access-Control-Allow-Origin", origin)
+  }
+  if p.AllowCredentials {
+    w.Header().Set("Access-Control-Allow-Credentials", "true")
+  }
+}
@@ -0,0 +1,107 @@
+package cors
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "time"
+)
+
+var policy = &Policy{
+  AllowedOrigins: []string{"https://goboard.example.com", "https://*.staging.example.com", "http://localhost:8000"},
+  AllowedMethods: []string{"GET", "POST", "PUT"},
+  AllowedHeaders: []string{"Content-Type", "If-Match", "Authorization"},
+  ExposedHeaders: []string{"ETag"},
+  MaxAge: 10 * time.Minute,
+}
+
+func TestPolicy_AllowsOrigin(t *testing.T) {
+  allowed := []string{
+    "https://goboard.example.com",
+    "HTTPS://GOBOARD.example.com",
+    "https://pr-42.staging.example.com",
+    "https://a.b.staging.example.com",
+    "http://localhost:8000",
+  }
+  for _, origin := range allowed {
+    if !policy.AllowsOrigin(origin) {
+      t.Errorf("Expected %s to be allowed", origin)
+    }
+  }
+
+  disallowed := []string{
+    "",
+    "http://goboard.example.com",
+    "https://staging.example.com",
+    "https://evilstaging.example.com",
+    "http://pr-42.staging.example.com",
+    "https://pr-42.staging.example.com:8443",
+    "http://localhost:3000",
+  }
+  for _, origin := range disallowed {
+    if policy.AllowsOrigin(origin) {
+      t.Errorf("Expected %s to be disallowed", origin)
+    }
+  }
+
+  if !(&Policy{AllowedOrigins: []string{"*"}}).AllowsOrigin("https://anything.example.org") {
+    t.Error("Expected * to allow any origin")
+  }
+}
+
+func TestPolicy_Handler_Preflight(t *testing.T) {
+  called := false
+  h := policy.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+  r := httptest.NewRequest("OPTIONS", "/sessions", nil)
+  r.Header.Set("Origin", "https://pr-42.staging.example.com")
+  r.Header.Set("Access-Control-Request-Method", "PUT")
+  r.Header.Set("Access-Control-Request-Headers", "content-type, if-match")
+  w := httptest.NewRecorder()
+  h.ServeHTTP(w, r)
+
+  if called {
+    t.Fatal("Preflight request should not reach the handler")
+  }
+  if w.Code != http.StatusNoContent {
+    t.Fatalf("Expected 204, got %d", w.Code)
+  }
+  if w.Header().Get("Access-Control-Allow-Origin") != "https://pr-42.staging.example.com" {
+    t.Fatal("Expected origin to be allowed")
+  }
+  if w.Header().Get("Access-Control-Allow-Headers") != "content-type, if-match" {
+    t.Fatalf("Unexpected allowed headers %q", w.Header().Get("Access-Control-Allow-Headers"))
+  }
+  if w.Header().Get("Access-Control-Max-Age") != "600" {
+    t.Fatal("Expected max age in seconds")
+  }
+
+  r.Header.Set("Access-Control-Request-Headers", "X-Custom")
+  w = httptest.NewRecorder()
+  h.ServeHTTP(w, r)
+  if w.Code != http.StatusForbidden {
+    t.Fatalf("Expected 403 for disallowed header, got %d", w.Code)
+  }
+}
+
+func TestPolicy_Handler_Simple(t *testing.T) {
+  h := policy.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+  r := httptest.NewRequest("GET", "/games", nil)
+  r.Header.Set("Origin", "https://goboard.example.com")
+  w := httptest.NewRecorder()
+  h.ServeHTTP(w, r)
+  if w.Header().Get("Access-Control-Allow-Origin") != "https://goboard.example.com" {
+    t.Fatal("Expected origin to be allowed")
+  }
+  if w.Header().Get("Access-Control-Expose-Headers") != "ETag" {
+    t.Fatal("Expected ETag to be exposed")
+  }
+
+  r.Header.Set("Origin", "https://elsewhere.example.org")
+  w = httptest.NewRecorder()
+  h.ServeHTTP(w, r)
+  if "" != w.Header().Get("Access-Control-Allow-Origin") {
+    t.Fatal("Expected no CORS headers for disallowed origin")
+  }
+}
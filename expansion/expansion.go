@@ -0,0 +1,172 @@
+/*
+
+Expansions and variants of a game, each a named set of changes to the base game's setup rules, which
+sessions choose among when they start.
+
+A module adds rules of its own, which may depend on the base game's rules and on each other, and may
+remove or replace base rules. Rules that depended on a removed rule wait for what it waited for
+instead, and rules that depended on a replaced rule wait for its replacement:
+
+  g, err := expansion.Apply(base, []*expansion.Module{onTheBrink, heroicVariant})
+
+*/
+
+package expansion
+
+import (
+  "errors"
+  "fmt"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+const (
+  Expansion = "expansion"
+  Variant = "variant"
+)
+
+// A base rule that a module sets up differently
+type Replacement struct {
+  Rule *game.SetupRule  // Of the base game
+  With *game.SetupRule  // One of the module's rules
+}
+
+type Module struct {
+  Id int
+  GameId uint
+  Name string  // Unique among the game's modules
+  Kind string  // Expansion or Variant
+  // The players the game is for with the module, where they differ from the base game's. 0 if they don't.
+  MinPlayers int
+  MaxPlayers int
+  Rules []*game.SetupRule
+  Removes []*game.SetupRule  // Base rules left out
+  Replaces []Replacement
+}
+
+// Whether the rule is one of the rules
+func contains(rules []*game.SetupRule, rule *game.SetupRule) bool {
+  for _, other := range rules {
+    if other == rule {
+      return true
+    }
+  }
+  return false
+}
+
+// The game without the rules, whose dependents wait for what they waited for instead. Returns the
+// game itself if there are no rules to leave out.
+func Remove(base *game.Game, rules []*game.SetupRule) (*game.Game, error) {
+  if 0 == len(rules) {
+    return base, nil
+  }
+  return Apply(base, []*Module{&Module{GameId: base.Id, Removes: rules}})
+}
+
+// The base game with the modules' changes made, for a session to be set up from. The base game is
+// left as it was: its rules are copied, keeping their IDs. Returns the base game itself if there are
+// no modules, and a *setupgraph.IntegrityError if the rules that result can't be set up.
+func Apply(base *game.Game, modules []*Module) (*game.Game, error) {
+  if 0 == len(modules) {
+    return base, nil
+  }
+
+  removed := make(map[*game.SetupRule]bool)
+  replaced := make(map[*game.SetupRule]*game.SetupRule)
+  replacedBy := make(map[*game.SetupRule]string)
+  g := &game.Game{Id: base.Id, Name: base.Name, MinPlayers: base.MinPlayers, MaxPlayers: base.MaxPlayers}
+  for i, m := range modules {
+    if m.GameId != base.Id {
+      return nil, errors.New(fmt.Sprintf("%s is a module of game %d, not %s", m.Name, m.GameId, base.Name))
+    }
+    for _, other := range modules[:i] {
+      if other.Name == m.Name {
+        return nil, errors.New(fmt.Sprintf("%s is chosen twice", m.Name))
+      }
+    }
+    if m.MinPlayers > 0 {
+      g.MinPlayers = m.MinPlayers
+    }
+    if m.MaxPlayers > 0 {
+      g.MaxPlayers = m.MaxPlayers
+    }
+    for _, rule := range m.Removes {
+      if name, ok := replacedBy[rule]; ok {
+        return nil, errors.New(fmt.Sprintf("%s removes %q, which %s replaces", m.Name, rule.Description, name))
+      }
+      removed[rule] = true
+    }
+    for _, r := range m.Replaces {
+      if name, ok := replacedBy[r.Rule]; ok {
+        return nil, errors.New(fmt.Sprintf("%s and %s both replace %q", name, m.Name, r.Rule.Description))
+      }
+      if removed[r.Rule] {
+        return nil, errors.New(fmt.Sprintf("%s replaces %q, which is removed", m.Name, r.Rule.Description))
+      }
+      replaced[r.Rule] = r.With
+      replacedBy[r.Rule] = m.Name
+    }
+  }
+
+  // Base rules stay in their places, with replacements taking the places of the rules they replace,
+  // followed by the modules' other rules
+  copies := make(map[*game.SetupRule]*game.SetupRule)
+  copyRule := func(rule *game.SetupRule) {
+    ruleCopy := *rule
+    copies[rule] = &ruleCopy
+    g.SetupRules = append(g.SetupRules, &ruleCopy)
+  }
+  for _, rule := range base.SetupRules {
+    if with, ok := replaced[rule]; ok {
+      copyRule(with)
+    } else if !removed[rule] {
+      copyRule(rule)
+    }
+  }
+  for _, m := range modules {
+    for _, rule := range m.Rules {
+      if _, ok := copies[rule]; !ok {
+        copyRule(rule)
+      }
+    }
+  }
+
+  // What a rule waits for, in place of a dependency on the given rule
+  var resolve func(dep *game.SetupRule, seen map[*game.SetupRule]bool) []*game.SetupRule
+  resolve = func(dep *game.SetupRule, seen map[*game.SetupRule]bool) []*game.SetupRule {
+    if with, ok := replaced[dep]; ok {
+      dep = with
+    }
+    if ruleCopy, ok := copies[dep]; ok {
+      return []*game.SetupRule{ruleCopy}
+    }
+    if !removed[dep] || seen[dep] {
+      return nil  // Left for CheckGame to report, if it's not one of the game's rules
+    }
+    seen[dep] = true
+    deps := make([]*game.SetupRule, 0)
+    for _, inherited := range dep.Dependencies {
+      deps = append(deps, resolve(inherited, seen)...)
+    }
+    return deps
+  }
+  for original, ruleCopy := range copies {
+    ruleCopy.Dependencies = make([]*game.SetupRule, 0, len(original.Dependencies))
+    for _, dep := range original.Dependencies {
+      if _, ok := copies[dep]; !ok && !removed[dep] && !contains(base.SetupRules, dep) {
+        ruleCopy.Dependencies = append(ruleCopy.Dependencies, dep)
+        continue
+      }
+      for _, resolved := range resolve(dep, make(map[*game.SetupRule]bool)) {
+        if !contains(ruleCopy.Dependencies, resolved) {
+          ruleCopy.Dependencies = append(ruleCopy.Dependencies, resolved)
+        }
+      }
+    }
+  }
+
+  if err := setupgraph.CheckGame(g); nil != err {
+    return nil, err
+  }
+  return g, nil
+}
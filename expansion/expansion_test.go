@@ -0,0 +1,127 @@
+package expansion
+
+import (
+  "testing"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+// Lay out the board and shuffle, then each player places a pawn and is dealt cards, then start
+func baseGame() *game.Game {
+  board := &game.SetupRule{Id: 1, Description: "Lay out the board", Arity: "Once"}
+  shuffle := &game.SetupRule{Id: 2, Description: "Shuffle", Arity: "Once"}
+  pawn := &game.SetupRule{Id: 3, Description: "Place pawn", Arity: "Each player", Dependencies: []*game.SetupRule{board}}
+  deal := &game.SetupRule{Id: 4, Description: "Deal cards", Arity: "Each player", Dependencies: []*game.SetupRule{shuffle}}
+  start := &game.SetupRule{Id: 5, Description: "Start", Arity: "Once", Dependencies: []*game.SetupRule{pawn, deal}}
+  return &game.Game{Id: 1, Name: "Test", MinPlayers: 2, MaxPlayers: 4, SetupRules: []*game.SetupRule{board, shuffle, pawn, deal, start}}
+}
+
+func descriptions(rules []*game.SetupRule) []string {
+  list := make([]string, len(rules))
+  for i, rule := range rules {
+    list[i] = rule.Description
+  }
+  return list
+}
+
+func rule(g *game.Game, description string) *game.SetupRule {
+  for _, rule := range g.SetupRules {
+    if rule.Description == description {
+      return rule
+    }
+  }
+  return nil
+}
+
+func TestApply_None(t *testing.T) {
+  base := baseGame()
+  if g, err := Apply(base, nil); nil != err || g != base {
+    t.Errorf("Expected the base game itself, got %v, %v", g, err)
+  }
+}
+
+func TestApply(t *testing.T) {
+  base := baseGame()
+  shuffle, deal := base.SetupRules[1], base.SetupRules[3]
+  roles := &game.SetupRule{Id: 6, Description: "Deal roles", Arity: "Each player", Dependencies: []*game.SetupRule{shuffle}}
+  tokens := &game.SetupRule{Id: 7, Description: "Place tokens", Arity: "Once", Dependencies: []*game.SetupRule{base.SetupRules[0]}}
+  expansion := &Module{Id: 1, GameId: 1, Name: "Roles", Kind: Expansion, MaxPlayers: 5,
+    Rules: []*game.SetupRule{roles, tokens}, Replaces: []Replacement{{deal, roles}}}
+  variant := &Module{Id: 2, GameId: 1, Name: "Quick start", Kind: Variant, Removes: []*game.SetupRule{shuffle}}
+
+  g, err := Apply(base, []*Module{expansion, variant})
+  if nil != err {
+    t.Fatal(err)
+  }
+  expected := []string{"Lay out the board", "Place pawn", "Deal roles", "Start", "Place tokens"}
+  if got := descriptions(g.SetupRules); len(got) != len(expected) {
+    t.Fatalf("Expected %v, got %v", expected, got)
+  } else {
+    for i := range expected {
+      if expected[i] != got[i] {
+        t.Errorf("Expected %v, got %v", expected, got)
+        break
+      }
+    }
+  }
+  if 2 != g.MinPlayers || 5 != g.MaxPlayers {
+    t.Errorf("Expected 2 to 5 players, got %d to %d", g.MinPlayers, g.MaxPlayers)
+  }
+
+  // The start waits for the roles in place of the cards, and the roles wait for nothing once the shuffle is gone
+  start := rule(g, "Start")
+  if 2 != len(start.Dependencies) || start.Dependencies[1] != rule(g, "Deal roles") {
+    t.Errorf("Expected the start to wait for the pawns and roles, got %v", descriptions(start.Dependencies))
+  }
+  if deps := rule(g, "Deal roles").Dependencies; 0 != len(deps) {
+    t.Errorf("Expected the roles to wait for nothing, got %v", descriptions(deps))
+  }
+  if 6 != rule(g, "Deal roles").Id {
+    t.Error("Expected the rules to keep their IDs")
+  }
+
+  // The base game is untouched
+  if 5 != len(base.SetupRules) || base.SetupRules[4].Dependencies[1] != deal || 4 != base.MaxPlayers {
+    t.Error("Expected the base game to be left as it was")
+  }
+}
+
+func TestApply_RemovedInherits(t *testing.T) {
+  base := baseGame()
+  pawn := base.SetupRules[2]
+  m := &Module{Id: 1, GameId: 1, Name: "No pawns", Kind: Variant, Removes: []*game.SetupRule{pawn}}
+  g, err := Apply(base, []*Module{m})
+  if nil != err {
+    t.Fatal(err)
+  }
+  // The start waits for the board the pawns waited for
+  if deps := descriptions(rule(g, "Start").Dependencies); 2 != len(deps) || "Lay out the board" != deps[0] {
+    t.Errorf("Expected the start to wait for the board and the cards, got %v", deps)
+  }
+}
+
+func TestApply_Conflicts(t *testing.T) {
+  base := baseGame()
+  deal := base.SetupRules[3]
+  roles := &game.SetupRule{Id: 6, Description: "Deal roles", Arity: "Each player"}
+  hands := &game.SetupRule{Id: 7, Description: "Deal hands", Arity: "Each player"}
+  first := &Module{Id: 1, GameId: 1, Name: "Roles", Rules: []*game.SetupRule{roles}, Replaces: []Replacement{{deal, roles}}}
+  second := &Module{Id: 2, GameId: 1, Name: "Hands", Rules: []*game.SetupRule{hands}, Replaces: []Replacement{{deal, hands}}}
+  other := &Module{Id: 3, GameId: 2, Name: "Other"}
+
+  for _, modules := range [][]*Module{{first, second}, {first, first}, {other}} {
+    if _, err := Apply(base, modules); nil == err {
+      t.Errorf("Expected an error for %s and %s", modules[0].Name, modules[len(modules) - 1].Name)
+    }
+  }
+}
+
+func TestApply_Integrity(t *testing.T) {
+  base := baseGame()
+  copied := &game.SetupRule{Id: 6, Description: "Shuffle", Arity: "Once"}
+  m := &Module{Id: 1, GameId: 1, Name: "Again", Rules: []*game.SetupRule{copied}}
+  _, err := Apply(base, []*Module{m})
+  if _, ok := err.(*setupgraph.IntegrityError); !ok {
+    t.Errorf("Expected an *IntegrityError for a repeated description, got %v", err)
+  }
+}
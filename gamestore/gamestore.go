@@ -12,9 +12,12 @@ import (
   "database/sql"
   "flag"
   "fmt"
+  "io"
   "os"
   _ "github.com/lib/pq"
+  "github.com/rkbodenner/meeple_mover/graphviz"
   "github.com/rkbodenner/meeple_mover/record"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
   "github.com/rkbodenner/parallel_universe/collection"
 )
 
@@ -25,6 +28,8 @@ func main() {
   flag.StringVar(&databaseName, "dbname", "meeple_mover_test", "Name of the database")
   var dryRun bool
   flag.BoolVar(&dryRun, "dry-run", false, "Run without creating any records")
+  var graph bool
+  flag.BoolVar(&graph, "graph", false, "Print the game's setup rules in DOT format before storing it, and everything else to stderr")
   flag.Parse()
 
   if "" == gameName {
@@ -32,26 +37,43 @@ func main() {
     os.Exit(1)
   }
 
-  fmt.Printf("Searching for %s...\n", gameName)
+  // Leave stdout to the graph, so that it can be piped to Graphviz
+  var status io.Writer = os.Stdout
+  if graph {
+    status = os.Stderr
+  }
+
+  fmt.Fprintf(status, "Searching for %s...\n", gameName)
 
   connectString := fmt.Sprintf("user=ralph dbname=%s sslmode=disable", databaseName)
   db, err := sql.Open("postgres", connectString)
   if nil != err {
-    fmt.Print(err)
+    fmt.Fprint(status, err)
   }
   defer db.Close()
 
   shelf := collection.NewCollection().Games
   for _, game := range shelf {
     if gameName == game.Name {
-      fmt.Printf("Found %s in the collection\n", gameName)
+      fmt.Fprintf(status, "Found %s in the collection\n", gameName)
+      if graph {
+        if err := graphviz.ForGame(game).DOT(os.Stdout); nil != err {
+          fmt.Fprintln(status, err)
+          os.Exit(1)
+        }
+      }
+      // Checked on a dry run too, so that the rules can be fixed before anything is stored
+      if err := setupgraph.CheckGame(game); nil != err {
+        fmt.Fprintln(status, err)
+        os.Exit(1)
+      }
       rec := record.NewGameRecord(game)
       if !dryRun {
         err := rec.Create(db)
         if nil != err {
-          fmt.Println(err)
+          fmt.Fprintln(status, err)
         } else {
-          fmt.Printf("Stored %s as ID %d\n", gameName, rec.Game.Id)
+          fmt.Fprintf(status, "Stored %s as ID %d\n", gameName, rec.Game.Id)
         }
       }
     }
@@ -0,0 +1,186 @@
+/*
+
+Draw the graph that a game's setup rules form through their dependencies, for designing the rules of
+a new game, or the steps of a session, colored by how far setup has got.
+
+Graphs are written in the DOT language, for Graphviz to lay out:
+
+  dot -Tpng -o setup.png setup.dot
+
+or as SVG, laid out here in layers, each node below those it depends on, for when Graphviz isn't at hand.
+
+*/
+
+package graphviz
+
+import (
+  "errors"
+  "fmt"
+  "io"
+  "strings"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// How far setup has got with a session's step. Rules of a game have no status.
+const (
+  Done = "done"
+  Assigned = "assigned"
+  Blocked = "blocked"
+  Ready = "ready"
+)
+
+// Fill colors of nodes, by status
+var colors = map[string]string{
+  "": "white",
+  Done: "#c8e6c9",
+  Assigned: "#fff59d",
+  Blocked: "#ffcdd2",
+  Ready: "white",
+}
+
+type Node struct {
+  Id string
+  Lines []string  // The label, one line at a time
+  Status string
+  Dependencies []*Node  // Nodes that must be done before this one
+}
+
+type Graph struct {
+  Title string
+  Nodes []*Node
+}
+
+// The graph of the game's rules, each labeled with its description and whether each player does it
+func ForGame(g *game.Game) *Graph {
+  graph := &Graph{Title: fmt.Sprintf("%s setup", g.Name)}
+  nodes := make(map[*game.SetupRule]*Node)
+  for i, rule := range g.SetupRules {
+    node := &Node{Id: fmt.Sprintf("rule%d", i + 1), Lines: []string{rule.Description}}
+    if "Each player" == rule.Arity {
+      node.Lines = append(node.Lines, "each player")
+    }
+    nodes[rule] = node
+    graph.Nodes = append(graph.Nodes, node)
+  }
+  // Drawn even with dependencies on rules of other games, or in a cycle, so that they can be seen
+  for _, rule := range g.SetupRules {
+    for _, dep := range rule.Dependencies {
+      if depNode, ok := nodes[dep]; ok {
+        nodes[rule].Dependencies = append(nodes[rule].Dependencies, depNode)
+      }
+    }
+  }
+  return graph
+}
+
+// The graph of the session's steps, labeled with their owners and who they're assigned to, and
+// colored by status
+func ForSession(s *session.Session) *Graph {
+  graph := &Graph{Title: fmt.Sprintf("%s setup", s.Game.Name)}
+  nodes := make(map[*game.SetupStep]*Node)
+  for i, step := range s.SetupSteps {
+    node := &Node{Id: fmt.Sprintf("step%d", i + 1), Lines: []string{step.Rule.Description}}
+    if nil != step.Owner {
+      node.Lines = append(node.Lines, fmt.Sprintf("%s's", step.Owner.Name))
+    }
+    var assignee *game.Player
+    for _, p := range s.Players {
+      if current, ok := s.SetupAssignments.Get(p); ok && current == step {
+        assignee = p
+      }
+    }
+    switch {
+    case step.Done:
+      node.Status = Done
+    case nil != assignee:
+      node.Status = Assigned
+      node.Lines = append(node.Lines, fmt.Sprintf("assigned to %s", assignee.Name))
+    case len(setupgraph.Blockers(s.SetupSteps, step)) > 0:
+      node.Status = Blocked
+    default:
+      node.Status = Ready
+    }
+    nodes[step] = node
+    graph.Nodes = append(graph.Nodes, node)
+  }
+  // Each step waits for every step of the rules its own rule depends on
+  for _, step := range s.SetupSteps {
+    for _, dep := range step.Rule.Dependencies {
+      for _, other := range s.SetupSteps {
+        if other.Rule == dep {
+          nodes[step].Dependencies = append(nodes[step].Dependencies, nodes[other])
+        }
+      }
+    }
+  }
+  return graph
+}
+
+func escape(s string) string {
+  return strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1)
+}
+
+func quote(s string) string {
+  return `"` + escape(s) + `"`
+}
+
+// Write the graph in the DOT language, with an edge from each node to those that wait on it
+func (graph *Graph) DOT(w io.Writer) error {
+  var b strings.Builder
+  fmt.Fprintf(&b, "digraph %s {\n", quote(graph.Title))
+  b.WriteString("  node [shape=box, style=\"rounded,filled\", fillcolor=white, fontname=\"sans-serif\"];\n")
+  for _, node := range graph.Nodes {
+    lines := make([]string, len(node.Lines))
+    for i, line := range node.Lines {
+      lines[i] = escape(line)
+    }
+    fmt.Fprintf(&b, "  %s [label=\"%s\"", node.Id, strings.Join(lines, `\n`))
+    if "" != node.Status {
+      fmt.Fprintf(&b, ", fillcolor=%s, tooltip=%s", quote(colors[node.Status]), quote(node.Status))
+    }
+    b.WriteString("];\n")
+  }
+  for _, node := range graph.Nodes {
+    for _, dep := range node.Dependencies {
+      fmt.Fprintf(&b, "  %s -> %s;\n", dep.Id, node.Id)
+    }
+  }
+  b.WriteString("}\n")
+  _, err := io.WriteString(w, b.String())
+  return err
+}
+
+// Each node's layer: one more than the deepest of those it depends on
+func layers(graph *Graph) (map[*Node]int, error) {
+  layer := make(map[*Node]int)
+  visiting := make(map[*Node]bool)
+  var visit func(node *Node) error
+  visit = func(node *Node) error {
+    if _, ok := layer[node]; ok {
+      return nil
+    }
+    if visiting[node] {
+      return errors.New(fmt.Sprintf("Can't lay out %s: %q depends on itself through the others", graph.Title, node.Lines[0]))
+    }
+    visiting[node] = true
+    deepest := -1
+    for _, dep := range node.Dependencies {
+      if err := visit(dep); nil != err {
+        return err
+      }
+      if layer[dep] > deepest {
+        deepest = layer[dep]
+      }
+    }
+    layer[node] = deepest + 1
+    return nil
+  }
+  for _, node := range graph.Nodes {
+    if err := visit(node); nil != err {
+      return nil, err
+    }
+  }
+  return layer, nil
+}
@@ -0,0 +1,90 @@
+package graphviz
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+func testGame() *game.Game {
+  board := &game.SetupRule{Id: 1, Description: "Lay out the board", Arity: "Once"}
+  pawn := &game.SetupRule{Id: 2, Description: `Place "pawn"`, Arity: "Each player", Dependencies: []*game.SetupRule{board}}
+  start := &game.SetupRule{Id: 3, Description: "Start", Arity: "Once", Dependencies: []*game.SetupRule{pawn}}
+  return &game.Game{Id: 1, Name: "Test", MinPlayers: 1, MaxPlayers: 4, SetupRules: []*game.SetupRule{board, pawn, start}}
+}
+
+func TestForGame_DOT(t *testing.T) {
+  var buf bytes.Buffer
+  if err := ForGame(testGame()).DOT(&buf); nil != err {
+    t.Fatal(err)
+  }
+  dot := buf.String()
+  for _, expected := range []string{
+    `digraph "Test setup" {`,
+    `rule2 [label="Place \"pawn\"\neach player"];`,
+    "rule1 -> rule2;",
+    "rule2 -> rule3;",
+  } {
+    if !strings.Contains(dot, expected) {
+      t.Errorf("Expected %q in:\n%s", expected, dot)
+    }
+  }
+}
+
+func TestForSession(t *testing.T) {
+  alice := &game.Player{Id: 1, Name: "Alice"}
+  bob := &game.Player{Id: 2, Name: "Bob"}
+  s, err := session.NewSession(testGame(), []*game.Player{alice, bob})
+  if nil != err {
+    t.Fatal(err)
+  }
+  s.SetupSteps[0].Done = true
+  s.SetupAssignments.Set(bob, s.SetupSteps[2])
+
+  graph := ForSession(s)
+  expected := []string{Done, Ready, Assigned, Blocked}
+  for i, node := range graph.Nodes {
+    if expected[i] != node.Status {
+      t.Errorf("Expected %s to be %s, got %s", node.Lines, expected[i], node.Status)
+    }
+  }
+  if lines := graph.Nodes[2].Lines; 3 != len(lines) || "Bob's" != lines[1] || "assigned to Bob" != lines[2] {
+    t.Errorf("Expected Bob's pawn to be labeled as his and assigned to him, got %q", lines)
+  }
+  // The start waits for both pawns
+  if 2 != len(graph.Nodes[3].Dependencies) {
+    t.Errorf("Expected the start to wait for 2 steps, got %d", len(graph.Nodes[3].Dependencies))
+  }
+}
+
+func TestSVG(t *testing.T) {
+  var buf bytes.Buffer
+  if err := ForGame(testGame()).SVG(&buf); nil != err {
+    t.Fatal(err)
+  }
+  svg := buf.String()
+  if !strings.HasPrefix(svg, "<svg ") || 3 != strings.Count(svg, "<rect ") || 2 != strings.Count(svg, "<line ") {
+    t.Errorf("Expected 3 nodes and 2 edges, got:\n%s", svg)
+  }
+  if !strings.Contains(svg, "Place &#34;pawn&#34;") {
+    t.Errorf("Expected the label to be escaped, got:\n%s", svg)
+  }
+}
+
+func TestSVG_Cycle(t *testing.T) {
+  g := testGame()
+  g.SetupRules[0].Dependencies = []*game.SetupRule{g.SetupRules[2]}
+  var buf bytes.Buffer
+  if err := ForGame(g).SVG(&buf); nil == err {
+    t.Error("Expected an error for a cycle")
+  }
+  if 0 != buf.Len() {
+    t.Error("Expected nothing written")
+  }
+  // The cycle can still be drawn for Graphviz to lay out
+  if err := ForGame(g).DOT(&buf); nil != err || !strings.Contains(buf.String(), "rule3 -> rule1;") {
+    t.Errorf("Expected the cycle in DOT, got %v:\n%s", err, buf.String())
+  }
+}
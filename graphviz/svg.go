@@ -0,0 +1,139 @@
+package graphviz
+
+import (
+  "fmt"
+  "html"
+  "io"
+  "sort"
+  "strings"
+)
+
+// Sizes in pixels, for 12px sans-serif text
+const (
+  charWidth = 7
+  lineHeight = 16
+  padding = 8
+  nodeGap = 24  // Between nodes in a layer
+  layerGap = 48  // Between layers, leaving room for the edges
+  margin = 16
+)
+
+type box struct {
+  x, y, width, height int
+}
+
+func size(node *Node) (int, int) {
+  longest := 0
+  for _, line := range node.Lines {
+    if n := len([]rune(line)); n > longest {
+      longest = n
+    }
+  }
+  return longest * charWidth + 2 * padding, len(node.Lines) * lineHeight + padding
+}
+
+// Lay out the nodes in layers, top to bottom, each below those it depends on. Within a layer, nodes
+// are ordered by where those they depend on are, to keep edges short and crossing less.
+func layout(graph *Graph) (map[*Node]box, int, int, error) {
+  layer, err := layers(graph)
+  if nil != err {
+    return nil, 0, 0, err
+  }
+  rows := make([][]*Node, 0)
+  for _, node := range graph.Nodes {
+    for len(rows) <= layer[node] {
+      rows = append(rows, make([]*Node, 0))
+    }
+    rows[layer[node]] = append(rows[layer[node]], node)
+  }
+
+  widest := 0
+  rowWidths := make([]int, len(rows))
+  rowHeights := make([]int, len(rows))
+  for i, row := range rows {
+    for j, node := range row {
+      width, height := size(node)
+      if j > 0 {
+        rowWidths[i] += nodeGap
+      }
+      rowWidths[i] += width
+      if height > rowHeights[i] {
+        rowHeights[i] = height
+      }
+    }
+    if rowWidths[i] > widest {
+      widest = rowWidths[i]
+    }
+  }
+
+  boxes := make(map[*Node]box)
+  center := func(node *Node) float64 {
+    b := boxes[node]
+    return float64(b.x) + float64(b.width) / 2
+  }
+  y := margin
+  for i, row := range rows {
+    if i > 0 {
+      barycenter := make(map[*Node]float64)
+      for _, node := range row {
+        total := 0.0
+        for _, dep := range node.Dependencies {
+          total += center(dep)
+        }
+        barycenter[node] = total / float64(len(node.Dependencies))
+      }
+      sort.SliceStable(row, func(a, b int) bool { return barycenter[row[a]] < barycenter[row[b]] })
+    }
+
+    x := margin + (widest - rowWidths[i]) / 2
+    for _, node := range row {
+      width, height := size(node)
+      boxes[node] = box{x, y + (rowHeights[i] - height) / 2, width, height}
+      x += width + nodeGap
+    }
+    y += rowHeights[i] + layerGap
+  }
+  return boxes, widest + 2 * margin, y - layerGap + margin, nil
+}
+
+// Write the graph as an SVG image, with an arrow from each node to those that wait on it. Returns an
+// error, having written nothing, if the nodes depend on each other in a cycle.
+func (graph *Graph) SVG(w io.Writer) error {
+  boxes, width, height, err := layout(graph)
+  if nil != err {
+    return err
+  }
+
+  var b strings.Builder
+  fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"sans-serif\" font-size=\"12\">\n", width, height, width, height)
+  fmt.Fprintf(&b, "<title>%s</title>\n", html.EscapeString(graph.Title))
+  b.WriteString("<defs><marker id=\"arrow\" viewBox=\"0 0 10 10\" refX=\"10\" refY=\"5\" markerWidth=\"8\" markerHeight=\"8\" orient=\"auto\"><path d=\"M0,0 L10,5 L0,10 z\"/></marker></defs>\n")
+
+  for _, node := range graph.Nodes {
+    to := boxes[node]
+    for _, dep := range node.Dependencies {
+      from := boxes[dep]
+      fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\" marker-end=\"url(#arrow)\"/>\n",
+        from.x + from.width / 2, from.y + from.height, to.x + to.width / 2, to.y)
+    }
+  }
+
+  for _, node := range graph.Nodes {
+    box := boxes[node]
+    b.WriteString("<g>")
+    if "" != node.Status {
+      fmt.Fprintf(&b, "<title>%s</title>", node.Status)
+    }
+    fmt.Fprintf(&b, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"6\" fill=\"%s\" stroke=\"black\"/>",
+      box.x, box.y, box.width, box.height, colors[node.Status])
+    for i, line := range node.Lines {
+      fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%s</text>",
+        box.x + box.width / 2, box.y + padding / 2 + (i + 1) * lineHeight - 4, html.EscapeString(line))
+    }
+    b.WriteString("</g>\n")
+  }
+  b.WriteString("</svg>\n")
+
+  _, err = io.WriteString(w, b.String())
+  return err
+}
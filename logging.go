@@ -0,0 +1,27 @@
+package main
+
+import (
+  "io"
+  "log/slog"
+  "os"
+  "strings"
+)
+
+// Global logger, replaced in main according to MEEPLE_MOVER_LOG_FORMAT and MEEPLE_MOVER_LOG_LEVEL
+var glog = newLogger(os.Stderr, "", "")
+
+// Logs key/value pairs, as JSON if format is "json" and as logfmt-style text otherwise.
+// Level is one of debug, info, warn or error; info if unset.
+func newLogger(w io.Writer, format string, level string) *slog.Logger {
+  var lvl slog.Level
+  err := lvl.UnmarshalText([]byte(level))
+  if nil != err {
+    lvl = slog.LevelInfo
+  }
+  opts := &slog.HandlerOptions{Level: lvl}
+
+  if "json" == strings.ToLower(format) {
+    return slog.New(slog.NewJSONHandler(w, opts))
+  }
+  return slog.New(slog.NewTextHandler(w, opts))
+}
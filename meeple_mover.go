@@ -2,408 +2,144 @@ package main
 
 import (
   "database/sql"
-  "encoding/json"
-  "errors"
   "fmt"
-  "log"
-  "net/http"
-  "net/url"
+  "net"
   "os"
-  "strconv"
+  "strings"
+  "time"
   _ "github.com/lib/pq"
-  "github.com/rcrowley/go-tigertonic"
-  "github.com/rkbodenner/meeple_mover/record"
-  "github.com/rkbodenner/parallel_universe/game"
-  "github.com/rkbodenner/parallel_universe/session"
+  "github.com/rkbodenner/meeple_mover/api"
+  "github.com/rkbodenner/meeple_mover/cors"
 )
 
-var glog = log.New(os.Stderr, "", log.Ldate | log.Ltime | log.Lshortfile)
-
-var games []*game.Game
-var gameIndex = make(map[uint64]*game.Game)
-
-func initGameData(db *sql.DB) error {
-  gameRecords := &record.GameRecordList{}
-  err := gameRecords.FindAll(db)
-  if nil != err {
-    return err
-  }
-  games = gameRecords.List()
-
-  for _, game := range games {
-    gameIndex[(uint64)(game.Id)] = game
-  }
-
-  glog.Printf("Loaded %d games from DB\n", len(games))
-  return nil
-}
-
-var sessions []*session.Session
-var sessionIndex = make(map[uint64]*session.Session)
-
-func initSessionData(db *sql.DB) error {
-  records := &record.SessionRecordList{}
-  err := records.FindAll(db)
-  if nil != err {
-    return err
-  }
-  sessions = records.List()
-
-  // Update global cache of sessions
-  for _, s := range sessions {
-    sessionIndex[(uint64)(s.Id)] = s
-  }
-
-  glog.Printf("Loaded %d sessions from DB\n", len(sessions))
-  return nil
-}
-
-
-type CollectionHandler struct{}
-func (h CollectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-  err := json.NewEncoder(w).Encode(games)
-  if ( nil != err ) {
-    fmt.Fprintln(w, err)
-  }
-}
-
-type GameHandler struct{}
-func (h GameHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-  id_str := r.URL.Query().Get("id")
-  id, err := strconv.ParseUint(id_str, 10, 64)
-  if nil != err {
-    http.Error(w, "Not found", http.StatusNotFound)
-    return
+// Comma-separated list from the environment, or the default if it's unset
+func listFromEnv(name string, defaults ...string) []string {
+  value := os.Getenv(name)
+  if "" == value {
+    return defaults
   }
-
-  game, ok := gameIndex[id]
-  if ok {
-    err := json.NewEncoder(w).Encode(game)
-    if ( nil != err ) {
-      http.Error(w, "Error", http.StatusInternalServerError)
+  list := make([]string, 0)
+  for _, item := range strings.Split(value, ",") {
+    if item = strings.TrimSpace(item); "" != item {
+      list = append(list, item)
     }
-  } else {
-    http.Error(w, "Not found", http.StatusNotFound)
   }
+  return list
 }
 
-type PlayersHandler struct {
-  db *sql.DB
-}
-func (h PlayersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-  playerRecords := &record.PlayerRecordList{}
-  err := playerRecords.FindAll(h.db)
-  if nil != err {
-    http.Error(w, "Error", http.StatusInternalServerError)
-    return
-  }
-  players := playerRecords.List()
-
-  err = json.NewEncoder(w).Encode(players)
-  if ( nil != err ) {
-    fmt.Fprintln(w, err)
-  }
-}
-
-type PlayerHandler struct {
-  db *sql.DB
-}
-func (h PlayerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-  player_id_str := r.URL.Query().Get("player_id")
-  player_id, err := strconv.ParseUint(player_id_str, 10, 64)
-  if nil != err {
-    http.Error(w, "Not found", http.StatusNotFound)
-    return
+func corsPolicyFromEnv() *cors.Policy {
+  // MEEPLE_MOVER_ORIGIN_URL predates the list of origins
+  defaultOrigin := os.Getenv("MEEPLE_MOVER_ORIGIN_URL")
+  if "" == defaultOrigin {
+    defaultOrigin = "http://localhost:8000"
   }
 
-  player := &game.Player{}
-  playerRecord := &record.PlayerRecord{player}
-  err = playerRecord.Find(h.db, (int)(player_id))
-  if nil != err {
-    http.Error(w, "Player not found", http.StatusNotFound)
-    return
+  maxAge := 10 * time.Minute
+  if maxAgeOption, err := time.ParseDuration(os.Getenv("MEEPLE_MOVER_CORS_MAX_AGE")); nil == err {
+    maxAge = maxAgeOption
   }
 
-  err = json.NewEncoder(w).Encode(player)
-  if nil != err {
-    http.Error(w, "Error", http.StatusInternalServerError)
+  return &cors.Policy{
+    AllowedOrigins: listFromEnv("MEEPLE_MOVER_CORS_ORIGINS", defaultOrigin),
+    AllowedMethods: listFromEnv("MEEPLE_MOVER_CORS_METHODS", "GET", "POST", "PUT", "DELETE"),
+    AllowedHeaders: listFromEnv("MEEPLE_MOVER_CORS_HEADERS", "Content-Type", "Accept", "Authorization", "If-Match", "If-None-Match", api.RequestIDHeader, api.IdempotencyKeyHeader),
+    ExposedHeaders: listFromEnv("MEEPLE_MOVER_CORS_EXPOSED_HEADERS", "ETag", "Location", "Retry-After", api.RequestIDHeader, "Idempotent-Replayed"),
+    AllowCredentials: "true" == os.Getenv("MEEPLE_MOVER_CORS_ALLOW_CREDENTIALS"),
+    MaxAge: maxAge,
   }
 }
 
-type PlayerCreateRequest struct {
-  Player game.Player `json:"player"`
-}
-
-type PlayerCreateHandler struct {
-  db *sql.DB
-}
-func (handler PlayerCreateHandler) marshalFunc() (func(*url.URL, http.Header, *PlayerCreateRequest) (int, http.Header, *game.Player, error)) {
-  return func(u *url.URL, h http.Header, rq *PlayerCreateRequest) (int, http.Header, *game.Player, error) {
-    playerRecord :=  &record.PlayerRecord{&rq.Player}
-    err := playerRecord.Create(handler.db)
+// Private networks that webhook receivers may be on, as CIDRs
+func webhookNetworksFromEnv() ([]*net.IPNet, error) {
+  networks := make([]*net.IPNet, 0)
+  for _, cidr := range listFromEnv("MEEPLE_MOVER_WEBHOOK_ALLOWED_NETWORKS") {
+    _, network, err := net.ParseCIDR(cidr)
     if nil != err {
-      return http.StatusInternalServerError, nil, nil, errors.New("Could not create player in database")
+      return nil, err
     }
-
-    glog.Printf("Created player #%d: %s\n", rq.Player.Id, rq.Player.Name)
-    return http.StatusCreated, nil, &rq.Player, nil
+    networks = append(networks, network)
   }
+  return networks, nil
 }
 
-type PlayerDeleteHandler struct {
-  db *sql.DB
-}
-func (h PlayerDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-  player_id_str := r.URL.Query().Get("player_id")
-  player_id, err := strconv.ParseUint(player_id_str, 10, 64)
-  if nil != err {
-    http.Error(w, "Not found", http.StatusNotFound)
-    return
-  }
+func main() {
+  glog = newLogger(os.Stderr, os.Getenv("MEEPLE_MOVER_LOG_FORMAT"), os.Getenv("MEEPLE_MOVER_LOG_LEVEL"))
 
-  playerRecord := &record.PlayerRecord{&game.Player{Id: (int)(player_id)}}
-  err = playerRecord.Delete(h.db)
-  if nil != err {
-    http.Error(w, "Could not delete player from database", http.StatusInternalServerError)
-    return
+  databaseName := "meeple_mover"
+  if databaseNameOption := os.Getenv("MEEPLE_MOVER_DB_NAME"); databaseNameOption != "" {
+    databaseName = databaseNameOption
   }
+  connectString := fmt.Sprintf("user=ralph dbname=%s sslmode=disable", databaseName)
+  connectMsg := fmt.Sprintf("Connected to database %s", databaseName)
 
-  glog.Printf("Deleted player #%d\n", player_id)
-}
-
-
-type SessionsHandler struct{}
-func (h SessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-  err := json.NewEncoder(w).Encode(sessions)
-  if ( nil != err ) {
-    http.Error(w, "Error", http.StatusInternalServerError)
+  if herokuConnectString := os.Getenv("HEROKU_POSTGRESQL_SILVER_URL"); herokuConnectString != "" {
+    connectString = herokuConnectString
+    connectMsg = fmt.Sprintf("Connected to Heroku database")
   }
-}
 
-
-type SessionCreateHandler struct {
-  db *sql.DB
-}
-type SessionCreateHash struct {
-  StartedDate string `json:"started_date"`
-  Game string `json:"game"`
-  Players []string `json:"players"`
-}
-type SessionCreateRequest struct {
-  Session SessionCreateHash `json:"session"`
-}
-
-func fetchPlayersById(db *sql.DB, playerIds []int) ([]*game.Player, error) {
-  players := make([]*game.Player, len(playerIds))
-
-  for i, playerId := range playerIds {
-    var name string
-    err := db.QueryRow("SELECT name FROM players WHERE id = $1", playerId).Scan(&name)
-    if err != nil {
-       return players, err
-    }
-    players[i] = &game.Player{playerId, name}
+  db, err := sql.Open("postgres", connectString)
+  if err != nil {
+    glog.Error("Error opening database", "error", err)
+    os.Exit(1)
   }
+  glog.Info(connectMsg)
 
-  return players, nil
-}
-
-// Persist a new session
-func (handler SessionCreateHandler) marshalFunc() (func(*url.URL, http.Header, *SessionCreateRequest) (int, http.Header, *session.Session, error)) {
-  return func(u *url.URL, h http.Header, rq *SessionCreateRequest) (int, http.Header, *session.Session, error) {
-    var err error
+  webhookNetworks, err := webhookNetworksFromEnv()
+  if nil != err {
+    glog.Error("Error parsing MEEPLE_MOVER_WEBHOOK_ALLOWED_NETWORKS", "error", err)
+    db.Close()
+    os.Exit(1)
+  }
 
-    var game_id uint64
-    game_id, err = strconv.ParseUint(rq.Session.Game, 10, 64)
-    if nil != err {
-      return http.StatusBadRequest, nil, nil, errors.New("Expected integer game ID")
-    }
+  app := api.New(api.NewPostgresStore(db), glog, api.Config{WriteTimeout: writeTimeout, WebhookAllowedNetworks: webhookNetworks})
+  // Serve the probes while the caches load, so that supervisors can see that we're starting
+  go app.Load()
+  go app.DeliverWebhooks()
 
-    player_ids := make([]int, 0)
-    for _, player_id_str := range rq.Session.Players {
-      player_id, err := strconv.ParseInt(player_id_str, 10, 32)
-      if nil != err {
-        return http.StatusBadRequest, nil, nil, errors.New("Expected integer player ID")
-      }
-      player_ids = append(player_ids, (int)(player_id))
-    }
+  corsPolicy := corsPolicyFromEnv()
+  glog.Info("Allowed CORS origins", "origins", corsPolicy.AllowedOrigins)
 
-    var players []*game.Player
-    players, err = fetchPlayersById(handler.db, player_ids)
-    if nil != err {
-      return http.StatusInternalServerError, nil, nil, err
-    }
+  // Outside the API, so that it can answer preflight requests for any route
+  handler := corsPolicy.Handler(app)
 
-    var _session *session.Session
-    _session, err = session.NewSession(gameIndex[game_id], players)
-    if nil != err {
-      return http.StatusInternalServerError, nil, nil, err
-    }
-    _session.StepAllPlayers()
+  port := os.Getenv("PORT")
 
-    err = record.NewSessionRecord(_session).Create(handler.db)
+  servers := make([]server, 0)
+  tlsOpts := tlsOptionsFromEnv()
+  if tlsOpts.enabled() {
+    tlsServer, err := newTLSServer(tlsOpts, handler)
     if nil != err {
-      return http.StatusInternalServerError, nil, nil, err
+      glog.Error("Error configuring HTTPS", "error", err)
+      db.Close()
+      os.Exit(1)
     }
-
-    sessions = append(sessions, _session)
-    sessionIndex[(uint64)(_session.Id)] = _session
-
-    for _,step := range _session.SetupSteps {
-      glog.Printf("Session #%d: Created with step %s\n", _session.Id, _session.StepWithAssigneeString(step))
-    }
-
-    return http.StatusCreated, nil, _session, nil
-  }
-}
-
-
-type SessionHandler struct{}
-func (h SessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-  id_str := r.URL.Query().Get("session_id")
-  id, err := strconv.ParseUint(id_str, 10, 64)
-  if nil != err {
-    http.Error(w, "Not found", http.StatusNotFound)
-    return
-  }
-
-  session, ok := sessionIndex[id]
-  if ok {
-    err := json.NewEncoder(w).Encode(session)
-    if ( nil != err ) {
-      http.Error(w, "Error", http.StatusInternalServerError)
+    servers = append(servers, tlsServer)
+    // Serve plain HTTP too only if asked to, and then only to redirect to HTTPS
+    if "" != port {
+      servers = append(servers, newHTTPServer(fmt.Sprintf(":%s", port), redirectToHTTPS(tlsOpts.port, handler)))
     }
   } else {
-    http.Error(w, "Not found", http.StatusNotFound)
-  }
-}
-
-type StepHandler struct{
-  db *sql.DB
-}
-func (h StepHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-  session_id_str := r.URL.Query().Get("session_id")
-  session_id, err := strconv.ParseUint(session_id_str, 10, 64)
-  if nil != err {
-    http.Error(w, "Session not found", http.StatusNotFound)
-    return
-  }
-  session,ok := sessionIndex[session_id]
-  if !ok {
-    http.Error(w, "Session not found", http.StatusNotFound)
-    return
-  }
-
-  player_id_str := r.URL.Query().Get("player_id")
-  player_id, err := strconv.ParseUint(player_id_str, 10, 64)
-  if nil != err {
-    http.Error(w, "Player not found", http.StatusNotFound)
-    return
-  }
-  player := &game.Player{}
-  playerRecord := &record.PlayerRecord{player}
-  err = playerRecord.Find(h.db, (int)(player_id))
-  if nil != err {
-    http.Error(w, "Player not found", http.StatusNotFound)
-    return
-  }
-
-  step_desc,err := url.QueryUnescape(r.URL.Query().Get("step_desc"))
-  for _,step := range session.SetupSteps {
-    if ( step.Rule.Description == step_desc && step.CanBeOwnedBy(player) ) {
-      step.Finish()  // FIXME. Should look in request data to see what to change.
-      glog.Printf("Session #%d: Finished step %s\n", session.Id, session.StepWithAssigneeString(step))
-
-      rec := &record.SetupStepRecord{Step: step, SessionId: (int)(session.Id)}
-      err := rec.Update(h.db)
-      if nil != err {
-        // FIXME: Revert to the previous state if we can't save.
-        http.Error(w, fmt.Sprintf("Error saving update to step: %s", err), http.StatusInternalServerError)
-        return
-      }
-
-      nextStep := session.Step(player)
-      if step.Equal(nextStep) {
-        glog.Printf("Session #%d: Player %s is done", session.Id, player)
-      } else {
-        glog.Printf("Session #%d: Assigned step %s\n", session.Id, session.StepWithAssigneeString(nextStep))
-      }
-
-      if nextStep != step && nil != nextStep {
-        lastAssignmentRec := &record.SetupStepAssignmentRecord{session, player, step.Rule}
-        err = lastAssignmentRec.Delete(h.db)
-        if nil != err {
-          http.Error(w, fmt.Sprintf("Error removing assignment of last step: %s", err), http.StatusInternalServerError)
-          return
-        }
-        nextAssignmentRec := &record.SetupStepAssignmentRecord{session, player, nextStep.Rule}
-        err = nextAssignmentRec.Create(h.db)
-        if nil != err {
-          http.Error(w, fmt.Sprintf("Error creating assignment of next step: %s", err), http.StatusInternalServerError)
-          return
-        }
-      }
-      return  // Found the matching step, so return response
+    if "" == port {
+      port = "8080"
     }
+    servers = append(servers, newHTTPServer(fmt.Sprintf(":%s", port), handler))
   }
-  http.Error(w, "Step not found", http.StatusNotFound)
-}
-
-func main() {
-  databaseName := "meeple_mover"
-  if databaseNameOption := os.Getenv("MEEPLE_MOVER_DB_NAME"); databaseNameOption != "" {
-    databaseName = databaseNameOption
-  }
-  connectString := fmt.Sprintf("user=ralph dbname=%s sslmode=disable", databaseName)
-  connectMsg := fmt.Sprintf("Connected to database %s", databaseName)
-
-  if herokuConnectString := os.Getenv("HEROKU_POSTGRESQL_SILVER_URL"); herokuConnectString != "" {
-    connectString = herokuConnectString
-    connectMsg = fmt.Sprintf("Connected to Heroku database")
-  }
-
-  db, err := sql.Open("postgres", connectString)
-  if err != nil {
-    glog.Print(err)
-  } else {
-    glog.Println(connectMsg)
-  }
-  defer db.Close()
 
-  err = initGameData(db)
-  if err != nil {
-    glog.Panicf("Error initializing games: %s\n", err)
-  }
-  err = initSessionData(db)
-  if err != nil {
-    glog.Panicf("Error initializing sessions: %s\n", err)
+  // gRPC is served on its own port, only if one is given
+  if grpcPort := os.Getenv("MEEPLE_MOVER_GRPC_PORT"); "" != grpcPort {
+    servers = append(servers, &grpcListener{app.GRPCServer(), fmt.Sprintf(":%s", grpcPort)})
   }
 
-  var origin string
-  origin = os.Getenv("MEEPLE_MOVER_ORIGIN_URL")
-  if "" == origin {
-    origin = "http://localhost:8000"
+  err = serveUntilSignalled(app.Close, servers...)
+  if nil != err {
+    glog.Error("Server failed", "error", err)
   }
-  cors := tigertonic.NewCORSBuilder().AddAllowedOrigins(origin).AddAllowedHeaders("Content-Type")
-  glog.Printf("Allowed CORS origin %s\n", origin)
 
-  mux := tigertonic.NewTrieServeMux()
-  mux.Handle("GET", "/games", cors.Build(CollectionHandler{}))
-  mux.Handle("GET", "/games/{id}", cors.Build(GameHandler{}))
-  mux.Handle("GET", "/players", cors.Build(PlayersHandler{db}))
-  mux.Handle("GET", "/players/{player_id}", cors.Build(PlayerHandler{db}))
-  mux.Handle("POST", "/players", cors.Build(tigertonic.Marshaled(PlayerCreateHandler{db}.marshalFunc())))
-  mux.Handle("DELETE", "/players/{player_id}", cors.Build(PlayerDeleteHandler{db}))
-  mux.Handle("GET", "/sessions", cors.Build(SessionsHandler{}))
-  mux.Handle("POST", "/sessions", cors.Build(tigertonic.Marshaled(SessionCreateHandler{db}.marshalFunc())))
-  mux.Handle("GET", "/sessions/{session_id}", cors.Build(SessionHandler{}))
-  mux.Handle("PUT", "/sessions/{session_id}/players/{player_id}/steps/{step_desc}", cors.Build(StepHandler{db}))
+  // Only once no more requests can use it
+  db.Close()
+  glog.Info("Closed database")
 
-  var port string
-  port = os.Getenv("PORT")
-  if "" == port {
-    port = "8080"
+  if nil != err {
+    os.Exit(1)
   }
-
-  http.ListenAndServe(fmt.Sprintf(":%s", port), mux)
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+func TestNewLogger_JSON(t *testing.T) {
+  var buf bytes.Buffer
+  log := newLogger(&buf, "json", "warn")
+  log.Info("Hidden")
+  log.Warn("Shown", "session_id", 7)
+
+  var entry map[string]interface{}
+  err := json.Unmarshal(buf.Bytes(), &entry)
+  if nil != err {
+    t.Fatalf("Expected a single JSON log entry, got %q", buf.String())
+  }
+  if entry["msg"] != "Shown" || entry["session_id"] != 7.0 {
+    t.Fatalf("Unexpected log entry %v", entry)
+  }
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+  probed := false
+  h := redirectToHTTPS("8443", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { probed = true }))
+
+  w := httptest.NewRecorder()
+  h.ServeHTTP(w, httptest.NewRequest("GET", "http://gamenight.local:8080/sessions/3?x=1", nil))
+  if w.Code != http.StatusPermanentRedirect {
+    t.Fatalf("Expected 308, got %d", w.Code)
+  }
+  if location := w.Header().Get("Location"); location != "https://gamenight.local:8443/sessions/3?x=1" {
+    t.Fatalf("Unexpected redirect to %s", location)
+  }
+
+  w = httptest.NewRecorder()
+  redirectToHTTPS("443", nil).ServeHTTP(w, httptest.NewRequest("GET", "http://gamenight.local/games", nil))
+  if location := w.Header().Get("Location"); location != "https://gamenight.local/games" {
+    t.Fatalf("Expected default HTTPS port to be left out, redirected to %s", location)
+  }
+
+  h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://gamenight.local:8080/healthz", nil))
+  if !probed {
+    t.Fatal("Expected probe to be served over plain HTTP")
+  }
+}
+
+func TestCorsPolicyFromEnv(t *testing.T) {
+  t.Setenv("MEEPLE_MOVER_ORIGIN_URL", "http://example.com")
+  t.Setenv("MEEPLE_MOVER_CORS_ORIGINS", "")
+  policy := corsPolicyFromEnv()
+  if len(policy.AllowedOrigins) != 1 || policy.AllowedOrigins[0] != "http://example.com" {
+    t.Fatalf("Expected single origin from MEEPLE_MOVER_ORIGIN_URL, got %v", policy.AllowedOrigins)
+  }
+
+  t.Setenv("MEEPLE_MOVER_CORS_ORIGINS", "https://goboard.example.com, https://*.staging.example.com,")
+  t.Setenv("MEEPLE_MOVER_CORS_EXPOSED_HEADERS", "ETag")
+  policy = corsPolicyFromEnv()
+  if len(policy.AllowedOrigins) != 2 || policy.AllowedOrigins[1] != "https://*.staging.example.com" {
+    t.Fatalf("Expected list of origins, got %v", policy.AllowedOrigins)
+  }
+  if len(policy.ExposedHeaders) != 1 {
+    t.Fatalf("Expected exposed headers to be configured, got %v", policy.ExposedHeaders)
+  }
+}
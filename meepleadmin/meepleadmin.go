@@ -0,0 +1,255 @@
+/*
+
+Administer the database: inspect and repair sessions, and prune old ones.
+
+Works on the database directly, through the record package, so a running server won't see
+the changes until it restarts and reloads its caches.
+
+  meepleadmin sessions
+  meepleadmin reset 3
+  meepleadmin reassign 3 2 5
+  meepleadmin -dry-run prune 2024-01-01
+  meepleadmin counts
+
+*/
+
+package main
+
+import (
+  "database/sql"
+  "errors"
+  "flag"
+  "fmt"
+  "io"
+  "os"
+  "strconv"
+  "strings"
+  "text/tabwriter"
+  "time"
+  _ "github.com/lib/pq"
+  "github.com/rkbodenner/meeple_mover/record"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+var usage = `Usage: meepleadmin [-dbname NAME] [-dry-run] <command> [arguments]
+
+Commands:
+  sessions                                 List sessions with how many of their steps are done
+  reset <session>                          Undo every step of a session
+  reassign <session> <player> <new player> Give a departed player's steps to another player, by ID
+  prune <date>                             Delete sessions created before the date, like 2006-01-02
+  counts                                   Count the rows in each table
+`
+
+var errUsage = errors.New("Wrong arguments")
+
+type admin struct {
+  db *sql.DB
+  out io.Writer
+  dryRun bool
+}
+
+func (a *admin) table(header string, rows [][]string) error {
+  w := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+  fmt.Fprintln(w, header)
+  for _, row := range rows {
+    fmt.Fprintln(w, strings.Join(row, "\t"))
+  }
+  return w.Flush()
+}
+
+func summaryRows(summaries []*record.SessionSummary) [][]string {
+  rows := make([][]string, len(summaries))
+  for i, s := range summaries {
+    rows[i] = []string{
+      strconv.Itoa(s.Id),
+      s.GameName,
+      strings.Join(s.Players, ", "),
+      fmt.Sprintf("%d/%d", s.StepsDone, s.Steps),
+      s.CreatedAt.Format("2006-01-02 15:04"),
+    }
+  }
+  return rows
+}
+
+func (a *admin) sessions() error {
+  summaries, err := record.FindSessionSummaries(a.db)
+  if nil != err {
+    return err
+  }
+  return a.table("ID\tGAME\tPLAYERS\tDONE\tCREATED", summaryRows(summaries))
+}
+
+func (a *admin) findSession(idArg string) (*record.SessionRecord, *session.Session, error) {
+  id, err := strconv.Atoi(idArg)
+  if nil != err {
+    return nil, nil, errUsage
+  }
+  s := session.NewEmptySession()
+  rec := record.NewSessionRecord(s)
+  err = rec.Find(a.db, id)
+  if sql.ErrNoRows == err {
+    return nil, nil, errors.New(fmt.Sprintf("No session %d", id))
+  }
+  return rec, s, err
+}
+
+func (a *admin) reset(idArg string) error {
+  rec, s, err := a.findSession(idArg)
+  if nil != err {
+    return err
+  }
+  if a.dryRun {
+    fmt.Fprintf(a.out, "Would reset the %d steps of session %d\n", len(s.SetupSteps), s.Id)
+    return nil
+  }
+  if err := rec.ResetSteps(a.db); nil != err {
+    return err
+  }
+  fmt.Fprintf(a.out, "Reset the %d steps of session %d\n", len(s.SetupSteps), s.Id)
+  return nil
+}
+
+func (a *admin) reassign(idArg string, departedArg string, replacementArg string) error {
+  departedId, err := strconv.Atoi(departedArg)
+  if nil != err {
+    return errUsage
+  }
+  replacementId, err := strconv.Atoi(replacementArg)
+  if nil != err {
+    return errUsage
+  }
+  rec, s, err := a.findSession(idArg)
+  if nil != err {
+    return err
+  }
+  replacement := &game.Player{}
+  err = (&record.PlayerRecord{replacement}).Find(a.db, replacementId)
+  if sql.ErrNoRows == err {
+    return errors.New(fmt.Sprintf("No player %d", replacementId))
+  } else if nil != err {
+    return err
+  }
+
+  if a.dryRun {
+    fmt.Fprintf(a.out, "Would give player %d's steps in session %d to %s\n", departedId, s.Id, replacement.Name)
+    return nil
+  }
+  if err := rec.ReplacePlayer(a.db, departedId, replacement); nil != err {
+    return err
+  }
+  fmt.Fprintf(a.out, "Gave player %d's steps in session %d to %s\n", departedId, s.Id, replacement.Name)
+  return nil
+}
+
+func parseDate(date string) (time.Time, error) {
+  if t, err := time.Parse(time.RFC3339, date); nil == err {
+    return t, nil
+  }
+  return time.ParseInLocation("2006-01-02", date, time.Local)
+}
+
+func (a *admin) prune(date string) error {
+  before, err := parseDate(date)
+  if nil != err {
+    return errUsage
+  }
+  if a.dryRun {
+    summaries, err := record.FindSessionSummaries(a.db)
+    if nil != err {
+      return err
+    }
+    old := make([]*record.SessionSummary, 0)
+    for _, s := range summaries {
+      if s.CreatedAt.Before(before) {
+        old = append(old, s)
+      }
+    }
+    fmt.Fprintf(a.out, "Would delete %d sessions\n\n", len(old))
+    return a.table("ID\tGAME\tPLAYERS\tDONE\tCREATED", summaryRows(old))
+  }
+
+  count, err := record.PruneSessions(a.db, before)
+  if nil != err {
+    return err
+  }
+  fmt.Fprintf(a.out, "Deleted %d sessions\n", count)
+  return nil
+}
+
+func (a *admin) counts() error {
+  counts, err := record.CountRows(a.db)
+  if nil != err {
+    return err
+  }
+  rows := make([][]string, len(counts))
+  for i, count := range counts {
+    rows[i] = []string{count.Table, strconv.FormatInt(count.Rows, 10)}
+  }
+  return a.table("TABLE\tROWS", rows)
+}
+
+func (a *admin) run(args []string) error {
+  if len(args) < 1 {
+    return errUsage
+  }
+  command, args := args[0], args[1:]
+  switch {
+  case "sessions" == command && len(args) == 0:
+    return a.sessions()
+  case "reset" == command && len(args) == 1:
+    return a.reset(args[0])
+  case "reassign" == command && len(args) == 3:
+    return a.reassign(args[0], args[1], args[2])
+  case "prune" == command && len(args) == 1:
+    return a.prune(args[0])
+  case "counts" == command && len(args) == 0:
+    return a.counts()
+  }
+  return errUsage
+}
+
+func main() {
+  defaultDatabase := os.Getenv("MEEPLE_MOVER_DB_NAME")
+  if "" == defaultDatabase {
+    defaultDatabase = "meeple_mover"
+  }
+  var databaseName string
+  flag.StringVar(&databaseName, "dbname", defaultDatabase, "Name of the database. Defaults to $MEEPLE_MOVER_DB_NAME.")
+  var dryRun bool
+  flag.BoolVar(&dryRun, "dry-run", false, "Say what would be changed without changing it")
+  flag.Usage = func() {
+    fmt.Fprint(os.Stderr, usage)
+    fmt.Fprintln(os.Stderr, "\nOptions:")
+    flag.PrintDefaults()
+  }
+  flag.Parse()
+
+  connectString := fmt.Sprintf("user=ralph dbname=%s sslmode=disable", databaseName)
+  if herokuConnectString := os.Getenv("HEROKU_POSTGRESQL_SILVER_URL"); herokuConnectString != "" {
+    connectString = herokuConnectString
+  }
+  db, err := sql.Open("postgres", connectString)
+  if nil != err {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+  defer db.Close()
+
+  if err := record.CheckSchemaVersion(db); nil != err {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+
+  a := &admin{db, os.Stdout, dryRun}
+  err = a.run(flag.Args())
+  if errUsage == err {
+    flag.Usage()
+    os.Exit(2)
+  }
+  if nil != err {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+}
@@ -0,0 +1,111 @@
+package meepleclient
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "net"
+  "net/http"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// Match the errors the server responds with, by status, with errors.Is
+var (
+  ErrBadRequest = errors.New("bad request")  // 400
+  ErrNotFound = errors.New("not found")  // 404
+  ErrConflict = errors.New("conflict")  // 409
+  ErrTooLarge = errors.New("request too large")  // 413
+  ErrInvalid = errors.New("invalid request")  // 422
+  ErrUnavailable = errors.New("service unavailable")  // 503, while the server is starting
+  ErrServer = errors.New("server error")  // Any 5xx
+)
+
+// The server's response to a request it couldn't serve
+type StatusError struct {
+  Status int
+  Name string  // The kind of error, like "idempotency", when the server gives one
+  Message string
+  RetryAfter time.Duration  // When the server says to try again, as it does while starting
+}
+
+func (err *StatusError) Error() string {
+  return fmt.Sprintf("%d %s: %s", err.Status, http.StatusText(err.Status), err.Message)
+}
+
+func (err *StatusError) Is(target error) bool {
+  return statusIs(err.Status, target)
+}
+
+// The server's refusal of a request whose contents it couldn't act on, listing every problem found
+type ValidationError struct {
+  Problems []string
+}
+
+func (err *ValidationError) Error() string {
+  return strings.Join(err.Problems, "; ")
+}
+
+func (err *ValidationError) Is(target error) bool {
+  return statusIs(http.StatusUnprocessableEntity, target)
+}
+
+func statusIs(status int, target error) bool {
+  switch target {
+  case ErrBadRequest:
+    return http.StatusBadRequest == status
+  case ErrNotFound:
+    return http.StatusNotFound == status
+  case ErrConflict:
+    return http.StatusConflict == status
+  case ErrTooLarge:
+    return http.StatusRequestEntityTooLarge == status
+  case ErrInvalid:
+    return http.StatusUnprocessableEntity == status
+  case ErrUnavailable:
+    return http.StatusServiceUnavailable == status
+  case ErrServer:
+    return status >= 500
+  }
+  return false
+}
+
+func decodeError(rs *http.Response, body []byte) error {
+  // tigertonic and the idempotency checks describe errors in JSON; http.Error in plain text
+  described := struct {
+    Description string `json:"description"`
+    Error string `json:"error"`
+  }{}
+  if nil == json.Unmarshal(body, &described) && "" != described.Description {
+    if "validation" == described.Error {
+      return &ValidationError{strings.Split(described.Description, "; ")}
+    }
+  } else {
+    described.Description = strings.TrimSpace(string(body))
+  }
+
+  err := &StatusError{Status: rs.StatusCode, Name: described.Error, Message: described.Description}
+  if seconds, parseErr := strconv.Atoi(rs.Header.Get("Retry-After")); nil == parseErr {
+    err.RetryAfter = (time.Duration)(seconds) * time.Second
+  }
+  return err
+}
+
+// Whether another attempt might succeed: the server was unavailable, or still serving the same
+// request, or the connection failed
+func retryable(err error) bool {
+  var statusErr *StatusError
+  if errors.As(err, &statusErr) {
+    switch statusErr.Status {
+    case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+      return true
+    case http.StatusConflict:
+      return "idempotency" == statusErr.Name
+    }
+    return false
+  }
+  var netErr net.Error
+  return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
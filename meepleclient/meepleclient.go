@@ -0,0 +1,400 @@
+/*
+
+A client for the meeple_mover HTTP API, returning games, players and sessions as parallel_universe
+types, linked as the server has them: rules depend on rules of the same game, and steps belong to
+the session's players.
+
+There's a method for each endpoint, other than those meant for operators and tools rather than
+clients: /healthz, /readyz, /metrics and /openapi.json. Sessions are fetched through /graphql, which
+isn't otherwise exposed, since its answers don't come back as parallel_universe types.
+
+Calls that are safe to repeat are retried when the server is unavailable or the connection fails.
+Creating players, sessions, modules and webhooks is made safe to repeat by sending an Idempotency-Key.
+
+  c := meepleclient.New("http://localhost:8080", meepleclient.Config{})
+  s, err := c.CreateSession(ctx, 1, []int{1, 2}, meepleclient.SessionOptions{})
+  err = c.Follow(ctx, s.Id, func(s *session.Session) error {
+    fmt.Println(s.StepWithAssigneeString(s.SetupSteps[0]))
+    return nil
+  })
+
+*/
+
+package meepleclient
+
+import (
+  "bytes"
+  "context"
+  "crypto/rand"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "net/http"
+  "net/url"
+  "strconv"
+  "strings"
+  "time"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+const (
+  defaultRetries = 3
+  defaultRetryWait = 500 * time.Millisecond
+  // Longest the client waits between attempts, whatever the server's Retry-After says
+  maxRetryWait = 30 * time.Second
+
+  idempotencyKeyHeader = "Idempotency-Key"
+)
+
+type Config struct {
+  // Makes the requests. One with a timeout of 30 seconds if nil. Streams of updates ignore its timeout.
+  HTTPClient *http.Client
+  // How many times to retry a call that is safe to repeat. 3 if zero; none if negative.
+  Retries int
+  // How long to wait before the first retry, doubling for each after it. Half a second if zero.
+  RetryWait time.Duration
+}
+
+type Client struct {
+  server string
+  http *http.Client
+  retries int
+  retryWait time.Duration
+}
+
+// A client for the server at the given URL, like http://localhost:8080
+func New(server string, config Config) *Client {
+  c := &Client{strings.TrimRight(server, "/"), config.HTTPClient, config.Retries, config.RetryWait}
+  if nil == c.http {
+    c.http = &http.Client{Timeout: 30 * time.Second}
+  }
+  if 0 == c.retries {
+    c.retries = defaultRetries
+  } else if c.retries < 0 {
+    c.retries = 0
+  }
+  if 0 == c.retryWait {
+    c.retryWait = defaultRetryWait
+  }
+  return c
+}
+
+// A request to the server. Retried if it's safe to repeat.
+type request struct {
+  method string
+  path string
+  body interface{}
+  out interface{}  // Decoded from JSON, or the whole body if a *string
+  header http.Header
+  safe bool
+}
+
+func newIdempotencyKey() string {
+  buf := make([]byte, 16)
+  rand.Read(buf)
+  return hex.EncodeToString(buf)
+}
+
+// How long to wait before another attempt. The server's Retry-After wins, within reason.
+func (c *Client) backoff(attempt int, err error) time.Duration {
+  var statusErr *StatusError
+  if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+    if statusErr.RetryAfter > maxRetryWait {
+      return maxRetryWait
+    }
+    return statusErr.RetryAfter
+  }
+  wait := c.retryWait << attempt
+  if wait <= 0 || wait > maxRetryWait {
+    return maxRetryWait
+  }
+  return wait
+}
+
+func (c *Client) do(ctx context.Context, rq *request) error {
+  var payload []byte
+  if nil != rq.body {
+    var err error
+    payload, err = json.Marshal(rq.body)
+    if nil != err {
+      return err
+    }
+  }
+
+  var err error
+  for attempt := 0; ; attempt++ {
+    err = c.attempt(ctx, rq, payload)
+    if nil == err || !rq.safe || attempt >= c.retries || !retryable(err) {
+      return err
+    }
+    select {
+    case <-ctx.Done():
+      return err
+    case <-time.After(c.backoff(attempt, err)):
+    }
+  }
+}
+
+func (c *Client) attempt(ctx context.Context, rq *request, payload []byte) error {
+  var body io.Reader
+  if nil != payload {
+    body = bytes.NewReader(payload)
+  }
+  r, err := http.NewRequestWithContext(ctx, rq.method, c.server + rq.path, body)
+  if nil != err {
+    return err
+  }
+  for name, values := range rq.header {
+    r.Header[name] = values
+  }
+  if "" == r.Header.Get("Accept") {
+    r.Header.Set("Accept", "application/json")
+  }
+  if nil != payload {
+    r.Header.Set("Content-Type", "application/json")
+  }
+
+  rs, err := c.http.Do(r)
+  if nil != err {
+    return err
+  }
+  defer rs.Body.Close()
+  respBody, err := io.ReadAll(rs.Body)
+  if nil != err {
+    return err
+  }
+  if rs.StatusCode >= 400 {
+    return decodeError(rs, respBody)
+  }
+
+  switch out := rq.out.(type) {
+  case nil:
+    return nil
+  case *string:
+    *out = string(respBody)
+    return nil
+  default:
+    return json.Unmarshal(respBody, out)
+  }
+}
+
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+  return c.do(ctx, &request{method: "GET", path: path, out: out, safe: true})
+}
+
+// POST with an Idempotency-Key, so that it can be retried
+func (c *Client) create(ctx context.Context, path string, body interface{}, out interface{}) error {
+  header := http.Header{idempotencyKeyHeader: []string{newIdempotencyKey()}}
+  return c.do(ctx, &request{method: "POST", path: path, body: body, out: out, header: header, safe: true})
+}
+
+// Run a GraphQL query, decoding its data into out. Queries are safe to repeat; mutations aren't.
+func (c *Client) query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+  result := struct {
+    Data json.RawMessage `json:"data"`
+    Errors []struct {
+      Message string `json:"message"`
+    } `json:"errors"`
+  }{}
+  body := map[string]interface{}{"query": query, "variables": variables}
+  err := c.do(ctx, &request{method: "POST", path: "/graphql", body: body, out: &result, safe: true})
+  if nil != err {
+    return err
+  }
+  if len(result.Errors) > 0 {
+    messages := make([]string, len(result.Errors))
+    for i, e := range result.Errors {
+      messages[i] = e.Message
+    }
+    return errors.New(strings.Join(messages, "; "))
+  }
+  return json.Unmarshal(result.Data, out)
+}
+
+// Point each rule's dependencies at the game's own rules, rather than the copies the JSON has
+func linkRules(g *game.Game) {
+  rules := make(map[int]*game.SetupRule)
+  for _, rule := range g.SetupRules {
+    rules[rule.Id] = rule
+  }
+  for _, rule := range g.SetupRules {
+    for i, dep := range rule.Dependencies {
+      if linked, ok := rules[dep.Id]; ok {
+        rule.Dependencies[i] = linked
+      }
+    }
+  }
+}
+
+func (c *Client) Games(ctx context.Context) ([]*game.Game, error) {
+  games := make([]*game.Game, 0)
+  if err := c.get(ctx, "/games", &games); nil != err {
+    return nil, err
+  }
+  for _, g := range games {
+    linkRules(g)
+  }
+  return games, nil
+}
+
+func (c *Client) Game(ctx context.Context, id uint) (*game.Game, error) {
+  g := &game.Game{}
+  if err := c.get(ctx, fmt.Sprintf("/games/%d", id), g); nil != err {
+    return nil, err
+  }
+  linkRules(g)
+  return g, nil
+}
+
+// The game's setup checklist for the number of players, in markdown, text or html
+func (c *Client) GameChecklist(ctx context.Context, id uint, players int, format string) (string, error) {
+  var checklist string
+  query := url.Values{"players": []string{strconv.Itoa(players)}, "format": []string{format}}
+  err := c.get(ctx, fmt.Sprintf("/games/%d/checklist?%s", id, query.Encode()), &checklist)
+  return checklist, err
+}
+
+// How setup goes for the number of players, if each step takes a round
+func (c *Client) GameAnalysis(ctx context.Context, id uint, players int) (*setupgraph.Analysis, error) {
+  analysis := &setupgraph.Analysis{}
+  if err := c.get(ctx, fmt.Sprintf("/games/%d/analysis?players=%d", id, players), analysis); nil != err {
+    return nil, err
+  }
+  return analysis, nil
+}
+
+// The game's setup rules and what each depends on, in dot or svg
+func (c *Client) GameGraph(ctx context.Context, id uint, format string) (string, error) {
+  var graph string
+  err := c.get(ctx, fmt.Sprintf("/games/%d/graph?format=%s", id, url.QueryEscape(format)), &graph)
+  return graph, err
+}
+
+func (c *Client) Players(ctx context.Context) ([]*game.Player, error) {
+  players := make([]*game.Player, 0)
+  if err := c.get(ctx, "/players", &players); nil != err {
+    return nil, err
+  }
+  return players, nil
+}
+
+func (c *Client) Player(ctx context.Context, id int) (*game.Player, error) {
+  player := &game.Player{}
+  if err := c.get(ctx, fmt.Sprintf("/players/%d", id), player); nil != err {
+    return nil, err
+  }
+  return player, nil
+}
+
+func (c *Client) CreatePlayer(ctx context.Context, name string) (*game.Player, error) {
+  player := &game.Player{}
+  body := map[string]interface{}{"player": &game.Player{Name: name}}
+  if err := c.create(ctx, "/players", body, player); nil != err {
+    return nil, err
+  }
+  return player, nil
+}
+
+func (c *Client) DeletePlayer(ctx context.Context, id int) error {
+  return c.do(ctx, &request{method: "DELETE", path: fmt.Sprintf("/players/%d", id), safe: true})
+}
+
+// How a new session is set up, beyond its game and players
+type SessionOptions struct {
+  Modules []string  // Names of the game's expansions and variants to set it up with
+  Strategy string  // How players' next steps are chosen. The server's default if empty.
+}
+
+// Start a session of the game for the players, assigning each their first step
+func (c *Client) CreateSession(ctx context.Context, gameId uint, playerIds []int, options SessionOptions) (*session.Session, error) {
+  players := make([]string, len(playerIds))
+  for i, id := range playerIds {
+    players[i] = strconv.Itoa(id)
+  }
+  hash := map[string]interface{}{"game": strconv.FormatUint((uint64)(gameId), 10), "players": players}
+  if 0 != len(options.Modules) {
+    hash["modules"] = options.Modules
+  }
+  if "" != options.Strategy {
+    hash["strategy"] = options.Strategy
+  }
+  body := map[string]interface{}{"session": hash}
+  created := struct {
+    Id uint
+  }{}
+  if err := c.create(ctx, "/sessions", body, &created); nil != err {
+    return nil, err
+  }
+  return c.Session(ctx, created.Id)
+}
+
+// The session's setup checklist, with finished steps checked off, in markdown, text or html
+func (c *Client) SessionChecklist(ctx context.Context, id uint, format string) (string, error) {
+  var checklist string
+  err := c.get(ctx, fmt.Sprintf("/sessions/%d/checklist?format=%s", id, url.QueryEscape(format)), &checklist)
+  return checklist, err
+}
+
+// What's left of the session's setup, and the unfinished steps holding up the most others
+func (c *Client) SessionAnalysis(ctx context.Context, id uint) (*setupgraph.SessionAnalysis, error) {
+  analysis := &setupgraph.SessionAnalysis{}
+  if err := c.get(ctx, fmt.Sprintf("/sessions/%d/analysis", id), analysis); nil != err {
+    return nil, err
+  }
+  return analysis, nil
+}
+
+// The session's setup steps, colored by whether they're done, assigned, blocked or ready, in dot or svg
+func (c *Client) SessionGraph(ctx context.Context, id uint, format string) (string, error) {
+  var graph string
+  err := c.get(ctx, fmt.Sprintf("/sessions/%d/graph?format=%s", id, url.QueryEscape(format)), &graph)
+  return graph, err
+}
+
+// Finish a player's step and assign them their next one. Retried like a GET, since finishing a step
+// that's already done changes nothing.
+func (c *Client) FinishStep(ctx context.Context, sessionId uint, playerId int, stepDesc string) error {
+  path := fmt.Sprintf("/sessions/%d/players/%d/steps/%s", sessionId, playerId, url.PathEscape(stepDesc))
+  return c.do(ctx, &request{method: "PUT", path: path, safe: true})
+}
+
+const (
+  Finish = "finish"
+  Reopen = "reopen"
+)
+
+// A step to finish or reopen, for ChangeSteps
+type StepAction struct {
+  PlayerId int
+  StepDesc string
+  Action string  // Finish, the default, or Reopen
+}
+
+// A player's current step, which is nil once they have none left to do
+type Assignment struct {
+  Player *game.Player `json:"player"`
+  Step *game.SetupStep `json:"step"`
+  Done bool `json:"done"`
+}
+
+// Finish or reopen many steps at once. Not retried, since a repeat would be refused for steps
+// already finished or reopened. Returns each player's step afterwards.
+func (c *Client) ChangeSteps(ctx context.Context, sessionId uint, actions []StepAction) ([]*Assignment, error) {
+  steps := make([]map[string]string, len(actions))
+  for i, action := range actions {
+    steps[i] = map[string]string{"player_id": strconv.Itoa(action.PlayerId), "step_desc": action.StepDesc, "action": action.Action}
+  }
+  result := struct {
+    Assignments []*Assignment `json:"assignments"`
+  }{}
+  path := fmt.Sprintf("/sessions/%d/steps:batch", sessionId)
+  err := c.do(ctx, &request{method: "POST", path: path, body: map[string]interface{}{"steps": steps}, out: &result})
+  if nil != err {
+    return nil, err
+  }
+  return result.Assignments, nil
+}
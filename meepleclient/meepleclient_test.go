@@ -0,0 +1,170 @@
+package meepleclient
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+  "time"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+const testSession = `{"data": {"session": {"id": "3",
+  "game": {"id": "1", "name": "Forbidden Island", "minPlayers": 2, "maxPlayers": 4, "rules": [
+    {"id": "10", "description": "Lay out the board", "arity": "Once", "dependsOn": []},
+    {"id": "11", "description": "Place pawn", "arity": "Each player", "dependsOn": [{"id": "10"}]}
+  ]},
+  "players": [{"id": "1", "name": "Alice"}, {"id": "2", "name": "Bob"}],
+  "steps": [
+    {"rule": {"id": "10"}, "owner": null, "done": true},
+    {"rule": {"id": "11"}, "owner": {"id": "1"}, "done": false},
+    {"rule": {"id": "11"}, "owner": {"id": "2"}, "done": true}
+  ],
+  "assignments": [
+    {"player": {"id": "1"}, "step": {"rule": {"id": "11"}, "owner": {"id": "1"}}},
+    {"player": {"id": "2"}, "step": null}
+  ]}}}`
+
+func testClient(handler http.HandlerFunc) (*Client, *httptest.Server) {
+  server := httptest.NewServer(handler)
+  return New(server.URL, Config{HTTPClient: server.Client(), RetryWait: time.Millisecond}), server
+}
+
+func TestClient_Games(t *testing.T) {
+  c, server := testClient(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(`[{"Id": 1, "Name": "Forbidden Island", "SetupRules": [
+      {"Id": 10, "Description": "Lay out the board"},
+      {"Id": 11, "Description": "Place pawn", "Dependencies": [{"Id": 10, "Description": "Lay out the board"}]}
+    ]}]`))
+  })
+  defer server.Close()
+
+  games, err := c.Games(context.Background())
+  if nil != err {
+    t.Fatal(err)
+  }
+  rules := games[0].SetupRules
+  if rules[1].Dependencies[0] != rules[0] {
+    t.Error("Expected the rule's dependency to be the game's own rule")
+  }
+}
+
+func TestClient_Session(t *testing.T) {
+  c, server := testClient(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(testSession))
+  })
+  defer server.Close()
+
+  s, err := c.Session(context.Background(), 3)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if 3 != s.Id || "Forbidden Island" != s.Game.Name || 3 != len(s.SetupSteps) {
+    t.Fatalf("Expected session 3 with 3 steps, got %+v", s)
+  }
+  alice, bob := s.Players[0], s.Players[1]
+  if s.SetupSteps[1].Owner != alice || s.SetupSteps[1].Rule.Dependencies[0] != s.SetupSteps[0].Rule {
+    t.Error("Expected steps to point at the session's players and rules")
+  }
+  if step, ok := s.SetupAssignments.Get(alice); !ok || step != s.SetupSteps[1] {
+    t.Errorf("Expected Alice to be assigned her pawn, got %v", step)
+  }
+  if _, ok := s.SetupAssignments.Get(bob); ok {
+    t.Error("Expected Bob, who is done, to have no step")
+  }
+}
+
+func TestClient_Errors(t *testing.T) {
+  c, server := testClient(func(w http.ResponseWriter, r *http.Request) {
+    switch r.URL.Path {
+    case "/players/7":
+      http.Error(w, "Player not found", http.StatusNotFound)
+    case "/players":
+      w.Header().Set("Content-Type", "application/json")
+      w.WriteHeader(http.StatusUnprocessableEntity)
+      w.Write([]byte(`{"description": "Name is required; Name is too long", "error": "validation"}`))
+    case "/graphql":
+      w.Write([]byte(`{"data": {"session": null}}`))
+    }
+  })
+  defer server.Close()
+  ctx := context.Background()
+
+  _, err := c.Player(ctx, 7)
+  var statusErr *StatusError
+  if !errors.Is(err, ErrNotFound) || !errors.As(err, &statusErr) || "Player not found" != statusErr.Message {
+    t.Errorf("Expected a 404, got %v", err)
+  }
+  if _, err = c.Session(ctx, 7); !errors.Is(err, ErrNotFound) {
+    t.Errorf("Expected a 404 for a missing session, got %v", err)
+  }
+
+  _, err = c.CreatePlayer(ctx, "")
+  var invalid *ValidationError
+  if !errors.Is(err, ErrInvalid) || !errors.As(err, &invalid) || 2 != len(invalid.Problems) {
+    t.Errorf("Expected both problems, got %v", err)
+  }
+}
+
+func TestClient_Retries(t *testing.T) {
+  attempts := 0
+  keys := make(map[string]bool)
+  c, server := testClient(func(w http.ResponseWriter, r *http.Request) {
+    attempts++
+    keys[r.Header.Get(idempotencyKeyHeader)] = true
+    if attempts < 3 {
+      http.Error(w, "Games not loaded", http.StatusServiceUnavailable)
+      return
+    }
+    w.WriteHeader(http.StatusCreated)
+    w.Write([]byte(`{"Id": 3, "Name": "Carol"}`))
+  })
+  defer server.Close()
+
+  player, err := c.CreatePlayer(context.Background(), "Carol")
+  if nil != err || 3 != player.Id {
+    t.Fatalf("Expected Carol after retrying, got %v, %v", player, err)
+  }
+  if 3 != attempts || 1 != len(keys) || keys[""] {
+    t.Errorf("Expected 3 attempts with one Idempotency-Key, got %d with %v", attempts, keys)
+  }
+
+  attempts = 0
+  _, err = c.ChangeSteps(context.Background(), 3, []StepAction{{PlayerId: 1, StepDesc: "Place pawn"}})
+  if !errors.Is(err, ErrUnavailable) || 1 != attempts {
+    t.Errorf("Expected one attempt at changing steps, got %d: %v", attempts, err)
+  }
+}
+
+func TestClient_Follow(t *testing.T) {
+  c, server := testClient(func(w http.ResponseWriter, r *http.Request) {
+    if "/sessions/3/updates" == r.URL.Path {
+      w.Header().Set("Content-Type", "text/event-stream")
+      for i := 0; i < 3; i++ {
+        fmt.Fprintf(w, ": keep-alive\n\nevent: session\ndata: {\"session_id\":3}\n\n")
+        w.(http.Flusher).Flush()
+        time.Sleep(10 * time.Millisecond)
+      }
+      return
+    }
+    w.Write([]byte(testSession))
+  })
+  defer server.Close()
+
+  stop := errors.New("Seen enough")
+  seen := 0
+  err := c.Follow(context.Background(), 3, func(s *session.Session) error {
+    if 3 != s.Id {
+      t.Errorf("Expected session 3, got %d", s.Id)
+    }
+    if seen++; 4 == seen {
+      return stop
+    }
+    return nil
+  })
+  if err != stop {
+    t.Errorf("Expected Follow to end with f's error, got %v", err)
+  }
+}
@@ -0,0 +1,52 @@
+package meepleclient
+
+import (
+  "context"
+  "fmt"
+)
+
+// A rule a module adds to its game
+type ModuleRule struct {
+  Description string `json:"description"`
+  Details string `json:"details,omitempty"`
+  EachPlayer bool `json:"each_player"`
+  // Descriptions of the rules it depends on, of the game or of the module
+  After []string `json:"after"`
+}
+
+type Replacement struct {
+  Rule string `json:"rule"`  // Description of the game's rule
+  With string `json:"with"`  // Description of the module's rule
+}
+
+// An expansion or variant of a game, with its rules referred to by description, as the server has it
+type Module struct {
+  Id int `json:"id"`  // Set by the server
+  Name string `json:"name"`
+  Kind string `json:"kind"`  // expansion, the default, or variant
+  // The players the game is for with the module, where they differ from the base game's
+  MinPlayers int `json:"min_players,omitempty"`
+  MaxPlayers int `json:"max_players,omitempty"`
+  Rules []ModuleRule `json:"rules"`
+  Removes []string `json:"removes"`  // Descriptions of the game's rules that the module leaves out
+  Replaces []Replacement `json:"replaces"`
+}
+
+// The game's expansions and variants, which sessions can be started with
+func (c *Client) Modules(ctx context.Context, gameId uint) ([]*Module, error) {
+  modules := make([]*Module, 0)
+  if err := c.get(ctx, fmt.Sprintf("/games/%d/modules", gameId), &modules); nil != err {
+    return nil, err
+  }
+  return modules, nil
+}
+
+// Add an expansion or variant to the game
+func (c *Client) CreateModule(ctx context.Context, gameId uint, m *Module) (*Module, error) {
+  created := &Module{}
+  body := map[string]interface{}{"module": m}
+  if err := c.create(ctx, fmt.Sprintf("/games/%d/modules", gameId), body, created); nil != err {
+    return nil, err
+  }
+  return created, nil
+}
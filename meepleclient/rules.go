@@ -0,0 +1,72 @@
+package meepleclient
+
+import (
+  "context"
+  "fmt"
+)
+
+// The numbers of players a rule is set up for. Every part is optional, and a rule with none is always set up.
+type Condition struct {
+  MinPlayers int `json:"min_players,omitempty"`
+  MaxPlayers int `json:"max_players,omitempty"`
+  Expression string `json:"expression,omitempty"`  // Such as "players == 2 || players >= 5"
+}
+
+type RuleCondition struct {
+  RuleId int `json:"rule_id"`
+  Rule string `json:"rule"`  // Its description
+  Condition Condition `json:"condition"`
+  Description string `json:"description"`  // Of the condition, such as "at most 3 players"
+}
+
+// Values of a rule's placeholders: by name, then by number of players, or "*" for any other number
+type Quantities map[string]map[string]string
+
+type RuleQuantities struct {
+  RuleId int `json:"rule_id"`
+  Rule string `json:"rule"`  // Its description, with the placeholders
+  Details string `json:"details,omitempty"`
+  Quantities Quantities `json:"quantities"`
+}
+
+// The conditions of the game's rules and its modules' rules that have them
+func (c *Client) Conditions(ctx context.Context, gameId uint) ([]*RuleCondition, error) {
+  conditions := make([]*RuleCondition, 0)
+  if err := c.get(ctx, fmt.Sprintf("/games/%d/conditions", gameId), &conditions); nil != err {
+    return nil, err
+  }
+  return conditions, nil
+}
+
+// Set the numbers of players the rule is set up for. An empty condition sets it up for any number.
+// Retried like a GET, since setting it again leaves it as it was.
+func (c *Client) SetCondition(ctx context.Context, gameId uint, ruleId int, condition Condition) (*RuleCondition, error) {
+  set := &RuleCondition{}
+  path := fmt.Sprintf("/games/%d/rules/%d/condition", gameId, ruleId)
+  body := map[string]interface{}{"condition": condition}
+  if err := c.do(ctx, &request{method: "PUT", path: path, body: body, out: set, safe: true}); nil != err {
+    return nil, err
+  }
+  return set, nil
+}
+
+// The values of the placeholders of the game's rules and its modules' rules that have them
+func (c *Client) Quantities(ctx context.Context, gameId uint) ([]*RuleQuantities, error) {
+  quantities := make([]*RuleQuantities, 0)
+  if err := c.get(ctx, fmt.Sprintf("/games/%d/quantities", gameId), &quantities); nil != err {
+    return nil, err
+  }
+  return quantities, nil
+}
+
+// Set the values of the rule's placeholders, replacing any it had. Retried like a GET, since setting
+// them again leaves them as they were.
+func (c *Client) SetQuantities(ctx context.Context, gameId uint, ruleId int, quantities Quantities) (*RuleQuantities, error) {
+  set := &RuleQuantities{}
+  path := fmt.Sprintf("/games/%d/rules/%d/quantities", gameId, ruleId)
+  body := map[string]interface{}{"quantities": quantities}
+  if err := c.do(ctx, &request{method: "PUT", path: path, body: body, out: set, safe: true}); nil != err {
+    return nil, err
+  }
+  return set, nil
+}
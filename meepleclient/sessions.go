@@ -0,0 +1,245 @@
+package meepleclient
+
+import (
+  "bufio"
+  "context"
+  "errors"
+  "fmt"
+  "net/http"
+  "strconv"
+  "strings"
+  "time"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// Sessions are fetched through GraphQL, which has each player's current step as well as the steps
+const sessionFields = `id
+  game { id name minPlayers maxPlayers rules { id description details arity dependsOn { id } } }
+  players { id name }
+  steps { rule { id } owner { id } done }
+  assignments { player { id } step { rule { id } owner { id } } }`
+
+type graphQLId struct {
+  Id string `json:"id"`
+}
+
+type graphQLStep struct {
+  Rule graphQLId `json:"rule"`
+  Owner *graphQLId `json:"owner"`
+  Done bool `json:"done"`
+}
+
+type graphQLSession struct {
+  Id string `json:"id"`
+  Game struct {
+    Id string `json:"id"`
+    Name string `json:"name"`
+    MinPlayers int `json:"minPlayers"`
+    MaxPlayers int `json:"maxPlayers"`
+    Rules []struct {
+      Id string `json:"id"`
+      Description string `json:"description"`
+      Details string `json:"details"`
+      Arity string `json:"arity"`
+      DependsOn []graphQLId `json:"dependsOn"`
+    } `json:"rules"`
+  } `json:"game"`
+  Players []struct {
+    Id string `json:"id"`
+    Name string `json:"name"`
+  } `json:"players"`
+  Steps []graphQLStep `json:"steps"`
+  Assignments []struct {
+    Player graphQLId `json:"player"`
+    Step *graphQLStep `json:"step"`
+  } `json:"assignments"`
+}
+
+func atoi(id string) int {
+  n, _ := strconv.Atoi(id)
+  return n
+}
+
+// Build the session, with its steps pointing at its game's rules and its players
+func (gs *graphQLSession) session() *session.Session {
+  s := session.NewEmptySession()
+  id, _ := strconv.ParseUint(gs.Id, 10, 64)
+  s.Id = (uint)(id)
+
+  gameId, _ := strconv.ParseUint(gs.Game.Id, 10, 64)
+  s.Game = &game.Game{Id: (uint)(gameId), Name: gs.Game.Name, MinPlayers: gs.Game.MinPlayers, MaxPlayers: gs.Game.MaxPlayers}
+  rules := make(map[string]*game.SetupRule)
+  for _, r := range gs.Game.Rules {
+    rule := &game.SetupRule{Id: atoi(r.Id), Description: r.Description, Details: r.Details, Arity: r.Arity}
+    rules[r.Id] = rule
+    s.Game.SetupRules = append(s.Game.SetupRules, rule)
+  }
+  for _, r := range gs.Game.Rules {
+    for _, dep := range r.DependsOn {
+      rules[r.Id].Dependencies = append(rules[r.Id].Dependencies, rules[dep.Id])
+    }
+  }
+
+  players := make(map[string]*game.Player)
+  for _, p := range gs.Players {
+    player := &game.Player{Id: atoi(p.Id), Name: p.Name}
+    players[p.Id] = player
+    s.Players = append(s.Players, player)
+  }
+
+  for _, st := range gs.Steps {
+    step := &game.SetupStep{Rule: rules[st.Rule.Id], Done: st.Done}
+    if nil != st.Owner {
+      step.Owner = players[st.Owner.Id]
+    }
+    s.SetupSteps = append(s.SetupSteps, step)
+  }
+
+  for _, a := range gs.Assignments {
+    if nil == a.Step {
+      continue
+    }
+    for _, step := range s.SetupSteps {
+      owned := (nil == a.Step.Owner && nil == step.Owner) || (nil != a.Step.Owner && nil != step.Owner && step.Owner == players[a.Step.Owner.Id])
+      if step.Rule == rules[a.Step.Rule.Id] && owned {
+        s.SetupAssignments.Set(players[a.Player.Id], step)
+        break
+      }
+    }
+  }
+  return s
+}
+
+func (c *Client) Sessions(ctx context.Context) ([]*session.Session, error) {
+  result := struct {
+    Sessions []*graphQLSession `json:"sessions"`
+  }{}
+  if err := c.query(ctx, "{ sessions { " + sessionFields + " } }", nil, &result); nil != err {
+    return nil, err
+  }
+  sessions := make([]*session.Session, len(result.Sessions))
+  for i, gs := range result.Sessions {
+    sessions[i] = gs.session()
+  }
+  return sessions, nil
+}
+
+func (c *Client) Session(ctx context.Context, id uint) (*session.Session, error) {
+  result := struct {
+    Session *graphQLSession `json:"session"`
+  }{}
+  variables := map[string]interface{}{"id": strconv.FormatUint((uint64)(id), 10)}
+  if err := c.query(ctx, "query($id: ID!) { session(id: $id) { " + sessionFields + " } }", variables, &result); nil != err {
+    return nil, err
+  }
+  if nil == result.Session {
+    return nil, &StatusError{Status: http.StatusNotFound, Message: "Session not found"}
+  }
+  return result.Session.session(), nil
+}
+
+// Call f with the session, and again each time it changes, until the context is done or f returns an
+// error, which Follow returns. Reconnects if the stream of updates drops, giving up after as many
+// failed attempts in a row as the client retries. Updates that come faster than f returns are
+// skipped, so f always sees the latest state.
+func (c *Client) Follow(ctx context.Context, id uint, f func(*session.Session) error) error {
+  failures := 0
+  for {
+    connected, err := c.follow(ctx, id, f)
+    if nil != ctx.Err() {
+      return ctx.Err()
+    }
+    var stop *followError
+    if errors.As(err, &stop) {
+      return stop.err
+    }
+    if nil != err && !retryable(err) {
+      return err
+    }
+    if connected {
+      failures = 0
+    } else if failures++; failures > c.retries {
+      if nil == err {
+        err = errors.New("Stream of updates ended")
+      }
+      return err
+    }
+
+    select {
+    case <-ctx.Done():
+      return ctx.Err()
+    case <-time.After(c.backoff(failures, err)):
+    }
+  }
+}
+
+// An error from the function following a session, which ends Follow
+type followError struct {
+  err error
+}
+
+func (err *followError) Error() string {
+  return err.err.Error()
+}
+
+// Follow the session until the stream ends. Returns whether it connected.
+func (c *Client) follow(ctx context.Context, id uint, f func(*session.Session) error) (bool, error) {
+  r, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/sessions/%d/updates", c.server, id), nil)
+  if nil != err {
+    return false, err
+  }
+  r.Header.Set("Accept", "text/event-stream")
+  // The stream is meant to outlast any timeout for a single call
+  streamer := *c.http
+  streamer.Timeout = 0
+  rs, err := streamer.Do(r)
+  if nil != err {
+    return false, err
+  }
+  defer rs.Body.Close()
+  if rs.StatusCode >= 400 {
+    body := make([]byte, 512)
+    n, _ := rs.Body.Read(body)
+    return false, decodeError(rs, body[:n])
+  }
+
+  // Each event says only that the session changed, so fetch it, once per burst of events
+  changed := make(chan struct{}, 1)
+  streamErr := make(chan error, 1)
+  go func() {
+    lines := bufio.NewScanner(rs.Body)
+    event := ""
+    for lines.Scan() {
+      line := lines.Text()
+      switch {
+      case strings.HasPrefix(line, "event:"):
+        event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+      case "" == line && "session" == event:
+        event = ""
+        select {
+        case changed <- struct{}{}:
+        default:
+        }
+      }
+    }
+    streamErr <- lines.Err()
+  }()
+
+  connected := false
+  for {
+    select {
+    case <-changed:
+      s, err := c.Session(ctx, id)
+      if nil != err {
+        return connected, err
+      }
+      connected = true
+      if err := f(s); nil != err {
+        return connected, &followError{err}
+      }
+    case err := <-streamErr:
+      return connected, err
+    }
+  }
+}
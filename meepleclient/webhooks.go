@@ -0,0 +1,78 @@
+package meepleclient
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+  "time"
+)
+
+// Events webhooks can subscribe to
+const (
+  EventSessionCreated = "session.created"
+  EventStepFinished = "step.finished"
+  EventPlayerDone = "player.done"
+  EventSetupCompleted = "setup.completed"
+)
+
+type Webhook struct {
+  Id int `json:"id"`  // Set by the server
+  URL string `json:"url"`
+  Events []string `json:"events"`
+  // Signs deliveries. Generated by the server if not given, and only returned when the webhook is created.
+  Secret string `json:"secret,omitempty"`
+  CreatedAt time.Time `json:"created_at"`
+}
+
+// An event sent to a webhook, or still to be
+type WebhookDelivery struct {
+  Id int `json:"id"`
+  Event string `json:"event"`
+  Payload json.RawMessage `json:"payload"`
+  Status string `json:"status"`  // pending, delivered or failed
+  Attempts int `json:"attempts"`
+  NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`  // While pending
+  LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+  LastStatusCode int `json:"last_status_code,omitempty"`
+  LastError string `json:"last_error,omitempty"`
+  CreatedAt time.Time `json:"created_at"`
+}
+
+func (c *Client) Webhooks(ctx context.Context) ([]*Webhook, error) {
+  hooks := make([]*Webhook, 0)
+  if err := c.get(ctx, "/webhooks", &hooks); nil != err {
+    return nil, err
+  }
+  return hooks, nil
+}
+
+func (c *Client) Webhook(ctx context.Context, id int) (*Webhook, error) {
+  hook := &Webhook{}
+  if err := c.get(ctx, fmt.Sprintf("/webhooks/%d", id), hook); nil != err {
+    return nil, err
+  }
+  return hook, nil
+}
+
+// Subscribe the webhook's URL to its events. The webhook returned has its secret.
+func (c *Client) CreateWebhook(ctx context.Context, hook *Webhook) (*Webhook, error) {
+  created := &Webhook{}
+  body := map[string]interface{}{"webhook": map[string]interface{}{"url": hook.URL, "events": hook.Events, "secret": hook.Secret}}
+  if err := c.create(ctx, "/webhooks", body, created); nil != err {
+    return nil, err
+  }
+  return created, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, id int) error {
+  return c.do(ctx, &request{method: "DELETE", path: fmt.Sprintf("/webhooks/%d", id), safe: true})
+}
+
+// The latest deliveries to the webhook, newest first
+func (c *Client) WebhookDeliveries(ctx context.Context, id int) ([]*WebhookDelivery, error) {
+  deliveries := make([]*WebhookDelivery, 0)
+  if err := c.get(ctx, fmt.Sprintf("/webhooks/%d/deliveries", id), &deliveries); nil != err {
+    return nil, err
+  }
+  return deliveries, nil
+}
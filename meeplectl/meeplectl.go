@@ -0,0 +1,396 @@
+/*
+
+Command-line client for a running meeple_mover.
+
+Lists games and players, starts sessions, and finishes or reopens steps over the HTTP API, through
+meepleclient, so that requests are retried while the server is unavailable.
+Games, players and steps may be named rather than numbered. Prints tables, or JSON with -json.
+
+  meeplectl games
+  meeplectl session-create "Forbidden Island" Alice Bob
+  meeplectl session-create -module "The Sunken Treasures" "Forbidden Island" Alice Bob
+  meeplectl step 3 Alice
+  meeplectl finish 3 Alice Create Forbidden Island
+
+*/
+
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "flag"
+  "fmt"
+  "io"
+  "os"
+  "strconv"
+  "strings"
+  "text/tabwriter"
+  "github.com/rkbodenner/meeple_mover/meepleclient"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// Find a game by ID or name
+func findGame(games []*game.Game, idOrName string) (*game.Game, error) {
+  for _, g := range games {
+    if strconv.FormatUint((uint64)(g.Id), 10) == idOrName || strings.EqualFold(g.Name, idOrName) {
+      return g, nil
+    }
+  }
+  return nil, errors.New(fmt.Sprintf("No game %q", idOrName))
+}
+
+// Find a player by ID, or by a name that only one player has
+func findPlayer(players []*game.Player, idOrName string) (*game.Player, error) {
+  var found *game.Player
+  for _, p := range players {
+    if strconv.Itoa(p.Id) == idOrName {
+      return p, nil
+    }
+    if strings.EqualFold(p.Name, idOrName) {
+      if nil != found {
+        return nil, errors.New(fmt.Sprintf("More than one player is named %q. Use an ID.", idOrName))
+      }
+      found = p
+    }
+  }
+  if nil == found {
+    return nil, errors.New(fmt.Sprintf("No player %q", idOrName))
+  }
+  return found, nil
+}
+
+func findSession(ctx context.Context, c *meepleclient.Client, id string) (*session.Session, error) {
+  sessionId, err := strconv.ParseUint(id, 10, 64)
+  if nil != err {
+    return nil, errors.New(fmt.Sprintf("Expected a session ID, got %q", id))
+  }
+  return c.Session(ctx, (uint)(sessionId))
+}
+
+// A flag that may be given more than once
+type stringList []string
+
+func (list *stringList) String() string {
+  return strings.Join(*list, ", ")
+}
+
+func (list *stringList) Set(value string) error {
+  *list = append(*list, value)
+  return nil
+}
+
+// Find a game by ID or name, among those on the server
+func fetchGame(ctx context.Context, c *meepleclient.Client, idOrName string) (*game.Game, error) {
+  games, err := c.Games(ctx)
+  if nil != err {
+    return nil, err
+  }
+  return findGame(games, idOrName)
+}
+
+// Start a session of the named game with the named players
+func createSession(ctx context.Context, c *meepleclient.Client, gameName string, playerNames []string, options meepleclient.SessionOptions) (*session.Session, error) {
+  g, err := fetchGame(ctx, c, gameName)
+  if nil != err {
+    return nil, err
+  }
+  all, err := c.Players(ctx)
+  if nil != err {
+    return nil, err
+  }
+  playerIds := make([]int, len(playerNames))
+  for i, name := range playerNames {
+    p, err := findPlayer(all, name)
+    if nil != err {
+      return nil, err
+    }
+    playerIds[i] = p.Id
+  }
+  return c.CreateSession(ctx, g.Id, playerIds, options)
+}
+
+// The named player's current step in a session
+func assignment(s *session.Session, idOrName string) (*meepleclient.Assignment, error) {
+  p, err := findPlayer(s.Players, idOrName)
+  if nil != err {
+    return nil, err
+  }
+  return playerAssignment(s, p), nil
+}
+
+func playerAssignment(s *session.Session, p *game.Player) *meepleclient.Assignment {
+  step, _ := s.SetupAssignments.Get(p)
+  return &meepleclient.Assignment{Player: p, Step: step, Done: nil == step || step.Done}
+}
+
+// Finish or reopen one of a player's steps, returning their current step afterwards
+func changeStep(ctx context.Context, c *meepleclient.Client, sessionId string, playerName string, stepDesc string, action string) (*meepleclient.Assignment, error) {
+  s, err := findSession(ctx, c, sessionId)
+  if nil != err {
+    return nil, err
+  }
+  p, err := findPlayer(s.Players, playerName)
+  if nil != err {
+    return nil, err
+  }
+  assignments, err := c.ChangeSteps(ctx, s.Id, []meepleclient.StepAction{{PlayerId: p.Id, StepDesc: stepDesc, Action: action}})
+  if nil != err {
+    return nil, err
+  }
+  for _, a := range assignments {
+    if nil != a.Player && a.Player.Id == p.Id {
+      a.Player = p
+      return a, nil
+    }
+  }
+  return nil, errors.New(fmt.Sprintf("No step for %s in session %d", p.Name, s.Id))
+}
+
+// Each player's current step
+func sessionAssignments(s *session.Session) []*meepleclient.Assignment {
+  assignments := make([]*meepleclient.Assignment, len(s.Players))
+  for i, p := range s.Players {
+    assignments[i] = playerAssignment(s, p)
+  }
+  return assignments
+}
+
+// What -json prints of a session
+type sessionView struct {
+  Id uint `json:"id"`
+  Game *game.Game `json:"game"`
+  Players []*game.Player `json:"players"`
+  Assignments []*meepleclient.Assignment `json:"assignments"`
+}
+
+func stepDescription(a *meepleclient.Assignment) string {
+  if nil == a.Step {
+    return "-"
+  }
+  return a.Step.Rule.Description
+}
+
+func stepStatus(a *meepleclient.Assignment) string {
+  switch {
+  case nil == a.Step:
+    return "done with setup"
+  case a.Step.Done:
+    return "done"
+  }
+  return "to do"
+}
+
+func writeAssignments(out io.Writer, assignments []*meepleclient.Assignment) error {
+  w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+  fmt.Fprintln(w, "PLAYER\tSTEP\tSTATUS")
+  for _, a := range assignments {
+    fmt.Fprintf(w, "%s\t%s\t%s\n", a.Player.Name, stepDescription(a), stepStatus(a))
+  }
+  return w.Flush()
+}
+
+func writeTable(out io.Writer, v interface{}) error {
+  w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+  switch v := v.(type) {
+  case []*game.Game:
+    fmt.Fprintln(w, "ID\tNAME\tPLAYERS")
+    for _, g := range v {
+      fmt.Fprintf(w, "%d\t%s\t%d-%d\n", g.Id, g.Name, g.MinPlayers, g.MaxPlayers)
+    }
+  case *game.Game:
+    fmt.Fprintf(w, "%s (%d-%d players)\n\n", v.Name, v.MinPlayers, v.MaxPlayers)
+    fmt.Fprintln(w, "RULE\tWHO\tAFTER")
+    for _, r := range v.SetupRules {
+      after := make([]string, len(r.Dependencies))
+      for i, dep := range r.Dependencies {
+        after[i] = dep.Description
+      }
+      fmt.Fprintf(w, "%s\t%s\t%s\n", r.Description, r.Arity, strings.Join(after, ", "))
+    }
+  case []*meepleclient.Module:
+    fmt.Fprintln(w, "NAME\tKIND\tPLAYERS")
+    for _, m := range v {
+      players := "-"
+      if 0 != m.MinPlayers || 0 != m.MaxPlayers {
+        players = fmt.Sprintf("%d-%d", m.MinPlayers, m.MaxPlayers)
+      }
+      fmt.Fprintf(w, "%s\t%s\t%s\n", m.Name, m.Kind, players)
+    }
+  case []*game.Player:
+    fmt.Fprintln(w, "ID\tNAME")
+    for _, p := range v {
+      fmt.Fprintf(w, "%d\t%s\n", p.Id, p.Name)
+    }
+  case *game.Player:
+    fmt.Fprintln(w, "ID\tNAME")
+    fmt.Fprintf(w, "%d\t%s\n", v.Id, v.Name)
+  case *session.Session:
+    fmt.Fprintf(w, "Session %d: %s\n\n", v.Id, v.Game.Name)
+    w.Flush()
+    return writeAssignments(out, sessionAssignments(v))
+  case *meepleclient.Assignment:
+    w.Flush()
+    return writeAssignments(out, []*meepleclient.Assignment{v})
+  case string:
+    fmt.Fprintln(w, v)
+  }
+  return w.Flush()
+}
+
+func write(out io.Writer, asJSON bool, v interface{}) error {
+  if !asJSON {
+    return writeTable(out, v)
+  }
+  switch value := v.(type) {
+  case string:
+    v = map[string]string{"message": value}
+  case *session.Session:
+    v = &sessionView{value.Id, value.Game, value.Players, sessionAssignments(value)}
+  }
+  enc := json.NewEncoder(out)
+  enc.SetIndent("", "  ")
+  return enc.Encode(v)
+}
+
+var usage = `Usage: meeplectl [-server URL] [-json] <command> [arguments]
+
+Commands:
+  games                                    List games
+  game <game>                              Show a game's setup rules
+  modules <game>                           List a game's expansions and variants
+  players                                  List players
+  player-create <name>                     Create a player
+  player-delete <player>                   Delete a player
+  session-create [-module <module>]... [-strategy <strategy>] <game> <player>...
+                                           Start a session, with any of the game's modules,
+                                           choosing players' next steps by the strategy
+  session <session>                        Show every player's current step
+  step <session> <player>                  Show a player's current step
+  finish <session> <player> <step>         Finish a step
+  reopen <session> <player> <step>         Reopen a finished step
+
+Games and players may be given by ID or name.
+`
+
+var errUsage = errors.New("Wrong number of arguments")
+
+// Run a command, returning the value to print
+func run(ctx context.Context, c *meepleclient.Client, args []string) (interface{}, error) {
+  if len(args) < 1 {
+    return nil, errUsage
+  }
+  command, args := args[0], args[1:]
+  need := func(n int) bool { return len(args) >= n }
+
+  switch command {
+  case "games":
+    return c.Games(ctx)
+  case "game":
+    if !need(1) {
+      return nil, errUsage
+    }
+    return fetchGame(ctx, c, strings.Join(args, " "))
+  case "modules":
+    if !need(1) {
+      return nil, errUsage
+    }
+    g, err := fetchGame(ctx, c, strings.Join(args, " "))
+    if nil != err {
+      return nil, err
+    }
+    return c.Modules(ctx, g.Id)
+  case "players":
+    return c.Players(ctx)
+  case "player-create":
+    if !need(1) {
+      return nil, errUsage
+    }
+    return c.CreatePlayer(ctx, strings.Join(args, " "))
+  case "player-delete":
+    if !need(1) {
+      return nil, errUsage
+    }
+    players, err := c.Players(ctx)
+    if nil != err {
+      return nil, err
+    }
+    p, err := findPlayer(players, strings.Join(args, " "))
+    if nil != err {
+      return nil, err
+    }
+    if err := c.DeletePlayer(ctx, p.Id); nil != err {
+      return nil, err
+    }
+    return fmt.Sprintf("Deleted player %d (%s)", p.Id, p.Name), nil
+  case "session-create":
+    var modules stringList
+    var strategy string
+    flags := flag.NewFlagSet(command, flag.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    flags.Var(&modules, "module", "")
+    flags.StringVar(&strategy, "strategy", "", "")
+    if err := flags.Parse(args); nil != err {
+      return nil, errUsage
+    }
+    args = flags.Args()
+    if !need(2) {
+      return nil, errUsage
+    }
+    return createSession(ctx, c, args[0], args[1:], meepleclient.SessionOptions{Modules: modules, Strategy: strategy})
+  case "session":
+    if !need(1) {
+      return nil, errUsage
+    }
+    return findSession(ctx, c, args[0])
+  case "step":
+    if !need(2) {
+      return nil, errUsage
+    }
+    s, err := findSession(ctx, c, args[0])
+    if nil != err {
+      return nil, err
+    }
+    return assignment(s, args[1])
+  case "finish", "reopen":
+    if !need(3) {
+      return nil, errUsage
+    }
+    return changeStep(ctx, c, args[0], args[1], strings.Join(args[2:], " "), command)
+  }
+  return nil, errors.New(fmt.Sprintf("Unknown command %q", command))
+}
+
+func main() {
+  defaultServer := os.Getenv("MEEPLE_MOVER_URL")
+  if "" == defaultServer {
+    defaultServer = "http://localhost:8080"
+  }
+  var server string
+  flag.StringVar(&server, "server", defaultServer, "URL of the meeple_mover server. Defaults to $MEEPLE_MOVER_URL.")
+  var asJSON bool
+  flag.BoolVar(&asJSON, "json", false, "Print JSON instead of tables")
+  flag.Usage = func() {
+    fmt.Fprint(os.Stderr, usage)
+    fmt.Fprintln(os.Stderr, "\nOptions:")
+    flag.PrintDefaults()
+  }
+  flag.Parse()
+
+  c := meepleclient.New(server, meepleclient.Config{})
+  result, err := run(context.Background(), c, flag.Args())
+  if errUsage == err {
+    flag.Usage()
+    os.Exit(2)
+  }
+  if nil != err {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+  if err := write(os.Stdout, asJSON, result); nil != err {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+}
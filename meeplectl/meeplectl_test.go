@@ -0,0 +1,208 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+  "time"
+  "github.com/rkbodenner/meeple_mover/meepleclient"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+const testSession = `{"data": {"session": {"id": "3",
+  "game": {"id": "1", "name": "Forbidden Island", "minPlayers": 2, "maxPlayers": 4, "rules": [
+    {"id": "1", "description": "Lay out the board", "arity": "Once", "dependsOn": []},
+    {"id": "2", "description": "Place pawn", "arity": "Each player", "dependsOn": [{"id": "1"}]}]},
+  "players": [{"id": "1", "name": "Alice"}, {"id": "2", "name": "Bob"}],
+  "steps": [
+    {"rule": {"id": "1"}, "owner": null, "done": true},
+    {"rule": {"id": "2"}, "owner": {"id": "1"}, "done": false},
+    {"rule": {"id": "2"}, "owner": {"id": "2"}, "done": true}],
+  "assignments": [
+    {"player": {"id": "1"}, "step": {"rule": {"id": "2"}, "owner": {"id": "1"}}},
+    {"player": {"id": "2"}, "step": null}
+  ]}}}`
+
+func newTestClient(server *httptest.Server) *meepleclient.Client {
+  return meepleclient.New(server.URL, meepleclient.Config{HTTPClient: server.Client(), RetryWait: time.Millisecond})
+}
+
+func TestFindPlayer(t *testing.T) {
+  players := []*game.Player{{Id: 1, Name: "Alice"}, {Id: 2, Name: "Bob"}, {Id: 3, Name: "bob"}}
+  p, err := findPlayer(players, "alice")
+  if nil != err || 1 != p.Id {
+    t.Errorf("Expected to find Alice by name, got %v, %v", p, err)
+  }
+  p, err = findPlayer(players, "3")
+  if nil != err || "bob" != p.Name {
+    t.Errorf("Expected to find a player by ID, got %v, %v", p, err)
+  }
+  if _, err = findPlayer(players, "Bob"); nil == err {
+    t.Error("Expected an error for a name shared by two players")
+  }
+  if _, err = findPlayer(players, "Carol"); nil == err {
+    t.Error("Expected an error for an unknown player")
+  }
+}
+
+func TestRun_Session(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(testSession))
+  }))
+  defer server.Close()
+
+  result, err := run(context.Background(), newTestClient(server), []string{"session", "3"})
+  if nil != err {
+    t.Fatal(err)
+  }
+  var b strings.Builder
+  if err := write(&b, false, result); nil != err {
+    t.Fatal(err)
+  }
+  expected := "Session 3: Forbidden Island\n\nPLAYER  STEP        STATUS\nAlice   Place pawn  to do\nBob     -           done with setup\n"
+  if b.String() != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, b.String())
+  }
+}
+
+func TestRun_Step(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(testSession))
+  }))
+  defer server.Close()
+
+  result, err := run(context.Background(), newTestClient(server), []string{"step", "3", "Bob"})
+  if nil != err {
+    t.Fatal(err)
+  }
+  var b strings.Builder
+  if err := write(&b, false, result); nil != err {
+    t.Fatal(err)
+  }
+  expected := "PLAYER  STEP  STATUS\nBob     -     done with setup\n"
+  if b.String() != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, b.String())
+  }
+}
+
+func TestRun_Finish(t *testing.T) {
+  var batch map[string][]map[string]string
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if "/sessions/3/steps:batch" == r.URL.Path {
+      json.NewDecoder(r.Body).Decode(&batch)
+      w.Write([]byte(`{"assignments": [{"player": {"Id": 1, "Name": "Alice"}, "step": null, "done": true}]}`))
+      return
+    }
+    w.Write([]byte(testSession))
+  }))
+  defer server.Close()
+
+  result, err := run(context.Background(), newTestClient(server), []string{"reopen", "3", "alice", "Lay", "out", "the", "board"})
+  if nil != err {
+    t.Fatal(err)
+  }
+  steps := batch["steps"]
+  if len(steps) != 1 || "1" != steps[0]["player_id"] || "Lay out the board" != steps[0]["step_desc"] || "reopen" != steps[0]["action"] {
+    t.Errorf("Unexpected batch %v", batch)
+  }
+  if a, ok := result.(*meepleclient.Assignment); !ok || "Alice" != a.Player.Name || !a.Done {
+    t.Errorf("Expected Alice's assignment afterwards, got %v", result)
+  }
+}
+
+// Creating is retried while the server is unavailable, with the same Idempotency-Key
+func TestRun_PlayerCreate(t *testing.T) {
+  keys := make([]string, 0)
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    keys = append(keys, r.Header.Get("Idempotency-Key"))
+    if 1 == len(keys) {
+      http.Error(w, "Starting", http.StatusServiceUnavailable)
+      return
+    }
+    w.WriteHeader(http.StatusCreated)
+    w.Write([]byte(`{"Id": 5, "Name": "Carol"}`))
+  }))
+  defer server.Close()
+
+  result, err := run(context.Background(), newTestClient(server), []string{"player-create", "Carol"})
+  if nil != err {
+    t.Fatal(err)
+  }
+  if 2 != len(keys) || "" == keys[0] || keys[0] != keys[1] {
+    t.Errorf("Expected a retry with the same Idempotency-Key, got %v", keys)
+  }
+  var b strings.Builder
+  if err := write(&b, false, result); nil != err {
+    t.Fatal(err)
+  }
+  if expected := "ID  NAME\n5   Carol\n"; b.String() != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, b.String())
+  }
+}
+
+func TestRun_SessionCreate(t *testing.T) {
+  var created map[string]map[string]interface{}
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    switch r.URL.Path {
+    case "/games":
+      w.Write([]byte(`[{"Id": 1, "Name": "Forbidden Island", "MinPlayers": 2, "MaxPlayers": 4}]`))
+    case "/players":
+      w.Write([]byte(`[{"Id": 1, "Name": "Alice"}, {"Id": 2, "Name": "Bob"}]`))
+    case "/sessions":
+      json.NewDecoder(r.Body).Decode(&created)
+      w.WriteHeader(http.StatusCreated)
+      w.Write([]byte(`{"Id": 3}`))
+    default:
+      w.Write([]byte(testSession))
+    }
+  }))
+  defer server.Close()
+
+  args := []string{"session-create", "-module", "The Sunken Treasures", "-module", "Heroic", "-strategy", "balanced", "forbidden island", "Alice", "2"}
+  result, err := run(context.Background(), newTestClient(server), args)
+  if nil != err {
+    t.Fatal(err)
+  }
+  hash := created["session"]
+  modules, _ := hash["modules"].([]interface{})
+  if "1" != hash["game"] || 2 != len(modules) || "The Sunken Treasures" != modules[0] || "Heroic" != modules[1] || "balanced" != hash["strategy"] {
+    t.Errorf("Unexpected session %v", created)
+  }
+  if _, ok := result.(*session.Session); !ok {
+    t.Errorf("Expected the session, got %v", result)
+  }
+
+  if _, err := run(context.Background(), newTestClient(server), []string{"session-create", "-module", "Heroic", "Forbidden Island"}); errUsage != err {
+    t.Errorf("Expected usage for a session without players, got %v", err)
+  }
+}
+
+func TestRun_Modules(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    switch r.URL.Path {
+    case "/games":
+      w.Write([]byte(`[{"Id": 1, "Name": "Forbidden Island", "MinPlayers": 2, "MaxPlayers": 4}]`))
+    case "/games/1/modules":
+      w.Write([]byte(`[{"id": 1, "name": "The Sunken Treasures", "kind": "expansion", "rules": []},
+        {"id": 2, "name": "Solo", "kind": "variant", "min_players": 1, "max_players": 1, "rules": []}]`))
+    }
+  }))
+  defer server.Close()
+
+  result, err := run(context.Background(), newTestClient(server), []string{"modules", "Forbidden", "Island"})
+  if nil != err {
+    t.Fatal(err)
+  }
+  var b strings.Builder
+  if err := write(&b, false, result); nil != err {
+    t.Fatal(err)
+  }
+  expected := "NAME                  KIND       PLAYERS\nThe Sunken Treasures  expansion  -\nSolo                  variant    1-1\n"
+  if b.String() != expected {
+    t.Errorf("Expected:\n%s\nGot:\n%s", expected, b.String())
+  }
+}
@@ -0,0 +1,1380 @@
+// The meeple_mover gRPC API. It mirrors the REST routes for games, players and sessions,
+// and adds a stream of changes to a session.
+//
+// Regenerate the Go code after editing, from the repository root:
+//
+//     protoc --go_out=. --go_opt=paths=source_relative \
+//       --go-grpc_out=. --go-grpc_opt=paths=source_relative meeplepb/meeple.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.29.3
+// source: meeplepb/meeple.proto
+
+package meeplepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Player struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Player) Reset() {
+	*x = Player{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Player) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Player) ProtoMessage() {}
+
+func (x *Player) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Player.ProtoReflect.Descriptor instead.
+func (*Player) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Player) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Player) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type Rule struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Id          int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Description string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	Details     string                 `protobuf:"bytes,3,opt,name=details,proto3" json:"details,omitempty"`
+	// "Each player" or "Once"
+	Arity string `protobuf:"bytes,4,opt,name=arity,proto3" json:"arity,omitempty"`
+	// IDs of the rules that must be done first
+	DependencyIds []int64 `protobuf:"varint,5,rep,packed,name=dependency_ids,json=dependencyIds,proto3" json:"dependency_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Rule) Reset() {
+	*x = Rule{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Rule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Rule) ProtoMessage() {}
+
+func (x *Rule) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Rule.ProtoReflect.Descriptor instead.
+func (*Rule) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Rule) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Rule) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Rule) GetDetails() string {
+	if x != nil {
+		return x.Details
+	}
+	return ""
+}
+
+func (x *Rule) GetArity() string {
+	if x != nil {
+		return x.Arity
+	}
+	return ""
+}
+
+func (x *Rule) GetDependencyIds() []int64 {
+	if x != nil {
+		return x.DependencyIds
+	}
+	return nil
+}
+
+type Game struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	MinPlayers    int32                  `protobuf:"varint,3,opt,name=min_players,json=minPlayers,proto3" json:"min_players,omitempty"`
+	MaxPlayers    int32                  `protobuf:"varint,4,opt,name=max_players,json=maxPlayers,proto3" json:"max_players,omitempty"`
+	Rules         []*Rule                `protobuf:"bytes,5,rep,name=rules,proto3" json:"rules,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Game) Reset() {
+	*x = Game{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Game) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Game) ProtoMessage() {}
+
+func (x *Game) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Game.ProtoReflect.Descriptor instead.
+func (*Game) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Game) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Game) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Game) GetMinPlayers() int32 {
+	if x != nil {
+		return x.MinPlayers
+	}
+	return 0
+}
+
+func (x *Game) GetMaxPlayers() int32 {
+	if x != nil {
+		return x.MaxPlayers
+	}
+	return 0
+}
+
+func (x *Game) GetRules() []*Rule {
+	if x != nil {
+		return x.Rules
+	}
+	return nil
+}
+
+type Step struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Rule  *Rule                  `protobuf:"bytes,1,opt,name=rule,proto3" json:"rule,omitempty"`
+	// Unset for steps that any player may do
+	Owner         *Player `protobuf:"bytes,2,opt,name=owner,proto3" json:"owner,omitempty"`
+	Done          bool    `protobuf:"varint,3,opt,name=done,proto3" json:"done,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Step) Reset() {
+	*x = Step{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Step) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Step) ProtoMessage() {}
+
+func (x *Step) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Step.ProtoReflect.Descriptor instead.
+func (*Step) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Step) GetRule() *Rule {
+	if x != nil {
+		return x.Rule
+	}
+	return nil
+}
+
+func (x *Step) GetOwner() *Player {
+	if x != nil {
+		return x.Owner
+	}
+	return nil
+}
+
+func (x *Step) GetDone() bool {
+	if x != nil {
+		return x.Done
+	}
+	return false
+}
+
+// A player's current step. Done if they have nothing left to do.
+type Assignment struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Player        *Player                `protobuf:"bytes,1,opt,name=player,proto3" json:"player,omitempty"`
+	Step          *Step                  `protobuf:"bytes,2,opt,name=step,proto3" json:"step,omitempty"`
+	Done          bool                   `protobuf:"varint,3,opt,name=done,proto3" json:"done,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Assignment) Reset() {
+	*x = Assignment{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Assignment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Assignment) ProtoMessage() {}
+
+func (x *Assignment) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Assignment.ProtoReflect.Descriptor instead.
+func (*Assignment) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Assignment) GetPlayer() *Player {
+	if x != nil {
+		return x.Player
+	}
+	return nil
+}
+
+func (x *Assignment) GetStep() *Step {
+	if x != nil {
+		return x.Step
+	}
+	return nil
+}
+
+func (x *Assignment) GetDone() bool {
+	if x != nil {
+		return x.Done
+	}
+	return false
+}
+
+type Session struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Id          uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Game        *Game                  `protobuf:"bytes,2,opt,name=game,proto3" json:"game,omitempty"`
+	Players     []*Player              `protobuf:"bytes,3,rep,name=players,proto3" json:"players,omitempty"`
+	Steps       []*Step                `protobuf:"bytes,4,rep,name=steps,proto3" json:"steps,omitempty"`
+	Assignments []*Assignment          `protobuf:"bytes,5,rep,name=assignments,proto3" json:"assignments,omitempty"`
+	// How each player's next step is picked
+	Strategy string `protobuf:"bytes,6,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	// Names of the expansions and variants the game is set up with, in the order they were applied
+	Modules       []string `protobuf:"bytes,7,rep,name=modules,proto3" json:"modules,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Session) Reset() {
+	*x = Session{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Session) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Session) ProtoMessage() {}
+
+func (x *Session) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Session.ProtoReflect.Descriptor instead.
+func (*Session) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Session) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Session) GetGame() *Game {
+	if x != nil {
+		return x.Game
+	}
+	return nil
+}
+
+func (x *Session) GetPlayers() []*Player {
+	if x != nil {
+		return x.Players
+	}
+	return nil
+}
+
+func (x *Session) GetSteps() []*Step {
+	if x != nil {
+		return x.Steps
+	}
+	return nil
+}
+
+func (x *Session) GetAssignments() []*Assignment {
+	if x != nil {
+		return x.Assignments
+	}
+	return nil
+}
+
+func (x *Session) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *Session) GetModules() []string {
+	if x != nil {
+		return x.Modules
+	}
+	return nil
+}
+
+type ListGamesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListGamesRequest) Reset() {
+	*x = ListGamesRequest{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListGamesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListGamesRequest) ProtoMessage() {}
+
+func (x *ListGamesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListGamesRequest.ProtoReflect.Descriptor instead.
+func (*ListGamesRequest) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{6}
+}
+
+type ListGamesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Games         []*Game                `protobuf:"bytes,1,rep,name=games,proto3" json:"games,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListGamesResponse) Reset() {
+	*x = ListGamesResponse{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListGamesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListGamesResponse) ProtoMessage() {}
+
+func (x *ListGamesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListGamesResponse.ProtoReflect.Descriptor instead.
+func (*ListGamesResponse) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListGamesResponse) GetGames() []*Game {
+	if x != nil {
+		return x.Games
+	}
+	return nil
+}
+
+type GetGameRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetGameRequest) Reset() {
+	*x = GetGameRequest{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetGameRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetGameRequest) ProtoMessage() {}
+
+func (x *GetGameRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetGameRequest.ProtoReflect.Descriptor instead.
+func (*GetGameRequest) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetGameRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type ListPlayersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPlayersRequest) Reset() {
+	*x = ListPlayersRequest{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPlayersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPlayersRequest) ProtoMessage() {}
+
+func (x *ListPlayersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPlayersRequest.ProtoReflect.Descriptor instead.
+func (*ListPlayersRequest) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{9}
+}
+
+type ListPlayersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Players       []*Player              `protobuf:"bytes,1,rep,name=players,proto3" json:"players,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPlayersResponse) Reset() {
+	*x = ListPlayersResponse{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPlayersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPlayersResponse) ProtoMessage() {}
+
+func (x *ListPlayersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPlayersResponse.ProtoReflect.Descriptor instead.
+func (*ListPlayersResponse) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListPlayersResponse) GetPlayers() []*Player {
+	if x != nil {
+		return x.Players
+	}
+	return nil
+}
+
+type GetPlayerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPlayerRequest) Reset() {
+	*x = GetPlayerRequest{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPlayerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPlayerRequest) ProtoMessage() {}
+
+func (x *GetPlayerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPlayerRequest.ProtoReflect.Descriptor instead.
+func (*GetPlayerRequest) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetPlayerRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type CreatePlayerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreatePlayerRequest) Reset() {
+	*x = CreatePlayerRequest{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreatePlayerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreatePlayerRequest) ProtoMessage() {}
+
+func (x *CreatePlayerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreatePlayerRequest.ProtoReflect.Descriptor instead.
+func (*CreatePlayerRequest) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *CreatePlayerRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type DeletePlayerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeletePlayerRequest) Reset() {
+	*x = DeletePlayerRequest{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeletePlayerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeletePlayerRequest) ProtoMessage() {}
+
+func (x *DeletePlayerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeletePlayerRequest.ProtoReflect.Descriptor instead.
+func (*DeletePlayerRequest) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *DeletePlayerRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type DeletePlayerResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeletePlayerResponse) Reset() {
+	*x = DeletePlayerResponse{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeletePlayerResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeletePlayerResponse) ProtoMessage() {}
+
+func (x *DeletePlayerResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeletePlayerResponse.ProtoReflect.Descriptor instead.
+func (*DeletePlayerResponse) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{14}
+}
+
+type ListSessionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSessionsRequest) Reset() {
+	*x = ListSessionsRequest{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSessionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSessionsRequest) ProtoMessage() {}
+
+func (x *ListSessionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSessionsRequest.ProtoReflect.Descriptor instead.
+func (*ListSessionsRequest) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{15}
+}
+
+type ListSessionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sessions      []*Session             `protobuf:"bytes,1,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSessionsResponse) Reset() {
+	*x = ListSessionsResponse{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSessionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSessionsResponse) ProtoMessage() {}
+
+func (x *ListSessionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSessionsResponse.ProtoReflect.Descriptor instead.
+func (*ListSessionsResponse) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ListSessionsResponse) GetSessions() []*Session {
+	if x != nil {
+		return x.Sessions
+	}
+	return nil
+}
+
+type GetSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSessionRequest) Reset() {
+	*x = GetSessionRequest{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSessionRequest) ProtoMessage() {}
+
+func (x *GetSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSessionRequest.ProtoReflect.Descriptor instead.
+func (*GetSessionRequest) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *GetSessionRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type CreateSessionRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	GameId    uint64                 `protobuf:"varint,1,opt,name=game_id,json=gameId,proto3" json:"game_id,omitempty"`
+	PlayerIds []int64                `protobuf:"varint,2,rep,packed,name=player_ids,json=playerIds,proto3" json:"player_ids,omitempty"`
+	// RFC 3339 or YYYY-MM-DD
+	StartedDate string `protobuf:"bytes,3,opt,name=started_date,json=startedDate,proto3" json:"started_date,omitempty"`
+	// first, the default, balanced, unblocking or related
+	Strategy string `protobuf:"bytes,4,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	// Names of the game's expansions and variants to set it up with
+	Modules       []string `protobuf:"bytes,5,rep,name=modules,proto3" json:"modules,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateSessionRequest) Reset() {
+	*x = CreateSessionRequest{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateSessionRequest) ProtoMessage() {}
+
+func (x *CreateSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateSessionRequest.ProtoReflect.Descriptor instead.
+func (*CreateSessionRequest) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *CreateSessionRequest) GetGameId() uint64 {
+	if x != nil {
+		return x.GameId
+	}
+	return 0
+}
+
+func (x *CreateSessionRequest) GetPlayerIds() []int64 {
+	if x != nil {
+		return x.PlayerIds
+	}
+	return nil
+}
+
+func (x *CreateSessionRequest) GetStartedDate() string {
+	if x != nil {
+		return x.StartedDate
+	}
+	return ""
+}
+
+func (x *CreateSessionRequest) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *CreateSessionRequest) GetModules() []string {
+	if x != nil {
+		return x.Modules
+	}
+	return nil
+}
+
+type StepAction struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	PlayerId int64                  `protobuf:"varint,1,opt,name=player_id,json=playerId,proto3" json:"player_id,omitempty"`
+	StepDesc string                 `protobuf:"bytes,2,opt,name=step_desc,json=stepDesc,proto3" json:"step_desc,omitempty"`
+	// "finish", the default, or "reopen"
+	Action        string `protobuf:"bytes,3,opt,name=action,proto3" json:"action,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StepAction) Reset() {
+	*x = StepAction{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StepAction) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StepAction) ProtoMessage() {}
+
+func (x *StepAction) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StepAction.ProtoReflect.Descriptor instead.
+func (*StepAction) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *StepAction) GetPlayerId() int64 {
+	if x != nil {
+		return x.PlayerId
+	}
+	return 0
+}
+
+func (x *StepAction) GetStepDesc() string {
+	if x != nil {
+		return x.StepDesc
+	}
+	return ""
+}
+
+func (x *StepAction) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+type FinishStepsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     uint64                 `protobuf:"varint,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Steps         []*StepAction          `protobuf:"bytes,2,rep,name=steps,proto3" json:"steps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FinishStepsRequest) Reset() {
+	*x = FinishStepsRequest{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FinishStepsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FinishStepsRequest) ProtoMessage() {}
+
+func (x *FinishStepsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FinishStepsRequest.ProtoReflect.Descriptor instead.
+func (*FinishStepsRequest) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *FinishStepsRequest) GetSessionId() uint64 {
+	if x != nil {
+		return x.SessionId
+	}
+	return 0
+}
+
+func (x *FinishStepsRequest) GetSteps() []*StepAction {
+	if x != nil {
+		return x.Steps
+	}
+	return nil
+}
+
+type WatchSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     uint64                 `protobuf:"varint,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchSessionRequest) Reset() {
+	*x = WatchSessionRequest{}
+	mi := &file_meeplepb_meeple_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchSessionRequest) ProtoMessage() {}
+
+func (x *WatchSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meeplepb_meeple_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchSessionRequest.ProtoReflect.Descriptor instead.
+func (*WatchSessionRequest) Descriptor() ([]byte, []int) {
+	return file_meeplepb_meeple_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *WatchSessionRequest) GetSessionId() uint64 {
+	if x != nil {
+		return x.SessionId
+	}
+	return 0
+}
+
+var File_meeplepb_meeple_proto protoreflect.FileDescriptor
+
+const file_meeplepb_meeple_proto_rawDesc = "" +
+	"\n" +
+	"\x15meeplepb/meeple.proto\x12\fmeeple_mover\",\n" +
+	"\x06Player\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"\x8f\x01\n" +
+	"\x04Rule\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\x12\x18\n" +
+	"\adetails\x18\x03 \x01(\tR\adetails\x12\x14\n" +
+	"\x05arity\x18\x04 \x01(\tR\x05arity\x12%\n" +
+	"\x0edependency_ids\x18\x05 \x03(\x03R\rdependencyIds\"\x96\x01\n" +
+	"\x04Game\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1f\n" +
+	"\vmin_players\x18\x03 \x01(\x05R\n" +
+	"minPlayers\x12\x1f\n" +
+	"\vmax_players\x18\x04 \x01(\x05R\n" +
+	"maxPlayers\x12(\n" +
+	"\x05rules\x18\x05 \x03(\v2\x12.meeple_mover.RuleR\x05rules\"n\n" +
+	"\x04Step\x12&\n" +
+	"\x04rule\x18\x01 \x01(\v2\x12.meeple_mover.RuleR\x04rule\x12*\n" +
+	"\x05owner\x18\x02 \x01(\v2\x14.meeple_mover.PlayerR\x05owner\x12\x12\n" +
+	"\x04done\x18\x03 \x01(\bR\x04done\"v\n" +
+	"\n" +
+	"Assignment\x12,\n" +
+	"\x06player\x18\x01 \x01(\v2\x14.meeple_mover.PlayerR\x06player\x12&\n" +
+	"\x04step\x18\x02 \x01(\v2\x12.meeple_mover.StepR\x04step\x12\x12\n" +
+	"\x04done\x18\x03 \x01(\bR\x04done\"\x8d\x02\n" +
+	"\aSession\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12&\n" +
+	"\x04game\x18\x02 \x01(\v2\x12.meeple_mover.GameR\x04game\x12.\n" +
+	"\aplayers\x18\x03 \x03(\v2\x14.meeple_mover.PlayerR\aplayers\x12(\n" +
+	"\x05steps\x18\x04 \x03(\v2\x12.meeple_mover.StepR\x05steps\x12:\n" +
+	"\vassignments\x18\x05 \x03(\v2\x18.meeple_mover.AssignmentR\vassignments\x12\x1a\n" +
+	"\bstrategy\x18\x06 \x01(\tR\bstrategy\x12\x18\n" +
+	"\amodules\x18\a \x03(\tR\amodules\"\x12\n" +
+	"\x10ListGamesRequest\"=\n" +
+	"\x11ListGamesResponse\x12(\n" +
+	"\x05games\x18\x01 \x03(\v2\x12.meeple_mover.GameR\x05games\" \n" +
+	"\x0eGetGameRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\"\x14\n" +
+	"\x12ListPlayersRequest\"E\n" +
+	"\x13ListPlayersResponse\x12.\n" +
+	"\aplayers\x18\x01 \x03(\v2\x14.meeple_mover.PlayerR\aplayers\"\"\n" +
+	"\x10GetPlayerRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\")\n" +
+	"\x13CreatePlayerRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"%\n" +
+	"\x13DeletePlayerRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"\x16\n" +
+	"\x14DeletePlayerResponse\"\x15\n" +
+	"\x13ListSessionsRequest\"I\n" +
+	"\x14ListSessionsResponse\x121\n" +
+	"\bsessions\x18\x01 \x03(\v2\x15.meeple_mover.SessionR\bsessions\"#\n" +
+	"\x11GetSessionRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\"\xa7\x01\n" +
+	"\x14CreateSessionRequest\x12\x17\n" +
+	"\agame_id\x18\x01 \x01(\x04R\x06gameId\x12\x1d\n" +
+	"\n" +
+	"player_ids\x18\x02 \x03(\x03R\tplayerIds\x12!\n" +
+	"\fstarted_date\x18\x03 \x01(\tR\vstartedDate\x12\x1a\n" +
+	"\bstrategy\x18\x04 \x01(\tR\bstrategy\x12\x18\n" +
+	"\amodules\x18\x05 \x03(\tR\amodules\"^\n" +
+	"\n" +
+	"StepAction\x12\x1b\n" +
+	"\tplayer_id\x18\x01 \x01(\x03R\bplayerId\x12\x1b\n" +
+	"\tstep_desc\x18\x02 \x01(\tR\bstepDesc\x12\x16\n" +
+	"\x06action\x18\x03 \x01(\tR\x06action\"c\n" +
+	"\x12FinishStepsRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\x04R\tsessionId\x12.\n" +
+	"\x05steps\x18\x02 \x03(\v2\x18.meeple_mover.StepActionR\x05steps\"4\n" +
+	"\x13WatchSessionRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\x04R\tsessionId2\xcc\x06\n" +
+	"\vMeepleMover\x12L\n" +
+	"\tListGames\x12\x1e.meeple_mover.ListGamesRequest\x1a\x1f.meeple_mover.ListGamesResponse\x12;\n" +
+	"\aGetGame\x12\x1c.meeple_mover.GetGameRequest\x1a\x12.meeple_mover.Game\x12R\n" +
+	"\vListPlayers\x12 .meeple_mover.ListPlayersRequest\x1a!.meeple_mover.ListPlayersResponse\x12A\n" +
+	"\tGetPlayer\x12\x1e.meeple_mover.GetPlayerRequest\x1a\x14.meeple_mover.Player\x12G\n" +
+	"\fCreatePlayer\x12!.meeple_mover.CreatePlayerRequest\x1a\x14.meeple_mover.Player\x12U\n" +
+	"\fDeletePlayer\x12!.meeple_mover.DeletePlayerRequest\x1a\".meeple_mover.DeletePlayerResponse\x12U\n" +
+	"\fListSessions\x12!.meeple_mover.ListSessionsRequest\x1a\".meeple_mover.ListSessionsResponse\x12D\n" +
+	"\n" +
+	"GetSession\x12\x1f.meeple_mover.GetSessionRequest\x1a\x15.meeple_mover.Session\x12J\n" +
+	"\rCreateSession\x12\".meeple_mover.CreateSessionRequest\x1a\x15.meeple_mover.Session\x12F\n" +
+	"\vFinishSteps\x12 .meeple_mover.FinishStepsRequest\x1a\x15.meeple_mover.Session\x12J\n" +
+	"\fWatchSession\x12!.meeple_mover.WatchSessionRequest\x1a\x15.meeple_mover.Session0\x01B-Z+github.com/rkbodenner/meeple_mover/meeplepbb\x06proto3"
+
+var (
+	file_meeplepb_meeple_proto_rawDescOnce sync.Once
+	file_meeplepb_meeple_proto_rawDescData []byte
+)
+
+func file_meeplepb_meeple_proto_rawDescGZIP() []byte {
+	file_meeplepb_meeple_proto_rawDescOnce.Do(func() {
+		file_meeplepb_meeple_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_meeplepb_meeple_proto_rawDesc), len(file_meeplepb_meeple_proto_rawDesc)))
+	})
+	return file_meeplepb_meeple_proto_rawDescData
+}
+
+var file_meeplepb_meeple_proto_msgTypes = make([]protoimpl.MessageInfo, 22)
+var file_meeplepb_meeple_proto_goTypes = []any{
+	(*Player)(nil),               // 0: meeple_mover.Player
+	(*Rule)(nil),                 // 1: meeple_mover.Rule
+	(*Game)(nil),                 // 2: meeple_mover.Game
+	(*Step)(nil),                 // 3: meeple_mover.Step
+	(*Assignment)(nil),           // 4: meeple_mover.Assignment
+	(*Session)(nil),              // 5: meeple_mover.Session
+	(*ListGamesRequest)(nil),     // 6: meeple_mover.ListGamesRequest
+	(*ListGamesResponse)(nil),    // 7: meeple_mover.ListGamesResponse
+	(*GetGameRequest)(nil),       // 8: meeple_mover.GetGameRequest
+	(*ListPlayersRequest)(nil),   // 9: meeple_mover.ListPlayersRequest
+	(*ListPlayersResponse)(nil),  // 10: meeple_mover.ListPlayersResponse
+	(*GetPlayerRequest)(nil),     // 11: meeple_mover.GetPlayerRequest
+	(*CreatePlayerRequest)(nil),  // 12: meeple_mover.CreatePlayerRequest
+	(*DeletePlayerRequest)(nil),  // 13: meeple_mover.DeletePlayerRequest
+	(*DeletePlayerResponse)(nil), // 14: meeple_mover.DeletePlayerResponse
+	(*ListSessionsRequest)(nil),  // 15: meeple_mover.ListSessionsRequest
+	(*ListSessionsResponse)(nil), // 16: meeple_mover.ListSessionsResponse
+	(*GetSessionRequest)(nil),    // 17: meeple_mover.GetSessionRequest
+	(*CreateSessionRequest)(nil), // 18: meeple_mover.CreateSessionRequest
+	(*StepAction)(nil),           // 19: meeple_mover.StepAction
+	(*FinishStepsRequest)(nil),   // 20: meeple_mover.FinishStepsRequest
+	(*WatchSessionRequest)(nil),  // 21: meeple_mover.WatchSessionRequest
+}
+var file_meeplepb_meeple_proto_depIdxs = []int32{
+	1,  // 0: meeple_mover.Game.rules:type_name -> meeple_mover.Rule
+	1,  // 1: meeple_mover.Step.rule:type_name -> meeple_mover.Rule
+	0,  // 2: meeple_mover.Step.owner:type_name -> meeple_mover.Player
+	0,  // 3: meeple_mover.Assignment.player:type_name -> meeple_mover.Player
+	3,  // 4: meeple_mover.Assignment.step:type_name -> meeple_mover.Step
+	2,  // 5: meeple_mover.Session.game:type_name -> meeple_mover.Game
+	0,  // 6: meeple_mover.Session.players:type_name -> meeple_mover.Player
+	3,  // 7: meeple_mover.Session.steps:type_name -> meeple_mover.Step
+	4,  // 8: meeple_mover.Session.assignments:type_name -> meeple_mover.Assignment
+	2,  // 9: meeple_mover.ListGamesResponse.games:type_name -> meeple_mover.Game
+	0,  // 10: meeple_mover.ListPlayersResponse.players:type_name -> meeple_mover.Player
+	5,  // 11: meeple_mover.ListSessionsResponse.sessions:type_name -> meeple_mover.Session
+	19, // 12: meeple_mover.FinishStepsRequest.steps:type_name -> meeple_mover.StepAction
+	6,  // 13: meeple_mover.MeepleMover.ListGames:input_type -> meeple_mover.ListGamesRequest
+	8,  // 14: meeple_mover.MeepleMover.GetGame:input_type -> meeple_mover.GetGameRequest
+	9,  // 15: meeple_mover.MeepleMover.ListPlayers:input_type -> meeple_mover.ListPlayersRequest
+	11, // 16: meeple_mover.MeepleMover.GetPlayer:input_type -> meeple_mover.GetPlayerRequest
+	12, // 17: meeple_mover.MeepleMover.CreatePlayer:input_type -> meeple_mover.CreatePlayerRequest
+	13, // 18: meeple_mover.MeepleMover.DeletePlayer:input_type -> meeple_mover.DeletePlayerRequest
+	15, // 19: meeple_mover.MeepleMover.ListSessions:input_type -> meeple_mover.ListSessionsRequest
+	17, // 20: meeple_mover.MeepleMover.GetSession:input_type -> meeple_mover.GetSessionRequest
+	18, // 21: meeple_mover.MeepleMover.CreateSession:input_type -> meeple_mover.CreateSessionRequest
+	20, // 22: meeple_mover.MeepleMover.FinishSteps:input_type -> meeple_mover.FinishStepsRequest
+	21, // 23: meeple_mover.MeepleMover.WatchSession:input_type -> meeple_mover.WatchSessionRequest
+	7,  // 24: meeple_mover.MeepleMover.ListGames:output_type -> meeple_mover.ListGamesResponse
+	2,  // 25: meeple_mover.MeepleMover.GetGame:output_type -> meeple_mover.Game
+	10, // 26: meeple_mover.MeepleMover.ListPlayers:output_type -> meeple_mover.ListPlayersResponse
+	0,  // 27: meeple_mover.MeepleMover.GetPlayer:output_type -> meeple_mover.Player
+	0,  // 28: meeple_mover.MeepleMover.CreatePlayer:output_type -> meeple_mover.Player
+	14, // 29: meeple_mover.MeepleMover.DeletePlayer:output_type -> meeple_mover.DeletePlayerResponse
+	16, // 30: meeple_mover.MeepleMover.ListSessions:output_type -> meeple_mover.ListSessionsResponse
+	5,  // 31: meeple_mover.MeepleMover.GetSession:output_type -> meeple_mover.Session
+	5,  // 32: meeple_mover.MeepleMover.CreateSession:output_type -> meeple_mover.Session
+	5,  // 33: meeple_mover.MeepleMover.FinishSteps:output_type -> meeple_mover.Session
+	5,  // 34: meeple_mover.MeepleMover.WatchSession:output_type -> meeple_mover.Session
+	24, // [24:35] is the sub-list for method output_type
+	13, // [13:24] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_meeplepb_meeple_proto_init() }
+func file_meeplepb_meeple_proto_init() {
+	if File_meeplepb_meeple_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_meeplepb_meeple_proto_rawDesc), len(file_meeplepb_meeple_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   22,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_meeplepb_meeple_proto_goTypes,
+		DependencyIndexes: file_meeplepb_meeple_proto_depIdxs,
+		MessageInfos:      file_meeplepb_meeple_proto_msgTypes,
+	}.Build()
+	File_meeplepb_meeple_proto = out.File
+	file_meeplepb_meeple_proto_goTypes = nil
+	file_meeplepb_meeple_proto_depIdxs = nil
+}
@@ -0,0 +1,250 @@
+/*
+
+Collect counters, gauges and histograms and expose them in the Prometheus text format.
+
+Each metric may be partitioned by labels, whose values are passed in the order the labels were declared.
+
+*/
+
+package metrics
+
+import (
+  "bufio"
+  "fmt"
+  "io"
+  "math"
+  "net/http"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+)
+
+// Buckets suited to durations of web requests and database queries, in seconds
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+  write(w *bufio.Writer)
+}
+
+type Registry struct {
+  mutex sync.Mutex
+  metrics []metric
+}
+
+func NewRegistry() *Registry {
+  return &Registry{metrics: make([]metric, 0)}
+}
+
+func (r *Registry) register(m metric) {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+  r.metrics = append(r.metrics, m)
+}
+
+func (r *Registry) WritePrometheus(w io.Writer) error {
+  r.mutex.Lock()
+  metrics := append([]metric{}, r.metrics...)
+  r.mutex.Unlock()
+
+  buf := bufio.NewWriter(w)
+  for _, m := range metrics {
+    m.write(buf)
+  }
+  return buf.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+  w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+  err := r.WritePrometheus(w)
+  if nil != err {
+    http.Error(w, "Error", http.StatusInternalServerError)
+  }
+}
+
+type desc struct {
+  name string
+  help string
+  kind string
+  labels []string
+}
+
+func (d *desc) writeHeader(w *bufio.Writer) {
+  fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+  fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// Values of the labels, joined with a byte that can't appear in UTF-8 so they can key a map
+func (d *desc) key(labelValues []string) string {
+  if len(labelValues) != len(d.labels) {
+    panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+  }
+  return strings.Join(labelValues, "\xff")
+}
+
+func (d *desc) labelPairs(key string, extra ...string) string {
+  pairs := make([]string, 0)
+  if len(d.labels) > 0 {
+    for i, value := range strings.Split(key, "\xff") {
+      pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", d.labels[i], escapeLabelValue(value)))
+    }
+  }
+  for i := 0; i+1 < len(extra); i += 2 {
+    pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], escapeLabelValue(extra[i+1])))
+  }
+  if 0 == len(pairs) {
+    return ""
+  }
+  return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys(m map[string]float64) []string {
+  keys := make([]string, 0, len(m))
+  for k := range m {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+// Only ever goes up, e.g. the number of requests served
+type Counter struct {
+  desc
+  mutex sync.Mutex
+  values map[string]float64
+}
+
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+  c := &Counter{desc: desc{name, help, "counter", labels}, values: make(map[string]float64)}
+  r.register(c)
+  return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+  c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+  key := c.key(labelValues)
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+  c.values[key] += delta
+}
+
+func (c *Counter) Value(labelValues ...string) float64 {
+  key := c.key(labelValues)
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+  return c.values[key]
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+  c.writeHeader(w)
+  for _, key := range sortedKeys(c.values) {
+    fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(key), formatFloat(c.values[key]))
+  }
+}
+
+// A value sampled when the metrics are collected, e.g. the size of a cache
+type GaugeFunc struct {
+  desc
+  f func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name string, help string, f func() float64) *GaugeFunc {
+  g := &GaugeFunc{desc{name, help, "gauge", nil}, f}
+  r.register(g)
+  return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+  g.writeHeader(w)
+  fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.f()))
+}
+
+// Counts observations, e.g. request durations, in cumulative buckets
+type Histogram struct {
+  desc
+  buckets []float64
+  mutex sync.Mutex
+  series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+  counts []uint64  // Per bucket, not cumulative
+  count uint64
+  sum float64
+}
+
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+  sorted := append([]float64{}, buckets...)
+  sort.Float64s(sorted)
+  h := &Histogram{desc: desc{name, help, "histogram", labels}, buckets: sorted, series: make(map[string]*histogramSeries)}
+  r.register(h)
+  return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+  key := h.key(labelValues)
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  s, ok := h.series[key]
+  if !ok {
+    s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+    h.series[key] = s
+  }
+  for i, bound := range h.buckets {
+    if value <= bound {
+      s.counts[i]++
+      break
+    }
+  }
+  s.count++
+  s.sum += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+  h.mutex.Lock()
+  defer h.mutex.Unlock()
+  h.writeHeader(w)
+
+  keys := make([]string, 0, len(h.series))
+  for k := range h.series {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+
+  for _, key := range keys {
+    s := h.series[key]
+    var cumulative uint64 = 0
+    for i, bound := range h.buckets {
+      cumulative += s.counts[i]
+      fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, "le", formatFloat(bound)), cumulative)
+    }
+    fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, "le", "+Inf"), s.count)
+    fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(key), formatFloat(s.sum))
+    fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(key), s.count)
+  }
+}
+
+func formatFloat(v float64) string {
+  switch {
+  case math.IsInf(v, 1):
+    return "+Inf"
+  case math.IsInf(v, -1):
+    return "-Inf"
+  case math.IsNaN(v):
+    return "NaN"
+  }
+  return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+  return strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+  return strings.NewReplacer("\\", `\\`, "\n", `\n`, "\"", `\"`).Replace(s)
+}
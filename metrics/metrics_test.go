@@ -0,0 +1,54 @@
+package metrics
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+)
+
+func TestRegistry_WritePrometheus(t *testing.T) {
+  r := NewRegistry()
+  requests := r.NewCounter("requests_total", "Requests served", "route", "code")
+  requests.Inc("/games", "200")
+  requests.Inc("/games", "200")
+  requests.Inc("/a\"b", "404")
+  r.NewGaugeFunc("cached_games", "Games in the cache", func() float64 { return 3 })
+  durations := r.NewHistogram("duration_seconds", "How long it took", []float64{1, 0.5}, "route")
+  durations.Observe(0.2, "/games")
+  durations.Observe(0.7, "/games")
+  durations.Observe(2, "/games")
+
+  var buf bytes.Buffer
+  err := r.WritePrometheus(&buf)
+  if nil != err {
+    t.Fatal(err)
+  }
+
+  expected := `# HELP requests_total Requests served
+# TYPE requests_total counter
+requests_total{route="/a\"b",code="404"} 1
+requests_total{route="/games",code="200"} 2
+# HELP cached_games Games in the cache
+# TYPE cached_games gauge
+cached_games 3
+# HELP duration_seconds How long it took
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/games",le="0.5"} 1
+duration_seconds_bucket{route="/games",le="1"} 2
+duration_seconds_bucket{route="/games",le="+Inf"} 3
+duration_seconds_sum{route="/games"} 2.9
+duration_seconds_count{route="/games"} 3
+`
+  if buf.String() != expected {
+    t.Fatalf("Unexpected output:\n%s", buf.String())
+  }
+}
+
+func TestCounter_WrongLabelCount(t *testing.T) {
+  defer func() {
+    if r := recover(); nil == r || !strings.Contains(r.(string), "expects 1 label values") {
+      t.Fatalf("Expected panic about label values, got %v", r)
+    }
+  }()
+  NewRegistry().NewCounter("c", "help", "route").Inc()
+}
@@ -0,0 +1,214 @@
+/*
+
+Build OpenAPI 3 documents describing a JSON web service.
+
+Schemas for request and response bodies are derived from Go types by reflection, following
+the same rules as encoding/json, so the description can't drift from what's actually served.
+
+*/
+
+package openapi
+
+import (
+  "encoding/json"
+  "reflect"
+  "strings"
+  "time"
+)
+
+const Version = "3.0.3"
+
+type Document struct {
+  OpenAPI string `json:"openapi"`
+  Info Info `json:"info"`
+  Paths map[string]PathItem `json:"paths"`
+  Components Components `json:"components"`
+}
+
+type Info struct {
+  Title string `json:"title"`
+  Description string `json:"description,omitempty"`
+  Version string `json:"version"`
+}
+
+// Operations on a path, keyed by lower-case HTTP method
+type PathItem map[string]*Operation
+
+type Operation struct {
+  Summary string `json:"summary,omitempty"`
+  Parameters []*Parameter `json:"parameters,omitempty"`
+  RequestBody *RequestBody `json:"requestBody,omitempty"`
+  Responses map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+  Name string `json:"name"`
+  In string `json:"in"`
+  Description string `json:"description,omitempty"`
+  Required bool `json:"required"`
+  Schema *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+  Required bool `json:"required"`
+  Content map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+  Description string `json:"description"`
+  Content map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+  Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+  Ref string `json:"$ref,omitempty"`
+  Type string `json:"type,omitempty"`
+  Format string `json:"format,omitempty"`
+  Nullable bool `json:"nullable,omitempty"`
+  Properties map[string]*Schema `json:"properties,omitempty"`
+  Items *Schema `json:"items,omitempty"`
+  AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+}
+
+type Components struct {
+  Schemas map[string]*Schema `json:"schemas"`
+}
+
+func New(title string, version string) *Document {
+  return &Document{
+    OpenAPI: Version,
+    Info: Info{Title: title, Version: version},
+    Paths: make(map[string]PathItem),
+    Components: Components{Schemas: make(map[string]*Schema)},
+  }
+}
+
+// Describe the operation served at a path. Path parameters use the same {name} syntax as tigertonic.
+func (doc *Document) Add(method string, path string, op *Operation) {
+  item, ok := doc.Paths[path]
+  if !ok {
+    item = make(PathItem)
+    doc.Paths[path] = item
+  }
+  item[strings.ToLower(method)] = op
+}
+
+func (doc *Document) Has(method string, path string) bool {
+  item, ok := doc.Paths[path]
+  if !ok {
+    return false
+  }
+  _, ok = item[strings.ToLower(method)]
+  return ok
+}
+
+// Schema of the JSON encoding of v. Named struct types are stored once in the document's
+// components and referenced, which also takes care of recursive types.
+func (doc *Document) SchemaFor(v interface{}) *Schema {
+  return doc.schemaForType(reflect.TypeOf(v))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func (doc *Document) schemaForType(t reflect.Type) *Schema {
+  if t == timeType {
+    return &Schema{Type: "string", Format: "date-time"}
+  }
+  // Custom encodings are opaque to reflection, so allow any value
+  if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+    return &Schema{}
+  }
+
+  switch t.Kind() {
+  case reflect.Ptr:
+    return doc.schemaForType(t.Elem())
+  case reflect.Bool:
+    return &Schema{Type: "boolean"}
+  case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+    return &Schema{Type: "integer", Format: "int32"}
+  case reflect.Int64, reflect.Uint, reflect.Uint64:
+    return &Schema{Type: "integer", Format: "int64"}
+  case reflect.Float32:
+    return &Schema{Type: "number", Format: "float"}
+  case reflect.Float64:
+    return &Schema{Type: "number", Format: "double"}
+  case reflect.String:
+    return &Schema{Type: "string"}
+  case reflect.Slice, reflect.Array:
+    if t.Elem().Kind() == reflect.Uint8 {
+      return &Schema{Type: "string", Format: "byte"}
+    }
+    return &Schema{Type: "array", Items: doc.schemaForType(t.Elem())}
+  case reflect.Map:
+    return &Schema{Type: "object", AdditionalProperties: doc.schemaForType(t.Elem())}
+  case reflect.Struct:
+    if "" == t.Name() {
+      return doc.structSchema(t)
+    }
+    name := t.Name()
+    if _, ok := doc.Components.Schemas[name]; !ok {
+      // Reserve the name before recursing, in case the type refers to itself
+      doc.Components.Schemas[name] = &Schema{Type: "object"}
+      doc.Components.Schemas[name] = doc.structSchema(t)
+    }
+    return &Schema{Ref: "#/components/schemas/" + name}
+  }
+  return &Schema{}
+}
+
+func (doc *Document) structSchema(t reflect.Type) *Schema {
+  schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+  doc.addFields(schema, t)
+  return schema
+}
+
+func (doc *Document) addFields(schema *Schema, t reflect.Type) {
+  for i := 0; i < t.NumField(); i++ {
+    field := t.Field(i)
+    tag := field.Tag.Get("json")
+    if "-" == tag {
+      continue
+    }
+    name := strings.Split(tag, ",")[0]
+
+    // Untagged embedded structs have their fields promoted, as in encoding/json
+    if field.Anonymous && "" == name {
+      embedded := field.Type
+      if embedded.Kind() == reflect.Ptr {
+        embedded = embedded.Elem()
+      }
+      if embedded.Kind() == reflect.Struct {
+        doc.addFields(schema, embedded)
+        continue
+      }
+    }
+    if "" != field.PkgPath {
+      continue  // Unexported
+    }
+
+    if "" == name {
+      name = field.Name
+    }
+    fieldSchema := doc.schemaForType(field.Type)
+    if field.Type.Kind() == reflect.Ptr && "" == fieldSchema.Ref {
+      fieldSchema.Nullable = true
+    }
+    schema.Properties[name] = fieldSchema
+  }
+}
+
+func JSONContent(schema *Schema) map[string]*MediaType {
+  return map[string]*MediaType{"application/json": &MediaType{Schema: schema}}
+}
+
+func TextContent() map[string]*MediaType {
+  return map[string]*MediaType{"text/plain": &MediaType{Schema: &Schema{Type: "string"}}}
+}
+
+func PathParameter(name string, description string, schema *Schema) *Parameter {
+  return &Parameter{Name: name, In: "path", Description: description, Required: true, Schema: schema}
+}
@@ -0,0 +1,72 @@
+package openapi
+
+import (
+  "testing"
+  "time"
+)
+
+type node struct {
+  Name string `json:"name"`
+  Skipped string `json:"-"`
+  Optional *int `json:"optional,omitempty"`
+  Children []*node
+  Created time.Time `json:"created"`
+  hidden int
+}
+
+type wrapper struct {
+  node
+  Extra map[string]bool `json:"extra"`
+}
+
+func TestSchemaFor_Struct(t *testing.T) {
+  doc := New("test", "1")
+  schema := doc.SchemaFor(&node{})
+  if schema.Ref != "#/components/schemas/node" {
+    t.Fatalf("Expected reference to node schema, got %q", schema.Ref)
+  }
+
+  props := doc.Components.Schemas["node"].Properties
+  if len(props) != 4 {
+    t.Fatalf("Expected 4 properties, got %d", len(props))
+  }
+  if props["name"].Type != "string" {
+    t.Fatal("Tagged field should use its JSON name")
+  }
+  if _, ok := props["Skipped"]; ok {
+    t.Fatal("Field tagged with - should be skipped")
+  }
+  if !props["optional"].Nullable || props["optional"].Format != "int32" {
+    t.Fatal("Pointer to int should be a nullable integer")
+  }
+  if props["Children"].Items.Ref != "#/components/schemas/node" {
+    t.Fatal("Recursive field should refer back to the named schema")
+  }
+  if props["created"].Format != "date-time" {
+    t.Fatal("time.Time should be a date-time string")
+  }
+}
+
+func TestSchemaFor_EmbeddedStruct(t *testing.T) {
+  doc := New("test", "1")
+  doc.SchemaFor(wrapper{})
+
+  props := doc.Components.Schemas["wrapper"].Properties
+  if _, ok := props["name"]; !ok {
+    t.Fatal("Fields of embedded struct should be promoted")
+  }
+  if props["extra"].AdditionalProperties.Type != "boolean" {
+    t.Fatal("Map should be an object with typed values")
+  }
+}
+
+func TestDocument_Has(t *testing.T) {
+  doc := New("test", "1")
+  doc.Add("GET", "/things/{id}", &Operation{})
+  if !doc.Has("GET", "/things/{id}") {
+    t.Fatal("Expected operation to be described")
+  }
+  if doc.Has("DELETE", "/things/{id}") {
+    t.Fatal("Did not expect undescribed method to be found")
+  }
+}
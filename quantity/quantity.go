@@ -0,0 +1,176 @@
+/*
+
+Quantities in setup rules that depend on the number of players, as in "Deal {cards} cards to each
+player", where cards is 9 for 2 players, 7 for 3 and 6 for 4.
+
+A rule's description and details may name placeholders in braces, each bound to a table of values by
+number of players. A value for 0 players is used for any number the table doesn't list:
+
+  q := quantity.Quantities{"cards": quantity.Table{2: "9", 3: "7", 4: "6"}}
+  text, err := q.Render("Deal {cards} cards to each player", 3)
+
+Sessions are set up from rules with the values for their players filled in:
+
+  g, err := quantity.Render(base, quantities, len(players))
+
+Braces that don't name one of the rule's placeholders are left as they are.
+
+*/
+
+package quantity
+
+import (
+  "errors"
+  "fmt"
+  "regexp"
+  "sort"
+  "strings"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+// A placeholder's values by number of players, with 0 for any number not listed
+type Table map[int]string
+
+// A rule's tables, by placeholder name
+type Quantities map[string]Table
+
+var (
+  placeholder = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+  validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Whether a placeholder can be named so
+func ValidName(name string) bool {
+  return validName.MatchString(name)
+}
+
+// Names in braces in the text, in the order they first appear
+func Placeholders(text string) []string {
+  names := make([]string, 0)
+  seen := make(map[string]bool)
+  for _, match := range placeholder.FindAllStringSubmatch(text, -1) {
+    if !seen[match[1]] {
+      seen[match[1]] = true
+      names = append(names, match[1])
+    }
+  }
+  return names
+}
+
+// The value for the number of players. Returns false if there's none.
+func (t Table) Value(players int) (string, bool) {
+  if value, ok := t[players]; ok {
+    return value, true
+  }
+  value, ok := t[0]
+  return value, ok
+}
+
+// The names of the placeholders, sorted
+func (q Quantities) Names() []string {
+  names := make([]string, 0, len(q))
+  for name := range q {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+// The text with each of the placeholders that has a table replaced by its value for the number of
+// players. Returns an error if a table has no value for it.
+func (q Quantities) Render(text string, players int) (string, error) {
+  var err error
+  rendered := placeholder.ReplaceAllStringFunc(text, func(match string) string {
+    name := match[1:len(match) - 1]
+    table, ok := q[name]
+    if !ok {
+      return match
+    }
+    value, ok := table.Value(players)
+    if !ok && nil == err {
+      err = errors.New(fmt.Sprintf("No value of {%s} for %d players", name, players))
+    }
+    return value
+  })
+  return rendered, err
+}
+
+// Check that every table is named in the texts and has a value for every number of players from
+// min to max. Returns every problem found.
+func (q Quantities) Check(texts []string, minPlayers int, maxPlayers int) []string {
+  problems := make([]string, 0)
+  named := make(map[string]bool)
+  for _, text := range texts {
+    for _, name := range Placeholders(text) {
+      named[name] = true
+    }
+  }
+  for _, name := range q.Names() {
+    if !ValidName(name) {
+      problems = append(problems, fmt.Sprintf("Placeholder %q should be letters, digits and underscores", name))
+      continue
+    }
+    if !named[name] {
+      problems = append(problems, fmt.Sprintf("{%s} isn't in the rule's description or details", name))
+    }
+    missing := make([]string, 0)
+    for players := minPlayers; players <= maxPlayers; players++ {
+      if _, ok := q[name].Value(players); !ok {
+        missing = append(missing, fmt.Sprintf("%d", players))
+      }
+    }
+    if len(missing) > 0 {
+      problems = append(problems, fmt.Sprintf("{%s} has no value for %s players", name, strings.Join(missing, ", ")))
+    }
+  }
+  return problems
+}
+
+// The game with the quantities of its rules, by rule ID, filled in for the number of players. Its rules
+// are copied, keeping their IDs, and the game is left as it was. Returns the game itself if none of
+// its rules have quantities.
+func Render(g *game.Game, quantities map[int]Quantities, players int) (*game.Game, error) {
+  quantified := false
+  for _, rule := range g.SetupRules {
+    if _, ok := quantities[rule.Id]; ok {
+      quantified = true
+    }
+  }
+  if !quantified {
+    return g, nil
+  }
+
+  rendered := &game.Game{Id: g.Id, Name: g.Name, MinPlayers: g.MinPlayers, MaxPlayers: g.MaxPlayers}
+  copies := make(map[*game.SetupRule]*game.SetupRule)
+  for _, rule := range g.SetupRules {
+    ruleCopy := *rule
+    if q, ok := quantities[rule.Id]; ok {
+      var err error
+      if ruleCopy.Description, err = q.Render(rule.Description, players); nil != err {
+        return nil, errors.New(fmt.Sprintf("%q: %s", rule.Description, err))
+      }
+      if ruleCopy.Details, err = q.Render(rule.Details, players); nil != err {
+        return nil, errors.New(fmt.Sprintf("%q: %s", rule.Description, err))
+      }
+    }
+    copies[rule] = &ruleCopy
+    rendered.SetupRules = append(rendered.SetupRules, &ruleCopy)
+  }
+  for _, ruleCopy := range rendered.SetupRules {
+    deps := make([]*game.SetupRule, 0, len(ruleCopy.Dependencies))
+    for _, dep := range ruleCopy.Dependencies {
+      if depCopy, ok := copies[dep]; ok {
+        dep = depCopy
+      }
+      deps = append(deps, dep)
+    }
+    ruleCopy.Dependencies = deps
+  }
+
+  // Values may make two rules' descriptions the same
+  if err := setupgraph.CheckGame(rendered); nil != err {
+    return nil, err
+  }
+  return rendered, nil
+}
@@ -0,0 +1,88 @@
+package quantity
+
+import (
+  "strings"
+  "testing"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+func TestQuantities_Render(t *testing.T) {
+  q := Quantities{"cards": Table{2: "9", 3: "7", 4: "6"}, "cubes": Table{0: "3", 4: "2"}}
+  cases := []struct {
+    text string
+    players int
+    expected string
+  }{
+    {"Deal {cards} cards to each player", 3, "Deal 7 cards to each player"},
+    {"Deal {cards} cards and {cubes} cubes", 4, "Deal 6 cards and 2 cubes"},
+    {"Place {cubes} cubes, then {cubes} more", 2, "Place 3 cubes, then 3 more"},
+    {"Leave {tokens} and {} as they are", 2, "Leave {tokens} and {} as they are"},
+  }
+  for _, c := range cases {
+    rendered, err := q.Render(c.text, c.players)
+    if nil != err {
+      t.Errorf("%s: %s", c.text, err)
+    } else if c.expected != rendered {
+      t.Errorf("Expected %q, got %q", c.expected, rendered)
+    }
+  }
+  if _, err := q.Render("Deal {cards} cards", 5); nil == err || !strings.Contains(err.Error(), "{cards} for 5 players") {
+    t.Errorf("Expected an error for a missing value, got %v", err)
+  }
+}
+
+func TestQuantities_Check(t *testing.T) {
+  q := Quantities{"cards": Table{2: "9", 3: "7"}, "unused": Table{0: "1"}, "bad name": Table{0: "1"}}
+  problems := q.Check([]string{"Deal {cards} cards", ""}, 2, 4)
+  expected := []string{"should be letters", "{cards} has no value for 4 players", "{unused} isn't in the rule's"}
+  if len(expected) != len(problems) {
+    t.Fatalf("Expected %d problems, got %v", len(expected), problems)
+  }
+  for i := range expected {
+    if !strings.Contains(problems[i], expected[i]) {
+      t.Errorf("Expected a problem containing %q, got %q", expected[i], problems[i])
+    }
+  }
+}
+
+func TestPlaceholders(t *testing.T) {
+  names := Placeholders("Deal {cards} cards and {cubes} cubes, {cards} face up {1st}")
+  if 2 != len(names) || "cards" != names[0] || "cubes" != names[1] {
+    t.Errorf("Expected cards and cubes, got %v", names)
+  }
+}
+
+func TestRender(t *testing.T) {
+  shuffle := &game.SetupRule{Id: 1, Description: "Shuffle", Arity: "Once"}
+  deal := &game.SetupRule{Id: 2, Description: "Deal {cards} cards", Details: "{cards} face down", Arity: "Each player", Dependencies: []*game.SetupRule{shuffle}}
+  g := &game.Game{Id: 1, Name: "Test", MinPlayers: 2, MaxPlayers: 4, SetupRules: []*game.SetupRule{shuffle, deal}}
+  quantities := map[int]Quantities{deal.Id: Quantities{"cards": Table{2: "9", 0: "7"}}}
+
+  if rendered, err := Render(g, map[int]Quantities{}, 2); nil != err || rendered != g {
+    t.Errorf("Expected the game itself without quantities, got %v", err)
+  }
+  rendered, err := Render(g, quantities, 2)
+  if nil != err {
+    t.Fatal(err)
+  }
+  dealt := rendered.SetupRules[1]
+  if "Deal 9 cards" != dealt.Description || "9 face down" != dealt.Details || 2 != dealt.Id {
+    t.Errorf("Expected the deal to be rendered for 2 players, got %q: %q", dealt.Description, dealt.Details)
+  }
+  if dealt.Dependencies[0] != rendered.SetupRules[0] {
+    t.Error("Expected the deal to depend on the rendered game's shuffle")
+  }
+  if "Deal {cards} cards" != deal.Description {
+    t.Error("Expected the game to be left as it was")
+  }
+
+  // Values that make two rules the same
+  same := &game.SetupRule{Id: 3, Description: "Deal 7 cards", Arity: "Each player"}
+  g.SetupRules = append(g.SetupRules, same)
+  if _, err := Render(g, quantities, 3); nil == err {
+    t.Error("Expected an error for repeated descriptions")
+  } else if _, ok := err.(*setupgraph.IntegrityError); !ok {
+    t.Errorf("Expected an *IntegrityError, got %v", err)
+  }
+}
@@ -0,0 +1,194 @@
+package record
+
+import (
+  "database/sql"
+  "errors"
+  "fmt"
+  "time"
+  "github.com/lib/pq"
+  "github.com/rkbodenner/meeple_mover/assign"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// Run f in a transaction, committing if it succeeds
+func inTransaction(db *sql.DB, f func(tx *sql.Tx) error) error {
+  tx, err := db.Begin()
+  if nil != err {
+    return err
+  }
+  if err := f(tx); nil != err {
+    tx.Rollback()
+    return err
+  }
+  return tx.Commit()
+}
+
+// A session's progress, without loading its game and steps
+type SessionSummary struct {
+  Id int
+  GameName string
+  Players []string
+  Steps int
+  StepsDone int
+  CreatedAt time.Time
+}
+
+func FindSessionSummaries(db *sql.DB) ([]*SessionSummary, error) {
+  rows, err := db.Query(`SELECT s.id, g.name, s.created_at,
+      ARRAY(SELECT p.name FROM players p INNER JOIN sessions_players sp ON sp.player_id = p.id WHERE sp.session_id = s.id ORDER BY p.id),
+      (SELECT count(*) FROM setup_steps st WHERE st.session_id = s.id),
+      (SELECT count(*) FROM setup_steps st WHERE st.session_id = s.id AND st.done)
+    FROM sessions s INNER JOIN games g ON g.id = s.game_id ORDER BY s.id`)
+  if nil != err {
+    return nil, err
+  }
+  defer rows.Close()
+
+  summaries := make([]*SessionSummary, 0)
+  for rows.Next() {
+    summary := &SessionSummary{}
+    var gameName sql.NullString
+    err := rows.Scan(&summary.Id, &gameName, &summary.CreatedAt, pq.Array(&summary.Players), &summary.Steps, &summary.StepsDone)
+    if nil != err {
+      return nil, err
+    }
+    summary.GameName = gameName.String
+    summaries = append(summaries, summary)
+  }
+  return summaries, rows.Err()
+}
+
+// Undo every step of the session, and assign each player their first step again, by the session's
+// strategy. Find the session first.
+func (rec *SessionRecord) ResetSteps(db *sql.DB) error {
+  fresh := session.NewEmptySession()
+  fresh.Id = rec.s.Id
+  fresh.Game = rec.s.Game
+  fresh.Players = rec.s.Players
+  fresh.SetupSteps = rec.s.SetupSteps
+  for _, step := range fresh.SetupSteps {
+    step.Done = false
+  }
+  strategy := assign.Lookup(rec.Strategy)
+  if nil == strategy {
+    strategy = assign.Default
+  }
+  assign.StepAllPlayers(strategy, fresh)
+
+  err := inTransaction(db, func(tx *sql.Tx) error {
+    if _, err := tx.Exec("UPDATE setup_steps SET done = false WHERE session_id = $1", fresh.Id); nil != err {
+      return err
+    }
+    if _, err := tx.Exec("DELETE FROM setup_step_assignments WHERE session_id = $1", fresh.Id); nil != err {
+      return err
+    }
+    for _, player := range fresh.Players {
+      if step, ok := fresh.SetupAssignments.Get(player); ok {
+        if err := (&SetupStepAssignmentRecord{fresh, player, step.Rule}).Create(tx); nil != err {
+          return err
+        }
+      }
+    }
+    return nil
+  })
+  if nil != err {
+    return err
+  }
+  *rec.s = *fresh
+  return nil
+}
+
+// Give another player the seat of one who has left the session: their steps, whether done or not,
+// and their current step. Find the session first.
+func (rec *SessionRecord) ReplacePlayer(db *sql.DB, departedId int, replacement *game.Player) error {
+  var departed *game.Player
+  for _, p := range rec.s.Players {
+    if p.Id == replacement.Id {
+      return errors.New(fmt.Sprintf("Player %d is already in session %d", replacement.Id, rec.s.Id))
+    }
+    if p.Id == departedId {
+      departed = p
+    }
+  }
+  if nil == departed {
+    return errors.New(fmt.Sprintf("Player %d is not in session %d", departedId, rec.s.Id))
+  }
+
+  err := inTransaction(db, func(tx *sql.Tx) error {
+    for _, table := range []string{"sessions_players", "setup_steps", "setup_step_assignments"} {
+      _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET player_id = $1 WHERE session_id = $2 AND player_id = $3", table),
+        replacement.Id, rec.s.Id, departedId)
+      if nil != err {
+        return err
+      }
+    }
+    return nil
+  })
+  if nil != err {
+    return err
+  }
+
+  // Steps are owned by the player object, so renaming it in place keeps the session consistent
+  departed.Id = replacement.Id
+  departed.Name = replacement.Name
+  return nil
+}
+
+// Delete sessions created before the given time, with their players, modules, steps and assignments.
+// Returns how many sessions were deleted.
+func PruneSessions(db *sql.DB, before time.Time) (int64, error) {
+  var count int64
+  err := inTransaction(db, func(tx *sql.Tx) error {
+    for _, table := range []string{"sessions_players", "sessions_modules", "setup_steps", "setup_step_assignments"} {
+      _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE session_id IN (SELECT id FROM sessions WHERE created_at < $1)", table), before)
+      if nil != err {
+        return err
+      }
+    }
+    result, err := tx.Exec("DELETE FROM sessions WHERE created_at < $1", before)
+    if nil != err {
+      return err
+    }
+    count, err = result.RowsAffected()
+    return err
+  })
+  return count, err
+}
+
+type TableCount struct {
+  Table string
+  Rows int64
+}
+
+// How many rows each table in the schema has, in order of table name
+func CountRows(db *sql.DB) ([]*TableCount, error) {
+  rows, err := db.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_type = 'BASE TABLE' ORDER BY table_name")
+  if nil != err {
+    return nil, err
+  }
+  tables := make([]string, 0)
+  for rows.Next() {
+    var table string
+    if err := rows.Scan(&table); nil != err {
+      rows.Close()
+      return nil, err
+    }
+    tables = append(tables, table)
+  }
+  rows.Close()
+  if err := rows.Err(); nil != err {
+    return nil, err
+  }
+
+  counts := make([]*TableCount, 0, len(tables))
+  for _, table := range tables {
+    count := &TableCount{Table: table}
+    err := db.QueryRow("SELECT count(*) FROM " + pq.QuoteIdentifier(table)).Scan(&count.Rows)
+    if nil != err {
+      return nil, err
+    }
+    counts = append(counts, count)
+  }
+  return counts, nil
+}
@@ -0,0 +1,196 @@
+package record
+
+import (
+  "testing"
+  "time"
+  "github.com/rkbodenner/meeple_mover/assign"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+func createTestSession(t *testing.T) *session.Session {
+  board := &game.SetupRule{Description: "Lay out the board", Arity: "Once"}
+  pawn := &game.SetupRule{Description: "Place pawn", Arity: "Each player", Dependencies: []*game.SetupRule{board}}
+  g := &game.Game{Name: "Admin test", MinPlayers: 1, MaxPlayers: 2, SetupRules: []*game.SetupRule{board, pawn}}
+  if err := NewGameRecord(g).Create(db); nil != err {
+    t.Fatal(err)
+  }
+  alice := &game.Player{Name: "Alice"}
+  if err := (&PlayerRecord{alice}).Create(db); nil != err {
+    t.Fatal(err)
+  }
+
+  s, err := session.NewSession(g, []*game.Player{alice})
+  if nil != err {
+    t.Fatal(err)
+  }
+  for _, step := range s.SetupSteps {
+    step.Finish()
+  }
+  s.StepAllPlayers()
+  if err := NewSessionRecord(s).Create(db); nil != err {
+    t.Fatal(err)
+  }
+  return s
+}
+
+func findTestSession(t *testing.T, id uint) *SessionRecord {
+  rec := NewSessionRecord(session.NewEmptySession())
+  if err := rec.Find(db, (int)(id)); nil != err {
+    t.Fatal(err)
+  }
+  return rec
+}
+
+func TestSessionRecord_ResetSteps(t *testing.T) {
+  s := createTestSession(t)
+
+  rec := findTestSession(t, s.Id)
+  if err := rec.ResetSteps(db); nil != err {
+    t.Fatal(err)
+  }
+
+  found := findTestSession(t, s.Id).s
+  for _, step := range found.SetupSteps {
+    if step.Done {
+      t.Errorf("Expected %s to be undone", step)
+    }
+  }
+  step, ok := found.SetupAssignments.Get(found.Players[0])
+  if !ok || "Lay out the board" != step.Rule.Description {
+    t.Error("Expected Alice to be assigned the board again")
+  }
+}
+
+// Chooses the last candidate, so that steps assigned by it can be told from the default's
+type lastStrategy struct{}
+
+func (lastStrategy) Name() string {
+  return "last"
+}
+
+func (lastStrategy) Choose(s *session.Session, p *game.Player, candidates []*game.SetupStep) *game.SetupStep {
+  return candidates[len(candidates) - 1]
+}
+
+func init() {
+  assign.Register(lastStrategy{})
+}
+
+func TestSessionRecord_ResetStepsByStrategy(t *testing.T) {
+  board := &game.SetupRule{Description: "Lay out the board", Arity: "Once"}
+  shuffle := &game.SetupRule{Description: "Shuffle", Arity: "Once"}
+  g := &game.Game{Name: "Reset test", MinPlayers: 1, MaxPlayers: 1, SetupRules: []*game.SetupRule{board, shuffle}}
+  if err := NewGameRecord(g).Create(db); nil != err {
+    t.Fatal(err)
+  }
+  alice := &game.Player{Name: "Alice"}
+  if err := (&PlayerRecord{alice}).Create(db); nil != err {
+    t.Fatal(err)
+  }
+  s, err := session.NewSession(g, []*game.Player{alice})
+  if nil != err {
+    t.Fatal(err)
+  }
+  if err := (&SessionRecord{s: s, Strategy: "last"}).Create(db); nil != err {
+    t.Fatal(err)
+  }
+
+  if err := findTestSession(t, s.Id).ResetSteps(db); nil != err {
+    t.Fatal(err)
+  }
+  found := findTestSession(t, s.Id).s
+  if step, ok := found.SetupAssignments.Get(found.Players[0]); !ok || "Shuffle" != step.Rule.Description {
+    t.Errorf("Expected Alice to be assigned the last step, by the session's strategy, got %v", step)
+  }
+}
+
+func TestSessionRecord_Strategy(t *testing.T) {
+  s := createTestSession(t)
+  if strategy := findTestSession(t, s.Id).Strategy; "first" != strategy {
+    t.Errorf("Expected the default strategy, got %q", strategy)
+  }
+
+  other, err := session.NewSession(s.Game, s.Players)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if err := (&SessionRecord{s: other, Strategy: "balanced"}).Create(db); nil != err {
+    t.Fatal(err)
+  }
+  strategies, err := FindSessionStrategies(db)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if "first" != strategies[s.Id] || "balanced" != strategies[other.Id] {
+    t.Errorf("Expected each session's strategy, got %v", strategies)
+  }
+}
+
+func TestSessionRecord_ReplacePlayer(t *testing.T) {
+  s := createTestSession(t)
+  bob := &game.Player{Name: "Bob"}
+  if err := (&PlayerRecord{bob}).Create(db); nil != err {
+    t.Fatal(err)
+  }
+
+  rec := findTestSession(t, s.Id)
+  if err := rec.ReplacePlayer(db, bob.Id, bob); nil == err {
+    t.Error("Expected an error replacing a player who isn't in the session")
+  }
+  if err := rec.ReplacePlayer(db, s.Players[0].Id, bob); nil != err {
+    t.Fatal(err)
+  }
+
+  found := findTestSession(t, s.Id).s
+  if len(found.Players) != 1 || found.Players[0].Id != bob.Id {
+    t.Fatalf("Expected Bob to have taken Alice's seat, got %v", found.Players)
+  }
+  for _, step := range found.SetupSteps {
+    if nil != step.Owner && step.Owner.Id != bob.Id {
+      t.Errorf("Expected Bob to own %s", step)
+    }
+  }
+}
+
+func TestPruneSessions(t *testing.T) {
+  s := createTestSession(t)
+
+  count, err := PruneSessions(db, time.Now().Add(-24 * time.Hour))
+  if nil != err {
+    t.Fatal(err)
+  }
+  if 0 != count {
+    t.Errorf("Expected nothing created yesterday, got %d", count)
+  }
+
+  count, err = PruneSessions(db, time.Now().Add(time.Minute))
+  if nil != err {
+    t.Fatal(err)
+  }
+  if count < 1 {
+    t.Fatal("Expected the session to be deleted")
+  }
+  summaries, err := FindSessionSummaries(db)
+  if nil != err {
+    t.Fatal(err)
+  }
+  for _, summary := range summaries {
+    if summary.Id == (int)(s.Id) {
+      t.Fatal("Expected the session to be gone")
+    }
+  }
+}
+
+func TestCountRows(t *testing.T) {
+  counts, err := CountRows(db)
+  if nil != err {
+    t.Fatal(err)
+  }
+  for _, count := range counts {
+    if "sessions" == count.Table {
+      return
+    }
+  }
+  t.Error("Expected a count of sessions")
+}
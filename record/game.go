@@ -5,6 +5,7 @@ import (
   "errors"
   "fmt"
   _ "github.com/lib/pq"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
   "github.com/rkbodenner/parallel_universe/game"
 )
 
@@ -41,9 +42,7 @@ func (rec *GameRecord) Find(db *sql.DB, id int) error {
   rec.Game.MaxPlayers = maxPlayers
 
   // Eager-load the associated game's setup rules
-  rec.findAssociations(db)
-
-  return nil
+  return rec.findAssociations(db)
 }
 
 func (rec *GameRecord) FindByName(db *sql.DB, name string) error {
@@ -63,9 +62,7 @@ func (rec *GameRecord) FindByName(db *sql.DB, name string) error {
   rec.Game.MaxPlayers = maxPlayers
 
   // Eager-load the associated game's setup rules
-  rec.findAssociations(db)
-
-  return nil
+  return rec.findAssociations(db)
 }
 
 func (rec *GameRecord) findAssociations(db *sql.DB) error {
@@ -79,22 +76,34 @@ func (rec *GameRecord) findAssociations(db *sql.DB) error {
   return nil
 }
 
+// Create the game and its rules, all or nothing. Returns a *setupgraph.IntegrityError, and creates
+// nothing, if the rules couldn't be set up.
 func (rec *GameRecord) Create(db *sql.DB) error {
-  err := db.QueryRow("INSERT INTO games(id, name, min_players, max_players) VALUES(default, $1, $2, $3) RETURNING id",
-    rec.Game.Name, rec.Game.MinPlayers, rec.Game.MaxPlayers).Scan(&rec.Game.Id)
+  if err := setupgraph.CheckGame(rec.Game); nil != err {
+    return err
+  }
+  // Each rule's dependencies are created before it, so that they have IDs to refer to
+  rules, err := setupgraph.SortRules(rec.Game.SetupRules)
   if nil != err {
     return err
   }
 
-  for _, rule := range rec.Game.SetupRules {
-    ruleRec := &SetupRuleRecord{Rule: rule, Game: rec.Game}
-    err = ruleRec.Create(db)
+  return inTransaction(db, func(tx *sql.Tx) error {
+    err := tx.QueryRow("INSERT INTO games(id, name, min_players, max_players) VALUES(default, $1, $2, $3) RETURNING id",
+      rec.Game.Name, rec.Game.MinPlayers, rec.Game.MaxPlayers).Scan(&rec.Game.Id)
     if nil != err {
       return err
     }
-  }
 
-  return nil
+    for _, rule := range rules {
+      ruleRec := &SetupRuleRecord{Rule: rule, Game: rec.Game}
+      err = ruleRec.Create(tx)
+      if nil != err {
+        return err
+      }
+    }
+    return nil
+  })
 }
 
 type GameRecordList struct {
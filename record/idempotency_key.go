@@ -0,0 +1,73 @@
+package record
+
+import (
+  "database/sql"
+  "time"
+  _ "github.com/lib/pq"
+)
+
+// The response to a request that carried an Idempotency-Key header.
+// Status is 0 while the first request with the key is still being served.
+type IdempotencyKeyRecord struct {
+  Key string
+  Fingerprint string  // Identifies the request, so a retry with a different body can be told apart
+  Status int
+  ContentType string
+  Location string
+  Body []byte
+  CreatedAt time.Time
+}
+
+// Claim the key for a request about to be served. A key reserved for the same request before
+// abandonedBefore and never completed is taken over, since the request that reserved it can't still be
+// served. Returns false if the key is already taken.
+func (rec *IdempotencyKeyRecord) Reserve(db *sql.DB, abandonedBefore time.Time) (bool, error) {
+  result, err := db.Exec("INSERT INTO idempotency_keys(key, fingerprint) VALUES($1, $2) " +
+    "ON CONFLICT (key) DO UPDATE SET created_at = now() " +
+    "WHERE idempotency_keys.status IS NULL AND idempotency_keys.fingerprint = $2 AND idempotency_keys.created_at < $3",
+    rec.Key, rec.Fingerprint, abandonedBefore)
+  if nil != err {
+    return false, err
+  }
+  count, err := result.RowsAffected()
+  if nil != err {
+    return false, err
+  }
+  return 1 == count, nil
+}
+
+func (rec *IdempotencyKeyRecord) FindByKey(db *sql.DB, key string) error {
+  var status sql.NullInt64
+  var contentType, location sql.NullString
+  err := db.QueryRow("SELECT fingerprint, status, content_type, location, body, created_at FROM idempotency_keys WHERE key = $1", key).Scan(
+    &rec.Fingerprint, &status, &contentType, &location, &rec.Body, &rec.CreatedAt)
+  if nil != err {
+    return err
+  }
+  rec.Key = key
+  rec.Status = (int)(status.Int64)
+  rec.ContentType = contentType.String
+  rec.Location = location.String
+  return nil
+}
+
+// Store the response to the request that reserved the key
+func (rec *IdempotencyKeyRecord) Complete(db *sql.DB) error {
+  _, err := db.Exec("UPDATE idempotency_keys SET status = $1, content_type = $2, location = $3, body = $4 WHERE key = $5",
+    rec.Status, rec.ContentType, rec.Location, rec.Body, rec.Key)
+  return err
+}
+
+func (rec *IdempotencyKeyRecord) Delete(db *sql.DB) error {
+  _, err := db.Exec("DELETE FROM idempotency_keys WHERE key = $1", rec.Key)
+  return err
+}
+
+// Forget keys older than the given time. Returns how many were forgotten.
+func PruneIdempotencyKeys(db *sql.DB, before time.Time) (int64, error) {
+  result, err := db.Exec("DELETE FROM idempotency_keys WHERE created_at < $1", before)
+  if nil != err {
+    return 0, err
+  }
+  return result.RowsAffected()
+}
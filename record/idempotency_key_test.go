@@ -0,0 +1,65 @@
+package record
+
+import (
+  "testing"
+  "time"
+)
+
+func TestIdempotencyKey_ReserveAndComplete(t *testing.T) {
+  _, err := db.Exec("DELETE FROM idempotency_keys WHERE key = 'test-key'")
+  if nil != err {
+    t.Fatal(err)
+  }
+
+  rec := &IdempotencyKeyRecord{Key: "test-key", Fingerprint: "abc"}
+  reserved, err := rec.Reserve(db, time.Now().Add(-time.Minute))
+  if nil != err {
+    t.Fatal(err)
+  }
+  if !reserved {
+    t.Fatal("Expected new key to be reserved")
+  }
+
+  reserved, err = (&IdempotencyKeyRecord{Key: "test-key", Fingerprint: "def"}).Reserve(db, time.Now().Add(-time.Minute))
+  if nil != err {
+    t.Fatal(err)
+  }
+  if reserved {
+    t.Fatal("Expected key to be reserved only once")
+  }
+
+  // Abandoned by a request that never finished, so taken over by its retry but not by another request
+  reserved, err = (&IdempotencyKeyRecord{Key: "test-key", Fingerprint: "def"}).Reserve(db, time.Now().Add(time.Minute))
+  if nil != err || reserved {
+    t.Fatalf("Expected a different request not to take over the key, got %v, %v", reserved, err)
+  }
+  reserved, err = rec.Reserve(db, time.Now().Add(time.Minute))
+  if nil != err || !reserved {
+    t.Fatalf("Expected a retry to take over the abandoned key, got %v, %v", reserved, err)
+  }
+
+  rec.Status = 201
+  rec.ContentType = "application/json"
+  rec.Body = []byte(`{"Id":1}`)
+  err = rec.Complete(db)
+  if nil != err {
+    t.Fatal(err)
+  }
+
+  found := &IdempotencyKeyRecord{}
+  err = found.FindByKey(db, "test-key")
+  if nil != err {
+    t.Fatal(err)
+  }
+  if found.Fingerprint != "abc" || found.Status != 201 || string(found.Body) != `{"Id":1}` {
+    t.Fatalf("Unexpected record %+v", found)
+  }
+
+  count, err := PruneIdempotencyKeys(db, time.Now().Add(time.Minute))
+  if nil != err {
+    t.Fatal(err)
+  }
+  if count < 1 {
+    t.Fatal("Expected key to be pruned")
+  }
+}
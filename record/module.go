@@ -0,0 +1,201 @@
+package record
+
+import (
+  "database/sql"
+  "errors"
+  "fmt"
+  _ "github.com/lib/pq"
+  "github.com/rkbodenner/meeple_mover/expansion"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+// An expansion or variant of a game, stored with the rules it adds
+type ModuleRecord struct {
+  Module *expansion.Module
+  Game *game.Game  // The base game, with its rules
+}
+
+// Check that the module only removes and replaces the game's own rules, with rules of its own, and
+// that the game can be set up with it
+func (rec *ModuleRecord) check() error {
+  problems := &setupgraph.IntegrityError{Game: fmt.Sprintf("%s with %s", rec.Game.Name, rec.Module.Name)}
+  isBase := make(map[*game.SetupRule]bool)
+  for _, rule := range rec.Game.SetupRules {
+    isBase[rule] = true
+  }
+  isOwn := make(map[*game.SetupRule]bool)
+  for _, rule := range rec.Module.Rules {
+    isOwn[rule] = true
+  }
+  for _, rule := range rec.Module.Removes {
+    if !isBase[rule] {
+      problems.Problems = append(problems.Problems, fmt.Sprintf("%q isn't one of %s's own rules, so can't be removed", rule.Description, rec.Game.Name))
+    }
+  }
+  for _, r := range rec.Module.Replaces {
+    if !isBase[r.Rule] {
+      problems.Problems = append(problems.Problems, fmt.Sprintf("%q isn't one of %s's own rules, so can't be replaced", r.Rule.Description, rec.Game.Name))
+    }
+    if !isOwn[r.With] {
+      problems.Problems = append(problems.Problems, fmt.Sprintf("%q is replaced with %q, which isn't one of the module's rules", r.Rule.Description, r.With.Description))
+    }
+  }
+  if len(problems.Problems) > 0 {
+    return problems
+  }
+
+  _, err := expansion.Apply(rec.Game, []*expansion.Module{rec.Module})
+  return err
+}
+
+// Create the module and its rules, all or nothing. Returns a *setupgraph.IntegrityError, and creates
+// nothing, if the game couldn't be set up with the module.
+func (rec *ModuleRecord) Create(db *sql.DB) error {
+  rec.Module.GameId = rec.Game.Id
+  if err := rec.check(); nil != err {
+    return err
+  }
+  // Each rule's dependencies among the module's rules are created before it, so that they have IDs to refer to
+  rules, err := setupgraph.SortRules(rec.Module.Rules)
+  if nil != err {
+    return err
+  }
+
+  return inTransaction(db, func(tx *sql.Tx) error {
+    err := tx.QueryRow("INSERT INTO game_modules(id, game_id, name, kind, min_players, max_players) VALUES(default, $1, $2, $3, $4, $5) RETURNING id",
+      rec.Game.Id, rec.Module.Name, rec.Module.Kind, rec.Module.MinPlayers, rec.Module.MaxPlayers).Scan(&rec.Module.Id)
+    if nil != err {
+      return err
+    }
+
+    for _, rule := range rules {
+      ruleRec := &SetupRuleRecord{Rule: rule, Game: rec.Game, ModuleId: rec.Module.Id}
+      if err := ruleRec.Create(tx); nil != err {
+        return err
+      }
+    }
+    for _, rule := range rec.Module.Removes {
+      _, err := tx.Exec("INSERT INTO game_module_removals(module_id, setup_rule_id) VALUES($1, $2)", rec.Module.Id, rule.Id)
+      if nil != err {
+        return err
+      }
+    }
+    for _, r := range rec.Module.Replaces {
+      _, err := tx.Exec("INSERT INTO game_module_removals(module_id, setup_rule_id, replacement_id) VALUES($1, $2, $3)",
+        rec.Module.Id, r.Rule.Id, r.With.Id)
+      if nil != err {
+        return err
+      }
+    }
+    return nil
+  })
+}
+
+// The expansions and variants of the game, which must have been found with its rules, in the order
+// they were created
+func FindModulesByGame(db Queryer, g *game.Game) ([]*expansion.Module, error) {
+  modules := make([]*expansion.Module, 0)
+  byId := make(map[int]*expansion.Module)
+  rows, err := db.Query("SELECT id, name, kind, min_players, max_players FROM game_modules WHERE game_id = $1 ORDER BY id", g.Id)
+  if nil != err {
+    return nil, err
+  }
+  defer rows.Close()
+  for rows.Next() {
+    m := &expansion.Module{GameId: g.Id, Rules: make([]*game.SetupRule, 0)}
+    if err := rows.Scan(&m.Id, &m.Name, &m.Kind, &m.MinPlayers, &m.MaxPlayers); nil != err {
+      return nil, err
+    }
+    modules = append(modules, m)
+    byId[m.Id] = m
+  }
+  if err := rows.Err(); nil != err {
+    return nil, err
+  }
+  if 0 == len(modules) {
+    return modules, nil
+  }
+
+  // The rules of the game and of every module, any of which a module's rules may depend on
+  rulesById := make(map[int]*game.SetupRule)
+  for _, rule := range g.SetupRules {
+    rulesById[rule.Id] = rule
+  }
+  ruleRows, err := db.Query("SELECT id, module_id, description, each_player, details FROM setup_rules WHERE game_id = $1 AND module_id IS NOT NULL ORDER BY id", g.Id)
+  if nil != err {
+    return nil, err
+  }
+  defer ruleRows.Close()
+  for ruleRows.Next() {
+    rule := &game.SetupRule{}
+    var moduleId int
+    var eachPlayer bool
+    var details sql.NullString
+    if err := ruleRows.Scan(&rule.Id, &moduleId, &rule.Description, &eachPlayer, &details); nil != err {
+      return nil, err
+    }
+    rule.Arity = arity(eachPlayer)
+    rule.Details = details.String
+    byId[moduleId].Rules = append(byId[moduleId].Rules, rule)
+    rulesById[rule.Id] = rule
+  }
+  if err := ruleRows.Err(); nil != err {
+    return nil, err
+  }
+
+  depRows, err := db.Query(`SELECT d.parent_id, d.child_id FROM setup_rule_dependencies d
+    INNER JOIN setup_rules c ON c.id = d.child_id
+    WHERE c.game_id = $1 AND c.module_id IS NOT NULL
+    ORDER BY d.child_id, d.parent_id`, g.Id)
+  if nil != err {
+    return nil, err
+  }
+  defer depRows.Close()
+  for depRows.Next() {
+    var parentId, childId int
+    if err := depRows.Scan(&parentId, &childId); nil != err {
+      return nil, err
+    }
+    parent, ok := rulesById[parentId]
+    if !ok {
+      return nil, errors.New(fmt.Sprintf("Rule %d %q depends on rule %d, which isn't one of %s's rules",
+        childId, rulesById[childId].Description, parentId, g.Name))
+    }
+    rulesById[childId].Dependencies = append(rulesById[childId].Dependencies, parent)
+  }
+  if err := depRows.Err(); nil != err {
+    return nil, err
+  }
+
+  removalRows, err := db.Query(`SELECT r.module_id, r.setup_rule_id, r.replacement_id FROM game_module_removals r
+    INNER JOIN game_modules m ON m.id = r.module_id
+    WHERE m.game_id = $1
+    ORDER BY r.module_id, r.setup_rule_id`, g.Id)
+  if nil != err {
+    return nil, err
+  }
+  defer removalRows.Close()
+  for removalRows.Next() {
+    var moduleId, ruleId int
+    var replacementId sql.NullInt64
+    if err := removalRows.Scan(&moduleId, &ruleId, &replacementId); nil != err {
+      return nil, err
+    }
+    m := byId[moduleId]
+    rule, ok := rulesById[ruleId]
+    if !ok {
+      return nil, errors.New(fmt.Sprintf("%s removes rule %d, which isn't one of %s's rules", m.Name, ruleId, g.Name))
+    }
+    if !replacementId.Valid {
+      m.Removes = append(m.Removes, rule)
+      continue
+    }
+    with, ok := rulesById[(int)(replacementId.Int64)]
+    if !ok {
+      return nil, errors.New(fmt.Sprintf("%s replaces %q with rule %d, which isn't one of its rules", m.Name, rule.Description, replacementId.Int64))
+    }
+    m.Replaces = append(m.Replaces, expansion.Replacement{Rule: rule, With: with})
+  }
+  return modules, removalRows.Err()
+}
@@ -0,0 +1,115 @@
+package record
+
+import (
+  "testing"
+  "github.com/rkbodenner/meeple_mover/expansion"
+  "github.com/rkbodenner/meeple_mover/setupgraph"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+func createTestModuleGame(t *testing.T) *game.Game {
+  board := &game.SetupRule{Description: "Lay out the board", Arity: "Once"}
+  shuffle := &game.SetupRule{Description: "Shuffle", Arity: "Once"}
+  pawn := &game.SetupRule{Description: "Place pawn", Arity: "Each player", Dependencies: []*game.SetupRule{board, shuffle}}
+  g := &game.Game{Name: "Module test", MinPlayers: 1, MaxPlayers: 2, SetupRules: []*game.SetupRule{board, shuffle, pawn}}
+  if err := NewGameRecord(g).Create(db); nil != err {
+    t.Fatal(err)
+  }
+  return g
+}
+
+func TestModuleRecord_Create(t *testing.T) {
+  g := createTestModuleGame(t)
+  board, shuffle, pawn := g.SetupRules[0], g.SetupRules[1], g.SetupRules[2]
+  figure := &game.SetupRule{Description: "Place figure", Arity: "Each player", Dependencies: []*game.SetupRule{board}}
+  tokens := &game.SetupRule{Description: "Place tokens", Arity: "Once", Dependencies: []*game.SetupRule{figure}}
+  m := &expansion.Module{Name: "Figures", Kind: expansion.Expansion, MaxPlayers: 3,
+    Rules: []*game.SetupRule{tokens, figure}, Removes: []*game.SetupRule{shuffle}, Replaces: []expansion.Replacement{{Rule: pawn, With: figure}}}
+  if err := (&ModuleRecord{m, g}).Create(db); nil != err {
+    t.Fatal(err)
+  }
+
+  modules, err := FindModulesByGame(db, g)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if 1 != len(modules) {
+    t.Fatalf("Expected one module, got %d", len(modules))
+  }
+  found := modules[0]
+  if "Figures" != found.Name || 3 != found.MaxPlayers || 2 != len(found.Rules) {
+    t.Errorf("Expected the module as created, got %+v", found)
+  }
+  // The figure is created before the tokens that depend on it
+  if "Place figure" != found.Rules[0].Description || found.Rules[1].Dependencies[0] != found.Rules[0] {
+    t.Error("Expected the module's rules to depend on each other")
+  }
+  if found.Rules[0].Dependencies[0] != board {
+    t.Error("Expected the figure to depend on the game's board")
+  }
+  if 1 != len(found.Removes) || found.Removes[0] != shuffle || 1 != len(found.Replaces) || found.Replaces[0].Rule != pawn {
+    t.Error("Expected the module to remove the shuffle and replace the pawn")
+  }
+
+  // The game's own rules are found without the module's
+  other := &game.Game{}
+  if err := NewGameRecord(other).Find(db, (int)(g.Id)); nil != err {
+    t.Fatal(err)
+  }
+  if 3 != len(other.SetupRules) {
+    t.Errorf("Expected the game's 3 rules, got %d", len(other.SetupRules))
+  }
+}
+
+func TestModuleRecord_CreateInvalid(t *testing.T) {
+  g := createTestModuleGame(t)
+  copied := &game.SetupRule{Description: "Shuffle", Arity: "Once"}
+  m := &expansion.Module{Name: "Again", Kind: expansion.Variant, Rules: []*game.SetupRule{copied}}
+  if _, ok := (&ModuleRecord{m, g}).Create(db).(*setupgraph.IntegrityError); !ok {
+    t.Error("Expected an *IntegrityError for a repeated description")
+  }
+  if modules, _ := FindModulesByGame(db, g); 0 != len(modules) {
+    t.Error("Expected nothing to be created")
+  }
+}
+
+func TestSessionRecord_Modules(t *testing.T) {
+  g := createTestModuleGame(t)
+  tokens := &game.SetupRule{Description: "Place tokens", Arity: "Once", Dependencies: []*game.SetupRule{g.SetupRules[0]}}
+  m := &expansion.Module{Name: "Tokens", Kind: expansion.Expansion, Rules: []*game.SetupRule{tokens}}
+  if err := (&ModuleRecord{m, g}).Create(db); nil != err {
+    t.Fatal(err)
+  }
+  alice := &game.Player{Name: "Alice"}
+  if err := (&PlayerRecord{alice}).Create(db); nil != err {
+    t.Fatal(err)
+  }
+
+  composed, err := expansion.Apply(g, []*expansion.Module{m})
+  if nil != err {
+    t.Fatal(err)
+  }
+  s, err := session.NewSession(composed, []*game.Player{alice})
+  if nil != err {
+    t.Fatal(err)
+  }
+  if err := (&SessionRecord{s: s, Strategy: "first", Modules: []*expansion.Module{m}}).Create(db); nil != err {
+    t.Fatal(err)
+  }
+
+  found := findTestSession(t, s.Id)
+  if 1 != len(found.Modules) || "Tokens" != found.Modules[0].Name {
+    t.Errorf("Expected the session's module, got %v", found.Modules)
+  }
+  if 4 != len(found.s.Game.SetupRules) || len(s.SetupSteps) != len(found.s.SetupSteps) {
+    t.Errorf("Expected the session to be set up with the module's rules, got %d rules", len(found.s.Game.SetupRules))
+  }
+  names, err := FindSessionModules(db)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if 1 != len(names[s.Id]) || "Tokens" != names[s.Id][0] {
+    t.Errorf("Expected the session's module names, got %v", names[s.Id])
+  }
+}
@@ -2,9 +2,33 @@ package record
 
 import (
   "database/sql"
+  "errors"
+  "fmt"
 )
 
+// Satisfied by both *sql.DB and *sql.Tx, so that records can be written inside a transaction
+type Queryer interface {
+  Exec(query string, args ...interface{}) (sql.Result, error)
+  Query(query string, args ...interface{}) (*sql.Rows, error)
+  QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 type Record interface {
   Create(*sql.DB) error
   Find(db *sql.DB, id int) error
 }
+
+// Version of the schema this package reads and writes. Must match schema_version() in the database.
+const SchemaVersion = 8
+
+func CheckSchemaVersion(db *sql.DB) error {
+  var version int
+  err := db.QueryRow("SELECT schema_version()").Scan(&version)
+  if nil != err {
+    return errors.New(fmt.Sprintf("Could not read schema version: %s", err))
+  }
+  if SchemaVersion != version {
+    return errors.New(fmt.Sprintf("Schema version is %d, expected %d", version, SchemaVersion))
+  }
+  return nil
+}
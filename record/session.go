@@ -5,12 +5,18 @@ import (
   "errors"
   "fmt"
   _ "github.com/lib/pq"
+  "github.com/rkbodenner/meeple_mover/assign"
+  "github.com/rkbodenner/meeple_mover/expansion"
   "github.com/rkbodenner/parallel_universe/game"
   "github.com/rkbodenner/parallel_universe/session"
 )
 
 type SessionRecord struct {
   s *session.Session
+  // Name of the assign.Strategy that picks each player's next step. The default if empty.
+  Strategy string
+  // Expansions and variants the session's game is set up with, in the order they were applied
+  Modules []*expansion.Module
 }
 
 func NewSessionRecord(s *session.Session) *SessionRecord {
@@ -36,15 +42,25 @@ func (rec *SessionRecord) storeSessionPlayerAssociations(db *sql.DB) (int, error
   return len(playerIds), nil
 }
 
+func (rec *SessionRecord) storeModules(db *sql.DB) error {
+  for i, m := range rec.Modules {
+    _, err := db.Exec("INSERT INTO sessions_modules(session_id, module_id, position) VALUES($1, $2, $3)", rec.s.Id, m.Id, i)
+    if nil != err {
+      return errors.New(fmt.Sprintf("Failed to create session's association with a module: %s", err))
+    }
+  }
+  return nil
+}
+
 func (rec *SessionRecord) storeSetupSteps(db *sql.DB) (int, error) {
   for i, step := range rec.s.SetupSteps {
     var err error
     if nil == step.Owner {
-      _, err = db.Exec("INSERT INTO setup_steps(session_id, setup_rule_id, player_id, done) VALUES($1, $2, $3, $4)",
-        rec.s.Id, step.Rule.Id, nil, step.Done)
+      _, err = db.Exec("INSERT INTO setup_steps(session_id, setup_rule_id, player_id, done, description, details) VALUES($1, $2, $3, $4, $5, $6)",
+        rec.s.Id, step.Rule.Id, nil, step.Done, step.Rule.Description, step.Rule.Details)
     } else {
-      _, err = db.Exec("INSERT INTO setup_steps(session_id, setup_rule_id, player_id, done) VALUES($1, $2, $3, $4)",
-        rec.s.Id, step.Rule.Id, step.Owner.Id, step.Done)
+      _, err = db.Exec("INSERT INTO setup_steps(session_id, setup_rule_id, player_id, done, description, details) VALUES($1, $2, $3, $4, $5, $6)",
+        rec.s.Id, step.Rule.Id, step.Owner.Id, step.Done, step.Rule.Description, step.Rule.Details)
     }
     if nil != err {
       return i, errors.New(fmt.Sprintf("Failed to create setup step: %s", err))
@@ -70,7 +86,11 @@ func (rec *SessionRecord) storeSetupStepAssignments(db *sql.DB) (error) {
 func (rec *SessionRecord) Create(db *sql.DB) error {
   var err error
 
-  err = db.QueryRow("INSERT INTO sessions(id, game_id) VALUES(default, $1) RETURNING id", rec.s.Game.Id).Scan(&rec.s.Id)
+  if "" == rec.Strategy {
+    rec.Strategy = assign.Default.Name()
+  }
+  err = db.QueryRow("INSERT INTO sessions(id, game_id, assignment_strategy) VALUES(default, $1, $2) RETURNING id",
+    rec.s.Game.Id, rec.Strategy).Scan(&rec.s.Id)
   if nil != err {
     return err
   }
@@ -80,6 +100,11 @@ func (rec *SessionRecord) Create(db *sql.DB) error {
     return err
   }
 
+  err = rec.storeModules(db)
+  if nil != err {
+    return err
+  }
+
   _, err = rec.storeSetupSteps(db)
   if nil != err {
     return err
@@ -99,7 +124,7 @@ func (rec *SessionRecord) Find(db *sql.DB, id int) error {
   var err error
 
   var gameId int
-  err = db.QueryRow("SELECT game_id FROM sessions WHERE id = $1", id).Scan(&gameId)
+  err = db.QueryRow("SELECT game_id, assignment_strategy FROM sessions WHERE id = $1", id).Scan(&gameId, &rec.Strategy)
   if nil != err {
     return err
   }
@@ -113,6 +138,16 @@ func (rec *SessionRecord) Find(db *sql.DB, id int) error {
   }
   rec.s.Game = g
 
+  // Set the game up with the session's modules, whose rules its steps may be for
+  rec.Modules, err = findSessionModules(db, rec.s.Id, g)
+  if nil != err {
+    return err
+  }
+  rec.s.Game, err = expansion.Apply(g, rec.Modules)
+  if nil != err {
+    return err
+  }
+
   // Eager-load the associated players
   var players = make([]*game.Player, 0)
   var playerRows *sql.Rows
@@ -137,8 +172,22 @@ func (rec *SessionRecord) Find(db *sql.DB, id int) error {
   if nil != err {
     return err
   }
+  // Leave out the rules the session wasn't set up with, as when their conditions didn't apply to its
+  // players. Its steps stay as they were set up, even if the conditions have been changed since.
+  left := make([]*game.SetupRule, 0)
+  ruleIds := setupSteps.RuleIds()
+  for _, rule := range rec.s.Game.SetupRules {
+    if !ruleIds[rule.Id] {
+      left = append(left, rule)
+    }
+  }
+  rec.s.Game, err = expansion.Remove(rec.s.Game, left)
+  if nil != err {
+    return err
+  }
   setupSteps.AssociatePlayers(rec.s.Players)
   setupSteps.AssociateRules(rec.s.Game.SetupRules)
+  setupSteps.AssociateText()
   rec.s.SetupSteps = setupSteps.List()
 
   // Eager-load setup step assignments
@@ -224,3 +273,86 @@ func (recs *SessionRecordList) FindAll(db *sql.DB) error {
 
   return nil
 }
+
+// The modules the session was started with, in order
+func findSessionModules(db *sql.DB, id uint, g *game.Game) ([]*expansion.Module, error) {
+  rows, err := db.Query("SELECT module_id FROM sessions_modules WHERE session_id = $1 ORDER BY position", id)
+  if nil != err {
+    return nil, err
+  }
+  defer rows.Close()
+  ids := make([]int, 0)
+  for rows.Next() {
+    var moduleId int
+    if err := rows.Scan(&moduleId); nil != err {
+      return nil, err
+    }
+    ids = append(ids, moduleId)
+  }
+  if err := rows.Err(); nil != err {
+    return nil, err
+  }
+  if 0 == len(ids) {
+    return []*expansion.Module{}, nil
+  }
+
+  all, err := FindModulesByGame(db, g)
+  if nil != err {
+    return nil, err
+  }
+  modules := make([]*expansion.Module, 0, len(ids))
+  for _, moduleId := range ids {
+    var found *expansion.Module
+    for _, m := range all {
+      if m.Id == moduleId {
+        found = m
+      }
+    }
+    if nil == found {
+      return nil, errors.New(fmt.Sprintf("Module %d isn't one of %s's", moduleId, g.Name))
+    }
+    modules = append(modules, found)
+  }
+  return modules, nil
+}
+
+// The names of the modules each session was started with, in order, by session ID. Sessions
+// without any are left out.
+func FindSessionModules(db *sql.DB) (map[uint][]string, error) {
+  rows, err := db.Query("SELECT sm.session_id, m.name FROM sessions_modules sm INNER JOIN game_modules m ON m.id = sm.module_id ORDER BY sm.session_id, sm.position")
+  if nil != err {
+    return nil, err
+  }
+  defer rows.Close()
+
+  names := make(map[uint][]string)
+  for rows.Next() {
+    var id uint
+    var name string
+    if err := rows.Scan(&id, &name); nil != err {
+      return nil, err
+    }
+    names[id] = append(names[id], name)
+  }
+  return names, rows.Err()
+}
+
+// The name of each session's assignment strategy, by session ID
+func FindSessionStrategies(db *sql.DB) (map[uint]string, error) {
+  rows, err := db.Query("SELECT id, assignment_strategy FROM sessions")
+  if nil != err {
+    return nil, err
+  }
+  defer rows.Close()
+
+  strategies := make(map[uint]string)
+  for rows.Next() {
+    var id uint
+    var strategy string
+    if err := rows.Scan(&id, &strategy); nil != err {
+      return nil, err
+    }
+    strategies[id] = strategy
+  }
+  return strategies, rows.Err()
+}
@@ -2,7 +2,11 @@ package record
 
 import (
   "database/sql"
+  "errors"
+  "fmt"
   _ "github.com/lib/pq"
+  "github.com/rkbodenner/meeple_mover/condition"
+  "github.com/rkbodenner/meeple_mover/quantity"
   "github.com/rkbodenner/parallel_universe/game"
   "github.com/rkbodenner/parallel_universe/session"
 )
@@ -10,11 +14,30 @@ import (
 type SetupRuleRecord struct {
   Rule *game.SetupRule
   Game *game.Game
+  ModuleId int  // Of the expansion or variant that adds the rule, or 0 for the game's own rules
+  Condition *condition.Condition  // On the number of players the rule is set up for, or nil if it always is
+  Quantities quantity.Quantities  // Values of the placeholders in its description and details
 }
 
-func (rec *SetupRuleRecord) Create(db *sql.DB) error {
-  err := db.QueryRow("INSERT INTO setup_rules(id, game_id, description, each_player, details) VALUES(default, $1, $2, $3, $4) RETURNING id",
-    rec.Game.Id, rec.Rule.Description, "Each player" == rec.Rule.Arity, rec.Rule.Details).Scan(&rec.Rule.Id)
+// The condition as it's stored, with nulls for the parts it doesn't have
+func (rec *SetupRuleRecord) conditionColumns() (sql.NullInt64, sql.NullInt64, sql.NullString) {
+  c := rec.Condition
+  if nil == c {
+    c = &condition.Condition{}
+  }
+  return sql.NullInt64{Int64: (int64)(c.MinPlayers), Valid: 0 != c.MinPlayers},
+    sql.NullInt64{Int64: (int64)(c.MaxPlayers), Valid: 0 != c.MaxPlayers},
+    sql.NullString{String: c.Expression, Valid: "" != c.Expression}
+}
+
+// Create the rule and its dependencies, which must have been created already
+func (rec *SetupRuleRecord) Create(db Queryer) error {
+  moduleId := sql.NullInt64{Int64: (int64)(rec.ModuleId), Valid: 0 != rec.ModuleId}
+  minPlayers, maxPlayers, expression := rec.conditionColumns()
+  err := db.QueryRow(`INSERT INTO setup_rules(id, game_id, description, each_player, details, module_id, min_players, max_players, condition)
+    VALUES(default, $1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+    rec.Game.Id, rec.Rule.Description, "Each player" == rec.Rule.Arity, rec.Rule.Details, moduleId,
+    minPlayers, maxPlayers, expression).Scan(&rec.Rule.Id)
   if nil != err {
     return err
   }
@@ -27,9 +50,107 @@ func (rec *SetupRuleRecord) Create(db *sql.DB) error {
     }
   }
 
+  return rec.storeQuantities(db)
+}
+
+func (rec *SetupRuleRecord) storeQuantities(db Queryer) error {
+  for name, table := range rec.Quantities {
+    for players, value := range table {
+      _, err := db.Exec("INSERT INTO setup_rule_quantities(setup_rule_id, name, players, value) VALUES($1, $2, $3, $4)",
+        rec.Rule.Id, name, players, value)
+      if nil != err {
+        return err
+      }
+    }
+  }
+  return nil
+}
+
+// Set the rule's condition, or clear it if it's nil or empty. Sessions that were already set up keep
+// the steps they have. Returns sql.ErrNoRows if there's no such rule.
+func (rec *SetupRuleRecord) UpdateCondition(db Queryer) error {
+  minPlayers, maxPlayers, expression := rec.conditionColumns()
+  result, err := db.Exec("UPDATE setup_rules SET min_players = $1, max_players = $2, condition = $3 WHERE id = $4",
+    minPlayers, maxPlayers, expression, rec.Rule.Id)
+  if nil != err {
+    return err
+  }
+  if count, err := result.RowsAffected(); nil != err {
+    return err
+  } else if 0 == count {
+    return sql.ErrNoRows
+  }
   return nil
 }
 
+// Replace the values of the rule's placeholders, all or nothing. Sessions that were already set up keep
+// the text they have. Returns sql.ErrNoRows if there's no such rule.
+func (rec *SetupRuleRecord) UpdateQuantities(db *sql.DB) error {
+  return inTransaction(db, func(tx *sql.Tx) error {
+    var id int
+    if err := tx.QueryRow("SELECT id FROM setup_rules WHERE id = $1 FOR UPDATE", rec.Rule.Id).Scan(&id); nil != err {
+      return err
+    }
+    if _, err := tx.Exec("DELETE FROM setup_rule_quantities WHERE setup_rule_id = $1", rec.Rule.Id); nil != err {
+      return err
+    }
+    return rec.storeQuantities(tx)
+  })
+}
+
+// The values of the placeholders of every rule that has any, of games and of their modules, by rule ID
+func FindQuantities(db Queryer) (map[int]quantity.Quantities, error) {
+  rows, err := db.Query("SELECT setup_rule_id, name, players, value FROM setup_rule_quantities")
+  if nil != err {
+    return nil, err
+  }
+  defer rows.Close()
+
+  quantities := make(map[int]quantity.Quantities)
+  for rows.Next() {
+    var id, players int
+    var name, value string
+    if err := rows.Scan(&id, &name, &players, &value); nil != err {
+      return nil, err
+    }
+    if _, ok := quantities[id]; !ok {
+      quantities[id] = make(quantity.Quantities)
+    }
+    if _, ok := quantities[id][name]; !ok {
+      quantities[id][name] = make(quantity.Table)
+    }
+    quantities[id][name][players] = value
+  }
+  return quantities, rows.Err()
+}
+
+// The conditions of every rule that has one, of games and of their modules, by rule ID
+func FindConditions(db Queryer) (map[int]*condition.Condition, error) {
+  rows, err := db.Query(`SELECT id, description, min_players, max_players, condition FROM setup_rules
+    WHERE min_players IS NOT NULL OR max_players IS NOT NULL OR condition IS NOT NULL`)
+  if nil != err {
+    return nil, err
+  }
+  defer rows.Close()
+
+  conditions := make(map[int]*condition.Condition)
+  for rows.Next() {
+    var id int
+    var description string
+    var minPlayers, maxPlayers sql.NullInt64
+    var expression sql.NullString
+    if err := rows.Scan(&id, &description, &minPlayers, &maxPlayers, &expression); nil != err {
+      return nil, err
+    }
+    c, err := condition.New((int)(minPlayers.Int64), (int)(maxPlayers.Int64), expression.String)
+    if nil != err {
+      return nil, errors.New(fmt.Sprintf("Rule %d %q has an invalid condition: %s", id, description, err))
+    }
+    conditions[id] = c
+  }
+  return conditions, rows.Err()
+}
+
 type SetupRuleRecordList struct {
   records []*SetupRuleRecord
 }
@@ -46,12 +167,21 @@ func (recs *SetupRuleRecordList) List() []*game.SetupRule {
   return steps
 }
 
+// Whether each player does the rule, as it's stored
+func arity(eachPlayer bool) string {
+  if eachPlayer {
+    return "Each player"
+  }
+  return "Once"
+}
+
+// Find the game's own rules, leaving out those of its expansions and variants
 func (rules *SetupRuleRecordList) FindByGame(db *sql.DB, g *game.Game) error {
   rules.records = make([]*SetupRuleRecord, 0)
   var err error
 
   var rows *sql.Rows
-  rows, err = db.Query("SELECT id, description, each_player, details FROM setup_rules WHERE game_id = $1", g.Id)
+  rows, err = db.Query("SELECT id, description, each_player, details FROM setup_rules WHERE game_id = $1 AND module_id IS NULL ORDER BY id", g.Id)
   if nil != err {
     return err
   }
@@ -64,44 +194,45 @@ func (rules *SetupRuleRecordList) FindByGame(db *sql.DB, g *game.Game) error {
     if err := rows.Scan(&record.Rule.Id, &record.Rule.Description, &eachPlayer, &details); nil != err {
       return err
     }
-    if eachPlayer {
-      record.Rule.Arity = "Each player"
-    } else {
-      record.Rule.Arity = "Once"
-    }
-    if details.Valid {
-      record.Rule.Details = details.String
-    } else {
-      record.Rule.Details = ""
-    }
+    record.Rule.Arity = arity(eachPlayer)
+    record.Rule.Details = details.String
     rules.records = append(rules.records, record)
   }
 
-  // Eager-load dependencies for the rules
-  for _, parentRec := range rules.records {
-    var depsRows *sql.Rows
-    var depCount int = 0
-    depsRows, err = db.Query("SELECT child_id FROM setup_rule_dependencies WHERE parent_id = $1", parentRec.Rule.Id)
-    if nil != err {
+  byId := make(map[int]*game.SetupRule)
+  for _, rec := range rules.records {
+    byId[rec.Rule.Id] = rec.Rule
+  }
+
+  // Eager-load dependencies for the rules. One between rules of different games is an error, rather
+  // than left out, since sessions would be set up without waiting for it. Modules' rules are loaded
+  // with the modules.
+  var depsRows *sql.Rows
+  depsRows, err = db.Query(`SELECT d.parent_id, d.child_id, p.description, c.description, p.game_id, c.game_id
+    FROM setup_rule_dependencies d
+    INNER JOIN setup_rules p ON p.id = d.parent_id
+    INNER JOIN setup_rules c ON c.id = d.child_id
+    WHERE (p.game_id = $1 OR c.game_id = $1) AND p.module_id IS NULL AND c.module_id IS NULL
+    ORDER BY d.child_id, d.parent_id`, g.Id)
+  if nil != err {
+    return err
+  }
+  defer depsRows.Close()
+  for depsRows.Next() {
+    var parentId, childId, parentGameId, childGameId int
+    var parentDesc, childDesc string
+    if err := depsRows.Scan(&parentId, &childId, &parentDesc, &childDesc, &parentGameId, &childGameId); nil != err {
       return err
     }
-    defer depsRows.Close()
-    for depsRows.Next() {
-      var childId int
-      if err := depsRows.Scan(&childId); nil != err {
-        return err
-      }
-      depCount++
-      for _, childRec := range rules.records {
-        if childRec.Rule.Id == childId {
-          childRec.Rule.Dependencies = append(childRec.Rule.Dependencies, parentRec.Rule)
-          break  // Optimization assumes unique ID
-        }
-      }
+    if parentGameId != childGameId {
+      return errors.New(fmt.Sprintf("Rule %d %q of game %d depends on rule %d %q of game %d",
+        childId, childDesc, childGameId, parentId, parentDesc, parentGameId))
     }
+    child := byId[childId]
+    child.Dependencies = append(child.Dependencies, byId[parentId])
   }
 
-  return nil
+  return depsRows.Err()
 }
 
 
@@ -111,10 +242,14 @@ type SetupStepRecord struct {
   // TODO: These are just a cache so we can associate objects we create elsewhere
   RuleId int
   OwnerId sql.NullInt64
+  // The rule's text as the step was set up, with its quantities filled in. Null for steps set up
+  // before they were kept.
+  Description sql.NullString
+  Details sql.NullString
 }
 
 // Only the 'done' field is updatable, since the rest constitute the unique primary key
-func (rec *SetupStepRecord) Update(db *sql.DB) error {
+func (rec *SetupStepRecord) Update(db Queryer) error {
   var err error
   if nil == rec.Step.Owner {
     _, err = db.Exec("UPDATE setup_steps SET done = $1 WHERE session_id = $2 AND setup_rule_id = $3 AND player_id IS NULL",
@@ -149,7 +284,7 @@ func (recs *SetupStepRecordList) SetRecords(records []*SetupStepRecord) {
 func (recs *SetupStepRecordList) FindBySession(db *sql.DB, s *session.Session) error {
   recs.records = make([]*SetupStepRecord, 0)
 
-  rows, err := db.Query("SELECT setup_rule_id, player_id, done FROM setup_steps WHERE session_id = $1", s.Id)
+  rows, err := db.Query("SELECT setup_rule_id, player_id, done, description, details FROM setup_steps WHERE session_id = $1", s.Id)
   if nil != err {
     return err
   }
@@ -157,7 +292,7 @@ func (recs *SetupStepRecordList) FindBySession(db *sql.DB, s *session.Session) e
   for rows.Next() {
     step := &game.SetupStep{}
     record := &SetupStepRecord{Step: step}
-    if err := rows.Scan(&record.RuleId, &record.OwnerId, &record.Step.Done); nil != err {
+    if err := rows.Scan(&record.RuleId, &record.OwnerId, &record.Step.Done, &record.Description, &record.Details); nil != err {
       return err
     }
     recs.records = append(recs.records, record)
@@ -166,6 +301,15 @@ func (recs *SetupStepRecordList) FindBySession(db *sql.DB, s *session.Session) e
   return nil
 }
 
+// IDs of the rules the steps are for
+func (recs *SetupStepRecordList) RuleIds() map[int]bool {
+  ids := make(map[int]bool)
+  for _, rec := range recs.records {
+    ids[rec.RuleId] = true
+  }
+  return ids
+}
+
 func (recs *SetupStepRecordList) AssociatePlayers(players []*game.Player) error {
   for _, rec := range recs.records {
     if !rec.OwnerId.Valid {
@@ -193,3 +337,19 @@ func (recs *SetupStepRecordList) AssociateRules(rules []*game.SetupRule) error {
   }
   return nil
 }
+
+// Give the steps' rules the text the steps were set up with, where they have it. Call it after
+// AssociateRules.
+func (recs *SetupStepRecordList) AssociateText() {
+  for _, rec := range recs.records {
+    if nil == rec.Step.Rule {
+      continue
+    }
+    if rec.Description.Valid {
+      rec.Step.Rule.Description = rec.Description.String
+    }
+    if rec.Details.Valid {
+      rec.Step.Rule.Details = rec.Details.String
+    }
+  }
+}
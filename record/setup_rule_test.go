@@ -0,0 +1,138 @@
+package record
+
+import (
+  "testing"
+  "github.com/rkbodenner/meeple_mover/condition"
+  "github.com/rkbodenner/meeple_mover/quantity"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+func TestSetupRuleRecord_UpdateCondition(t *testing.T) {
+  board := &game.SetupRule{Description: "Lay out the board", Arity: "Once"}
+  g := &game.Game{Name: "Condition test", MinPlayers: 1, MaxPlayers: 4, SetupRules: []*game.SetupRule{board}}
+  if err := NewGameRecord(g).Create(db); nil != err {
+    t.Fatal(err)
+  }
+
+  c, err := condition.New(2, 0, "players != 3")
+  if nil != err {
+    t.Fatal(err)
+  }
+  if err := (&SetupRuleRecord{Rule: board, Condition: c}).UpdateCondition(db); nil != err {
+    t.Fatal(err)
+  }
+  conditions, err := FindConditions(db)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if found, ok := conditions[board.Id]; !ok || 2 != found.MinPlayers || "players != 3" != found.Expression {
+    t.Errorf("Expected the condition as set, got %v", found)
+  }
+
+  if err := (&SetupRuleRecord{Rule: board, Condition: &condition.Condition{}}).UpdateCondition(db); nil != err {
+    t.Fatal(err)
+  }
+  if conditions, _ := FindConditions(db); nil != conditions[board.Id] {
+    t.Error("Expected the condition to be cleared")
+  }
+  if err := (&SetupRuleRecord{Rule: &game.SetupRule{Id: -1}, Condition: c}).UpdateCondition(db); nil == err {
+    t.Error("Expected an error for a rule that doesn't exist")
+  }
+}
+
+func TestSessionRecord_Conditions(t *testing.T) {
+  board := &game.SetupRule{Description: "Lay out the board", Arity: "Once"}
+  pawn := &game.SetupRule{Description: "Place pawn", Arity: "Each player", Dependencies: []*game.SetupRule{board}}
+  g := &game.Game{Name: "Session condition test", MinPlayers: 1, MaxPlayers: 2, SetupRules: []*game.SetupRule{board, pawn}}
+  if err := NewGameRecord(g).Create(db); nil != err {
+    t.Fatal(err)
+  }
+  twoPlayers, _ := condition.New(2, 0, "")
+  if err := (&SetupRuleRecord{Rule: board, Condition: twoPlayers}).UpdateCondition(db); nil != err {
+    t.Fatal(err)
+  }
+  alice := &game.Player{Name: "Alice"}
+  if err := (&PlayerRecord{alice}).Create(db); nil != err {
+    t.Fatal(err)
+  }
+
+  alone, err := condition.Filter(g, map[int]*condition.Condition{board.Id: twoPlayers}, 1)
+  if nil != err {
+    t.Fatal(err)
+  }
+  s, err := session.NewSession(alone, []*game.Player{alice})
+  if nil != err {
+    t.Fatal(err)
+  }
+  if err := NewSessionRecord(s).Create(db); nil != err {
+    t.Fatal(err)
+  }
+
+  // Found with the rules it was set up with, even once the condition is cleared
+  if err := (&SetupRuleRecord{Rule: board}).UpdateCondition(db); nil != err {
+    t.Fatal(err)
+  }
+  found := findTestSession(t, s.Id).s
+  if 1 != len(found.Game.SetupRules) || "Place pawn" != found.Game.SetupRules[0].Description {
+    t.Fatalf("Expected only the pawn, got %d rules", len(found.Game.SetupRules))
+  }
+  if 0 != len(found.Game.SetupRules[0].Dependencies) || found.SetupSteps[0].Rule != found.Game.SetupRules[0] {
+    t.Error("Expected the pawn's step to be for the pawn, waiting for nothing")
+  }
+}
+
+func TestSetupRuleRecord_UpdateQuantities(t *testing.T) {
+  deal := &game.SetupRule{Description: "Deal {cards} cards", Details: "{cards} face down", Arity: "Each player"}
+  g := &game.Game{Name: "Quantities test", MinPlayers: 2, MaxPlayers: 3, SetupRules: []*game.SetupRule{deal}}
+  q := quantity.Quantities{"cards": quantity.Table{2: "9", 0: "7"}}
+  if err := NewGameRecord(g).Create(db); nil != err {
+    t.Fatal(err)
+  }
+  if err := (&SetupRuleRecord{Rule: deal, Quantities: q}).UpdateQuantities(db); nil != err {
+    t.Fatal(err)
+  }
+  quantities, err := FindQuantities(db)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if found := quantities[deal.Id]; "9" != found["cards"][2] || "7" != found["cards"][0] {
+    t.Errorf("Expected the quantities as set, got %v", found)
+  }
+
+  alice := &game.Player{Name: "Alice"}
+  bob := &game.Player{Name: "Bob"}
+  for _, p := range []*game.Player{alice, bob} {
+    if err := (&PlayerRecord{p}).Create(db); nil != err {
+      t.Fatal(err)
+    }
+  }
+  rendered, err := quantity.Render(g, quantities, 2)
+  if nil != err {
+    t.Fatal(err)
+  }
+  s, err := session.NewSession(rendered, []*game.Player{alice, bob})
+  if nil != err {
+    t.Fatal(err)
+  }
+  if err := NewSessionRecord(s).Create(db); nil != err {
+    t.Fatal(err)
+  }
+
+  // Found with the text it was set up with, even once the quantities are cleared
+  if err := (&SetupRuleRecord{Rule: deal}).UpdateQuantities(db); nil != err {
+    t.Fatal(err)
+  }
+  if quantities, _ := FindQuantities(db); nil != quantities[deal.Id] {
+    t.Error("Expected the quantities to be cleared")
+  }
+  found := findTestSession(t, s.Id).s
+  for _, step := range found.SetupSteps {
+    if "Deal 9 cards" != step.Rule.Description || "9 face down" != step.Rule.Details {
+      t.Errorf("Expected the step to deal 9 cards, got %q: %q", step.Rule.Description, step.Rule.Details)
+    }
+  }
+  if err := (&SetupRuleRecord{Rule: &game.SetupRule{Id: -1}, Quantities: q}).UpdateQuantities(db); nil == err {
+    t.Error("Expected an error for a rule that doesn't exist")
+  }
+}
@@ -1,7 +1,6 @@
 package record
 
 import (
-  "database/sql"
   _ "github.com/lib/pq"
   "github.com/rkbodenner/parallel_universe/game"
   "github.com/rkbodenner/parallel_universe/session"
@@ -13,7 +12,7 @@ type SetupStepAssignmentRecord struct {
   Rule *game.SetupRule
 }
 
-func (rec *SetupStepAssignmentRecord) Create(db *sql.DB) error {
+func (rec *SetupStepAssignmentRecord) Create(db Queryer) error {
   _, err := db.Exec("INSERT INTO setup_step_assignments(session_id, player_id, setup_rule_id) VALUES($1, $2, $3)",
     rec.Session.Id, rec.Player.Id, rec.Rule.Id)
   if nil != err {
@@ -22,7 +21,7 @@ func (rec *SetupStepAssignmentRecord) Create(db *sql.DB) error {
   return nil
 }
 
-func (rec *SetupStepAssignmentRecord) Delete(db *sql.DB) error {
+func (rec *SetupStepAssignmentRecord) Delete(db Queryer) error {
   _, err := db.Exec("DELETE FROM setup_step_assignments WHERE session_id=$1 AND player_id=$2 AND setup_rule_id=$3",
     rec.Session.Id, rec.Player.Id, rec.Rule.Id)
   if nil != err {
@@ -0,0 +1,164 @@
+package record
+
+import (
+  "database/sql"
+  "time"
+  "github.com/lib/pq"
+)
+
+// A subscription to events, which are POSTed to the URL signed with the secret
+type WebhookRecord struct {
+  Id int
+  URL string
+  Secret string
+  Events []string
+  CreatedAt time.Time
+}
+
+func (rec *WebhookRecord) Create(db *sql.DB) error {
+  return db.QueryRow("INSERT INTO webhooks(id, url, secret, events) VALUES(default, $1, $2, $3) RETURNING id, created_at",
+    rec.URL, rec.Secret, pq.Array(rec.Events)).Scan(&rec.Id, &rec.CreatedAt)
+}
+
+func (rec *WebhookRecord) Find(db *sql.DB, id int) error {
+  err := db.QueryRow("SELECT url, secret, events, created_at FROM webhooks WHERE id = $1", id).Scan(
+    &rec.URL, &rec.Secret, pq.Array(&rec.Events), &rec.CreatedAt)
+  if nil == err {
+    rec.Id = id
+  }
+  return err
+}
+
+// Its deliveries are deleted too
+func (rec *WebhookRecord) Delete(db *sql.DB) error {
+  _, err := db.Exec("DELETE FROM webhooks WHERE id = $1", rec.Id)
+  return err
+}
+
+func FindAllWebhooks(db *sql.DB) ([]*WebhookRecord, error) {
+  rows, err := db.Query("SELECT id, url, secret, events, created_at FROM webhooks ORDER BY id")
+  if nil != err {
+    return nil, err
+  }
+  defer rows.Close()
+
+  recs := make([]*WebhookRecord, 0)
+  for rows.Next() {
+    rec := &WebhookRecord{}
+    if err := rows.Scan(&rec.Id, &rec.URL, &rec.Secret, pq.Array(&rec.Events), &rec.CreatedAt); nil != err {
+      return nil, err
+    }
+    recs = append(recs, rec)
+  }
+  return recs, rows.Err()
+}
+
+const (
+  DeliveryPending = "pending"
+  DeliveryDelivered = "delivered"
+  DeliveryFailed = "failed"
+)
+
+// An event to be POSTed to a webhook, and how the attempts to do so went
+type WebhookDeliveryRecord struct {
+  Id int
+  WebhookId int
+  Event string
+  Payload []byte
+  Status string
+  Attempts int
+  NextAttemptAt time.Time
+  LastAttemptAt *time.Time
+  LastStatusCode int
+  LastError string
+  CreatedAt time.Time
+
+  // From the webhook, when claimed for delivery
+  URL string
+  Secret string
+}
+
+// Queue an event for every webhook subscribed to it. Pass a transaction to queue it only if the
+// changes it reports are stored. Returns how many deliveries were queued.
+func EnqueueWebhookDeliveries(q Queryer, event string, payload []byte) (int64, error) {
+  result, err := q.Exec("INSERT INTO webhook_deliveries(webhook_id, event, payload) SELECT id, $1, $2 FROM webhooks WHERE $1 = ANY(events)",
+    event, payload)
+  if nil != err {
+    return 0, err
+  }
+  return result.RowsAffected()
+}
+
+// Take up to limit pending deliveries that are due. They aren't due again for the lease, so that
+// other servers won't take them while they're being delivered.
+func ClaimWebhookDeliveries(db *sql.DB, lease time.Duration, limit int) ([]*WebhookDeliveryRecord, error) {
+  rows, err := db.Query(`WITH due AS (
+      SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= now()
+      ORDER BY next_attempt_at LIMIT $2 FOR UPDATE SKIP LOCKED
+    )
+    UPDATE webhook_deliveries d SET next_attempt_at = now() + $1 * interval '1 second'
+    FROM due, webhooks w WHERE d.id = due.id AND w.id = d.webhook_id
+    RETURNING d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.created_at, w.url, w.secret`,
+    lease.Seconds(), limit)
+  if nil != err {
+    return nil, err
+  }
+  defer rows.Close()
+
+  recs := make([]*WebhookDeliveryRecord, 0)
+  for rows.Next() {
+    rec := &WebhookDeliveryRecord{}
+    err := rows.Scan(&rec.Id, &rec.WebhookId, &rec.Event, &rec.Payload, &rec.Status, &rec.Attempts, &rec.CreatedAt, &rec.URL, &rec.Secret)
+    if nil != err {
+      return nil, err
+    }
+    recs = append(recs, rec)
+  }
+  return recs, rows.Err()
+}
+
+// Store the outcome of an attempt
+func (rec *WebhookDeliveryRecord) Update(db *sql.DB) error {
+  var statusCode sql.NullInt64
+  if 0 != rec.LastStatusCode {
+    statusCode = sql.NullInt64{Int64: (int64)(rec.LastStatusCode), Valid: true}
+  }
+  var lastError sql.NullString
+  if "" != rec.LastError {
+    lastError = sql.NullString{String: rec.LastError, Valid: true}
+  }
+  _, err := db.Exec(`UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3,
+    last_attempt_at = $4, last_status_code = $5, last_error = $6 WHERE id = $7`,
+    rec.Status, rec.Attempts, rec.NextAttemptAt, rec.LastAttemptAt, statusCode, lastError, rec.Id)
+  return err
+}
+
+// The latest deliveries to a webhook, newest first
+func FindWebhookDeliveries(db *sql.DB, webhookId int, limit int) ([]*WebhookDeliveryRecord, error) {
+  rows, err := db.Query(`SELECT id, event, payload, status, attempts, next_attempt_at, last_attempt_at, last_status_code, last_error, created_at
+    FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2`, webhookId, limit)
+  if nil != err {
+    return nil, err
+  }
+  defer rows.Close()
+
+  recs := make([]*WebhookDeliveryRecord, 0)
+  for rows.Next() {
+    rec := &WebhookDeliveryRecord{WebhookId: webhookId}
+    var lastAttemptAt sql.NullTime
+    var statusCode sql.NullInt64
+    var lastError sql.NullString
+    err := rows.Scan(&rec.Id, &rec.Event, &rec.Payload, &rec.Status, &rec.Attempts, &rec.NextAttemptAt,
+      &lastAttemptAt, &statusCode, &lastError, &rec.CreatedAt)
+    if nil != err {
+      return nil, err
+    }
+    if lastAttemptAt.Valid {
+      rec.LastAttemptAt = &lastAttemptAt.Time
+    }
+    rec.LastStatusCode = (int)(statusCode.Int64)
+    rec.LastError = lastError.String
+    recs = append(recs, rec)
+  }
+  return recs, rows.Err()
+}
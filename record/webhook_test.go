@@ -0,0 +1,73 @@
+package record
+
+import (
+  "testing"
+  "time"
+)
+
+func TestWebhook_EnqueueAndClaim(t *testing.T) {
+  hook := &WebhookRecord{URL: "http://localhost/hook", Secret: "s3cret", Events: []string{"session.created"}}
+  err := hook.Create(db)
+  if nil != err {
+    t.Fatal(err)
+  }
+  defer hook.Delete(db)
+
+  found := &WebhookRecord{}
+  err = found.Find(db, hook.Id)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if found.URL != hook.URL || len(found.Events) != 1 || found.Events[0] != "session.created" {
+    t.Fatalf("Unexpected webhook %+v", found)
+  }
+
+  count, err := EnqueueWebhookDeliveries(db, "step.finished", []byte(`{}`))
+  if nil != err {
+    t.Fatal(err)
+  }
+  if 0 != count {
+    t.Errorf("Expected no deliveries for an event nobody subscribed to, got %d", count)
+  }
+  count, err = EnqueueWebhookDeliveries(db, "session.created", []byte(`{"session_id":1}`))
+  if nil != err {
+    t.Fatal(err)
+  }
+  if 1 != count {
+    t.Fatalf("Expected 1 delivery, got %d", count)
+  }
+
+  claimed, err := ClaimWebhookDeliveries(db, time.Minute, 10)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if len(claimed) != 1 || claimed[0].Secret != "s3cret" || string(claimed[0].Payload) != `{"session_id":1}` {
+    t.Fatalf("Expected to claim the delivery, got %+v", claimed)
+  }
+  again, err := ClaimWebhookDeliveries(db, time.Minute, 10)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if len(again) != 0 {
+    t.Fatal("Expected a claimed delivery not to be claimed again during its lease")
+  }
+
+  now := time.Now()
+  delivery := claimed[0]
+  delivery.Status = DeliveryDelivered
+  delivery.Attempts = 1
+  delivery.LastAttemptAt = &now
+  delivery.LastStatusCode = 204
+  err = delivery.Update(db)
+  if nil != err {
+    t.Fatal(err)
+  }
+
+  log, err := FindWebhookDeliveries(db, hook.Id, 10)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if len(log) != 1 || log[0].Status != DeliveryDelivered || log[0].LastStatusCode != 204 {
+    t.Fatalf("Unexpected delivery log %+v", log)
+  }
+}
@@ -0,0 +1,122 @@
+/*
+
+Generate a self-signed TLS certificate, for serving HTTPS where there's no certificate authority handy,
+like a LAN at game night. Browsers will ask to trust it once.
+
+*/
+
+package selfsigned
+
+import (
+  "crypto/ecdsa"
+  "crypto/elliptic"
+  "crypto/rand"
+  "crypto/x509"
+  "crypto/x509/pkix"
+  "encoding/pem"
+  "errors"
+  "fmt"
+  "math/big"
+  "net"
+  "os"
+  "time"
+)
+
+const Validity = 2 * 365 * 24 * time.Hour
+
+// Write a new certificate valid for the given host names and IP addresses, and its private key, as PEM files
+func Generate(certFile string, keyFile string, hosts []string) error {
+  key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+  if nil != err {
+    return err
+  }
+
+  serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+  if nil != err {
+    return err
+  }
+
+  now := time.Now()
+  template := &x509.Certificate{
+    SerialNumber: serial,
+    Subject: pkix.Name{Organization: []string{"meeple_mover"}, CommonName: "meeple_mover self-signed"},
+    NotBefore: now.Add(-time.Hour),
+    NotAfter: now.Add(Validity),
+    KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+    ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+    BasicConstraintsValid: true,
+    IsCA: true,
+  }
+  for _, host := range hosts {
+    if ip := net.ParseIP(host); nil != ip {
+      template.IPAddresses = append(template.IPAddresses, ip)
+    } else {
+      template.DNSNames = append(template.DNSNames, host)
+    }
+  }
+
+  der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+  if nil != err {
+    return err
+  }
+  keyDer, err := x509.MarshalECPrivateKey(key)
+  if nil != err {
+    return err
+  }
+
+  err = writePEM(keyFile, "EC PRIVATE KEY", keyDer, 0600)
+  if nil != err {
+    return err
+  }
+  return writePEM(certFile, "CERTIFICATE", der, 0644)
+}
+
+// Generate a certificate unless both files already exist. Returns whether one was generated.
+func Ensure(certFile string, keyFile string, hosts []string) (bool, error) {
+  _, certErr := os.Stat(certFile)
+  _, keyErr := os.Stat(keyFile)
+  if nil == certErr && nil == keyErr {
+    return false, nil
+  }
+  if !errors.Is(certErr, os.ErrNotExist) && nil != certErr {
+    return false, certErr
+  }
+  if !errors.Is(keyErr, os.ErrNotExist) && nil != keyErr {
+    return false, keyErr
+  }
+  if nil == certErr || nil == keyErr {
+    return false, errors.New(fmt.Sprintf("Only one of %s and %s exists. Remove it to generate a new certificate.", certFile, keyFile))
+  }
+  return true, Generate(certFile, keyFile, hosts)
+}
+
+// Names a machine on a LAN is likely to be reached by: localhost, its host name, and its addresses
+func LocalHosts() []string {
+  hosts := []string{"localhost", "127.0.0.1", "::1"}
+  if name, err := os.Hostname(); nil == err {
+    hosts = append(hosts, name)
+  }
+  addrs, err := net.InterfaceAddrs()
+  if nil != err {
+    return hosts
+  }
+  for _, addr := range addrs {
+    if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+      hosts = append(hosts, ipNet.IP.String())
+    }
+  }
+  return hosts
+}
+
+func writePEM(path string, blockType string, der []byte, mode os.FileMode) error {
+  f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+  if nil != err {
+    return err
+  }
+  err = pem.Encode(f, &pem.Block{Type: blockType, Bytes: der})
+  if nil != err {
+    f.Close()
+    return err
+  }
+  return f.Close()
+}
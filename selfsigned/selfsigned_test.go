@@ -0,0 +1,68 @@
+package selfsigned
+
+import (
+  "crypto/tls"
+  "crypto/x509"
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+func TestEnsure(t *testing.T) {
+  dir := t.TempDir()
+  certFile := filepath.Join(dir, "cert.pem")
+  keyFile := filepath.Join(dir, "key.pem")
+
+  created, err := Ensure(certFile, keyFile, []string{"gamenight.local", "192.168.1.10"})
+  if nil != err {
+    t.Fatal(err)
+  }
+  if !created {
+    t.Fatal("Expected certificate to be generated")
+  }
+
+  pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+  if nil != err {
+    t.Fatal(err)
+  }
+  cert, err := x509.ParseCertificate(pair.Certificate[0])
+  if nil != err {
+    t.Fatal(err)
+  }
+  if err := cert.VerifyHostname("gamenight.local"); nil != err {
+    t.Fatal(err)
+  }
+  if err := cert.VerifyHostname("192.168.1.10"); nil != err {
+    t.Fatal(err)
+  }
+
+  info, err := os.Stat(keyFile)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if info.Mode().Perm() != 0600 {
+    t.Fatalf("Private key should only be readable by its owner, has mode %s", info.Mode())
+  }
+
+  created, err = Ensure(certFile, keyFile, nil)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if created {
+    t.Fatal("Expected existing certificate to be kept")
+  }
+}
+
+func TestEnsure_OnlyOneFile(t *testing.T) {
+  dir := t.TempDir()
+  certFile := filepath.Join(dir, "cert.pem")
+  err := os.WriteFile(certFile, []byte("junk"), 0644)
+  if nil != err {
+    t.Fatal(err)
+  }
+
+  _, err = Ensure(certFile, filepath.Join(dir, "key.pem"), nil)
+  if nil == err {
+    t.Fatal("Expected error when only the certificate exists")
+  }
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+  "context"
+  "crypto/tls"
+  "errors"
+  "fmt"
+  "net"
+  "net/http"
+  "os"
+  "os/signal"
+  "strings"
+  "sync"
+  "syscall"
+  "time"
+  "github.com/rkbodenner/meeple_mover/selfsigned"
+  "google.golang.org/grpc"
+)
+
+const (
+  readHeaderTimeout = 5 * time.Second
+  readTimeout = 15 * time.Second
+  writeTimeout = 30 * time.Second
+  idleTimeout = 2 * time.Minute
+
+  // Heroku kills the process 30 seconds after SIGTERM
+  shutdownTimeout = 25 * time.Second
+)
+
+func newHTTPServer(addr string, h http.Handler) *http.Server {
+  return &http.Server{
+    Addr: addr,
+    Handler: h,
+    ReadHeaderTimeout: readHeaderTimeout,
+    ReadTimeout: readTimeout,
+    WriteTimeout: writeTimeout,
+    IdleTimeout: idleTimeout,
+  }
+}
+
+// Where to find the certificate for serving HTTPS, configured by environment variables
+type tlsOptions struct {
+  certFile string
+  keyFile string
+  selfSigned bool
+  hosts []string  // Extra names for a self-signed certificate
+  port string
+}
+
+func tlsOptionsFromEnv() tlsOptions {
+  opts := tlsOptions{
+    certFile: os.Getenv("MEEPLE_MOVER_TLS_CERT_FILE"),
+    keyFile: os.Getenv("MEEPLE_MOVER_TLS_KEY_FILE"),
+    selfSigned: "true" == os.Getenv("MEEPLE_MOVER_TLS_SELF_SIGNED"),
+    port: os.Getenv("MEEPLE_MOVER_TLS_PORT"),
+  }
+  if hosts := os.Getenv("MEEPLE_MOVER_TLS_HOSTS"); "" != hosts {
+    opts.hosts = strings.Split(hosts, ",")
+  }
+  if opts.selfSigned {
+    if "" == opts.certFile {
+      opts.certFile = "meeple_mover.crt"
+    }
+    if "" == opts.keyFile {
+      opts.keyFile = "meeple_mover.key"
+    }
+  }
+  if "" == opts.port {
+    opts.port = "8443"
+  }
+  return opts
+}
+
+func (opts tlsOptions) enabled() bool {
+  return "" != opts.certFile && "" != opts.keyFile
+}
+
+// An HTTPS server, generating a self-signed certificate first if asked to and there isn't one yet
+func newTLSServer(opts tlsOptions, h http.Handler) (*http.Server, error) {
+  if opts.selfSigned {
+    hosts := append(selfsigned.LocalHosts(), opts.hosts...)
+    created, err := selfsigned.Ensure(opts.certFile, opts.keyFile, hosts)
+    if nil != err {
+      return nil, errors.New(fmt.Sprintf("Could not generate self-signed certificate: %s", err))
+    }
+    if created {
+      glog.Info("Generated self-signed certificate", "cert_file", opts.certFile, "key_file", opts.keyFile, "hosts", hosts)
+    }
+  }
+
+  // Load now rather than when serving, so a bad certificate stops startup
+  cert, err := tls.LoadX509KeyPair(opts.certFile, opts.keyFile)
+  if nil != err {
+    return nil, errors.New(fmt.Sprintf("Could not load TLS certificate: %s", err))
+  }
+
+  srv := newHTTPServer(fmt.Sprintf(":%s", opts.port), h)
+  srv.TLSConfig = &tls.Config{
+    Certificates: []tls.Certificate{cert},
+    MinVersion: tls.VersionTLS12,
+  }
+  return srv, nil
+}
+
+// Send plain HTTP requests to the same path over HTTPS. The probes are still served directly,
+// so supervisors needn't trust the certificate.
+func redirectToHTTPS(tlsPort string, h http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if "/healthz" == r.URL.Path || "/readyz" == r.URL.Path {
+      h.ServeHTTP(w, r)
+      return
+    }
+
+    host := r.Host
+    if hostOnly, _, err := net.SplitHostPort(r.Host); nil == err {
+      host = hostOnly
+    }
+    if "443" != tlsPort {
+      host = net.JoinHostPort(host, tlsPort)
+    }
+    http.Redirect(w, r, "https://" + host + r.URL.RequestURI(), http.StatusPermanentRedirect)
+  })
+}
+
+// An HTTP or gRPC server that serveUntilSignalled can run and drain
+type server interface {
+  ListenAndServe() error
+  Shutdown(ctx context.Context) error
+}
+
+// Serves gRPC until shut down, in the way serveUntilSignalled expects of its servers
+type grpcListener struct {
+  srv *grpc.Server
+  addr string
+}
+
+func (l *grpcListener) ListenAndServe() error {
+  lis, err := net.Listen("tcp", l.addr)
+  if nil != err {
+    return err
+  }
+  glog.Info("Listening for gRPC", "addr", l.addr)
+  return l.srv.Serve(lis)
+}
+
+// Wait for calls in flight to finish, cancelling them if they haven't by the deadline
+func (l *grpcListener) Shutdown(ctx context.Context) error {
+  stopped := make(chan struct{})
+  go func() {
+    l.srv.GracefulStop()
+    close(stopped)
+  }()
+  select {
+  case <-stopped:
+    return nil
+  case <-ctx.Done():
+    l.srv.Stop()
+    return fmt.Errorf("gRPC calls still in flight at shutdown: %s", ctx.Err())
+  }
+}
+
+// Serve until SIGTERM or SIGINT, then stop accepting connections and wait for in-flight requests to finish.
+// HTTP servers with a TLSConfig serve HTTPS. Returns nil after a clean shutdown.
+// Calls draining as shutdown starts, to end the requests that servers won't interrupt, like streams.
+func serveUntilSignalled(draining func(), servers ...server) error {
+  errs := make(chan error, len(servers))
+  for _, srv := range servers {
+    go func(srv server) {
+      httpSrv, ok := srv.(*http.Server)
+      switch {
+      case ok && nil != httpSrv.TLSConfig:
+        glog.Info("Listening for HTTPS", "addr", httpSrv.Addr)
+        errs <- httpSrv.ListenAndServeTLS("", "")
+      case ok:
+        glog.Info("Listening for HTTP", "addr", httpSrv.Addr)
+        errs <- httpSrv.ListenAndServe()
+      default:
+        errs <- srv.ListenAndServe()
+      }
+    }(srv)
+  }
+
+  signals := make(chan os.Signal, 1)
+  signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+  defer signal.Stop(signals)
+
+  var failed error
+  select {
+  case failed = <-errs:
+    glog.Error("Shutting down after server failed", "error", failed)
+  case sig := <-signals:
+    glog.Info("Shutting down, draining in-flight requests", "signal", sig.String(), "timeout", shutdownTimeout.String())
+  }
+  draining()
+
+  ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+  defer cancel()
+  var wg sync.WaitGroup
+  shutdownErrs := make(chan error, len(servers))
+  for _, srv := range servers {
+    wg.Add(1)
+    go func(srv server) {
+      defer wg.Done()
+      shutdownErrs <- srv.Shutdown(ctx)
+    }(srv)
+  }
+  wg.Wait()
+  close(shutdownErrs)
+
+  if nil != failed {
+    return failed
+  }
+  for err := range shutdownErrs {
+    if nil != err {
+      return err
+    }
+  }
+  return nil
+}
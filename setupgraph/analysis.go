@@ -0,0 +1,397 @@
+package setupgraph
+
+import (
+  "errors"
+  "fmt"
+  "sort"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// How setting up a game goes, if each step takes a round and each player does at most one step a round
+type Analysis struct {
+  Players int `json:"players"`
+  // The longest chain of rules, each waiting on the one before. Setup takes at least this many rounds.
+  CriticalPath []string `json:"critical_path"`
+  // Setup takes no fewer rounds with more players than this. Filled in from MaxUsefulPlayers.
+  MaxUsefulPlayers int `json:"max_useful_players"`
+  // Rules on a critical path that others wait on, those with the most waiting first
+  Bottlenecks []Bottleneck `json:"bottlenecks"`
+  // Rounds setup takes with the number of players, each picking the step with the longest chain after it
+  Rounds int `json:"rounds"`
+}
+
+type Bottleneck struct {
+  Rule string `json:"rule"`
+  // Rules that can't be done until this one is, directly or not
+  Waiting int `json:"waiting"`
+}
+
+// Rules depending on each rule, directly, among the rules
+func dependents(rules []*game.SetupRule) map[*game.SetupRule][]*game.SetupRule {
+  inList := make(map[*game.SetupRule]bool)
+  for _, rule := range rules {
+    inList[rule] = true
+  }
+  children := make(map[*game.SetupRule][]*game.SetupRule)
+  for _, rule := range rules {
+    for _, dep := range rule.Dependencies {
+      if inList[dep] {
+        children[dep] = append(children[dep], rule)
+      }
+    }
+  }
+  return children
+}
+
+// The length of the longest chain of rules ending with each rule, and starting with it.
+// The rules must be sorted.
+func depths(sorted []*game.SetupRule) (map[*game.SetupRule]int, map[*game.SetupRule]int) {
+  children := dependents(sorted)
+  depth := make(map[*game.SetupRule]int)
+  for _, rule := range sorted {
+    depth[rule] = 1
+    for _, dep := range rule.Dependencies {
+      if d, ok := depth[dep]; ok && d + 1 > depth[rule] {
+        depth[rule] = d + 1
+      }
+    }
+  }
+  height := make(map[*game.SetupRule]int)
+  for i := len(sorted) - 1; i >= 0; i-- {
+    rule := sorted[i]
+    height[rule] = 1
+    for _, child := range children[rule] {
+      if height[child] + 1 > height[rule] {
+        height[rule] = height[child] + 1
+      }
+    }
+  }
+  return depth, height
+}
+
+// The longest chain of rules, each waiting on the one before, earliest first
+func CriticalPath(rules []*game.SetupRule) ([]*game.SetupRule, error) {
+  sorted, err := SortRules(rules)
+  if nil != err {
+    return nil, err
+  }
+  if 0 == len(sorted) {
+    return []*game.SetupRule{}, nil
+  }
+  depth, _ := depths(sorted)
+
+  last := sorted[0]
+  for _, rule := range sorted {
+    if depth[rule] > depth[last] {
+      last = rule
+    }
+  }
+  path := make([]*game.SetupRule, depth[last])
+  for i := len(path) - 1; i >= 0; i-- {
+    path[i] = last
+    for _, dep := range last.Dependencies {
+      if d, ok := depth[dep]; ok && d == depth[last] - 1 {
+        last = dep
+        break
+      }
+    }
+  }
+  return path, nil
+}
+
+// Rules that can't be done until the rule is, directly or not
+func waitingOn(children map[*game.SetupRule][]*game.SetupRule, rule *game.SetupRule, seen map[*game.SetupRule]bool) int {
+  n := 0
+  for _, child := range children[rule] {
+    if !seen[child] {
+      seen[child] = true
+      n += 1 + waitingOn(children, child, seen)
+    }
+  }
+  return n
+}
+
+// Rules on a critical path that others wait on, those with the most waiting first
+func Bottlenecks(rules []*game.SetupRule) ([]Bottleneck, error) {
+  sorted, err := SortRules(rules)
+  if nil != err {
+    return nil, err
+  }
+  depth, height := depths(sorted)
+  longest := 0
+  for _, rule := range sorted {
+    if depth[rule] > longest {
+      longest = depth[rule]
+    }
+  }
+
+  children := dependents(sorted)
+  bottlenecks := make([]Bottleneck, 0)
+  for _, rule := range rules {
+    // A rule on a critical path can't wait a round without setup taking a round longer
+    if depth[rule] + height[rule] - 1 != longest {
+      continue
+    }
+    if waiting := waitingOn(children, rule, make(map[*game.SetupRule]bool)); waiting > 0 {
+      bottlenecks = append(bottlenecks, Bottleneck{rule.Description, waiting})
+    }
+  }
+  sort.SliceStable(bottlenecks, func(i, j int) bool { return bottlenecks[i].Waiting > bottlenecks[j].Waiting })
+  return bottlenecks, nil
+}
+
+// Rounds it takes the players to finish the steps that aren't done, if each does at most one step a
+// round, picking from the steps they could do the one with the longest chain of rules after it
+func EstimateRounds(steps []*game.SetupStep, players []*game.Player) (int, error) {
+  rules := make([]*game.SetupRule, 0)
+  seenRule := make(map[*game.SetupRule]bool)
+  for _, step := range steps {
+    if !seenRule[step.Rule] {
+      seenRule[step.Rule] = true
+      rules = append(rules, step.Rule)
+    }
+  }
+  sorted, err := SortRules(rules)
+  if nil != err {
+    return 0, err
+  }
+  _, height := depths(sorted)
+
+  done := make(map[*game.SetupStep]bool)
+  left := 0
+  for _, step := range steps {
+    if step.Done {
+      done[step] = true
+    } else {
+      left++
+    }
+  }
+
+  rounds := 0
+  for left > 0 {
+    available := make([]*game.SetupStep, 0)
+    for _, step := range steps {
+      if !done[step] && ready(steps, step, done) {
+        available = append(available, step)
+      }
+    }
+
+    taken := make([]*game.SetupStep, 0)
+    for _, p := range players {
+      var next *game.SetupStep
+      for _, step := range available {
+        if !step.CanBeOwnedBy(p) || contains(taken, step) {
+          continue
+        }
+        if nil == next || height[step.Rule] > height[next.Rule] {
+          next = step
+        }
+      }
+      if nil != next {
+        taken = append(taken, next)
+      }
+    }
+    if 0 == len(taken) {
+      for _, step := range steps {
+        if !done[step] {
+          return rounds, errors.New(fmt.Sprintf("None of the players can do %q", step.Rule.Description))
+        }
+      }
+    }
+
+    for _, step := range taken {
+      done[step] = true
+    }
+    left -= len(taken)
+    rounds++
+  }
+  return rounds, nil
+}
+
+// Whether every step of the rules the step depends on is done
+func ready(steps []*game.SetupStep, step *game.SetupStep, done map[*game.SetupStep]bool) bool {
+  for _, dep := range step.Rule.Dependencies {
+    for _, other := range steps {
+      if other.Rule == dep && !done[other] {
+        return false
+      }
+    }
+  }
+  return true
+}
+
+func contains(steps []*game.SetupStep, step *game.SetupStep) bool {
+  for _, other := range steps {
+    if other == step {
+      return true
+    }
+  }
+  return false
+}
+
+// Players named Player 1, Player 2, etc., and the steps a session of the game would give them
+func gameSteps(g *game.Game, playerCount int) ([]*game.SetupStep, []*game.Player, error) {
+  players := make([]*game.Player, playerCount)
+  for i := range players {
+    players[i] = &game.Player{Id: i + 1, Name: fmt.Sprintf("Player %d", i + 1)}
+  }
+  s, err := session.NewSession(g, players)
+  if nil != err {
+    return nil, nil, err
+  }
+  return s.SetupSteps, players, nil
+}
+
+func descriptions(rules []*game.SetupRule) []string {
+  list := make([]string, len(rules))
+  for i, rule := range rules {
+    list[i] = rule.Description
+  }
+  return list
+}
+
+// Analyze setting up the game for the number of players, other than how many players are useful
+func AnalyzeGame(g *game.Game, playerCount int) (*Analysis, error) {
+  if playerCount < 1 {
+    return nil, errors.New(fmt.Sprintf("Expected at least 1 player, not %d", playerCount))
+  }
+  path, err := CriticalPath(g.SetupRules)
+  if nil != err {
+    return nil, err
+  }
+  bottlenecks, err := Bottlenecks(g.SetupRules)
+  if nil != err {
+    return nil, err
+  }
+  analysis := &Analysis{Players: playerCount, CriticalPath: descriptions(path), Bottlenecks: bottlenecks}
+
+  steps, players, err := gameSteps(g, playerCount)
+  if nil != err {
+    return nil, err
+  }
+  if analysis.Rounds, err = EstimateRounds(steps, players); nil != err {
+    return nil, err
+  }
+  return analysis, nil
+}
+
+// The fewest players the game is for that set it up in as few rounds as any number it's for.
+// forPlayers gives the game as it's set up for a number of players, or nil for the game as it is.
+// A game without a maximum is only tried with its minimum.
+func MaxUsefulPlayers(g *game.Game, forPlayers func(players int) (*game.Game, error)) (int, error) {
+  min, max := g.MinPlayers, g.MaxPlayers
+  if min < 1 {
+    min = 1
+  }
+  if max < min {
+    max = min
+  }
+
+  useful, fewest := min, -1
+  for n := min; n <= max; n++ {
+    setUp := g
+    if nil != forPlayers {
+      var err error
+      if setUp, err = forPlayers(n); nil != err {
+        return 0, err
+      }
+    }
+    steps, players, err := gameSteps(setUp, n)
+    if nil != err {
+      return 0, err
+    }
+    rounds, err := EstimateRounds(steps, players)
+    if nil != err {
+      return 0, err
+    }
+    if fewest < 0 || rounds < fewest {
+      fewest = rounds
+      useful = n
+    }
+  }
+  return useful, nil
+}
+
+// Where a session's setup stands, if each step takes a round and each player does at most one step a round
+type SessionAnalysis struct {
+  // Rounds the session's players need to finish setup, as estimated for a game
+  RoundsLeft int `json:"rounds_left"`
+  // The longest chain of rules with steps still to do
+  CriticalPath []string `json:"critical_path"`
+  // Unfinished steps that others wait on, those with the most waiting first
+  Blocking []BlockingStep `json:"blocking"`
+}
+
+type BlockingStep struct {
+  Step string `json:"step"`
+  Owner string `json:"owner,omitempty"`  // For a step each player does
+  Assignee string `json:"assignee,omitempty"`
+  Ready bool `json:"ready"`  // Nothing it depends on is left to do
+  // Unfinished steps that can't be done until this one is, directly or not
+  Waiting int `json:"waiting"`
+}
+
+// Unfinished steps that can't be done until the step is, directly or not
+func Waiting(steps []*game.SetupStep, step *game.SetupStep) int {
+  rules := make([]*game.SetupRule, 0)
+  seen := make(map[*game.SetupRule]bool)
+  for _, other := range steps {
+    if !seen[other.Rule] {
+      seen[other.Rule] = true
+      rules = append(rules, other.Rule)
+    }
+  }
+  after := make(map[*game.SetupRule]bool)
+  waitingOn(dependents(rules), step.Rule, after)
+
+  n := 0
+  for _, other := range steps {
+    if !other.Done && after[other.Rule] {
+      n++
+    }
+  }
+  return n
+}
+
+// Analyze what's left of the session's setup
+func AnalyzeSession(s *session.Session) (*SessionAnalysis, error) {
+  left := make([]*game.SetupRule, 0)
+  seen := make(map[*game.SetupRule]bool)
+  for _, step := range s.SetupSteps {
+    if !step.Done && !seen[step.Rule] {
+      seen[step.Rule] = true
+      left = append(left, step.Rule)
+    }
+  }
+  path, err := CriticalPath(left)
+  if nil != err {
+    return nil, err
+  }
+  analysis := &SessionAnalysis{CriticalPath: descriptions(path), Blocking: make([]BlockingStep, 0)}
+  if analysis.RoundsLeft, err = EstimateRounds(s.SetupSteps, s.Players); nil != err {
+    return nil, err
+  }
+
+  for _, step := range s.SetupSteps {
+    if step.Done {
+      continue
+    }
+    waiting := Waiting(s.SetupSteps, step)
+    if 0 == waiting {
+      continue
+    }
+    blocking := BlockingStep{Step: step.Rule.Description, Ready: 0 == len(Blockers(s.SetupSteps, step)), Waiting: waiting}
+    if nil != step.Owner {
+      blocking.Owner = step.Owner.Name
+    }
+    for _, p := range s.Players {
+      if current, ok := s.SetupAssignments.Get(p); ok && current == step {
+        blocking.Assignee = p.Name
+      }
+    }
+    analysis.Blocking = append(analysis.Blocking, blocking)
+  }
+  sort.SliceStable(analysis.Blocking, func(i, j int) bool { return analysis.Blocking[i].Waiting > analysis.Blocking[j].Waiting })
+  return analysis, nil
+}
@@ -0,0 +1,105 @@
+package setupgraph
+
+import (
+  "reflect"
+  "testing"
+  "github.com/rkbodenner/parallel_universe/game"
+  "github.com/rkbodenner/parallel_universe/session"
+)
+
+// Lay out the board and shuffle, then each player places a pawn on the board and is dealt cards, then start
+func analysisGame() *game.Game {
+  board := &game.SetupRule{Id: 1, Description: "Lay out the board", Arity: "Once"}
+  shuffle := &game.SetupRule{Id: 2, Description: "Shuffle", Arity: "Once"}
+  pawn := &game.SetupRule{Id: 3, Description: "Place pawn", Arity: "Each player", Dependencies: []*game.SetupRule{board}}
+  deal := &game.SetupRule{Id: 4, Description: "Deal cards", Arity: "Each player", Dependencies: []*game.SetupRule{shuffle}}
+  start := &game.SetupRule{Id: 5, Description: "Start", Arity: "Once", Dependencies: []*game.SetupRule{pawn, deal}}
+  return &game.Game{Id: 1, Name: "Test", MinPlayers: 1, MaxPlayers: 4, SetupRules: []*game.SetupRule{board, shuffle, pawn, deal, start}}
+}
+
+func TestAnalyzeGame(t *testing.T) {
+  analysis, err := AnalyzeGame(analysisGame(), 2)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if !reflect.DeepEqual(analysis.CriticalPath, []string{"Lay out the board", "Place pawn", "Start"}) {
+    t.Errorf("Unexpected critical path %v", analysis.CriticalPath)
+  }
+  expected := []Bottleneck{{"Lay out the board", 2}, {"Shuffle", 2}, {"Place pawn", 1}, {"Deal cards", 1}}
+  if !reflect.DeepEqual(analysis.Bottlenecks, expected) {
+    t.Errorf("Expected bottlenecks %v, got %v", expected, analysis.Bottlenecks)
+  }
+  // The board and shuffle, the pawns, the cards, then start
+  if 4 != analysis.Rounds {
+    t.Errorf("Expected 4 rounds, got %d", analysis.Rounds)
+  }
+  if alone, err := AnalyzeGame(analysisGame(), 1); nil != err || 5 != alone.Rounds {
+    t.Errorf("Expected one player to take a round for each of their 5 steps, got %v, %v", alone, err)
+  }
+}
+
+func TestMaxUsefulPlayers(t *testing.T) {
+  // A third player would only bring a pawn and cards of their own
+  if useful, err := MaxUsefulPlayers(analysisGame(), nil); nil != err || 2 != useful {
+    t.Errorf("Expected 2 useful players, got %d, %v", useful, err)
+  }
+
+  // Two would help, but the game is only for one
+  solo := analysisGame()
+  solo.MaxPlayers = 1
+  if useful, err := MaxUsefulPlayers(solo, nil); nil != err || 1 != useful {
+    t.Errorf("Expected no more useful players than the game is for, got %d, %v", useful, err)
+  }
+
+  // Only tried with the numbers the game is for, as set up for each
+  tried := make([]int, 0)
+  crowd := analysisGame()
+  crowd.MinPlayers = 3
+  useful, err := MaxUsefulPlayers(crowd, func(players int) (*game.Game, error) {
+    tried = append(tried, players)
+    return crowd, nil
+  })
+  if nil != err || 3 != useful || !reflect.DeepEqual(tried, []int{3, 4}) {
+    t.Errorf("Expected 3 useful players from trying 3 and 4, got %d from %v, %v", useful, tried, err)
+  }
+}
+
+func TestAnalyzeGame_Cycle(t *testing.T) {
+  g := analysisGame()
+  g.SetupRules[0].Dependencies = []*game.SetupRule{g.SetupRules[4]}
+  if _, err := AnalyzeGame(g, 2); nil == err {
+    t.Error("Expected an error for a cycle")
+  }
+}
+
+func TestAnalyzeSession(t *testing.T) {
+  alice := &game.Player{Id: 1, Name: "Alice"}
+  bob := &game.Player{Id: 2, Name: "Bob"}
+  s, err := session.NewSession(analysisGame(), []*game.Player{alice, bob})
+  if nil != err {
+    t.Fatal(err)
+  }
+  s.SetupSteps[0].Done = true
+  s.SetupAssignments.Set(bob, s.SetupSteps[1])
+
+  analysis, err := AnalyzeSession(s)
+  if nil != err {
+    t.Fatal(err)
+  }
+  if 4 != analysis.RoundsLeft {
+    t.Errorf("Expected 4 rounds left, got %d", analysis.RoundsLeft)
+  }
+  if !reflect.DeepEqual(analysis.CriticalPath, []string{"Shuffle", "Deal cards", "Start"}) {
+    t.Errorf("Unexpected critical path %v", analysis.CriticalPath)
+  }
+  if 5 != len(analysis.Blocking) {
+    t.Fatalf("Expected the shuffle, pawns and cards to be blocking, got %v", analysis.Blocking)
+  }
+  expected := BlockingStep{Step: "Shuffle", Assignee: "Bob", Ready: true, Waiting: 3}
+  if analysis.Blocking[0] != expected {
+    t.Errorf("Expected %+v first, got %+v", expected, analysis.Blocking[0])
+  }
+  if "Alice" != analysis.Blocking[1].Owner || 1 != analysis.Blocking[1].Waiting {
+    t.Errorf("Expected Alice's pawn to hold up the start, got %+v", analysis.Blocking[1])
+  }
+}
@@ -0,0 +1,112 @@
+package setupgraph
+
+import (
+  "fmt"
+  "strings"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+// The problems that keep a game's rules from being set up, each naming the rules at fault
+type IntegrityError struct {
+  Game string
+  Problems []string
+}
+
+func (err *IntegrityError) Error() string {
+  return fmt.Sprintf("%s has invalid rules: %s", err.Game, strings.Join(err.Problems, "; "))
+}
+
+func (err *IntegrityError) add(format string, args ...interface{}) {
+  err.Problems = append(err.Problems, fmt.Sprintf(format, args...))
+}
+
+// A chain of dependencies that leads back to where it started, starting and ending with the same
+// rule, or nil if there's none. Rules depending on themselves are left to CheckGame.
+func FindCycle(rules []*game.SetupRule) []*game.SetupRule {
+  const (
+    unvisited = iota
+    visiting
+    visited
+  )
+  state := make(map[*game.SetupRule]int)
+  path := make([]*game.SetupRule, 0)
+
+  var visit func(rule *game.SetupRule) []*game.SetupRule
+  visit = func(rule *game.SetupRule) []*game.SetupRule {
+    state[rule] = visiting
+    path = append(path, rule)
+    for _, dep := range rule.Dependencies {
+      if dep == rule || nil == dep {
+        continue
+      }
+      switch state[dep] {
+      case visiting:
+        for i, onPath := range path {
+          if onPath == dep {
+            return append(append([]*game.SetupRule{}, path[i:]...), dep)
+          }
+        }
+      case unvisited:
+        if cycle := visit(dep); nil != cycle {
+          return cycle
+        }
+      }
+    }
+    path = path[:len(path) - 1]
+    state[rule] = visited
+    return nil
+  }
+
+  for _, rule := range rules {
+    if unvisited == state[rule] {
+      if cycle := visit(rule); nil != cycle {
+        return cycle
+      }
+    }
+  }
+  return nil
+}
+
+// Check that the game's rules can be set up: no rule may depend on itself, on a rule of another game,
+// or on rules that depend on it in turn, and no two rules may share a description, since steps are
+// found by it. Returns an *IntegrityError listing every problem found.
+func CheckGame(g *game.Game) error {
+  problems := &IntegrityError{Game: g.Name}
+
+  inGame := make(map[*game.SetupRule]bool)
+  described := make(map[string]int)
+  for i, rule := range g.SetupRules {
+    inGame[rule] = true
+    if first, ok := described[rule.Description]; ok {
+      problems.add("Rules %d and %d of the game are both described %q", first + 1, i + 1, rule.Description)
+    } else {
+      described[rule.Description] = i
+    }
+  }
+
+  for _, rule := range g.SetupRules {
+    for _, dep := range rule.Dependencies {
+      switch {
+      case nil == dep:
+        problems.add("%q depends on a missing rule", rule.Description)
+      case dep == rule:
+        problems.add("%q depends on itself", rule.Description)
+      case !inGame[dep]:
+        problems.add("%q depends on %q, which isn't one of the game's rules", rule.Description, dep.Description)
+      }
+    }
+  }
+
+  if cycle := FindCycle(g.SetupRules); nil != cycle {
+    names := make([]string, len(cycle))
+    for i, rule := range cycle {
+      names[i] = fmt.Sprintf("%q", rule.Description)
+    }
+    problems.add("Dependencies form a cycle: %s", strings.Join(names, " depends on "))
+  }
+
+  if len(problems.Problems) > 0 {
+    return problems
+  }
+  return nil
+}
@@ -0,0 +1,70 @@
+package setupgraph
+
+import (
+  "strings"
+  "testing"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+func problems(t *testing.T, g *game.Game) []string {
+  err := CheckGame(g)
+  if nil == err {
+    t.Fatal("Expected the game to be rejected")
+  }
+  integrity, ok := err.(*IntegrityError)
+  if !ok {
+    t.Fatalf("Expected an *IntegrityError, got %v", err)
+  }
+  return integrity.Problems
+}
+
+func expectProblem(t *testing.T, g *game.Game, expected string) {
+  found := problems(t, g)
+  if 1 != len(found) || expected != found[0] {
+    t.Errorf("Expected %q, got %q", expected, found)
+  }
+}
+
+func TestCheckGame(t *testing.T) {
+  if err := CheckGame(analysisGame()); nil != err {
+    t.Error(err)
+  }
+}
+
+func TestCheckGame_SelfDependency(t *testing.T) {
+  g := analysisGame()
+  g.SetupRules[1].Dependencies = []*game.SetupRule{g.SetupRules[1]}
+  expectProblem(t, g, `"Shuffle" depends on itself`)
+}
+
+func TestCheckGame_OtherGame(t *testing.T) {
+  g := analysisGame()
+  other := analysisGame()
+  g.SetupRules[4].Dependencies = append(g.SetupRules[4].Dependencies, other.SetupRules[1])
+  expectProblem(t, g, `"Start" depends on "Shuffle", which isn't one of the game's rules`)
+}
+
+func TestCheckGame_Duplicate(t *testing.T) {
+  g := analysisGame()
+  g.SetupRules[3].Description = "Place pawn"
+  expectProblem(t, g, `Rules 3 and 4 of the game are both described "Place pawn"`)
+}
+
+func TestCheckGame_Cycle(t *testing.T) {
+  g := analysisGame()
+  g.SetupRules[0].Dependencies = []*game.SetupRule{g.SetupRules[4]}
+  expectProblem(t, g, `Dependencies form a cycle: "Lay out the board" depends on "Start" depends on "Place pawn" depends on "Lay out the board"`)
+}
+
+func TestCheckGame_Every(t *testing.T) {
+  g := analysisGame()
+  g.SetupRules[1].Dependencies = []*game.SetupRule{g.SetupRules[1], nil}
+  g.SetupRules[3].Description = "Place pawn"
+  found := problems(t, g)
+  if 3 != len(found) {
+    t.Errorf("Expected a duplicate, a self-dependency and a missing rule, got %q", found)
+  }
+  if err := CheckGame(g); !strings.HasPrefix(err.Error(), "Test has invalid rules: ") {
+    t.Errorf("Expected the error to name the game, got %q", err)
+  }
+}
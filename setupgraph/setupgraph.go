@@ -0,0 +1,93 @@
+/*
+
+Work with the graph that setup rules form through their dependencies: each rule must wait for the
+rules it depends on to be done.
+
+*/
+
+package setupgraph
+
+import (
+  "errors"
+  "fmt"
+  "strings"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+// Unfinished steps of the rules that a step depends on, which must be done before it can be
+func Blockers(steps []*game.SetupStep, step *game.SetupStep) []*game.SetupStep {
+  blockers := make([]*game.SetupStep, 0)
+  for _, dep := range step.Rule.Dependencies {
+    for _, other := range steps {
+      if other.Rule == dep && !other.Done {
+        blockers = append(blockers, other)
+      }
+    }
+  }
+  return blockers
+}
+
+// Order rules so that each comes after those it depends on, keeping their order otherwise.
+// Dependencies on rules not in the list are ignored.
+func SortRules(rules []*game.SetupRule) ([]*game.SetupRule, error) {
+  placed := make(map[*game.SetupRule]bool)
+  inList := make(map[*game.SetupRule]bool)
+  for _, rule := range rules {
+    inList[rule] = true
+  }
+
+  sorted := make([]*game.SetupRule, 0, len(rules))
+  for len(sorted) < len(rules) {
+    progress := false
+    for _, rule := range rules {
+      if placed[rule] {
+        continue
+      }
+      ready := true
+      for _, dep := range rule.Dependencies {
+        if inList[dep] && !placed[dep] {
+          ready = false
+          break
+        }
+      }
+      if ready {
+        sorted = append(sorted, rule)
+        placed[rule] = true
+        progress = true
+        break  // Start over, so that earlier rules stay first
+      }
+    }
+    if !progress {
+      unplaced := make([]string, 0)
+      for _, rule := range rules {
+        if !placed[rule] {
+          unplaced = append(unplaced, fmt.Sprintf("%q", rule.Description))
+        }
+      }
+      return sorted, errors.New(fmt.Sprintf("Dependencies form a cycle among rules %s", strings.Join(unplaced, ", ")))
+    }
+  }
+  return sorted, nil
+}
+
+// Order steps so that each comes after the steps of the rules it depends on, keeping their order otherwise
+func SortSteps(steps []*game.SetupStep) ([]*game.SetupStep, error) {
+  rules := make([]*game.SetupRule, 0)
+  byRule := make(map[*game.SetupRule][]*game.SetupStep)
+  for _, step := range steps {
+    if _, ok := byRule[step.Rule]; !ok {
+      rules = append(rules, step.Rule)
+    }
+    byRule[step.Rule] = append(byRule[step.Rule], step)
+  }
+
+  sortedRules, err := SortRules(rules)
+  if nil != err {
+    return nil, err
+  }
+  sorted := make([]*game.SetupStep, 0, len(steps))
+  for _, rule := range sortedRules {
+    sorted = append(sorted, byRule[rule]...)
+  }
+  return sorted, nil
+}
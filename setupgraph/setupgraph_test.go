@@ -0,0 +1,70 @@
+package setupgraph
+
+import (
+  "testing"
+  "github.com/rkbodenner/parallel_universe/game"
+)
+
+func TestSortRules(t *testing.T) {
+  board := &game.SetupRule{Description: "Lay out the board"}
+  shuffle := &game.SetupRule{Description: "Shuffle"}
+  deal := &game.SetupRule{Description: "Deal cards", Dependencies: []*game.SetupRule{shuffle}}
+  pawns := &game.SetupRule{Description: "Place pawns", Dependencies: []*game.SetupRule{board}}
+
+  sorted, err := SortRules([]*game.SetupRule{pawns, deal, board, shuffle})
+  if nil != err {
+    t.Fatal(err)
+  }
+  expected := []*game.SetupRule{board, pawns, shuffle, deal}
+  for i, rule := range expected {
+    if sorted[i] != rule {
+      t.Fatalf("Expected %s at %d, got %s", rule.Description, i, sorted[i].Description)
+    }
+  }
+}
+
+func TestSortRules_Cycle(t *testing.T) {
+  a := &game.SetupRule{Description: "A"}
+  b := &game.SetupRule{Description: "B", Dependencies: []*game.SetupRule{a}}
+  a.Dependencies = []*game.SetupRule{b}
+
+  _, err := SortRules([]*game.SetupRule{a, b})
+  if nil == err {
+    t.Fatal("Expected error for cycle")
+  }
+}
+
+func TestSortSteps(t *testing.T) {
+  board := &game.SetupRule{Description: "Lay out the board"}
+  pawn := &game.SetupRule{Description: "Place pawn", Dependencies: []*game.SetupRule{board}}
+  alice := &game.Player{Id: 1, Name: "Alice"}
+  bob := &game.Player{Id: 2, Name: "Bob"}
+
+  alicePawn := &game.SetupStep{Rule: pawn, Owner: alice}
+  bobPawn := &game.SetupStep{Rule: pawn, Owner: bob}
+  boardStep := &game.SetupStep{Rule: board}
+
+  sorted, err := SortSteps([]*game.SetupStep{alicePawn, boardStep, bobPawn})
+  if nil != err {
+    t.Fatal(err)
+  }
+  if sorted[0] != boardStep || sorted[1] != alicePawn || sorted[2] != bobPawn {
+    t.Fatal("Expected board step first, then the pawns in their original order")
+  }
+}
+
+func TestBlockers(t *testing.T) {
+  board := &game.SetupRule{Description: "Lay out the board"}
+  pawn := &game.SetupRule{Description: "Place pawn", Dependencies: []*game.SetupRule{board}}
+  boardStep := &game.SetupStep{Rule: board}
+  pawnStep := &game.SetupStep{Rule: pawn}
+  steps := []*game.SetupStep{boardStep, pawnStep}
+
+  if blockers := Blockers(steps, pawnStep); len(blockers) != 1 || blockers[0] != boardStep {
+    t.Fatal("Expected pawn to be blocked by the board")
+  }
+  boardStep.Done = true
+  if blockers := Blockers(steps, pawnStep); len(blockers) != 0 {
+    t.Fatal("Expected pawn to be unblocked once the board is done")
+  }
+}